@@ -1,31 +1,78 @@
 package main
 
 import (
+	"context"
+	"hirevo/internal/accounting"
+	"hirevo/internal/archive"
+	"hirevo/internal/audit"
 	"hirevo/internal/company"
+	"hirevo/internal/config"
+	"hirevo/internal/currency"
 	"hirevo/internal/handlers"
 	"hirevo/internal/invoice"
+	"hirevo/internal/jobs"
+	"hirevo/internal/matching"
+	"hirevo/internal/notifications"
+	"hirevo/internal/payroll"
 	"hirevo/internal/reports"
+	"hirevo/internal/roster"
+	"hirevo/internal/webhooks"
+	"hirevo/internal/workers"
+	_ "hirevo/migrations"
+	"os"
 
 	"github.com/pocketbase/pocketbase"
 )
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		handlers.LogError(context.Background(), err, "Invalid configuration")
+		os.Exit(1)
+	}
+
 	app := pocketbase.New()
-	initializeHandlers(app)
-	initializeHooks(app)
+	if err := initializeHandlers(app, cfg); err != nil {
+		handlers.LogError(context.Background(), err, "Failed to initialize handlers")
+		os.Exit(1)
+	}
+	initializeHooks(app, cfg)
+	initializeCommands(app)
 
 	if err := app.Start(); err != nil {
-		handlers.LogError(err, "Failed to start app")
+		handlers.LogError(context.Background(), err, "Failed to start app")
 	}
 }
 
-func initializeHandlers(app *pocketbase.PocketBase) {
-	handlers.InitLogger(app)
+func initializeHandlers(app *pocketbase.PocketBase, cfg *config.Config) error {
+	if err := handlers.InitLogger(app, cfg.Log); err != nil {
+		return err
+	}
 	handlers.InitErrorHandler(app)
+	handlers.InitRequestID(app)
+	return nil
 }
 
-func initializeHooks(app *pocketbase.PocketBase) {
+func initializeHooks(app *pocketbase.PocketBase, cfg *config.Config) {
+	archive.RegisterHooks(app)
+	audit.RegisterHooks(app)
 	company.RegisterHooks(app)
-	invoice.RegisterHooks(app)
+	jobs.RegisterHooks(app, cfg.Jobs)
+	workers.RegisterHooks(app, cfg.Workers)
+	matching.RegisterHooks(app)
+	roster.RegisterHooks(app)
+	payroll.RegisterHooks(app)
+	notifications.RegisterHooks(app, cfg.Notifications)
+	webhooks.RegisterHooks(app, cfg.Webhooks)
+	currency.RegisterHooks(app)
+	invoice.RegisterHooks(app, cfg.Invoices)
+	accounting.RegisterHooks(app)
 	reports.RegisterHooks(app)
 }
+
+func initializeCommands(app *pocketbase.PocketBase) {
+	archive.RegisterCommands(app)
+	audit.RegisterCommands(app)
+	currency.RegisterCommands(app)
+	accounting.RegisterCommands(app)
+}
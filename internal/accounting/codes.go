@@ -0,0 +1,94 @@
+package accounting
+
+import (
+	"hirevo/internal/handlers"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Accounting software the documents are exported to
+const (
+	FormatXero = "XERO"
+	FormatMYOB = "MYOB"
+)
+
+// Kinds of exported documents
+const (
+	KindInvoice    = "INVOICE"
+	KindPayment    = "PAYMENT"
+	KindCreditNote = "CREDIT_NOTE"
+)
+
+// maxCodeLength of an account or tax code
+const maxCodeLength = 50
+
+// Codes accounts and tax code the exported documents are posted to
+type Codes struct {
+	// SalesAccount income account of the invoices and credit notes
+	SalesAccount string `json:"salesAccount"`
+	// BankAccount deposit account of the payments, the Xero bank statement is imported into the bank account itself
+	BankAccount string `json:"bankAccount"`
+	TaxCode     string `json:"taxCode"`
+}
+
+// defaultCodes codes of the standard Australian chart of accounts of each software
+var defaultCodes = map[string]Codes{
+	FormatXero: {SalesAccount: "200", TaxCode: "GST on Income"},
+	FormatMYOB: {SalesAccount: "4-1000", BankAccount: "1-1110", TaxCode: "GST"},
+}
+
+// CompanyCodes codes of the company for the format, the company "accountingCodes" override the defaults one by one
+func CompanyCodes(company *core.Record, format string) Codes {
+	codes := defaultCodes[format]
+	overrides := map[string]Codes{}
+	if err := company.UnmarshalJSONField("accountingCodes", &overrides); err != nil {
+		return codes
+	}
+	override := overrides[format]
+	if override.SalesAccount != "" {
+		codes.SalesAccount = override.SalesAccount
+	}
+	if override.BankAccount != "" {
+		codes.BankAccount = override.BankAccount
+	}
+	if override.TaxCode != "" {
+		codes.TaxCode = override.TaxCode
+	}
+	return codes
+}
+
+// onCompanyCodesChange validate the accounting codes of a company, keyed by format
+func onCompanyCodesChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		invalid := func(message string) error {
+			return handlers.Fail(ctx, handlers.ErrAccountingCodesInvalid.WithField("accountingCodes", validation.NewError(
+				"invalid_accounting_codes",
+				message,
+			)))
+		}
+		raw := e.Record.GetString("accountingCodes")
+		if raw == "" || raw == "null" {
+			return e.Next()
+		}
+		codes := map[string]Codes{}
+		if err := e.Record.UnmarshalJSONField("accountingCodes", &codes); err != nil {
+			return invalid("Accounting codes must be an object of codes by format")
+		}
+		for format, formatCodes := range codes {
+			if _, ok := defaultCodes[format]; !ok {
+				return invalid("Accounting codes are only supported for XERO and MYOB")
+			}
+			for _, code := range []string{formatCodes.SalesAccount, formatCodes.BankAccount, formatCodes.TaxCode} {
+				if len(code) > maxCodeLength {
+					return invalid("Accounting codes are limited to 50 characters")
+				}
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("companies").BindFunc(validate)
+	app.OnRecordUpdate("companies").BindFunc(validate)
+}
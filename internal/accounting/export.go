@@ -0,0 +1,240 @@
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/archive"
+	"hirevo/internal/currency"
+	"hirevo/internal/invoice"
+	"hirevo/internal/jobs"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// document line of an export, an invoice, the payment of an invoice or a credit note
+type document struct {
+	kind string
+	// recordID invoice or credit note exported, the invoice paid for the payments
+	recordID    string
+	number      string
+	reference   string
+	contact     string
+	email       string
+	date        time.Time
+	dueDate     time.Time
+	description string
+	amount      currency.Money
+	// exchangeRate base currency units for one unit of the document currency
+	exchangeRate float64
+	termsDays    int
+}
+
+// Export create the export batch of the invoices, payments and credit notes of the company not yet exported
+// to the software, nil when there is nothing new. The documents of a batch are recorded in the same transaction
+// with a unique index per software, so a document is never exported twice even by concurrent exports.
+func Export(ctx context.Context, app core.App, company *core.Record, format string, exportedBy string) (*core.Record, error) {
+	if _, ok := defaultCodes[format]; !ok {
+		return nil, fmt.Errorf("unsupported accounting format %q", format)
+	}
+	loc, err := time.LoadLocation(jobs.DefaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+	contacts := map[string]*core.Record{}
+	contact := func(userID string) (string, string) {
+		user, ok := contacts[userID]
+		if !ok {
+			user, _ = app.FindRecordById("users", userID)
+			contacts[userID] = user
+		}
+		if user == nil {
+			return userID, ""
+		}
+		return user.GetString("name"), user.Email()
+	}
+
+	invoices, err := pending(app, "invoices", KindInvoice, format, company.Id, dbx.NewExp(archive.ActiveFilter))
+	if err != nil {
+		return nil, err
+	}
+	sales := make([]document, 0, len(invoices))
+	for _, record := range invoices {
+		name, email := contact(record.GetString("userID"))
+		description := invoice.Content(record)["Description"]
+		if description == "" {
+			description = "Invoice " + invoice.Number(record)
+		}
+		sales = append(sales, document{
+			kind:         KindInvoice,
+			recordID:     record.Id,
+			number:       invoice.Number(record),
+			contact:      name,
+			email:        email,
+			date:         record.GetDateTime("created").Time().In(loc),
+			dueDate:      record.GetDateTime("dueDate").Time().In(loc),
+			description:  description,
+			amount:       documentTotal(record),
+			exchangeRate: record.GetFloat("exchangeRate"),
+			termsDays:    record.GetInt("paymentTermsDays"),
+		})
+	}
+
+	creditNotes, err := pending(app, "credit_notes", KindCreditNote, format, company.Id, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range creditNotes {
+		credited, err := app.FindRecordById("invoices", record.GetString("invoiceID"))
+		if err != nil {
+			return nil, err
+		}
+		name, email := contact(credited.GetString("userID"))
+		description := "Credit note on " + invoice.Number(credited)
+		if reason := record.GetString("reason"); reason != "" {
+			description += ": " + reason
+		}
+		date := record.GetDateTime("created").Time().In(loc)
+		sales = append(sales, document{
+			kind:         KindCreditNote,
+			recordID:     record.Id,
+			number:       invoice.CreditNoteNumber(record),
+			reference:    invoice.Number(credited),
+			contact:      name,
+			email:        email,
+			date:         date,
+			dueDate:      date,
+			description:  description,
+			amount:       currency.New(-int64(record.GetInt("amountMinor")), currency.Normalize(record.GetString("currency"))),
+			exchangeRate: credited.GetFloat("exchangeRate"),
+		})
+	}
+
+	paid, err := pending(app, "invoices", KindPayment, format, company.Id, dbx.And(
+		dbx.NewExp(archive.ActiveFilter),
+		dbx.HashExp{"status": invoice.StatusPaid},
+		dbx.NewExp("paidAt != ''"),
+	))
+	if err != nil {
+		return nil, err
+	}
+	payments := make([]document, 0, len(paid))
+	for _, record := range paid {
+		name, email := contact(record.GetString("userID"))
+		credited, err := invoice.CreditedTotal(app, record)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, document{
+			kind:         KindPayment,
+			recordID:     record.Id,
+			number:       "PAY-" + strings.ToUpper(record.Id),
+			reference:    invoice.Number(record),
+			contact:      name,
+			email:        email,
+			date:         record.GetDateTime("paidAt").Time().In(loc),
+			description:  "Payment of " + invoice.Number(record),
+			amount:       documentTotal(record).Sub(credited),
+			exchangeRate: record.GetFloat("exchangeRate"),
+		})
+	}
+
+	if len(sales) == 0 && len(payments) == 0 {
+		return nil, nil
+	}
+	return saveExport(ctx, app, company, format, exportedBy, sales, payments)
+}
+
+// documentTotal total of an invoice in its currency
+func documentTotal(record *core.Record) currency.Money {
+	return currency.New(int64(record.GetInt("totalMinor")), currency.Normalize(record.GetString("currency")))
+}
+
+// pending records of the company never exported to the software as the kind of document
+func pending(app core.App, collection string, kind string, format string, companyID string, where dbx.Expression) ([]*core.Record, error) {
+	records := []*core.Record{}
+	err := app.RecordQuery(collection).
+		AndWhere(dbx.HashExp{"companyID": companyID}).
+		AndWhere(where).
+		AndWhere(dbx.NewExp(
+			"id NOT IN (SELECT documentID FROM accounting_export_items WHERE format = {:format} AND kind = {:kind})",
+			dbx.Params{"format": format, "kind": kind},
+		)).
+		OrderBy("created ASC").
+		All(&records)
+	return records, err
+}
+
+// saveExport save the batch with its files and the documents it exported
+func saveExport(ctx context.Context, app core.App, company *core.Record, format string, exportedBy string, sales []document, payments []document) (*core.Record, error) {
+	codes := CompanyCodes(company, format)
+	stamp := time.Now().Format("20060102-150405")
+	files := []*filesystem.File{}
+	if len(sales) > 0 {
+		data, err := salesFile(format, sales, codes)
+		if err != nil {
+			return nil, err
+		}
+		file, err := filesystem.NewFileFromBytes(data, fmt.Sprintf("%s-sales-%s.csv", format, stamp))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if len(payments) > 0 {
+		data, err := paymentsFile(format, payments, codes)
+		if err != nil {
+			return nil, err
+		}
+		file, err := filesystem.NewFileFromBytes(data, fmt.Sprintf("%s-payments-%s.csv", format, stamp))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	exports, err := app.FindCollectionByNameOrId("accounting_exports")
+	if err != nil {
+		return nil, err
+	}
+	items, err := app.FindCollectionByNameOrId("accounting_export_items")
+	if err != nil {
+		return nil, err
+	}
+	batch := core.NewRecord(exports)
+	batch.Set("companyID", company.Id)
+	batch.Set("exportedBy", exportedBy)
+	batch.Set("format", format)
+	batch.Set("payments", len(payments))
+	batch.Set("files", files)
+	counts := map[string]int{}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for _, doc := range sales {
+			counts[doc.kind]++
+		}
+		batch.Set("invoices", counts[KindInvoice])
+		batch.Set("creditNotes", counts[KindCreditNote])
+		if err := txApp.SaveWithContext(ctx, batch); err != nil {
+			return err
+		}
+		for _, doc := range append(sales, payments...) {
+			item := core.NewRecord(items)
+			item.Set("exportID", batch.Id)
+			item.Set("companyID", company.Id)
+			item.Set("format", format)
+			item.Set("kind", doc.kind)
+			item.Set("documentID", doc.recordID)
+			if err := txApp.SaveWithContext(ctx, item); err != nil {
+				return fmt.Errorf("%s %s already exported: %w", doc.kind, doc.recordID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
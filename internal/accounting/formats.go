@@ -0,0 +1,100 @@
+package accounting
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+)
+
+// dateLayout dates of the Australian editions of Xero and MYOB
+const dateLayout = "02/01/2006"
+
+// xeroSalesColumns columns of the Xero sales invoice import template, credit notes are the lines with a negative amount
+var xeroSalesColumns = []string{
+	"*ContactName", "EmailAddress", "POAddressLine1", "POAddressLine2", "POAddressLine3", "POAddressLine4",
+	"POCity", "PORegion", "POPostalCode", "POCountry", "*InvoiceNumber", "Reference", "*InvoiceDate", "*DueDate",
+	"InventoryItemCode", "*Description", "*Quantity", "*UnitAmount", "Discount", "*AccountCode", "*TaxType",
+	"TrackingName1", "TrackingOption1", "TrackingName2", "TrackingOption2", "Currency", "BrandingTheme",
+}
+
+// xeroPaymentColumns columns of the Xero bank statement import, the payments are reconciled against the invoices
+var xeroPaymentColumns = []string{"*Date", "*Amount", "Payee", "Description", "Reference"}
+
+// myobSalesColumns columns of the MYOB AccountRight service sales import, credit notes are the sales with a negative amount
+var myobSalesColumns = []string{
+	"Co./Last Name", "First Name", "Inclusive", "Invoice #", "Date", "Customer PO", "Description",
+	"Account #", "Amount", "Inc-Tax Amount", "Journal Memo", "Tax Code", "Currency Code", "Exchange Rate",
+	"Balance Due Days", "Sale Status",
+}
+
+// myobPaymentColumns columns of the MYOB AccountRight customer payments import
+var myobPaymentColumns = []string{
+	"Co./Last Name", "First Name", "Deposit Account #", "ID #", "Receipt Date", "Invoice #",
+	"Amount Applied", "Memo", "Currency Code", "Exchange Rate",
+}
+
+// salesFile invoices and credit notes in the import format of the software
+func salesFile(format string, documents []document, codes Codes) ([]byte, error) {
+	if format == FormatMYOB {
+		rows := make([][]string, 0, len(documents))
+		for _, doc := range documents {
+			rows = append(rows, []string{
+				doc.contact, "", "X", doc.number, doc.date.Format(dateLayout), doc.reference, doc.description,
+				codes.SalesAccount, doc.amount.Decimal(), doc.amount.Decimal(), doc.description, codes.TaxCode,
+				doc.amount.Currency, strconv.FormatFloat(doc.exchangeRate, 'f', -1, 64),
+				strconv.Itoa(doc.termsDays), "I",
+			})
+		}
+		return writeCSV(myobSalesColumns, rows)
+	}
+
+	rows := make([][]string, 0, len(documents))
+	for _, doc := range documents {
+		row := make([]string, len(xeroSalesColumns))
+		row[0] = doc.contact
+		row[1] = doc.email
+		row[10] = doc.number
+		row[11] = doc.reference
+		row[12] = doc.date.Format(dateLayout)
+		row[13] = doc.dueDate.Format(dateLayout)
+		row[15] = doc.description
+		row[16] = "1"
+		row[17] = doc.amount.Decimal()
+		row[19] = codes.SalesAccount
+		row[20] = codes.TaxCode
+		row[25] = doc.amount.Currency
+		rows = append(rows, row)
+	}
+	return writeCSV(xeroSalesColumns, rows)
+}
+
+// paymentsFile payments of the invoices in the import format of the software
+func paymentsFile(format string, payments []document, codes Codes) ([]byte, error) {
+	rows := make([][]string, 0, len(payments))
+	for _, doc := range payments {
+		if format == FormatMYOB {
+			rows = append(rows, []string{
+				doc.contact, "", codes.BankAccount, doc.number, doc.date.Format(dateLayout), doc.reference,
+				doc.amount.Decimal(), doc.description, doc.amount.Currency, strconv.FormatFloat(doc.exchangeRate, 'f', -1, 64),
+			})
+			continue
+		}
+		rows = append(rows, []string{doc.date.Format(dateLayout), doc.amount.Decimal(), doc.contact, doc.description, doc.reference})
+	}
+	if format == FormatMYOB {
+		return writeCSV(myobPaymentColumns, rows)
+	}
+	return writeCSV(xeroPaymentColumns, rows)
+}
+
+func writeCSV(header []string, rows [][]string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	writer := csv.NewWriter(buffer)
+	if err := writer.Write(header); err != nil {
+		return nil, err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
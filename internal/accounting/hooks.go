@@ -0,0 +1,138 @@
+package accounting
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// ExportRequest body of the accounting export
+type ExportRequest struct {
+	// Format XERO or MYOB
+	Format string `json:"format"`
+}
+
+// RegisterHooks validate the accounting codes and expose the exports to the company owners and admins
+func RegisterHooks(app *pocketbase.PocketBase) {
+	onCompanyCodesChange(app)
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/companies/{id}/accounting-exports", exportRequest).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// RegisterCommands add the "accounting-export" command to the app
+func RegisterCommands(app *pocketbase.PocketBase) {
+	var format string
+	var out string
+	command := &cobra.Command{
+		Use:   "accounting-export [companyID]",
+		Short: "Export the invoices, payments and credit notes not yet exported to Xero or MYOB CSV files",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			format = strings.ToUpper(format)
+			companyRecord, err := app.FindRecordById("companies", args[0])
+			if err != nil {
+				return err
+			}
+			batch, err := Export(ctx, app, companyRecord, format, "")
+			if err != nil {
+				handlers.LogError(ctx, err, "Failed to export accounting documents", "companyID", args[0], "format", format)
+				return err
+			}
+			if batch == nil {
+				handlers.LogInfo(ctx, "Nothing to export", "companyID", args[0], "format", format)
+				return nil
+			}
+			return writeFiles(app, batch, out)
+		},
+	}
+	command.Flags().StringVar(&format, "format", FormatXero, "accounting software, XERO or MYOB")
+	command.Flags().StringVar(&out, "out", ".", "directory the CSV files are written to")
+	app.RootCmd.AddCommand(command)
+}
+
+// exportRequest POST /api/companies/{id}/accounting-exports, 204 when everything was already exported
+func exportRequest(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	companyID := e.Request.PathValue("id")
+	companyRecord, err := e.App.FindRecordById("companies", companyID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "companies", "id", companyID))
+	}
+	exportedBy := ""
+	if !e.HasSuperuserAuth() {
+		if !company.HasRole(e.App, companyID, e.Auth.Id, company.RoleOwner, company.RoleAdmin) {
+			handlers.LogWarn(ctx, "User not allowed to export accounting documents", "companyID", companyID, "userId", e.Auth.Id)
+			return handlers.Fail(ctx, handlers.ErrAccountingForbidden.WithParams("companyID", companyID))
+		}
+		exportedBy = e.Auth.Id
+	}
+
+	body := ExportRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
+	}
+	format := strings.ToUpper(body.Format)
+	if _, ok := defaultCodes[format]; !ok {
+		return handlers.Fail(ctx, handlers.ErrAccountingExportInvalid.WithField("format", validation.NewError(
+			"invalid_format",
+			"Format must be XERO or MYOB",
+		)))
+	}
+
+	batch, err := Export(ctx, e.App, companyRecord, format, exportedBy)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to export accounting documents", "companyID", companyID, "format", format)
+		return handlers.Fail(ctx, handlers.ErrAccountingExportFailed.Wrap(err), "companyID", companyID)
+	}
+	if batch == nil {
+		return e.NoContent(http.StatusNoContent)
+	}
+	handlers.LogInfo(ctx, "Accounting documents exported", "exportID", batch.Id, "companyID", companyID, "format", format,
+		"invoices", batch.GetInt("invoices"), "payments", batch.GetInt("payments"), "creditNotes", batch.GetInt("creditNotes"))
+	return e.JSON(http.StatusOK, batch)
+}
+
+// writeFiles copy the files of an export batch to a directory
+func writeFiles(app core.App, batch *core.Record, dir string) error {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+	for _, name := range batch.GetStringSlice("files") {
+		file, err := fsys.GetFile(batch.BaseFilesPath() + "/" + name)
+		if err != nil {
+			return err
+		}
+		target, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			file.Close()
+			return err
+		}
+		_, err = io.Copy(target, file)
+		file.Close()
+		if closeErr := target.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("write %s: %w", name, err)
+		}
+		handlers.LogInfo(context.Background(), "Accounting export file written", "exportID", batch.Id, "file", filepath.Join(dir, name))
+	}
+	return nil
+}
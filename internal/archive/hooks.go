@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"hirevo/internal/handlers"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Collections supporting soft delete through the "deletedAt" field
+var Collections = []string{"companies", "jobs", "invoices"}
+
+// ActiveFilter matches records that are not archived, used on reports and queries
+const ActiveFilter = "deletedAt = ''"
+
+// activeRuleFilter filter the migrations prepend to the rules of a collection, jobs and invoices
+// are also hidden while their company is archived
+func activeRuleFilter(collection string) string {
+	if collection == "companies" {
+		return ActiveFilter
+	}
+	return ActiveFilter + " && companyID." + ActiveFilter
+}
+
+// restoreRule update rule of a collection without its active filter, an archived record
+// can be restored by the users allowed to update it when active
+func restoreRule(collection string, rule *string) *string {
+	if rule == nil {
+		return nil
+	}
+	filter := activeRuleFilter(collection)
+	if *rule == filter {
+		empty := ""
+		return &empty
+	}
+	prefix := filter + " && ("
+	if strings.HasPrefix(*rule, prefix) && strings.HasSuffix(*rule, ")") {
+		original := strings.TrimSuffix(strings.TrimPrefix(*rule, prefix), ")")
+		return &original
+	}
+	return rule
+}
+
+// RegisterHooks replace hard deletes with soft deletes and expose the restore route
+func RegisterHooks(app *pocketbase.PocketBase) {
+	onDeleteRequest(app)
+	onRestoreRequest(app)
+}
+
+// IsArchived check if a record was soft deleted
+func IsArchived(record *core.Record) bool {
+	return !record.GetDateTime("deletedAt").IsZero()
+}
+
+func onDeleteRequest(app *pocketbase.PocketBase) {
+	app.OnRecordDeleteRequest(Collections...).BindFunc(func(e *core.RecordRequestEvent) error {
+		ctx := e.Request.Context()
+		collection := e.Record.Collection().Name
+		if IsArchived(e.Record) {
+			handlers.LogWarn(ctx, "Record already archived", "collection", collection, "id", e.Record.Id)
+			return handlers.Fail(ctx, handlers.ErrRecordNotFound.WithParams("collection", collection, "id", e.Record.Id))
+		}
+
+		e.Record.Set("deletedAt", types.NowDateTime())
+		if err := e.App.SaveWithContext(ctx, e.Record); err != nil {
+			handlers.LogError(ctx, err, "Failed to archive record", "collection", collection, "id", e.Record.Id)
+			return handlers.Fail(ctx, handlers.ErrArchiveFailed.Wrap(err), "collection", collection, "id", e.Record.Id)
+		}
+
+		handlers.LogInfo(ctx, "Record archived", "collection", collection, "id", e.Record.Id)
+		return e.NoContent(http.StatusNoContent)
+	})
+}
+
+func onRestoreRequest(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/collections/{collection}/records/{id}/restore", restoreRecord).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+func restoreRecord(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	collection := e.Request.PathValue("collection")
+	id := e.Request.PathValue("id")
+	if !slices.Contains(Collections, collection) {
+		handlers.LogWarn(ctx, "Restore requested for collection without soft delete", "collection", collection)
+		return handlers.Fail(ctx, handlers.ErrRestoreNotSupported.WithParams("collection", collection))
+	}
+
+	record, err := e.App.FindRecordById(collection, id)
+	if err != nil {
+		handlers.LogWarn(ctx, "Record to restore not found", "collection", collection, "id", id)
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", collection, "id", id))
+	}
+	if !IsArchived(record) {
+		handlers.LogWarn(ctx, "Record to restore is not archived", "collection", collection, "id", id)
+		return handlers.Fail(ctx, handlers.ErrRestoreNotArchived.WithParams("collection", collection, "id", id))
+	}
+
+	// Restoring follows the same access as updating the record once active
+	info, err := e.RequestInfo()
+	if err != nil {
+		handlers.LogError(ctx, err, "Error while getting RequestInfo")
+		return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
+	}
+	canRestore, err := e.App.CanAccessRecord(record, info, restoreRule(collection, record.Collection().UpdateRule))
+	if err != nil || !canRestore {
+		handlers.LogWarn(ctx, "User not allowed to restore record", "collection", collection, "id", id, "userId", info.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrRestoreForbidden.WithParams("collection", collection, "id", id))
+	}
+
+	// Children cannot be restored while their company is archived
+	if companyID := record.GetString("companyID"); collection != "companies" && companyID != "" {
+		company, err := e.App.FindRecordById("companies", companyID)
+		if err == nil && IsArchived(company) {
+			handlers.LogWarn(ctx, "Restore blocked by archived company", "collection", collection, "id", id, "companyID", companyID)
+			return handlers.Fail(ctx, handlers.ErrRestoreCompanyArchived.WithParams("companyID", companyID))
+		}
+	}
+
+	record.Set("deletedAt", "")
+	if err := e.App.SaveWithContext(ctx, record); err != nil {
+		handlers.LogError(ctx, err, "Failed to restore record", "collection", collection, "id", id)
+		return handlers.Fail(ctx, handlers.ErrRestoreFailed.Wrap(err), "collection", collection, "id", id)
+	}
+
+	handlers.LogInfo(ctx, "Record restored", "collection", collection, "id", id)
+	return e.JSON(http.StatusOK, record)
+}
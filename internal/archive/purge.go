@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/handlers"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// DefaultRetentionDays archived records are kept before purge
+const DefaultRetentionDays = 90
+
+// InvoiceRetentionYears invoices must be kept by law, even when archived
+const InvoiceRetentionYears = 5
+
+// RegisterCommands add the "purge" command to the app
+func RegisterCommands(app *pocketbase.PocketBase) {
+	var days int
+	command := &cobra.Command{
+		Use:   "purge",
+		Short: "Hard delete archived companies, jobs and invoices past the retention period",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if days < 0 {
+				return fmt.Errorf("invalid retention days %d", days)
+			}
+			return Purge(context.Background(), app, time.Duration(days)*24*time.Hour)
+		},
+	}
+	command.Flags().IntVar(&days, "days", DefaultRetentionDays, "days an archived record is kept before being purged")
+	app.RootCmd.AddCommand(command)
+}
+
+// Purge hard delete archived records older than retention, keeping invoices for the legal period
+func Purge(ctx context.Context, app core.App, retention time.Duration) error {
+	now := time.Now()
+	archivedBefore, err := types.ParseDateTime(now.Add(-retention))
+	if err != nil {
+		return err
+	}
+	invoiceCreatedBefore, err := types.ParseDateTime(now.AddDate(-InvoiceRetentionYears, 0, 0))
+	if err != nil {
+		return err
+	}
+
+	invoices, err := findPurgeable(app, "invoices", archivedBefore, "created < {:invoiceCreatedBefore}", dbx.Params{
+		"invoiceCreatedBefore": invoiceCreatedBefore.String(),
+	})
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to fetch purgeable invoices")
+		return err
+	}
+	for _, invoice := range invoices {
+		if err := app.Delete(invoice); err != nil {
+			handlers.LogError(ctx, err, "Failed to purge invoice", "invoiceID", invoice.Id)
+			return err
+		}
+	}
+
+	jobs, err := findPurgeable(app, "jobs", archivedBefore, "", nil)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to fetch purgeable jobs")
+		return err
+	}
+	for _, job := range jobs {
+		if err := app.RunInTransaction(func(txApp core.App) error {
+			return purgeJob(ctx, txApp, job)
+		}); err != nil {
+			handlers.LogError(ctx, err, "Failed to purge job", "jobID", job.Id)
+			return err
+		}
+	}
+
+	companies, err := findPurgeable(app, "companies", archivedBefore, "", nil)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to fetch purgeable companies")
+		return err
+	}
+	purgedCompanies := 0
+	for _, company := range companies {
+		// Companies still owning invoices are kept until the invoices can be purged
+		remaining, err := app.CountRecords("invoices", dbx.HashExp{"companyID": company.Id})
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			handlers.LogInfo(ctx, "Company kept while invoices are retained", "companyID", company.Id, "invoices", remaining)
+			continue
+		}
+
+		if err := app.RunInTransaction(func(txApp core.App) error {
+			return purgeCompany(ctx, txApp, company)
+		}); err != nil {
+			handlers.LogError(ctx, err, "Failed to purge company", "companyID", company.Id)
+			return err
+		}
+		purgedCompanies++
+	}
+
+	handlers.LogInfo(ctx, "Purge finished", "retention", retention.String(), "invoices", len(invoices), "jobs", len(jobs), "companies", purgedCompanies)
+	return nil
+}
+
+func findPurgeable(app core.App, collection string, archivedBefore types.DateTime, extraFilter string, params dbx.Params) ([]*core.Record, error) {
+	filter := "deletedAt != '' && deletedAt < {:archivedBefore}"
+	if extraFilter != "" {
+		filter += " && " + extraFilter
+	}
+	if params == nil {
+		params = dbx.Params{}
+	}
+	params["archivedBefore"] = archivedBefore.String()
+	return app.FindRecordsByFilter(collection, filter, "deletedAt", 0, 0, params)
+}
+
+// purgeJob delete a job with its members and rates
+func purgeJob(ctx context.Context, app core.App, job *core.Record) error {
+	members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": job.Id})
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if err := app.Delete(member); err != nil {
+			return err
+		}
+	}
+
+	rateIDs := job.GetStringSlice("rates")
+	if err := app.Delete(job); err != nil {
+		return err
+	}
+	if len(rateIDs) > 0 {
+		rates, err := app.FindRecordsByIds("job_rates", rateIDs)
+		if err != nil {
+			return err
+		}
+		for _, rate := range rates {
+			if err := app.Delete(rate); err != nil {
+				return err
+			}
+		}
+	}
+
+	handlers.LogInfo(ctx, "Job purged", "jobID", job.Id, "members", len(members), "rates", len(rateIDs))
+	return nil
+}
+
+// purgeCompany delete a company with its jobs, members and reports
+func purgeCompany(ctx context.Context, app core.App, company *core.Record) error {
+	jobs, err := app.FindAllRecords("jobs", dbx.HashExp{"companyID": company.Id})
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := purgeJob(ctx, app, job); err != nil {
+			return err
+		}
+	}
+
+	for _, collection := range []string{"company_members", "company_reports"} {
+		records, err := app.FindAllRecords(collection, dbx.HashExp{"companyID": company.Id})
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := app.Delete(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := app.Delete(company); err != nil {
+		return err
+	}
+
+	handlers.LogInfo(ctx, "Company purged", "companyID", company.Id, "jobs", len(jobs))
+	return nil
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hirevo/internal/handlers"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+	"github.com/spf13/cobra"
+)
+
+// Entry represents a single mutation written to audit_logs
+type Entry struct {
+	Collection      string
+	RecordID        string
+	CompanyID       string
+	Action          string
+	ActorID         string
+	ActorCollection string
+	Diff            map[string]any
+	IP              string
+	RequestID       string
+}
+
+// Append write the entry at the end of the hash chain, in the transaction of app when it has one.
+// The last entry is read and the new one inserted in the same transaction so appends are serialized
+// by the database write lock, a concurrent append fails on the unique seq instead of forking the chain.
+func Append(app core.App, entry Entry) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		return appendEntry(txApp, entry)
+	})
+}
+
+func appendEntry(app core.App, entry Entry) error {
+	collection, err := app.FindCollectionByNameOrId("audit_logs")
+	if err != nil {
+		return err
+	}
+
+	seq := 1
+	prevHash := ""
+	last, err := app.FindRecordsByFilter("audit_logs", "", "-seq", 1, 0)
+	if err != nil {
+		return err
+	}
+	if len(last) > 0 {
+		seq = last[0].GetInt("seq") + 1
+		prevHash = last[0].GetString("hash")
+	}
+
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("seq", seq)
+	record.Set("collection", entry.Collection)
+	record.Set("recordId", entry.RecordID)
+	record.Set("companyID", entry.CompanyID)
+	record.Set("action", entry.Action)
+	record.Set("actorId", entry.ActorID)
+	record.Set("actorCollection", entry.ActorCollection)
+	record.Set("diff", types.JSONRaw(diff))
+	record.Set("ip", entry.IP)
+	record.Set("requestId", entry.RequestID)
+	record.Set("occurredAt", types.NowDateTime())
+	record.Set("prevHash", prevHash)
+
+	hash, err := computeHash(record)
+	if err != nil {
+		return err
+	}
+	record.Set("hash", hash)
+
+	return app.Save(record)
+}
+
+// computeHash sha256 of the previous hash and every audited attribute of the entry
+func computeHash(record *core.Record) (string, error) {
+	var diff any
+	if raw, ok := record.Get("diff").(types.JSONRaw); ok && len(raw) > 0 {
+		if err := json.Unmarshal(raw, &diff); err != nil {
+			return "", err
+		}
+	}
+
+	payload, err := json.Marshal([]any{
+		record.GetString("prevHash"),
+		record.GetInt("seq"),
+		record.GetString("collection"),
+		record.GetString("recordId"),
+		record.GetString("companyID"),
+		record.GetString("action"),
+		record.GetString("actorId"),
+		record.GetString("actorCollection"),
+		diff,
+		record.GetString("ip"),
+		record.GetString("requestId"),
+		record.GetDateTime("occurredAt").String(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify walk the whole chain and return the number of valid entries or the first broken link
+func Verify(app core.App) (int, error) {
+	const pageSize = 500
+
+	expectedSeq := 1
+	prevHash := ""
+	for {
+		records, err := app.FindRecordsByFilter("audit_logs", "seq >= {:seq}", "seq", pageSize, 0, dbx.Params{
+			"seq": expectedSeq,
+		})
+		if err != nil {
+			return expectedSeq - 1, err
+		}
+
+		for _, record := range records {
+			seq := record.GetInt("seq")
+			if seq != expectedSeq {
+				return expectedSeq - 1, fmt.Errorf("audit log entry %d is missing", expectedSeq)
+			}
+			if record.GetString("prevHash") != prevHash {
+				return expectedSeq - 1, fmt.Errorf("audit log entry %d does not link to the previous entry", seq)
+			}
+			hash, err := computeHash(record)
+			if err != nil {
+				return expectedSeq - 1, err
+			}
+			if hash != record.GetString("hash") {
+				return expectedSeq - 1, fmt.Errorf("audit log entry %d was modified", seq)
+			}
+			prevHash = hash
+			expectedSeq++
+		}
+
+		if len(records) < pageSize {
+			return expectedSeq - 1, nil
+		}
+	}
+}
+
+// RegisterCommands add the "audit-verify" command to the app
+func RegisterCommands(app *pocketbase.PocketBase) {
+	app.RootCmd.AddCommand(&cobra.Command{
+		Use:   "audit-verify",
+		Short: "Verify the audit log hash chain was not tampered with",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			total, err := Verify(app)
+			if err != nil {
+				handlers.LogError(ctx, err, "Audit log verification failed", "validEntries", total)
+				return err
+			}
+			handlers.LogInfo(ctx, "Audit log verified", "entries", total)
+			return nil
+		},
+	})
+}
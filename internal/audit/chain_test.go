@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"hirevo/internal/tests"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+)
+
+// newAuditedApp app with the audit hooks and a company created, renamed and archived
+func newAuditedApp(t *testing.T) *pocketbase.PocketBase {
+	t.Helper()
+	app := tests.NewApp(t)
+	RegisterHooks(app)
+
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	company.Set("name", "Acme Pty Ltd")
+	if err := app.Save(company); err != nil {
+		t.Fatalf("rename company: %v", err)
+	}
+	company.Set("deletedAt", "2026-01-01 00:00:00.000Z")
+	if err := app.Save(company); err != nil {
+		t.Fatalf("archive company: %v", err)
+	}
+	return app
+}
+
+func TestAppendAndVerify(t *testing.T) {
+	app := newAuditedApp(t)
+
+	total, err := Verify(app)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("verified %d entries, want 3", total)
+	}
+	entries, err := app.FindRecordsByFilter("audit_logs", "", "seq", 0, 0)
+	if err != nil {
+		t.Fatalf("find entries: %v", err)
+	}
+	for i, action := range []string{ActionCreate, ActionUpdate, ActionArchive} {
+		if got := entries[i].GetString("action"); got != action {
+			t.Errorf("entry %d action = %s, want %s", i+1, got, action)
+		}
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tamper func(t *testing.T, app *pocketbase.PocketBase)
+		valid  int
+		want   string
+	}{
+		{
+			name: "modified",
+			tamper: func(t *testing.T, app *pocketbase.PocketBase) {
+				updateEntry(t, app, dbx.Params{"diff": `{"name":{"after":"Other"}}`}, 2)
+			},
+			valid: 1,
+			want:  "audit log entry 2 was modified",
+		},
+		{
+			name: "missing",
+			tamper: func(t *testing.T, app *pocketbase.PocketBase) {
+				if _, err := app.DB().Delete("audit_logs", dbx.HashExp{"seq": 2}).Execute(); err != nil {
+					t.Fatalf("delete entry: %v", err)
+				}
+			},
+			valid: 1,
+			want:  "audit log entry 2 is missing",
+		},
+		{
+			// the entry keeps a valid hash of its own content but points to another chain
+			name: "relinked",
+			tamper: func(t *testing.T, app *pocketbase.PocketBase) {
+				entry, err := app.FindFirstRecordByFilter("audit_logs", "seq = 3")
+				if err != nil {
+					t.Fatalf("find entry: %v", err)
+				}
+				entry.Set("prevHash", strings.Repeat("0", 64))
+				hash, err := computeHash(entry)
+				if err != nil {
+					t.Fatalf("hash entry: %v", err)
+				}
+				updateEntry(t, app, dbx.Params{"prevHash": entry.GetString("prevHash"), "hash": hash}, 3)
+			},
+			valid: 2,
+			want:  "audit log entry 3 does not link to the previous entry",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newAuditedApp(t)
+			tc.tamper(t, app)
+
+			valid, err := Verify(app)
+			if err == nil || err.Error() != tc.want {
+				t.Fatalf("verify error = %v, want %q", err, tc.want)
+			}
+			if valid != tc.valid {
+				t.Errorf("valid entries = %d, want %d", valid, tc.valid)
+			}
+		})
+	}
+}
+
+func TestFailedAppendRollsBackMutation(t *testing.T) {
+	app := newAuditedApp(t)
+	// the database refuses the next entry
+	if _, err := app.DB().NewQuery("CREATE TRIGGER audit_logs_full BEFORE INSERT ON audit_logs BEGIN SELECT RAISE(ABORT, 'audit log full'); END").Execute(); err != nil {
+		t.Fatalf("create trigger: %v", err)
+	}
+
+	company, err := app.FindFirstRecordByFilter("companies", "")
+	if err != nil {
+		t.Fatalf("find company: %v", err)
+	}
+	company.Set("name", "Renamed")
+	if err := app.Save(company); err == nil {
+		t.Fatal("save succeeded without its audit entry")
+	}
+	saved, err := app.FindRecordById("companies", company.Id)
+	if err != nil {
+		t.Fatalf("find company: %v", err)
+	}
+	if got := saved.GetString("name"); got != "Acme Pty Ltd" {
+		t.Errorf("name = %s, want the change rolled back", got)
+	}
+}
+
+// updateEntry update the audit log entry with the seq, bypassing the hooks
+func updateEntry(t *testing.T, app *pocketbase.PocketBase, params dbx.Params, seq int) {
+	t.Helper()
+	if _, err := app.DB().Update("audit_logs", params, dbx.HashExp{"seq": seq}).Execute(); err != nil {
+		t.Fatalf("update entry %d: %v", seq, err)
+	}
+}
@@ -0,0 +1,187 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"hirevo/internal/handlers"
+	"reflect"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// Collections tracked by the audit log
+var Collections = []string{"companies", "company_members", "jobs", "job_members", "job_rates", "invoices"}
+
+// Audit actions
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionArchive = "archive"
+	ActionRestore = "restore"
+)
+
+// RegisterHooks record every mutation on business collections into audit_logs
+func RegisterHooks(app *pocketbase.PocketBase) {
+	onRecordChange(app)
+	onAuditLogsRequest(app)
+}
+
+// appendPriority run the audit handlers after the other record handlers so their transaction only wraps the write
+const appendPriority = 1000
+
+// onRecordChange append each mutation to the chain in the transaction of the write,
+// a mutation whose entry cannot be appended is rolled back so the log has no gaps
+func onRecordChange(app *pocketbase.PocketBase) {
+	app.OnRecordCreate(Collections...).Bind(&hook.Handler[*core.RecordEvent]{
+		Priority: appendPriority,
+		Func: func(e *core.RecordEvent) error {
+			return withEntry(e, func(txApp core.App) error {
+				return record(handlers.RecordContext(e), txApp, e.Record, resolveCompanyID(txApp, e.Record), ActionCreate, diffRecords(nil, e.Record))
+			})
+		},
+	})
+
+	app.OnRecordUpdate(Collections...).Bind(&hook.Handler[*core.RecordEvent]{
+		Priority: appendPriority,
+		Func: func(e *core.RecordEvent) error {
+			return withEntry(e, func(txApp core.App) error {
+				diff := diffRecords(e.Record.Original(), e.Record)
+				if len(diff) == 0 {
+					return nil
+				}
+				return record(handlers.RecordContext(e), txApp, e.Record, resolveCompanyID(txApp, e.Record), updateAction(e.Record), diff)
+			})
+		},
+	})
+
+	app.OnRecordDelete(Collections...).Bind(&hook.Handler[*core.RecordEvent]{
+		Priority: appendPriority,
+		Func: func(e *core.RecordEvent) error {
+			// the company is resolved before the delete clears the relations to the record
+			companyID := resolveCompanyID(e.App, e.Record)
+			return withEntry(e, func(txApp core.App) error {
+				return record(handlers.RecordContext(e), txApp, e.Record, companyID, ActionDelete, diffRecords(e.Record, nil))
+			})
+		},
+	})
+}
+
+// withEntry run the write of the event and add its entry in one transaction, the after success hooks
+// of the record run once it is committed
+func withEntry(e *core.RecordEvent, add func(txApp core.App) error) error {
+	app := e.App
+	defer func() { e.App = app }()
+	return app.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+		if err := e.Next(); err != nil {
+			return err
+		}
+		return add(txApp)
+	})
+}
+
+// record append the mutation to the chain
+func record(ctx context.Context, app core.App, rec *core.Record, companyID string, action string, diff map[string]any) error {
+	entry := Entry{
+		Collection: rec.Collection().Name,
+		RecordID:   rec.Id,
+		CompanyID:  companyID,
+		Action:     action,
+		Diff:       diff,
+	}
+	if scope, ok := handlers.ScopeFromContext(ctx); ok {
+		entry.ActorID = scope.ActorID
+		entry.ActorCollection = scope.ActorCollection
+		entry.IP = scope.IP
+		entry.RequestID = scope.ID
+	}
+
+	if err := Append(app, entry); err != nil {
+		return handlers.Fail(ctx, handlers.ErrAuditWriteFailed.Wrap(err), "collection", entry.Collection, "recordId", entry.RecordID, "action", action)
+	}
+	return nil
+}
+
+// updateAction distinguish soft delete and restore from regular updates
+func updateAction(rec *core.Record) string {
+	if rec.Collection().Fields.GetByName("deletedAt") == nil {
+		return ActionUpdate
+	}
+	before := rec.Original().GetDateTime("deletedAt")
+	after := rec.GetDateTime("deletedAt")
+	switch {
+	case before.IsZero() && !after.IsZero():
+		return ActionArchive
+	case !before.IsZero() && after.IsZero():
+		return ActionRestore
+	default:
+		return ActionUpdate
+	}
+}
+
+// diffRecords list changed fields as {"field": {"before": x, "after": y}}
+func diffRecords(before *core.Record, after *core.Record) map[string]any {
+	source := after
+	if source == nil {
+		source = before
+	}
+
+	diff := map[string]any{}
+	for _, field := range source.Collection().Fields {
+		name := field.GetName()
+		if field.GetHidden() || name == "updated" {
+			continue
+		}
+
+		change := map[string]any{}
+		var beforeValue, afterValue any
+		if before != nil {
+			beforeValue = before.Get(name)
+			change["before"] = beforeValue
+		}
+		if after != nil {
+			afterValue = after.Get(name)
+			change["after"] = afterValue
+		}
+		if before != nil && after != nil && sameValue(beforeValue, afterValue) {
+			continue
+		}
+		diff[name] = change
+	}
+	return diff
+}
+
+func sameValue(a any, b any) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	if aErr != nil || bErr != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(aJSON) == string(bJSON)
+}
+
+// resolveCompanyID find the company owning a record so logs can be queried per company
+func resolveCompanyID(app core.App, rec *core.Record) string {
+	switch rec.Collection().Name {
+	case "companies":
+		return rec.Id
+	case "job_members":
+		job, err := app.FindRecordById("jobs", rec.GetString("jobID"))
+		if err != nil {
+			return ""
+		}
+		return job.GetString("companyID")
+	case "job_rates":
+		job, err := app.FindFirstRecordByFilter("jobs", "rates ~ {:rateID}", dbx.Params{"rateID": rec.Id})
+		if err != nil {
+			return ""
+		}
+		return job.GetString("companyID")
+	default:
+		return rec.GetString("companyID")
+	}
+}
@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const maxPerPage = 100
+
+// AuditLogsResponse paginated audit logs of a company
+type AuditLogsResponse struct {
+	Page       int            `json:"page"`
+	PerPage    int            `json:"perPage"`
+	TotalItems int64          `json:"totalItems"`
+	Items      []*core.Record `json:"items"`
+}
+
+func onAuditLogsRequest(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/companies/{id}/audit-logs", listCompanyAuditLogs).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// listCompanyAuditLogs newest first, filterable by collection, recordId and action
+func listCompanyAuditLogs(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	companyID := e.Request.PathValue("id")
+	if !e.HasSuperuserAuth() && !company.HasRole(e.App, companyID, e.Auth.Id, company.RoleOwner, company.RoleAdmin) {
+		handlers.LogWarn(ctx, "User not allowed to read company audit logs", "companyID", companyID, "userId", e.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrAuditForbidden.WithParams("companyID", companyID))
+	}
+
+	query := e.Request.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	page = max(page, 1)
+	perPage, _ := strconv.Atoi(query.Get("perPage"))
+	if perPage <= 0 || perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+
+	filter := dbx.HashExp{"companyID": companyID}
+	for _, param := range []string{"collection", "recordId", "action"} {
+		if value := query.Get(param); value != "" {
+			filter[param] = value
+		}
+	}
+
+	total, err := e.App.CountRecords("audit_logs", filter)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to count company audit logs", "companyID", companyID)
+		return handlers.Fail(ctx, handlers.ErrAuditFetchFailed.Wrap(err), "companyID", companyID)
+	}
+
+	items := []*core.Record{}
+	err = e.App.RecordQuery("audit_logs").
+		AndWhere(filter).
+		OrderBy("seq DESC").
+		Limit(int64(perPage)).
+		Offset(int64((page - 1) * perPage)).
+		All(&items)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to fetch company audit logs", "companyID", companyID)
+		return handlers.Fail(ctx, handlers.ErrAuditFetchFailed.Wrap(err), "companyID", companyID)
+	}
+
+	return e.JSON(http.StatusOK, AuditLogsResponse{
+		Page:       page,
+		PerPage:    perPage,
+		TotalItems: total,
+		Items:      items,
+	})
+}
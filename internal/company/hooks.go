@@ -20,76 +20,79 @@ func RegisterHooks(app *pocketbase.PocketBase) {
 
 func onCreateCompanyRequest(app *pocketbase.PocketBase) {
 	app.OnRecordCreateRequest("companies").BindFunc(func(e *core.RecordRequestEvent) error {
+		ctx := e.Request.Context()
 		info, err := e.RequestInfo()
 		if err != nil {
-			handlers.LogError(err, "Error while getting RequestInfo")
-			return handlers.BadRequestError("Failed to get request info", err)
+			handlers.LogError(ctx, err, "Error while getting RequestInfo")
+			return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
 		}
 		if info.Auth == nil || info.Auth.Id == "" {
-			handlers.LogWarn("No authenticated user for company creation", info)
-			return handlers.ForbiddenError("No authenticated user for company creation", err)
+			handlers.LogWarn(ctx, "No authenticated user for company creation", info)
+			return handlers.Fail(ctx, handlers.ErrCompanyAuthRequired)
 		}
 
 		userId := info.Auth.Id
 		e.Record.Set("createdBy", userId)
-		handlers.LogInfo("Company creation request", "userId", userId)
+		handlers.LogInfo(ctx, "Company creation request", "userId", userId)
 		return e.Next()
 	})
 }
 
 func onCreateCompanySuccess(app *pocketbase.PocketBase) {
 	app.OnRecordAfterCreateSuccess("companies").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		userId := e.Record.GetString("createdBy")
 		companyId := e.Record.Id
 
 		if userId == "" || companyId == "" {
-			handlers.LogWarn("Missing userId or companyId after company creation", "userId", userId, "companyId", companyId)
+			handlers.LogWarn(ctx, "Missing userId or companyId after company creation", "userId", userId, "companyId", companyId)
 			return e.Next()
 		}
 
 		collection, err := app.FindCollectionByNameOrId("company_members")
 		if err != nil {
-			handlers.LogError(err, "Failed to find company_members collection")
+			handlers.LogError(ctx, err, "Failed to find company_members collection")
 			return err
 		}
 
 		record := core.NewRecord(collection)
 		record.Set("userID", userId)
 		record.Set("companyID", companyId)
-		record.Set("role", "OWNER")
-		record.Set("status", "ACTIVE")
-		err = app.Save(record)
+		record.Set("role", RoleOwner)
+		record.Set("status", MemberStatusActive)
+		err = app.SaveWithContext(ctx, record)
 		if err != nil {
-			handlers.LogError(err, "Failed to save company member", "userId", userId, "companyId", companyId)
-			return handlers.InternalServerError("Has error occurred during create company", err)
+			handlers.LogError(ctx, err, "Failed to save company member", "userId", userId, "companyId", companyId)
+			return handlers.Fail(ctx, handlers.ErrCompanyOwnerCreateFailed.Wrap(err), "userId", userId, "companyId", companyId)
 		}
-		handlers.LogInfo("Company member created as OWNER", "userId", userId, "companyId", companyId)
+		handlers.LogInfo(ctx, "Company member created as OWNER", "userId", userId, "companyId", companyId)
 		return e.Next()
 	})
 }
 
 func onValidateCreateCompanyRequest(app *pocketbase.PocketBase) {
 	app.OnRecordCreate("companies").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		// Retrieve the "address" field
 		addressRaw := e.Record.Get("address")
 		jsonRaw, ok := addressRaw.(types.JSONRaw)
 
 		if !ok {
-			handlers.LogWarn("Failed to get JSON address", "address", addressRaw)
-			return handlers.BadRequestError("Failed to get JSON address", "", validation.NewError(
+			handlers.LogWarn(ctx, "Failed to get JSON address", "address", addressRaw)
+			return handlers.Fail(ctx, handlers.ErrCompanyAddressInvalid.WithField("address", validation.NewError(
 				"invalid_address",
 				"The 'address' field must be a JSON object with the required subfields.",
-			))
+			)))
 		}
 
 		// Unmarshal into a Go map
 		var addressData map[string]any
 		if err := json.Unmarshal(jsonRaw, &addressData); err != nil {
-			handlers.LogError(err, "Address field validation failed", &addressData)
-			return handlers.BadRequestError("Invalid JSON structure for 'address'", err, validation.NewError(
+			handlers.LogError(ctx, err, "Address field validation failed", &addressData)
+			return handlers.Fail(ctx, handlers.ErrCompanyAddressInvalid.Wrap(err).WithField("address", validation.NewError(
 				"invalid_json",
 				"Failed to parse the 'address' JSON",
-			))
+			)))
 		}
 
 		// Check required subfields
@@ -101,11 +104,11 @@ func onValidateCreateCompanyRequest(app *pocketbase.PocketBase) {
 			}
 		}
 		if len(missing) > 0 {
-			handlers.LogWarn("Address validation failed", "missingFields", missing)
-			return handlers.BadRequestError("Missing required subfields in 'address'", "", validation.NewError(
+			handlers.LogWarn(ctx, "Address validation failed", "missingFields", missing)
+			return handlers.Fail(ctx, handlers.ErrCompanyAddressIncomplete.WithParams("fields", missing).WithField("address", validation.NewError(
 				"missing_subfields",
 				"Required fields are missing: "+strings.Join(missing, ", "),
-			))
+			)))
 		}
 
 		lat, latOk := addressData["latitude"].(float64)
@@ -113,13 +116,13 @@ func onValidateCreateCompanyRequest(app *pocketbase.PocketBase) {
 
 		// Validate lat/lon -> Both must be decimal, lat range [-90,90] lon range [-190,180]
 		if !latOk || !lonOk || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
-			handlers.LogWarn("Invalid coordinates in address", "latitude", lat, "longitude", lon)
-			return handlers.BadRequestError("Missing required subfields in 'address'", "", validation.NewError(
+			handlers.LogWarn(ctx, "Invalid coordinates in address", "latitude", lat, "longitude", lon)
+			return handlers.Fail(ctx, handlers.ErrCompanyAddressCoordinates.WithField("address", validation.NewError(
 				"invalid_coords",
 				"Latitude must be between -90 and 90, and longitude between -180 and 180",
-			))
+			)))
 		}
-		handlers.LogInfo("Address validation successful", addressData)
+		handlers.LogInfo(ctx, "Address validation successful", addressData)
 		return e.Next()
 	})
 }
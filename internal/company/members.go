@@ -0,0 +1,39 @@
+package company
+
+import (
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Company member roles
+const (
+	RoleOwner = "OWNER"
+	RoleAdmin = "ADMIN"
+	// RolePayroll can read the payslips of the company workers
+	RolePayroll = "PAYROLL"
+)
+
+// Company member statuses
+const (
+	MemberStatusActive = "ACTIVE"
+)
+
+// FindActiveMember fetch the active membership of a user in a company
+func FindActiveMember(app core.App, companyID string, userID string) (*core.Record, error) {
+	return app.FindFirstRecordByFilter("company_members", "companyID = {:companyID} && userID = {:userID} && status = {:status}", dbx.Params{
+		"companyID": companyID,
+		"userID":    userID,
+		"status":    MemberStatusActive,
+	})
+}
+
+// HasRole check if the user is an active member of the company with one of the roles
+func HasRole(app core.App, companyID string, userID string, roles ...string) bool {
+	member, err := FindActiveMember(app, companyID, userID)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(roles, member.GetString("role"))
+}
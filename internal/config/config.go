@@ -0,0 +1,316 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log outputs
+const (
+	LogOutputStdout     = "stdout"
+	LogOutputFile       = "file"
+	LogOutputPocketBase = "pocketbase"
+)
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// defaultRedactKeys attributes never written in clear to the logs
+var defaultRedactKeys = []string{"email", "abn", "token", "password", "authorization", "phone"}
+
+// Config application settings read from environment variables
+type Config struct {
+	Log           LogConfig
+	Jobs          JobsConfig
+	Workers       WorkersConfig
+	Notifications NotificationsConfig
+	Webhooks      WebhooksConfig
+	Invoices      InvoicesConfig
+}
+
+// LogConfig logging backend and levels
+type LogConfig struct {
+	Level         slog.Level
+	Format        string
+	Outputs       []string
+	File          LogFileConfig
+	PackageLevels map[string]slog.Level
+	RedactKeys    []string
+}
+
+// LogFileConfig rotating log file
+type LogFileConfig struct {
+	Path       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+// JobsConfig hiring workflow
+type JobsConfig struct {
+	// OfferTTL time a worker has to accept an offer before it expires
+	OfferTTL time.Duration
+	// ScheduleHorizon how far ahead recurring schedules are expanded into shifts
+	ScheduleHorizon time.Duration
+}
+
+// WorkersConfig worker credentials
+type WorkersConfig struct {
+	// ExpiryWarning credentials expiring within this period are flagged EXPIRING
+	ExpiryWarning time.Duration
+}
+
+// NotificationsConfig notification deliveries
+type NotificationsConfig struct {
+	// MaxAttempts deliveries still failing after this many attempts are given up
+	MaxAttempts int
+	// WebhookTimeout time a webhook endpoint has to answer
+	WebhookTimeout time.Duration
+	// WebhookAllowPrivateNetworks let the webhook channel reach private addresses, see WebhooksConfig
+	WebhookAllowPrivateNetworks bool
+}
+
+// WebhooksConfig company webhook endpoints
+type WebhooksConfig struct {
+	// MaxAttempts deliveries still failing after this many attempts are given up
+	MaxAttempts int
+	// Timeout time an endpoint has to answer, also used by the notification webhooks
+	Timeout time.Duration
+	// AllowPrivateNetworks let the endpoints use loopback, private and link-local addresses,
+	// only for local testing, also used by the notification webhooks
+	AllowPrivateNetworks bool
+}
+
+// InvoicesConfig payment terms and reminders, companies can override them
+type InvoicesConfig struct {
+	// PaymentTermsDays days after the invoice creation it is due, NET 14 by default
+	PaymentTermsDays int
+	// ReminderDays days past the due date a reminder is sent, in ascending order
+	ReminderDays []int
+}
+
+// Load read the configuration from the environment, using defaults for unset variables
+func Load() (*Config, error) {
+	logConfig, err := loadLogConfig()
+	if err != nil {
+		return nil, err
+	}
+	jobsConfig, err := loadJobsConfig()
+	if err != nil {
+		return nil, err
+	}
+	workersConfig, err := loadWorkersConfig()
+	if err != nil {
+		return nil, err
+	}
+	webhooksConfig, err := loadWebhooksConfig()
+	if err != nil {
+		return nil, err
+	}
+	notificationsConfig, err := loadNotificationsConfig(webhooksConfig)
+	if err != nil {
+		return nil, err
+	}
+	invoicesConfig, err := loadInvoicesConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		Log:           logConfig,
+		Jobs:          jobsConfig,
+		Workers:       workersConfig,
+		Notifications: notificationsConfig,
+		Webhooks:      webhooksConfig,
+		Invoices:      invoicesConfig,
+	}, nil
+}
+
+func loadLogConfig() (LogConfig, error) {
+	cfg := LogConfig{
+		Format:        getEnv("HIREVO_LOG_FORMAT", LogFormatJSON),
+		Outputs:       splitList(getEnv("HIREVO_LOG_OUTPUTS", LogOutputStdout)),
+		PackageLevels: map[string]slog.Level{},
+		RedactKeys:    slices.Concat(defaultRedactKeys, splitList(os.Getenv("HIREVO_LOG_REDACT_KEYS"))),
+		File: LogFileConfig{
+			Path: getEnv("HIREVO_LOG_FILE", "pb_data/hirevo.log"),
+		},
+	}
+
+	level, err := parseLevel(getEnv("HIREVO_LOG_LEVEL", "debug"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Level = level
+
+	if cfg.Format != LogFormatJSON && cfg.Format != LogFormatText {
+		return cfg, fmt.Errorf("invalid HIREVO_LOG_FORMAT %q, expected json or text", cfg.Format)
+	}
+
+	for _, output := range cfg.Outputs {
+		switch output {
+		case LogOutputStdout, LogOutputFile, LogOutputPocketBase:
+		default:
+			return cfg, fmt.Errorf("invalid HIREVO_LOG_OUTPUTS entry %q, expected stdout, file or pocketbase", output)
+		}
+	}
+
+	// Format: "invoice=debug,reports=warn"
+	for _, override := range splitList(os.Getenv("HIREVO_LOG_PACKAGE_LEVELS")) {
+		pkg, levelName, ok := strings.Cut(override, "=")
+		if !ok {
+			return cfg, fmt.Errorf("invalid HIREVO_LOG_PACKAGE_LEVELS entry %q, expected package=level", override)
+		}
+		level, err := parseLevel(levelName)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.PackageLevels[strings.TrimSpace(pkg)] = level
+	}
+
+	if cfg.File.MaxSizeMB, err = getEnvInt("HIREVO_LOG_FILE_MAX_SIZE_MB", 50); err != nil {
+		return cfg, err
+	}
+	if cfg.File.MaxBackups, err = getEnvInt("HIREVO_LOG_FILE_MAX_BACKUPS", 5); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func loadJobsConfig() (JobsConfig, error) {
+	hours, err := getEnvInt("HIREVO_OFFER_TTL_HOURS", 48)
+	if err != nil {
+		return JobsConfig{}, err
+	}
+	if hours == 0 {
+		return JobsConfig{}, fmt.Errorf("invalid HIREVO_OFFER_TTL_HOURS %q, expected at least 1 hour", os.Getenv("HIREVO_OFFER_TTL_HOURS"))
+	}
+	days, err := getEnvInt("HIREVO_SCHEDULE_HORIZON_DAYS", 28)
+	if err != nil {
+		return JobsConfig{}, err
+	}
+	if days == 0 {
+		return JobsConfig{}, fmt.Errorf("invalid HIREVO_SCHEDULE_HORIZON_DAYS %q, expected at least 1 day", os.Getenv("HIREVO_SCHEDULE_HORIZON_DAYS"))
+	}
+	return JobsConfig{OfferTTL: time.Duration(hours) * time.Hour, ScheduleHorizon: time.Duration(days) * 24 * time.Hour}, nil
+}
+
+func loadWorkersConfig() (WorkersConfig, error) {
+	days, err := getEnvInt("HIREVO_CREDENTIAL_EXPIRY_WARNING_DAYS", 30)
+	if err != nil {
+		return WorkersConfig{}, err
+	}
+	return WorkersConfig{ExpiryWarning: time.Duration(days) * 24 * time.Hour}, nil
+}
+
+func loadNotificationsConfig(webhooks WebhooksConfig) (NotificationsConfig, error) {
+	attempts, err := getEnvInt("HIREVO_NOTIFICATION_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return NotificationsConfig{}, err
+	}
+	if attempts == 0 {
+		return NotificationsConfig{}, fmt.Errorf("invalid HIREVO_NOTIFICATION_MAX_ATTEMPTS %q, expected at least 1 attempt", os.Getenv("HIREVO_NOTIFICATION_MAX_ATTEMPTS"))
+	}
+	return NotificationsConfig{
+		MaxAttempts:                 attempts,
+		WebhookTimeout:              webhooks.Timeout,
+		WebhookAllowPrivateNetworks: webhooks.AllowPrivateNetworks,
+	}, nil
+}
+
+func loadWebhooksConfig() (WebhooksConfig, error) {
+	attempts, err := getEnvInt("HIREVO_WEBHOOK_MAX_ATTEMPTS", 8)
+	if err != nil {
+		return WebhooksConfig{}, err
+	}
+	if attempts == 0 {
+		return WebhooksConfig{}, fmt.Errorf("invalid HIREVO_WEBHOOK_MAX_ATTEMPTS %q, expected at least 1 attempt", os.Getenv("HIREVO_WEBHOOK_MAX_ATTEMPTS"))
+	}
+	seconds, err := getEnvInt("HIREVO_WEBHOOK_TIMEOUT_SECONDS", 10)
+	if err != nil {
+		return WebhooksConfig{}, err
+	}
+	if seconds == 0 {
+		return WebhooksConfig{}, fmt.Errorf("invalid HIREVO_WEBHOOK_TIMEOUT_SECONDS %q, expected at least 1 second", os.Getenv("HIREVO_WEBHOOK_TIMEOUT_SECONDS"))
+	}
+	allowPrivate, err := getEnvBool("HIREVO_WEBHOOK_ALLOW_PRIVATE_NETWORKS", false)
+	if err != nil {
+		return WebhooksConfig{}, err
+	}
+	return WebhooksConfig{MaxAttempts: attempts, Timeout: time.Duration(seconds) * time.Second, AllowPrivateNetworks: allowPrivate}, nil
+}
+
+func loadInvoicesConfig() (InvoicesConfig, error) {
+	terms, err := getEnvInt("HIREVO_INVOICE_PAYMENT_TERMS_DAYS", 14)
+	if err != nil {
+		return InvoicesConfig{}, err
+	}
+	// Format: "1,7,14,30"
+	reminders := []int{}
+	previous := 0
+	for _, item := range splitList(getEnv("HIREVO_INVOICE_REMINDER_DAYS", "1,7,14,30")) {
+		days, err := strconv.Atoi(item)
+		if err != nil || days <= previous {
+			return InvoicesConfig{}, fmt.Errorf("invalid HIREVO_INVOICE_REMINDER_DAYS %q, expected ascending positive days", os.Getenv("HIREVO_INVOICE_REMINDER_DAYS"))
+		}
+		reminders = append(reminders, days)
+		previous = days
+	}
+	return InvoicesConfig{PaymentTermsDays: terms, ReminderDays: reminders}, nil
+}
+
+func parseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(name))); err != nil {
+		return level, fmt.Errorf("invalid log level %q: %w", name, err)
+	}
+	return level, nil
+}
+
+func getEnv(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, expected a positive number", key, value)
+	}
+	return n, nil
+}
+
+func getEnvBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q, expected true or false", key, value)
+	}
+	return b, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToLower(item))
+		}
+	}
+	return items
+}
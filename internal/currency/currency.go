@@ -0,0 +1,62 @@
+package currency
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Base currency of the companies without one and of the invoices issued before currencies were supported
+const Base = "AUD"
+
+// exponents digits of the minor unit of the supported ISO 4217 currencies
+var exponents = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "DKK": 2,
+	"EUR": 2, "FJD": 2, "GBP": 2, "HKD": 2, "IDR": 2, "INR": 2, "JPY": 0, "KRW": 0,
+	"KWD": 3, "MXN": 2, "MYR": 2, "NOK": 2, "NZD": 2, "OMR": 3, "PGK": 2, "PHP": 2,
+	"SEK": 2, "SGD": 2, "THB": 2, "TOP": 2, "TWD": 2, "USD": 2, "VND": 0, "WST": 2,
+	"XPF": 0, "ZAR": 2,
+}
+
+// Valid check the code is a supported ISO 4217 currency
+func Valid(code string) bool {
+	_, ok := exponents[code]
+	return ok
+}
+
+// Exponent digits of the minor unit of the currency, eg. 2 for cents, 0 for JPY
+func Exponent(code string) int {
+	if exponent, ok := exponents[code]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Normalize upper case code, the base currency when empty
+func Normalize(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return Base
+	}
+	return code
+}
+
+// Format printed amount of minor units with the currency code, eg. "AUD 1,100.00"
+func Format(minor int64, code string) string {
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	exponent := Exponent(code)
+	scale := int64(math.Pow10(exponent))
+	whole := strconv.FormatInt(minor/scale, 10)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + "," + whole[i:]
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s %s%s", code, sign, whole)
+	}
+	return fmt.Sprintf("%s %s%s.%0*d", code, sign, whole, exponent, minor%scale)
+}
@@ -0,0 +1,223 @@
+package currency
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode of the amounts falling between two minor units
+type RoundingMode int
+
+const (
+	// RoundHalfUp round the halves away from zero, the rule of the amounts charged and paid:
+	// invoice lines, earnings, super and printed amounts
+	RoundHalfUp RoundingMode = iota
+	// RoundHalfEven round the halves to the even minor unit (banker's rounding), the rule of the currency
+	// conversions so the converted totals do not drift upwards over many invoices
+	RoundHalfEven
+)
+
+// Money exact amount in minor units of a currency, amounts are only added to amounts of the same currency
+// and every multiplication rounds to the minor unit with an explicit rounding mode
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// New amount of minor units of the currency
+func New(minor int64, code string) Money {
+	return Money{Minor: minor, Currency: code}
+}
+
+// Zero amount of the currency
+func Zero(code string) Money {
+	return Money{Currency: code}
+}
+
+// FromMajor amount of a decimal value in major units such as 12.345, rounded to the minor unit,
+// the value is read from its shortest decimal representation so 33.335 is a half and not 33.33499...
+func FromMajor(amount float64, code string, mode RoundingMode) Money {
+	value, _ := new(big.Rat).SetString(strconv.FormatFloat(amount, 'f', -1, 64))
+	return Money{Minor: round(value.Mul(value, pow10(Exponent(code))), mode), Currency: code}
+}
+
+// amountPattern printed amount: an optional code before or after the number, an optional sign and symbol,
+// digits grouped by three with commas or not grouped, and a decimal point
+var amountPattern = regexp.MustCompile(`^(?:([A-Z]{3}) ?)?(-)?(?:[A-Z]{0,2}\$|€|£|¥|₹)?(-)?(\d{1,3}(?:,\d{3})+|\d+)(\.\d+)?(?: ?([A-Z]{3}))?$`)
+
+// Parse exact amount of a printed amount such as "$1,100.00", "AUD -42.50" or "42.5 AUD", extra decimals are rounded half up.
+// Anything else is refused rather than guessed, such as "1.100,50", "1e3", a code of another currency or surrounding text
+func Parse(value string, code string) (Money, error) {
+	match := amountPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil || (match[2] != "" && match[3] != "") || (match[1] != "" && match[6] != "") {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if printed := match[1] + match[6]; printed != "" && printed != code {
+		return Money{}, fmt.Errorf("amount %q is not in %s", value, code)
+	}
+	amount, ok := new(big.Rat).SetString(match[2] + match[3] + strings.ReplaceAll(match[4], ",", "") + match[5])
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	return Money{Minor: round(amount.Mul(amount, pow10(Exponent(code))), RoundHalfUp), Currency: code}, nil
+}
+
+// Major amount in major units, for the number fields and the JSON
+func (m Money) Major() float64 {
+	value, _ := new(big.Rat).SetFrac(big.NewInt(m.Minor), pow10(Exponent(m.Currency)).Num()).Float64()
+	return value
+}
+
+// String printed amount with its currency code, eg. "AUD 1,100.00"
+func (m Money) String() string {
+	return Format(m.Minor, m.Currency)
+}
+
+// Decimal amount in major units without code nor thousand separators, eg. "-1100.00", for the data exchange formats
+func (m Money) Decimal() string {
+	return strings.ReplaceAll(Format(m.Minor, m.Currency)[len(m.Currency)+1:], ",", "")
+}
+
+// IsZero check the amount is zero
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// Add sum of the amounts, the currencies must be the same
+func (m Money) Add(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor + other.Minor, Currency: m.Currency}
+}
+
+// Sub difference of the amounts, the currencies must be the same
+func (m Money) Sub(other Money) Money {
+	m.mustMatch(other)
+	return Money{Minor: m.Minor - other.Minor, Currency: m.Currency}
+}
+
+// Neg opposite amount
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Mul amount multiplied by decimal factors such as hours and a loading, the product is exact
+// and rounded once to the minor unit
+func (m Money) Mul(mode RoundingMode, factors ...float64) Money {
+	value := new(big.Rat).SetInt64(m.Minor)
+	for _, factor := range factors {
+		decimal, _ := new(big.Rat).SetString(strconv.FormatFloat(factor, 'f', -1, 64))
+		value.Mul(value, decimal)
+	}
+	return Money{Minor: round(value, mode), Currency: m.Currency}
+}
+
+// MulRatio amount multiplied by an exact fraction such as the 1/11 GST of a tax inclusive amount
+func (m Money) MulRatio(numerator int64, denominator int64, mode RoundingMode) Money {
+	value := new(big.Rat).SetFrac(big.NewInt(m.Minor*numerator), big.NewInt(denominator))
+	return Money{Minor: round(value, mode), Currency: m.Currency}
+}
+
+// Convert amount in another currency at the rate, units of the currency for one unit of the amount currency
+func (m Money) Convert(code string, rate float64, mode RoundingMode) Money {
+	if m.Currency == code {
+		return m
+	}
+	value, _ := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	value.Mul(value, new(big.Rat).SetInt64(m.Minor))
+	value.Mul(value, pow10(Exponent(code)))
+	value.Quo(value, pow10(Exponent(m.Currency)))
+	return Money{Minor: round(value, mode), Currency: code}
+}
+
+// Allocate split the amount in parts proportional to the weights, the parts always add up to the amount:
+// each part gets its share rounded towards zero and the minor units left go to the largest remainders,
+// the first parts first on equal remainders
+func (m Money) Allocate(weights ...int64) []Money {
+	total := int64(0)
+	for _, weight := range weights {
+		if weight < 0 {
+			panic(fmt.Sprintf("currency: negative allocation weight %d", weight))
+		}
+		total += weight
+	}
+	if total == 0 {
+		panic("currency: allocation without weight")
+	}
+
+	parts := make([]Money, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	left := m.Minor
+	for i, weight := range weights {
+		share, remainder := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(m.Minor), big.NewInt(weight)), big.NewInt(total), new(big.Int))
+		parts[i] = Money{Minor: share.Int64(), Currency: m.Currency}
+		remainders[i] = remainder.Abs(remainder)
+		left -= parts[i].Minor
+	}
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return remainders[b].Cmp(remainders[a])
+	})
+	step := int64(1)
+	if left < 0 {
+		step = -1
+	}
+	for i := 0; left != 0; i++ {
+		parts[order[i]].Minor += step
+		left -= step
+	}
+	return parts
+}
+
+// MarshalJSON amount in major units, the currency is carried by the document
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Major())
+}
+
+// Sum total of the amounts in the currency
+func Sum(code string, amounts ...Money) Money {
+	total := Zero(code)
+	for _, amount := range amounts {
+		total = total.Add(amount)
+	}
+	return total
+}
+
+// mustMatch amounts of different currencies are never mixed, converting them first is a programming error to fix
+func (m Money) mustMatch(other Money) {
+	if m.Currency != other.Currency {
+		panic(fmt.Sprintf("currency: mixing %s and %s amounts", m.Currency, other.Currency))
+	}
+}
+
+// round rational amount of minor units to an integer with the rounding mode
+func round(value *big.Rat, mode RoundingMode) int64 {
+	quotient, remainder := new(big.Int).QuoRem(value.Num(), value.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient.Int64()
+	}
+	// compare twice the remainder with the denominator to find the halves
+	half := new(big.Int).Abs(remainder)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(value.Denom())
+	away := cmp > 0 || (cmp == 0 && (mode == RoundHalfUp || quotient.Bit(0) == 1))
+	if away {
+		if value.Sign() < 0 {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient.Int64()
+}
+
+func pow10(exponent int) *big.Rat {
+	return new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil))
+}
@@ -0,0 +1,360 @@
+package currency
+
+import (
+	"math/big"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// quickConfig runs of the property tests, seeded so a failure can be replayed
+var quickConfig = &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(1))}
+
+func TestRound(t *testing.T) {
+	for _, tc := range []struct {
+		num, denom     int64
+		halfUp, halfEv int64
+	}{
+		{0, 1, 0, 0},
+		{12, 1, 12, 12},
+		{24, 10, 2, 2},
+		{26, 10, 3, 3},
+		{25, 10, 3, 2},
+		{35, 10, 4, 4},
+		{1, 2, 1, 0},
+		{3, 2, 2, 2},
+		{-1, 2, -1, 0},
+		{-25, 10, -3, -2},
+		{-35, 10, -4, -4},
+		{-24, 10, -2, -2},
+		{-26, 10, -3, -3},
+		{1, 3, 0, 0},
+		{2, 3, 1, 1},
+		{-2, 3, -1, -1},
+		{100000000005, 10, 10000000001, 10000000000},
+	} {
+		value := big.NewRat(tc.num, tc.denom)
+		if got := round(value, RoundHalfUp); got != tc.halfUp {
+			t.Errorf("round(%d/%d, half up) = %d, want %d", tc.num, tc.denom, got, tc.halfUp)
+		}
+		if got := round(value, RoundHalfEven); got != tc.halfEv {
+			t.Errorf("round(%d/%d, half even) = %d, want %d", tc.num, tc.denom, got, tc.halfEv)
+		}
+	}
+}
+
+func TestFromMajor(t *testing.T) {
+	for _, tc := range []struct {
+		amount float64
+		code   string
+		mode   RoundingMode
+		want   int64
+	}{
+		{12.34, "AUD", RoundHalfUp, 1234},
+		{33.335, "AUD", RoundHalfUp, 3334},
+		{33.345, "AUD", RoundHalfUp, 3335},
+		{33.345, "AUD", RoundHalfEven, 3334},
+		{1.005, "AUD", RoundHalfUp, 101},
+		{1.005, "AUD", RoundHalfEven, 100},
+		{-1.005, "AUD", RoundHalfUp, -101},
+		{0.1 + 0.2, "AUD", RoundHalfUp, 30},
+		{1234.5, "JPY", RoundHalfUp, 1235},
+		{1234.5, "JPY", RoundHalfEven, 1234},
+		{1.2345, "KWD", RoundHalfUp, 1235},
+	} {
+		if got := FromMajor(tc.amount, tc.code, tc.mode); got.Minor != tc.want || got.Currency != tc.code {
+			t.Errorf("FromMajor(%v, %s, %d) = %v, want %d", tc.amount, tc.code, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		code  string
+		want  int64
+	}{
+		{"110", "AUD", 11000},
+		{"110.5", "AUD", 11050},
+		{"0.005", "AUD", 1},
+		{"$1,100.00", "AUD", 110000},
+		{"A$1,100.00", "AUD", 110000},
+		{"AUD 1,100.00", "AUD", 110000},
+		{"AUD 1,234,567.89", "AUD", 123456789},
+		{"AUD -42.50", "AUD", -4250},
+		{"-$42.50", "AUD", -4250},
+		{"$-42.50", "AUD", -4250},
+		{"42.50 AUD", "AUD", 4250},
+		{"  €12.30 ", "EUR", 1230},
+		{"JPY 1,235", "JPY", 1235},
+		{Format(-123456, "AUD"), "AUD", -123456},
+	} {
+		got, err := Parse(tc.value, tc.code)
+		if err != nil || got.Minor != tc.want || got.Currency != tc.code {
+			t.Errorf("Parse(%q, %s) = %v, %v, want %d", tc.value, tc.code, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseRefusesAmbiguousAmounts(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"AUD",
+		"1.100,50",
+		"1,10.50",
+		"1,1000",
+		",100",
+		"1e3",
+		"1.2.3",
+		"Total 2026: 100",
+		"100 per hour",
+		"--100",
+		"-$-100",
+		"AUD 100 AUD",
+		"USD 100",
+		"100 NZD",
+		"(100)",
+	} {
+		if got, err := Parse(value, "AUD"); err == nil {
+			t.Errorf("Parse(%q) = %v, want an error", value, got)
+		}
+	}
+}
+
+func TestMul(t *testing.T) {
+	for _, tc := range []struct {
+		minor   int64
+		factors []float64
+		mode    RoundingMode
+		want    int64
+	}{
+		{2500, []float64{7.6}, RoundHalfUp, 19000},
+		{2500, []float64{7.6, 1.25}, RoundHalfUp, 23750},
+		{3133, []float64{7.5, 1.5}, RoundHalfUp, 35246},
+		{3133, []float64{7.5, 1.5}, RoundHalfEven, 35246},
+		{1999, []float64{0.333}, RoundHalfUp, 666},
+		{5, []float64{0.5}, RoundHalfUp, 3},
+		{5, []float64{0.5}, RoundHalfEven, 2},
+		{7, []float64{0.5}, RoundHalfEven, 4},
+		{-5, []float64{0.5}, RoundHalfUp, -3},
+		{-5, []float64{0.5}, RoundHalfEven, -2},
+		// 0.1 and 0.115 are read as decimals, a float product would be 1149.9999...
+		{10000, []float64{0.1, 1.15}, RoundHalfUp, 1150},
+		{2000, []float64{0.115}, RoundHalfUp, 230},
+		{1234, []float64{}, RoundHalfUp, 1234},
+	} {
+		if got := New(tc.minor, "AUD").Mul(tc.mode, tc.factors...); got.Minor != tc.want {
+			t.Errorf("%d.Mul(%d, %v) = %d, want %d", tc.minor, tc.mode, tc.factors, got.Minor, tc.want)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	for _, tc := range []struct {
+		minor int64
+		want  int64
+	}{
+		{11000, 1000},
+		{1001, 91},
+		{1000, 91},
+		{55, 5},
+		{-1000, -91},
+	} {
+		if got := New(tc.minor, "AUD").MulRatio(10, 110, RoundHalfUp); got.Minor != tc.want {
+			t.Errorf("GST of %d = %d, want %d", tc.minor, got.Minor, tc.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, tc := range []struct {
+		minor    int64
+		from, to string
+		rate     float64
+		mode     RoundingMode
+		want     int64
+	}{
+		{12345, "AUD", "AUD", 2, RoundHalfEven, 12345},
+		{10000, "USD", "AUD", 1.5321, RoundHalfEven, 15321},
+		{12345, "AUD", "JPY", 97.5, RoundHalfEven, 12036},
+		{100000, "JPY", "AUD", 0.0103, RoundHalfEven, 103000},
+		{1000, "AUD", "KWD", 0.2, RoundHalfEven, 2000},
+		{2000, "KWD", "AUD", 5, RoundHalfEven, 1000},
+		{1, "USD", "AUD", 0.5, RoundHalfEven, 0},
+		{1, "USD", "AUD", 0.5, RoundHalfUp, 1},
+		{3, "USD", "AUD", 0.5, RoundHalfEven, 2},
+		{-3, "USD", "AUD", 0.5, RoundHalfEven, -2},
+	} {
+		got := New(tc.minor, tc.from).Convert(tc.to, tc.rate, tc.mode)
+		if got.Minor != tc.want || got.Currency != tc.to {
+			t.Errorf("%d %s.Convert(%s, %v, %d) = %v, want %d", tc.minor, tc.from, tc.to, tc.rate, tc.mode, got, tc.want)
+		}
+	}
+}
+
+func TestSum(t *testing.T) {
+	if got := Sum("AUD"); got != Zero("AUD") {
+		t.Errorf("Sum() = %v, want zero", got)
+	}
+	if got := Sum("AUD", New(1050, "AUD"), New(-50, "AUD"), New(1, "AUD")); got != New(1001, "AUD") {
+		t.Errorf("Sum = %v, want AUD 10.01", got)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Sum of AUD and USD amounts did not panic")
+		}
+	}()
+	Sum("AUD", New(100, "AUD"), New(100, "USD"))
+}
+
+func TestAllocate(t *testing.T) {
+	for _, tc := range []struct {
+		minor   int64
+		weights []int64
+		want    []int64
+	}{
+		{100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{-100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{101, []int64{1, 1}, []int64{51, 50}},
+		{5, []int64{3, 7}, []int64{2, 3}},
+		{6, []int64{3, 7}, []int64{2, 4}},
+		{100, []int64{1, 0, 1}, []int64{50, 0, 50}},
+		{0, []int64{2, 5}, []int64{0, 0}},
+		{1, []int64{1, 1, 1}, []int64{1, 0, 0}},
+		{1000, []int64{100, 10}, []int64{909, 91}},
+	} {
+		parts := New(tc.minor, "AUD").Allocate(tc.weights...)
+		for i, part := range parts {
+			if part.Minor != tc.want[i] || part.Currency != "AUD" {
+				t.Errorf("%d.Allocate(%v) = %v, want %v", tc.minor, tc.weights, parts, tc.want)
+				break
+			}
+		}
+	}
+}
+
+// amounts up to a million dollars keep the property tests far from overflows
+func boundedMinor(value int64) int64 {
+	return value % 100000000
+}
+
+func TestRoundModesAgreeBesideHalves(t *testing.T) {
+	property := func(num int64, denom uint16) bool {
+		num = boundedMinor(num)
+		value := big.NewRat(num, int64(denom)+1)
+		up, even := round(value, RoundHalfUp), round(value, RoundHalfEven)
+		isHalf := !value.IsInt() && new(big.Rat).Mul(value, big.NewRat(2, 1)).IsInt()
+		if !isHalf {
+			return up == even
+		}
+		// on a half the modes differ by one unit at most, half even lands on an even unit
+		diff := up - even
+		return (diff == 0 || diff == 1 || diff == -1) && even%2 == 0
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoundIsNearest(t *testing.T) {
+	property := func(num int64, denom uint16, halfEven bool) bool {
+		num = boundedMinor(num)
+		mode := RoundHalfUp
+		if halfEven {
+			mode = RoundHalfEven
+		}
+		value := big.NewRat(num, int64(denom)+1)
+		distance := new(big.Rat).Sub(value, big.NewRat(round(value, mode), 1))
+		return distance.Abs(distance).Cmp(big.NewRat(1, 2)) <= 0
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAllocateReconciles(t *testing.T) {
+	property := func(minor int64, weights []uint16) bool {
+		minor = boundedMinor(minor)
+		total := int64(0)
+		ints := make([]int64, 0, len(weights)+1)
+		for _, weight := range weights {
+			ints = append(ints, int64(weight))
+			total += int64(weight)
+		}
+		if total == 0 {
+			ints = append(ints, 1)
+			total = 1
+		}
+		amount := New(minor, "AUD")
+		parts := amount.Allocate(ints...)
+		if Sum("AUD", parts...) != amount {
+			return false
+		}
+		// each part is within one unit of its exact share
+		for i, part := range parts {
+			share := big.NewRat(minor*ints[i], total)
+			distance := new(big.Rat).Sub(share, big.NewRat(part.Minor, 1))
+			if distance.Abs(distance).Cmp(big.NewRat(1, 1)) >= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGSTSplitReconciles(t *testing.T) {
+	property := func(minor int64) bool {
+		total := New(boundedMinor(minor), "AUD")
+		gst := total.MulRatio(10, 110, RoundHalfUp)
+		net := total.Sub(gst)
+		parts := total.Allocate(100, 10)
+		return net.Add(gst) == total && Sum("AUD", parts...) == total
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConvertedSplitReconciles(t *testing.T) {
+	rates := []float64{0.0103, 0.65, 1, 1.0875, 1.5321, 97.5, 1234.5678}
+	codes := []string{"AUD", "JPY", "KWD", "USD"}
+	property := func(values []uint32, rateIndex uint8, codeIndex uint8) bool {
+		if len(values) == 0 {
+			return true
+		}
+		rate := rates[int(rateIndex)%len(rates)]
+		to := codes[int(codeIndex)%len(codes)]
+		parts := make([]Money, len(values))
+		weights := make([]int64, len(values))
+		for i, value := range values {
+			parts[i] = New(int64(value%10000000), "USD")
+			weights[i] = parts[i].Minor
+		}
+		total := Sum("USD", parts...)
+		converted := total.Convert(to, rate, RoundHalfEven)
+		if total.IsZero() {
+			return converted.IsZero()
+		}
+
+		// the converted total split like the original parts adds up to the converted total,
+		// each converted part is within one unit of the part converted on its own
+		split := converted.Allocate(weights...)
+		if Sum(to, split...) != converted {
+			return false
+		}
+		for i, part := range parts {
+			alone := part.Convert(to, rate, RoundHalfEven)
+			if diff := split[i].Minor - alone.Minor; diff < -1 || diff > 1 {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, quickConfig); err != nil {
+		t.Error(err)
+	}
+}
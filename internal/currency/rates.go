@@ -0,0 +1,199 @@
+package currency
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hirevo/internal/handlers"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/spf13/cobra"
+)
+
+// Rate exchange rate of a day, Rate units of Quote for one unit of Base
+type Rate struct {
+	Date  string
+	Base  string
+	Quote string
+	Rate  float64
+}
+
+// ErrRateNotFound no rate of the currencies on or before the day
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RegisterHooks validate the exchange rates
+func RegisterHooks(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		if err := validateRate(e.Record); err != nil {
+			return handlers.Fail(handlers.RecordContext(e), err)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("exchange_rates").BindFunc(validate)
+	app.OnRecordUpdate("exchange_rates").BindFunc(validate)
+}
+
+// RegisterCommands add the "exchange-rates-import" command to the app
+func RegisterCommands(app *pocketbase.PocketBase) {
+	var source string
+	command := &cobra.Command{
+		Use:   "exchange-rates-import [file.csv]",
+		Short: "Import exchange rates from a CSV file with the date, base, quote and rate columns",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := context.Background()
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if source == "" {
+				source = filepath.Base(args[0])
+			}
+			total, err := ImportRates(ctx, app, file, source)
+			if err != nil {
+				handlers.LogError(ctx, err, "Failed to import exchange rates", "file", args[0], "imported", total)
+				return err
+			}
+			handlers.LogInfo(ctx, "Exchange rates imported", "file", args[0], "imported", total)
+			return nil
+		},
+	}
+	command.Flags().StringVar(&source, "source", "", "source recorded on the rates, the file name by default")
+	app.RootCmd.AddCommand(command)
+}
+
+func validateRate(record *core.Record) *handlers.DomainError {
+	invalid := func(field string, code string, message string) *handlers.DomainError {
+		return handlers.ErrExchangeRateInvalid.WithParams("field", field).WithField(field, validation.NewError(code, message))
+	}
+	if _, err := time.Parse(time.DateOnly, record.GetString("date")); err != nil {
+		return invalid("date", "invalid_date", "Date must be a YYYY-MM-DD date")
+	}
+	for _, field := range []string{"base", "quote"} {
+		record.Set(field, Normalize(record.GetString(field)))
+		if !Valid(record.GetString(field)) {
+			return invalid(field, "invalid_currency", "Unsupported ISO 4217 currency")
+		}
+	}
+	if record.GetString("base") == record.GetString("quote") {
+		return invalid("quote", "same_currency", "The quote currency must differ from the base currency")
+	}
+	if record.GetFloat("rate") <= 0 {
+		return invalid("rate", "invalid_rate", "Rate must be positive")
+	}
+	return nil
+}
+
+// FindRate latest rate converting from a currency to another on or before the day,
+// the inverse of the opposite rate is used when only that one was recorded
+func FindRate(app core.App, from string, to string, day time.Time) (Rate, error) {
+	date := day.Format(time.DateOnly)
+	if from == to {
+		return Rate{Date: date, Base: from, Quote: to, Rate: 1}, nil
+	}
+
+	var found *Rate
+	for _, pair := range [][2]string{{from, to}, {to, from}} {
+		records, err := app.FindRecordsByFilter(
+			"exchange_rates",
+			"base = {:base} && quote = {:quote} && date <= {:date}",
+			"-date", 1, 0,
+			dbx.Params{"base": pair[0], "quote": pair[1], "date": date},
+		)
+		if err != nil {
+			return Rate{}, err
+		}
+		if len(records) == 0 || (found != nil && found.Date >= records[0].GetString("date")) {
+			continue
+		}
+		rate := records[0].GetFloat("rate")
+		if pair[0] != from {
+			rate = 1 / rate
+		}
+		found = &Rate{Date: records[0].GetString("date"), Base: from, Quote: to, Rate: rate}
+	}
+	if found == nil {
+		return Rate{}, fmt.Errorf("%w: %s to %s on %s", ErrRateNotFound, from, to, date)
+	}
+	return *found, nil
+}
+
+// ImportRates create or replace the rates of a CSV file, the header names the date, base, quote and rate columns,
+// every row is checked before any rate is saved, returns the number of rates imported
+func ImportRates(ctx context.Context, app core.App, reader io.Reader, source string) (int, error) {
+	rows, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, errors.New("empty exchange rates file")
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("missing %q column", name)
+		}
+	}
+
+	rates := make([]Rate, 0, len(rows)-1)
+	for i, row := range rows[1:] {
+		value := func(name string) string {
+			if columns[name] >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[columns[name]])
+		}
+		rate, err := strconv.ParseFloat(value("rate"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: invalid rate %q", i+2, value("rate"))
+		}
+		rates = append(rates, Rate{Date: value("date"), Base: Normalize(value("base")), Quote: Normalize(value("quote")), Rate: rate})
+	}
+
+	collection, err := app.FindCollectionByNameOrId("exchange_rates")
+	if err != nil {
+		return 0, err
+	}
+	err = app.RunInTransaction(func(txApp core.App) error {
+		for i, rate := range rates {
+			record, err := txApp.FindFirstRecordByFilter("exchange_rates", "date = {:date} && base = {:base} && quote = {:quote}", dbx.Params{
+				"date":  rate.Date,
+				"base":  rate.Base,
+				"quote": rate.Quote,
+			})
+			if err != nil {
+				record = core.NewRecord(collection)
+			}
+			record.Set("date", rate.Date)
+			record.Set("base", rate.Base)
+			record.Set("quote", rate.Quote)
+			record.Set("rate", rate.Rate)
+			record.Set("source", source)
+			if err := validateRate(record); err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+			if err := txApp.SaveWithContext(ctx, record); err != nil {
+				return fmt.Errorf("line %d: %w", i+2, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import "net/http"
+
+// Error catalogue - codes are stable and used by the frontend as translation keys, never rename them
+
+// Generic
+var (
+	ErrRequestInfo = NewDomainError("REQUEST_INFO_FAILED", http.StatusBadRequest, "Failed to get request info")
+	ErrInternal    = NewDomainError("INTERNAL_ERROR", http.StatusInternalServerError, "Something went wrong while processing your request")
+)
+
+// Companies
+var (
+	ErrCompanyAuthRequired       = NewDomainError("COMPANY_AUTH_REQUIRED", http.StatusForbidden, "No authenticated user for company creation")
+	ErrCompanyOwnerCreateFailed  = NewDomainError("COMPANY_OWNER_CREATE_FAILED", http.StatusInternalServerError, "Has error occurred during create company")
+	ErrCompanyAddressInvalid     = NewDomainError("COMPANY_ADDRESS_INVALID", http.StatusBadRequest, "Invalid JSON structure for 'address'")
+	ErrCompanyAddressIncomplete  = NewDomainError("COMPANY_ADDRESS_INCOMPLETE", http.StatusBadRequest, "Missing required subfields in 'address'")
+	ErrCompanyAddressCoordinates = NewDomainError("COMPANY_ADDRESS_INVALID_COORDINATES", http.StatusUnprocessableEntity, "Invalid coordinates in 'address'")
+	ErrCompanyRoleRequired       = NewDomainError("COMPANY_ROLE_REQUIRED", http.StatusForbidden, "Your role in the company does not allow this action")
+)
+
+// Invoices
+var (
+	ErrInvoiceMetadataMissing   = NewDomainError("INVOICE_METADATA_MISSING", http.StatusBadRequest, "Missing metadata field")
+	ErrInvoiceMetadataInvalid   = NewDomainError("INVOICE_METADATA_INVALID", http.StatusBadRequest, "Invalid metadata field")
+	ErrInvoiceContentInvalid    = NewDomainError("INVOICE_CONTENT_INVALID", http.StatusUnprocessableEntity, "Invoice content values must be strings")
+	ErrInvoiceCompanyRequired   = NewDomainError("INVOICE_COMPANY_REQUIRED", http.StatusBadRequest, "Missing or invalid 'companyID'")
+	ErrInvoiceUserRequired      = NewDomainError("INVOICE_USER_REQUIRED", http.StatusBadRequest, "Missing or invalid 'userID'")
+	ErrInvoiceCompanyNotFound   = NewDomainError("INVOICE_COMPANY_NOT_FOUND", http.StatusNotFound, "Company of the invoice not found")
+	ErrInvoiceUserNotFound      = NewDomainError("INVOICE_USER_NOT_FOUND", http.StatusNotFound, "User of the invoice not found")
+	ErrInvoiceLogoUnavailable   = NewDomainError("INVOICE_LOGO_UNAVAILABLE", http.StatusBadGateway, "Failed fetch company logo while generating invoice")
+	ErrInvoicePDFFailed         = NewDomainError("INVOICE_PDF_FAILED", http.StatusInternalServerError, "Failed while generate PDF invoice")
+	ErrInvoiceAttributesFailed  = NewDomainError("INVOICE_ATTRIBUTES_INVALID", http.StatusBadRequest, "Failed while convert invoice attributes")
+	ErrInvoiceSendInvalid       = NewDomainError("INVOICE_SEND_INVALID", http.StatusBadRequest, "Invalid invoice recipients")
+	ErrInvoiceSendForbidden     = NewDomainError("INVOICE_SEND_FORBIDDEN", http.StatusForbidden, "Only company owners and admins can send invoices")
+	ErrInvoiceDocumentMissing   = NewDomainError("INVOICE_DOCUMENT_MISSING", http.StatusConflict, "The invoice has no PDF to send")
+	ErrInvoiceSendFailed        = NewDomainError("INVOICE_SEND_FAILED", http.StatusBadGateway, "Failed to email the invoice")
+	ErrInvoiceTermsInvalid      = NewDomainError("INVOICE_TERMS_INVALID", http.StatusBadRequest, "Invalid payment terms")
+	ErrRecurringInvoiceInvalid  = NewDomainError("RECURRING_INVOICE_INVALID", http.StatusBadRequest, "Invalid recurring invoice")
+	ErrInvoiceCurrencyInvalid   = NewDomainError("INVOICE_CURRENCY_INVALID", http.StatusBadRequest, "Unsupported currency")
+	ErrInvoiceIssuedLocked      = NewDomainError("INVOICE_ISSUED_LOCKED", http.StatusConflict, "The amounts of an issued invoice cannot change")
+	ErrBaseCurrencyLocked       = NewDomainError("BASE_CURRENCY_LOCKED", http.StatusConflict, "The base currency cannot change once invoices were issued")
+	ErrExchangeRateMissing      = NewDomainError("EXCHANGE_RATE_MISSING", http.StatusUnprocessableEntity, "No exchange rate to the company base currency")
+	ErrExchangeRateInvalid      = NewDomainError("EXCHANGE_RATE_INVALID", http.StatusBadRequest, "Invalid exchange rate")
+	ErrCreditNoteInvalid        = NewDomainError("CREDIT_NOTE_INVALID", http.StatusBadRequest, "Invalid credit note")
+	ErrCreditNoteExceedsInvoice = NewDomainError("CREDIT_NOTE_EXCEEDS_INVOICE", http.StatusConflict, "The credit notes exceed the invoice total")
+	ErrEInvoiceInvalid          = NewDomainError("EINVOICE_INVALID", http.StatusUnprocessableEntity, "The e-invoice does not conform to Peppol BIS Billing 3.0 A-NZ")
+)
+
+// Jobs
+var (
+	ErrJobStatusUnknown      = NewDomainError("JOB_STATUS_UNKNOWN", http.StatusBadRequest, "Unknown job status")
+	ErrJobTransitionInvalid  = NewDomainError("JOB_TRANSITION_INVALID", http.StatusConflict, "Job status change is not allowed")
+	ErrJobPreconditionFailed = NewDomainError("JOB_PRECONDITION_FAILED", http.StatusUnprocessableEntity, "Job does not meet the requirements of the new status")
+	ErrJobTransitionFailed   = NewDomainError("JOB_TRANSITION_FAILED", http.StatusInternalServerError, "Failed to change job status")
+	ErrJobSearchInvalid      = NewDomainError("JOB_SEARCH_INVALID", http.StatusBadRequest, "Invalid job search parameters")
+	ErrJobSearchFailed       = NewDomainError("JOB_SEARCH_FAILED", http.StatusInternalServerError, "Failed to search jobs")
+	ErrJobSkillsInvalid      = NewDomainError("JOB_SKILLS_INVALID", http.StatusBadRequest, "Invalid job required skills")
+	ErrScheduleInvalid       = NewDomainError("SCHEDULE_INVALID", http.StatusBadRequest, "Invalid job schedule")
+	ErrScheduleSyncFailed    = NewDomainError("SCHEDULE_SYNC_FAILED", http.StatusInternalServerError, "Failed to generate the scheduled shifts")
+)
+
+// Job applications
+var (
+	ErrApplicationStatusUnknown     = NewDomainError("APPLICATION_STATUS_UNKNOWN", http.StatusBadRequest, "Unknown job member status")
+	ErrApplicationTransitionInvalid = NewDomainError("APPLICATION_TRANSITION_INVALID", http.StatusConflict, "Job member status change is not allowed")
+	ErrApplicationForbidden         = NewDomainError("APPLICATION_FORBIDDEN", http.StatusForbidden, "Not allowed to change this application")
+	ErrApplicationJobNotHiring      = NewDomainError("APPLICATION_JOB_NOT_HIRING", http.StatusConflict, "The job is not hiring")
+	ErrApplicationDuplicate         = NewDomainError("APPLICATION_DUPLICATE", http.StatusConflict, "The worker already applied to this job")
+	ErrApplicationOfferExpired      = NewDomainError("APPLICATION_OFFER_EXPIRED", http.StatusConflict, "The offer has expired")
+	ErrApplicationFailed            = NewDomainError("APPLICATION_FAILED", http.StatusInternalServerError, "Failed to update the application")
+	ErrJobFull                      = NewDomainError("JOB_FULL", http.StatusConflict, "The job has reached its headcount")
+)
+
+// Workers
+var (
+	ErrWorkerProfileInvalid     = NewDomainError("WORKER_PROFILE_INVALID", http.StatusBadRequest, "Invalid worker profile")
+	ErrCredentialInvalid        = NewDomainError("CREDENTIAL_INVALID", http.StatusBadRequest, "Invalid licence or certificate")
+	ErrWorkerCredentialsMissing = NewDomainError("WORKER_CREDENTIALS_MISSING", http.StatusUnprocessableEntity, "The worker lacks valid credentials required by the job")
+	ErrCredentialCheckFailed    = NewDomainError("CREDENTIAL_CHECK_FAILED", http.StatusInternalServerError, "Failed to check the worker credentials")
+	ErrAvailabilityInvalid      = NewDomainError("AVAILABILITY_INVALID", http.StatusBadRequest, "Invalid availability window")
+	ErrShiftConflict            = NewDomainError("SHIFT_CONFLICT", http.StatusConflict, "The worker is not available for the job shifts")
+	ErrAvailabilityCheckFailed  = NewDomainError("AVAILABILITY_CHECK_FAILED", http.StatusInternalServerError, "Failed to check the worker availability")
+)
+
+// Matching
+var (
+	ErrMatchingForbidden = NewDomainError("MATCHING_FORBIDDEN", http.StatusForbidden, "Only company owners and admins can see recommendations")
+	ErrMatchingFailed    = NewDomainError("MATCHING_FAILED", http.StatusInternalServerError, "Failed to compute recommendations")
+)
+
+// Rosters
+var (
+	ErrRosterInvalid   = NewDomainError("ROSTER_INVALID", http.StatusBadRequest, "Invalid roster parameters")
+	ErrRosterForbidden = NewDomainError("ROSTER_FORBIDDEN", http.StatusForbidden, "Only company members can see the roster")
+	ErrRosterFailed    = NewDomainError("ROSTER_FAILED", http.StatusInternalServerError, "Failed to build the roster")
+	ErrRosterPDFFailed = NewDomainError("ROSTER_PDF_FAILED", http.StatusInternalServerError, "Failed to generate the roster PDF")
+)
+
+// Payroll
+var (
+	ErrPayslipInvalid   = NewDomainError("PAYSLIP_INVALID", http.StatusBadRequest, "Invalid pay period")
+	ErrPayslipForbidden = NewDomainError("PAYSLIP_FORBIDDEN", http.StatusForbidden, "Only company owners, admins and payroll officers can generate payslips")
+	ErrPayslipFailed    = NewDomainError("PAYSLIP_FAILED", http.StatusInternalServerError, "Failed to generate the payslips")
+)
+
+// Notifications
+var (
+	ErrNotificationPreferencesInvalid = NewDomainError("NOTIFICATION_PREFERENCES_INVALID", http.StatusBadRequest, "Invalid notification preferences")
+)
+
+// Webhooks
+var (
+	ErrWebhookEndpointInvalid = NewDomainError("WEBHOOK_ENDPOINT_INVALID", http.StatusBadRequest, "Invalid webhook endpoint")
+	ErrWebhookForbidden       = NewDomainError("WEBHOOK_FORBIDDEN", http.StatusForbidden, "Only company owners and admins can manage webhooks")
+	ErrWebhookRedeliverFailed = NewDomainError("WEBHOOK_REDELIVER_FAILED", http.StatusInternalServerError, "Failed to redeliver the webhook")
+)
+
+// Accounting exports
+var (
+	ErrAccountingCodesInvalid  = NewDomainError("ACCOUNTING_CODES_INVALID", http.StatusBadRequest, "Invalid accounting codes")
+	ErrAccountingExportInvalid = NewDomainError("ACCOUNTING_EXPORT_INVALID", http.StatusBadRequest, "Invalid accounting export")
+	ErrAccountingForbidden     = NewDomainError("ACCOUNTING_FORBIDDEN", http.StatusForbidden, "Only company owners and admins can export accounting documents")
+	ErrAccountingExportFailed  = NewDomainError("ACCOUNTING_EXPORT_FAILED", http.StatusInternalServerError, "Failed to export the accounting documents")
+)
+
+// Reports
+var (
+	ErrReportFetchFailed = NewDomainError("REPORT_FETCH_FAILED", http.StatusInternalServerError, "Failed to fetch report data")
+	ErrReportSaveFailed  = NewDomainError("REPORT_SAVE_FAILED", http.StatusInternalServerError, "Failed to save report")
+)
+
+// Archive
+var (
+	ErrRecordNotFound         = NewDomainError("RECORD_NOT_FOUND", http.StatusNotFound, "Record not found")
+	ErrArchiveFailed          = NewDomainError("ARCHIVE_FAILED", http.StatusInternalServerError, "Failed to archive record")
+	ErrRestoreNotSupported    = NewDomainError("RESTORE_NOT_SUPPORTED", http.StatusNotFound, "Collection does not support restore")
+	ErrRestoreNotArchived     = NewDomainError("RESTORE_NOT_ARCHIVED", http.StatusConflict, "Only archived records can be restored")
+	ErrRestoreForbidden       = NewDomainError("RESTORE_FORBIDDEN", http.StatusForbidden, "Not allowed to restore this record")
+	ErrRestoreCompanyArchived = NewDomainError("RESTORE_COMPANY_ARCHIVED", http.StatusConflict, "Restore the company before restoring its records")
+	ErrRestoreFailed          = NewDomainError("RESTORE_FAILED", http.StatusInternalServerError, "Failed to restore record")
+)
+
+// Audit
+var (
+	ErrAuditForbidden   = NewDomainError("AUDIT_FORBIDDEN", http.StatusForbidden, "Only company owners and admins can read audit logs")
+	ErrAuditFetchFailed = NewDomainError("AUDIT_FETCH_FAILED", http.StatusInternalServerError, "Failed to fetch audit logs")
+	ErrAuditWriteFailed = NewDomainError("AUDIT_WRITE_FAILED", http.StatusInternalServerError, "Failed to write the audit log, the change was not saved")
+)
@@ -1,8 +1,20 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+	"github.com/pocketbase/pocketbase/tools/router"
 )
 
 var errHandler *ErrorHandler
@@ -12,71 +24,256 @@ type ErrorHandler struct {
 	app *pocketbase.PocketBase
 }
 
+// DomainError - Typed API error with a stable machine readable code, see catalogue.go
+type DomainError struct {
+	Code    string
+	Status  int
+	Message string
+	Params  map[string]any
+	Data    map[string]any
+	cause   error
+}
+
+// ErrorResponse - JSON body of every API error
+type ErrorResponse struct {
+	Status    int            `json:"status"`
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Params    map[string]any `json:"params,omitempty"`
+	Data      map[string]any `json:"data"`
+	RequestID string         `json:"requestId,omitempty"`
+}
+
+// NewDomainError - Catalogue entry
+func NewDomainError(code string, status int, message string) *DomainError {
+	return &DomainError{Code: code, Status: status, Message: message}
+}
+
+func (e *DomainError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.cause)
+	}
+	return e.Code + ": " + e.Message
+}
+
+// Unwrap - Cause of the error, keeps errors.Is(err, sql.ErrNoRows) working
+func (e *DomainError) Unwrap() error {
+	return e.cause
+}
+
+// Is - Errors with the same code are equal, so errors.Is(err, ErrInvoiceCompanyNotFound) works on copies
+func (e *DomainError) Is(target error) bool {
+	t, ok := target.(*DomainError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap - Copy with the underlying cause, logged but never exposed
+func (e *DomainError) Wrap(cause error) *DomainError {
+	c := e.clone()
+	c.cause = cause
+	return c
+}
+
+// WithParams - Copy with key/value parameters the frontend can use to localise the message
+func (e *DomainError) WithParams(kv ...any) *DomainError {
+	c := e.clone()
+	if c.Params == nil {
+		c.Params = map[string]any{}
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		c.Params[fmt.Sprint(kv[i])] = kv[i+1]
+	}
+	return c
+}
+
+// WithField - Copy with a field level validation error, same format as PocketBase "data"
+func (e *DomainError) WithField(field string, err validation.Error) *DomainError {
+	c := e.clone()
+	if c.Data == nil {
+		c.Data = map[string]any{}
+	}
+	c.Data[field] = map[string]any{"code": err.Code(), "message": err.Error()}
+	return c
+}
+
+// WithMessage - Copy with a more specific message, the code stays the same
+func (e *DomainError) WithMessage(message string) *DomainError {
+	c := e.clone()
+	c.Message = message
+	return c
+}
+
+func (e *DomainError) clone() *DomainError {
+	c := *e
+	c.Params = maps.Clone(e.Params)
+	c.Data = maps.Clone(e.Data)
+	return &c
+}
+
+// Response - JSON body for the error
+func (e *DomainError) Response(requestID string) ErrorResponse {
+	data := e.Data
+	if data == nil {
+		data = map[string]any{}
+	}
+	return ErrorResponse{
+		Status:    e.Status,
+		Code:      e.Code,
+		Message:   e.Message,
+		Params:    e.Params,
+		Data:      data,
+		RequestID: requestID,
+	}
+}
+
 // NewErrorHandler - ErrorHandler instance
 func NewErrorHandler(app *pocketbase.PocketBase) *ErrorHandler {
 	return &ErrorHandler{app: app}
 }
 
-// LogError - Custom errors
-func (h *ErrorHandler) Error(status int, message string, errData interface{}, attrs ...interface{}) error {
-	logAttrs := append([]interface{}{"status", status}, attrs...)
-	if errData != nil {
-		logAttrs = append(logAttrs, "data", errData)
+// Error - Log and build an error for any 4xx/5xx status, with the generic code of the status
+func (h *ErrorHandler) Error(ctx context.Context, status int, message string, errData interface{}, attrs ...interface{}) error {
+	err := statusError(status).WithMessage(message)
+	if cause, ok := errData.(error); ok {
+		err = err.Wrap(cause)
+	} else if errData != nil && errData != "" {
+		attrs = append(attrs, "data", errData)
+	}
+	return fail(ctx, 3, err, attrs...)
+}
+
+// Fail - Log the domain error with the caller as source and return it
+func Fail(ctx context.Context, err *DomainError, attrs ...interface{}) error {
+	return fail(ctx, 2, err, attrs...)
+}
+
+func fail(ctx context.Context, skip int, err *DomainError, attrs ...interface{}) error {
+	logAttrs := append([]interface{}{"status", err.Status, "code", err.Code}, attrs...)
+	if len(err.Params) > 0 {
+		logAttrs = append(logAttrs, "params", err.Params)
+	}
+	if err.cause != nil {
+		logAttrs = append(logAttrs, "error", err.cause)
 	}
 
-	switch status {
-	case 400, 401, 403, 404:
-		LogWarn(message, logAttrs...) // Usa a função LogWarn do mesmo pacote
-	case 500:
-		LogError(nil, message, logAttrs...) // Usa a função LogError do mesmo pacote
+	switch {
+	case err.Status >= 400 && err.Status < 500:
+		logAt(ctx, skip, slog.LevelWarn, err.Message, logAttrs...)
+	case err.Status >= 500 && err.Status < 600:
+		logAt(ctx, skip, slog.LevelError, err.Message, logAttrs...)
 	default:
-		LogError(nil, "Unknown error status", append(logAttrs, "originalMessage", message)...)
+		logAt(ctx, skip, slog.LevelError, "Unknown error status", append(logAttrs, "originalMessage", err.Message)...)
 	}
-	return apis.NewApiError(status, message, errData)
+	return err
 }
 
-// InitErrorHandler - global component
+// statusError - Generic catalogue entry of a status, eg. 422 -> UNPROCESSABLE_ENTITY
+func statusError(status int) *DomainError {
+	if status < 400 || status > 599 {
+		status = http.StatusInternalServerError
+	}
+	text := http.StatusText(status)
+	if text == "" {
+		text = fmt.Sprintf("Error %d", status)
+	}
+	code := strings.ToUpper(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+	return NewDomainError(code, status, text)
+}
+
+// InitErrorHandler - global component, renders every API error as ErrorResponse
 func InitErrorHandler(app *pocketbase.PocketBase) {
 	errHandler = NewErrorHandler(app)
-	LogInfo("ErrorHandler initialized")
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+			Id: "hirevoErrors",
+			// inside the request ID middleware so the response can include it
+			Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 2,
+			Func: func(e *core.RequestEvent) error {
+				err := e.Next()
+				if err == nil || e.Written() {
+					return err
+				}
+				return renderError(e, err)
+			},
+		})
+		return se.Next()
+	})
+
+	LogInfo(context.Background(), "ErrorHandler initialized")
+}
+
+func renderError(e *core.RequestEvent, err error) error {
+	domainErr := asDomainError(err)
+	if domainErr == nil {
+		// PocketBase errors keep their message and field data
+		apiErr := router.ToApiError(err)
+		domainErr = statusError(apiErr.Status).WithMessage(apiErr.Message)
+		domainErr.Data = apiErr.Data
+	}
+	return e.JSON(domainErr.Status, domainErr.Response(RequestID(e.Request.Context())))
+}
+
+// asDomainError find the DomainError of err, also when PocketBase wrapped a hook error
+// into its own ApiError (eg. "Failed to create record.")
+func asDomainError(err error) *DomainError {
+	var domainErr *DomainError
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+	var apiErr *router.ApiError
+	if errors.As(err, &apiErr) {
+		if raw, ok := apiErr.RawData().(error); ok && errors.As(raw, &domainErr) {
+			return domainErr
+		}
+	}
+	return nil
 }
 
 // BadRequestError - Validations
-func BadRequestError(message string, errData interface{}, attrs ...interface{}) error {
+func BadRequestError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
 	if errHandler == nil {
 		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
 	}
-	return errHandler.Error(400, message, errData, attrs...)
+	return errHandler.Error(ctx, 400, message, errData, attrs...)
 }
 
 // UnauthorizedError - Invalid credentials
-func UnauthorizedError(message string, errData interface{}, attrs ...interface{}) error {
+func UnauthorizedError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
 	if errHandler == nil {
 		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
 	}
-	return errHandler.Error(401, message, errData, attrs...)
+	return errHandler.Error(ctx, 401, message, errData, attrs...)
 }
 
 // ForbiddenError - User not authorized
-func ForbiddenError(message string, errData interface{}, attrs ...interface{}) error {
+func ForbiddenError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
 	if errHandler == nil {
 		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
 	}
-	return errHandler.Error(403, message, errData, attrs...)
+	return errHandler.Error(ctx, 403, message, errData, attrs...)
 }
 
 // NotFoundError - Resource not found
-func NotFoundError(message string, errData interface{}, attrs ...interface{}) error {
+func NotFoundError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
+	if errHandler == nil {
+		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
+	}
+	return errHandler.Error(ctx, 404, message, errData, attrs...)
+}
+
+// ConflictError - Resource state does not allow the operation
+func ConflictError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
 	if errHandler == nil {
 		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
 	}
-	return errHandler.Error(404, message, errData, attrs...)
+	return errHandler.Error(ctx, 409, message, errData, attrs...)
 }
 
 // InternalServerError - Internal errors (database, unknown exceptions)
-func InternalServerError(message string, errData interface{}, attrs ...interface{}) error {
+func InternalServerError(ctx context.Context, message string, errData interface{}, attrs ...interface{}) error {
 	if errHandler == nil {
 		return apis.NewApiError(500, "ErrorHandler not initialized", nil)
 	}
-	return errHandler.Error(500, message, errData, attrs...)
+	return errHandler.Error(ctx, 500, message, errData, attrs...)
 }
@@ -1,44 +1,170 @@
 package handlers
 
 import (
+	"context"
+	"hirevo/internal/config"
+	"io"
 	"log/slog"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/pocketbase/pocketbase"
 )
 
-var log *slog.Logger
+var log = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
-func InitLogger(app *pocketbase.PocketBase) {
-	log = app.Logger()
+// InitLogger build the logger from cfg, fanning out to stdout, a rotating file and/or PocketBase _logs
+func InitLogger(app *pocketbase.PocketBase, cfg config.LogConfig) error {
+	outputs := make([]slog.Handler, 0, len(cfg.Outputs))
+	for _, output := range cfg.Outputs {
+		switch output {
+		case config.LogOutputStdout:
+			outputs = append(outputs, newFormatHandler(os.Stdout, cfg.Format))
+		case config.LogOutputFile:
+			file, err := newRotatingFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)*1024*1024, cfg.File.MaxBackups)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, newFormatHandler(file, cfg.Format))
+		case config.LogOutputPocketBase:
+			outputs = append(outputs, &pocketbaseHandler{app: app})
+		}
+	}
 
-	consoleHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+	minLevel := cfg.Level
+	for _, level := range cfg.PackageLevels {
+		minLevel = min(minLevel, level)
+	}
+
+	log = slog.New(&requestHandler{
+		Handler: &levelHandler{
+			Handler:  &redactHandler{Handler: &fanoutHandler{handlers: outputs}, keys: cfg.RedactKeys},
+			level:    cfg.Level,
+			minLevel: minLevel,
+			packages: cfg.PackageLevels,
+		},
 	})
-	log = slog.New(consoleHandler)
 
-	log.Info("Custom log initialized")
+	log.Info("Custom log initialized", "level", cfg.Level.String(), "format", cfg.Format, "outputs", cfg.Outputs)
+	return nil
+}
+
+func newFormatHandler(w io.Writer, format string) slog.Handler {
+	// levels are filtered by levelHandler, outputs accept everything they receive
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+	if format == config.LogFormatText {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// requestHandler add the request ID of the context to every record
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h *requestHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("requestId", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *requestHandler) WithGroup(name string) slog.Handler {
+	return &requestHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// levelHandler apply the global level and the per package overrides
+type levelHandler struct {
+	slog.Handler
+	level    slog.Level
+	minLevel slog.Level
+	packages map[string]slog.Level
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.minLevel
+}
+
+func (h *levelHandler) Handle(ctx context.Context, record slog.Record) error {
+	if record.Level < h.levelFor(record.PC) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level, minLevel: h.minLevel, packages: h.packages}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level, minLevel: h.minLevel, packages: h.packages}
+}
+
+// levelFor match overrides by full package path ("hirevo/internal/invoice") or package name ("invoice")
+func (h *levelHandler) levelFor(pc uintptr) slog.Level {
+	if len(h.packages) == 0 || pc == 0 {
+		return h.level
+	}
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	pkg := frame.Function
+	if slash := strings.LastIndex(pkg, "/"); slash >= 0 {
+		if dot := strings.Index(pkg[slash:], "."); dot >= 0 {
+			pkg = pkg[:slash+dot]
+		}
+	} else if dot := strings.Index(pkg, "."); dot >= 0 {
+		pkg = pkg[:dot]
+	}
+
+	if level, ok := h.packages[strings.ToLower(pkg)]; ok {
+		return level
+	}
+	if level, ok := h.packages[strings.ToLower(pkg[strings.LastIndex(pkg, "/")+1:])]; ok {
+		return level
+	}
+	return h.level
+}
+
+// logAt write the record with the caller skip frames above, so package overrides see the real caller
+func logAt(ctx context.Context, skip int, level slog.Level, msg string, attrs ...interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !log.Enabled(ctx, level) {
+		return
+	}
+	var pcs [1]uintptr
+	runtime.Callers(skip+2, pcs[:])
+	record := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	record.Add(attrs...)
+	_ = log.Handler().Handle(ctx, record)
 }
 
 // LogInfo message
-func LogInfo(msg string, attrs ...interface{}) {
-	log.Info(msg, attrs...)
+func LogInfo(ctx context.Context, msg string, attrs ...interface{}) {
+	logAt(ctx, 1, slog.LevelInfo, msg, attrs...)
 }
 
 // LogWarn message
-func LogWarn(msg string, attrs ...interface{}) {
-	log.Warn(msg, attrs...)
+func LogWarn(ctx context.Context, msg string, attrs ...interface{}) {
+	logAt(ctx, 1, slog.LevelWarn, msg, attrs...)
 }
 
 // LogError message
-func LogError(err error, msg string, attrs ...interface{}) {
+func LogError(ctx context.Context, err error, msg string, attrs ...interface{}) {
 	attrs = append(attrs, "error", err)
-	log.Error(msg, attrs...)
+	logAt(ctx, 1, slog.LevelError, msg, attrs...)
 }
 
 // LogDebug message
-func LogDebug(msg string, attrs ...interface{}) {
-	log.Debug(msg, attrs...)
+func LogDebug(ctx context.Context, msg string, attrs ...interface{}) {
+	logAt(ctx, 1, slog.LevelDebug, msg, attrs...)
 }
 
 // LogWith attributes message
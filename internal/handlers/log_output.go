@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+)
+
+// fanoutHandler forward every record to all the configured outputs
+type fanoutHandler struct {
+	handlers []slog.Handler
+}
+
+func (h *fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h.handlers {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return &fanoutHandler{handlers: handlers}
+}
+
+func (h *fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make([]slog.Handler, len(h.handlers))
+	for i, handler := range h.handlers {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return &fanoutHandler{handlers: handlers}
+}
+
+// pocketbaseHandler write to the PocketBase _logs store, available only once the app is bootstrapped
+type pocketbaseHandler struct {
+	app *pocketbase.PocketBase
+	ops []func(slog.Handler) slog.Handler
+}
+
+func (h *pocketbaseHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *pocketbaseHandler) Handle(ctx context.Context, record slog.Record) error {
+	if !h.app.IsBootstrapped() {
+		return nil
+	}
+	handler := h.app.Logger().Handler()
+	for _, op := range h.ops {
+		handler = op(handler)
+	}
+	if !handler.Enabled(ctx, record.Level) {
+		return nil
+	}
+	return handler.Handle(ctx, record)
+}
+
+func (h *pocketbaseHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *pocketbaseHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+func (h *pocketbaseHandler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	ops := append(append([]func(slog.Handler) slog.Handler{}, h.ops...), op)
+	return &pocketbaseHandler{app: h.app, ops: ops}
+}
+
+// rotatingFile rename the file to path.1, path.2... once it reaches maxSize
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size+int64(len(p)) > f.maxSize && f.size > 0 {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+
+	// shift path.N-1 -> path.N, the oldest backup is overwritten
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", f.path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", f.path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+const redacted = "[REDACTED]"
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// redactHandler mask sensitive attributes (by key) and email addresses (by value)
+type redactHandler struct {
+	slog.Handler
+	keys []string
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	clean := slog.NewRecord(record.Time, record.Level, emailPattern.ReplaceAllString(record.Message, redacted), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		clean.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, clean)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clean := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		clean[i] = h.redactAttr(attr)
+	}
+	return &redactHandler{Handler: h.Handler.WithAttrs(clean), keys: h.keys}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name), keys: h.keys}
+}
+
+func (h *redactHandler) isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range h.keys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *redactHandler) redactAttr(attr slog.Attr) slog.Attr {
+	if h.isSensitive(attr.Key) {
+		return slog.String(attr.Key, redacted)
+	}
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, emailPattern.ReplaceAllString(value.String(), redacted))
+	case slog.KindGroup:
+		group := value.Group()
+		clean := make([]any, len(group))
+		for i, item := range group {
+			clean[i] = h.redactAttr(item)
+		}
+		return slog.Group(attr.Key, clean...)
+	case slog.KindAny:
+		return slog.Any(attr.Key, h.redactValue(value.Any()))
+	}
+	return attr
+}
+
+// redactValue walk the maps commonly logged by the hooks (metadata, address, content)
+func (h *redactHandler) redactValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return emailPattern.ReplaceAllString(v, redacted)
+	case map[string]string:
+		clean := make(map[string]string, len(v))
+		for key, item := range v {
+			if h.isSensitive(key) {
+				clean[key] = redacted
+			} else {
+				clean[key] = emailPattern.ReplaceAllString(item, redacted)
+			}
+		}
+		return clean
+	case map[string]any:
+		clean := make(map[string]any, len(v))
+		for key, item := range v {
+			if h.isSensitive(key) {
+				clean[key] = redacted
+			} else {
+				clean[key] = h.redactValue(item)
+			}
+		}
+		return clean
+	case error:
+		return emailPattern.ReplaceAllString(v.Error(), redacted)
+	}
+	return value
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"sync"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/hook"
+)
+
+// RequestIDHeader is read from incoming requests and written on every response
+const RequestIDHeader = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestScope identify the request that triggered some work
+type RequestScope struct {
+	ID              string
+	IP              string
+	ActorID         string
+	ActorCollection string
+}
+
+type scopeKey struct{}
+
+// trackedRecords hold the scope of records being saved by an API request
+var trackedRecords sync.Map
+
+// InitRequestID - assign/propagate X-Request-ID and keep the request scope in the request context
+func InitRequestID(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.Bind(&hook.Handler[*core.RequestEvent]{
+			Id: "hirevoRequestID",
+			// after the auth token is loaded so the actor is known
+			Priority: apis.DefaultLoadAuthTokenMiddlewarePriority + 1,
+			Func: func(e *core.RequestEvent) error {
+				scope := RequestScope{
+					ID: e.Request.Header.Get(RequestIDHeader),
+					IP: e.RealIP(),
+				}
+				if !validRequestID.MatchString(scope.ID) {
+					scope.ID = newRequestID()
+				}
+				if e.Auth != nil {
+					scope.ActorID = e.Auth.Id
+					scope.ActorCollection = e.Auth.Collection().Name
+				}
+
+				e.Response.Header().Set(RequestIDHeader, scope.ID)
+				e.Request = e.Request.WithContext(WithScope(e.Request.Context(), scope))
+				return e.Next()
+			},
+		})
+		return se.Next()
+	})
+
+	// record request hooks run before any other so the model hooks can find the request
+	for _, h := range []*hook.TaggedHook[*core.RecordRequestEvent]{
+		app.OnRecordCreateRequest(),
+		app.OnRecordUpdateRequest(),
+		app.OnRecordDeleteRequest(),
+	} {
+		h.Bind(&hook.Handler[*core.RecordRequestEvent]{
+			Priority: -100,
+			Func: func(e *core.RecordRequestEvent) error {
+				defer TrackRecord(e.Request.Context(), e.Record)()
+				return e.Next()
+			},
+		})
+	}
+}
+
+// WithScope return a copy of ctx carrying the request scope
+func WithScope(ctx context.Context, scope RequestScope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, scope)
+}
+
+// ScopeFromContext return the request scope stored in ctx, if any
+func ScopeFromContext(ctx context.Context) (RequestScope, bool) {
+	if ctx == nil {
+		return RequestScope{}, false
+	}
+	scope, ok := ctx.Value(scopeKey{}).(RequestScope)
+	return scope, ok
+}
+
+// RequestID return the request ID stored in ctx or an empty string
+func RequestID(ctx context.Context) string {
+	scope, _ := ScopeFromContext(ctx)
+	return scope.ID
+}
+
+// TrackRecord bind the request scope of ctx to record until the returned func is called
+func TrackRecord(ctx context.Context, record *core.Record) func() {
+	scope, ok := ScopeFromContext(ctx)
+	if !ok {
+		return func() {}
+	}
+	trackedRecords.Store(record, scope)
+	return func() {
+		trackedRecords.Delete(record)
+	}
+}
+
+// RecordContext return the context of a model event including the scope of the request that saved the record
+func RecordContext(e *core.RecordEvent) context.Context {
+	ctx := e.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ScopeFromContext(ctx); ok {
+		return ctx
+	}
+	if scope, ok := trackedRecords.Load(e.Record); ok {
+		return WithScope(ctx, scope.(RequestScope))
+	}
+	return ctx
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
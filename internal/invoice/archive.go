@@ -0,0 +1,67 @@
+package invoice
+
+import (
+	"encoding/json"
+	"hirevo/internal/currency"
+	"hirevo/internal/jobs"
+	pdfgenerator "hirevo/services/pdf"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// InvoiceData machine-readable data of an invoice that is not an e-invoice, embedded in its PDF
+type InvoiceData struct {
+	Number       string            `json:"number"`
+	IssueDate    string            `json:"issueDate"`
+	DueDate      string            `json:"dueDate,omitempty"`
+	Total        currency.Money    `json:"total"`
+	Currency     string            `json:"currency"`
+	BaseTotal    currency.Money    `json:"baseTotal"`
+	BaseCurrency string            `json:"baseCurrency"`
+	Content      map[string]string `json:"content"`
+}
+
+// invoiceAttachment file embedded in the PDF/A-3 of the invoice: the UBL document of an e-invoice,
+// an alternative of the PDF, else the invoice data as JSON with the issue date of the e-invoices
+func invoiceAttachment(invoice *core.Record, content map[string]string, ubl []byte, issued time.Time) (pdfgenerator.Attachment, error) {
+	if ubl != nil {
+		return pdfgenerator.Attachment{
+			Name:         "invoice.xml",
+			MimeType:     "application/xml",
+			Description:  "Peppol BIS Billing 3.0 A-NZ invoice " + Number(invoice),
+			Relationship: pdfgenerator.RelationshipAlternative,
+			Content:      ubl,
+		}, nil
+	}
+
+	loc, err := time.LoadLocation(jobs.DefaultTimezone)
+	if err != nil {
+		return pdfgenerator.Attachment{}, err
+	}
+	code := currency.Normalize(invoice.GetString("currency"))
+	baseTotal := BaseTotal(invoice)
+	data := InvoiceData{
+		Number:       Number(invoice),
+		IssueDate:    issued.In(loc).Format(time.DateOnly),
+		Total:        currency.New(int64(invoice.GetInt("totalMinor")), code),
+		Currency:     code,
+		BaseTotal:    baseTotal,
+		BaseCurrency: baseTotal.Currency,
+		Content:      content,
+	}
+	if due := invoice.GetDateTime("dueDate"); !due.IsZero() {
+		data.DueDate = due.Time().In(loc).Format(time.DateOnly)
+	}
+	encoded, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return pdfgenerator.Attachment{}, err
+	}
+	return pdfgenerator.Attachment{
+		Name:         "invoice.json",
+		MimeType:     "application/json",
+		Description:  "Invoice " + Number(invoice) + " data",
+		Relationship: pdfgenerator.RelationshipData,
+		Content:      encoded,
+	}, nil
+}
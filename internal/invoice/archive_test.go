@@ -0,0 +1,35 @@
+package invoice
+
+import (
+	"encoding/json"
+	"hirevo/internal/tests"
+	"testing"
+	"time"
+)
+
+func TestInvoiceAttachmentUsesIssueDate(t *testing.T) {
+	app := tests.NewApp(t)
+	user := tests.NewUser(t, app, "worker@example.com")
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	invoice := tests.NewRecord(t, app, "invoices", map[string]any{"companyID": company.Id, "userID": user.Id, "currency": "AUD", "totalMinor": 11000})
+
+	// late on the 1st of March in UTC, already the 2nd in Australia
+	issued := time.Date(2026, time.March, 1, 20, 0, 0, 0, time.UTC)
+	attachment, err := invoiceAttachment(invoice, map[string]string{"Total": "AUD 110.00"}, nil, issued)
+	if err != nil {
+		t.Fatalf("invoice attachment: %v", err)
+	}
+	var data struct {
+		IssueDate string `json:"issueDate"`
+		Currency  string `json:"currency"`
+	}
+	if err := json.Unmarshal(attachment.Content, &data); err != nil {
+		t.Fatalf("decode invoice data: %v", err)
+	}
+	if data.IssueDate != "2026-03-02" {
+		t.Errorf("issueDate = %s, want 2026-03-02", data.IssueDate)
+	}
+	if data.Currency != "AUD" {
+		t.Errorf("currency = %s, want AUD", data.Currency)
+	}
+}
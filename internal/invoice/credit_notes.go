@@ -0,0 +1,70 @@
+package invoice
+
+import (
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// onCreditNoteCreate credit notes take the currency of their invoice and never credit more than its total
+func onCreditNoteCreate(app *pocketbase.PocketBase) {
+	app.OnRecordCreateRequest("credit_notes").BindFunc(func(e *core.RecordRequestEvent) error {
+		if e.Auth != nil && !e.HasSuperuserAuth() {
+			e.Record.Set("issuedBy", e.Auth.Id)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordCreate("credit_notes").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		invoiceID := e.Record.GetString("invoiceID")
+		invoice, err := e.App.FindRecordById("invoices", invoiceID)
+		if err != nil || invoice.GetString("companyID") != e.Record.GetString("companyID") {
+			return handlers.Fail(ctx, handlers.ErrCreditNoteInvalid.WithParams("invoiceID", invoiceID).WithField("invoiceID", validation.NewError(
+				"invalid_invoice",
+				"The invoice must belong to the company",
+			)))
+		}
+
+		total := currency.New(int64(invoice.GetInt("totalMinor")), currency.Normalize(invoice.GetString("currency")))
+		credited, err := CreditedTotal(e.App, invoice)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrInternal.Wrap(err), "invoiceID", invoiceID)
+		}
+		amount := currency.New(int64(e.Record.GetInt("amountMinor")), total.Currency)
+		if amount.Minor <= 0 || credited.Add(amount).Minor > total.Minor {
+			return handlers.Fail(ctx, handlers.ErrCreditNoteExceedsInvoice.WithParams(
+				"invoiceID", invoiceID,
+				"total", total.String(),
+				"credited", credited.String(),
+			).WithField("amountMinor", validation.NewError(
+				"invalid_amount",
+				"The credit notes of an invoice cannot exceed its total",
+			)))
+		}
+		e.Record.Set("currency", total.Currency)
+		return e.Next()
+	})
+}
+
+// CreditedTotal amount already credited on the invoice, in its currency
+func CreditedTotal(app core.App, invoice *core.Record) (currency.Money, error) {
+	credited := struct {
+		Total int64 `db:"total"`
+	}{}
+	err := app.RecordQuery("credit_notes").
+		Select("COALESCE(SUM(amountMinor), 0) AS total").
+		AndWhere(dbx.HashExp{"invoiceID": invoice.Id}).
+		One(&credited)
+	return currency.New(credited.Total, currency.Normalize(invoice.GetString("currency"))), err
+}
+
+// CreditNoteNumber number of a credit note printed on its documents and used by the accounting exports
+func CreditNoteNumber(creditNote *core.Record) string {
+	return "CN-" + strings.ToUpper(creditNote.Id)
+}
@@ -0,0 +1,105 @@
+package invoice
+
+import (
+	"errors"
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// issueFields set when the invoice is issued, they never change afterwards, like the e-invoice options
+var issueFields = []string{"currency", "totalMinor", "baseCurrency", "exchangeRate", "exchangeRateDate", "baseTotalMinor"}
+
+// applyCurrency set the currency of a new invoice, its own else the company base currency, its total in minor units
+// from the "Total" line of the content, and the total in the base currency at the latest rate of the issue day
+func applyCurrency(app core.App, invoice *core.Record, content map[string]string, now time.Time) *handlers.DomainError {
+	base := currency.Base
+	if company, err := app.FindRecordById("companies", invoice.GetString("companyID")); err == nil {
+		base = currency.Normalize(company.GetString("baseCurrency"))
+	}
+	code := base
+	if invoice.GetString("currency") != "" {
+		code = currency.Normalize(invoice.GetString("currency"))
+	}
+	if !currency.Valid(code) {
+		return handlers.ErrInvoiceCurrencyInvalid.WithParams("currency", code).WithField("currency", validation.NewError(
+			"invalid_currency",
+			"Unsupported ISO 4217 currency",
+		))
+	}
+
+	total := currency.Zero(code)
+	if value, ok := content["Total"]; ok {
+		amount, err := currency.Parse(value, code)
+		if err != nil {
+			return handlers.ErrInvoiceMetadataInvalid.Wrap(err).WithField("metadata", validation.NewError(
+				"invalid_total",
+				"The 'Total' content must be an amount",
+			))
+		}
+		total = amount
+	}
+
+	rate, err := currency.FindRate(app, code, base, now)
+	if err != nil {
+		if errors.Is(err, currency.ErrRateNotFound) {
+			return handlers.ErrExchangeRateMissing.Wrap(err).WithParams("currency", code, "baseCurrency", base)
+		}
+		return handlers.ErrInternal.Wrap(err)
+	}
+
+	invoice.Set("currency", code)
+	invoice.Set("totalMinor", total.Minor)
+	invoice.Set("baseCurrency", base)
+	invoice.Set("exchangeRate", rate.Rate)
+	invoice.Set("exchangeRateDate", rate.Date)
+	invoice.Set("baseTotalMinor", total.Convert(base, rate.Rate, currency.RoundHalfEven).Minor)
+	return nil
+}
+
+// BaseTotal total of an invoice in the base currency it was issued with
+func BaseTotal(invoice *core.Record) currency.Money {
+	return currency.New(int64(invoice.GetInt("baseTotalMinor")), currency.Normalize(invoice.GetString("baseCurrency")))
+}
+
+// onCurrencyChange validate the company base currency, locked once invoices were issued in it,
+// and keep the amounts of the issued invoices
+func onCurrencyChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		code := currency.Normalize(e.Record.GetString("baseCurrency"))
+		if !currency.Valid(code) {
+			return handlers.Fail(ctx, handlers.ErrInvoiceCurrencyInvalid.WithParams("currency", code).WithField("baseCurrency", validation.NewError(
+				"invalid_currency",
+				"Unsupported ISO 4217 currency",
+			)))
+		}
+		e.Record.Set("baseCurrency", code)
+		if !e.Record.IsNew() && code != currency.Normalize(e.Record.Original().GetString("baseCurrency")) {
+			issued, err := e.App.CountRecords("invoices", dbx.HashExp{"companyID": e.Record.Id})
+			if err != nil {
+				return handlers.Fail(ctx, handlers.ErrInternal.Wrap(err))
+			}
+			if issued > 0 {
+				return handlers.Fail(ctx, handlers.ErrBaseCurrencyLocked.WithParams("companyID", e.Record.Id))
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("companies").BindFunc(validate)
+	app.OnRecordUpdate("companies").BindFunc(validate)
+
+	app.OnRecordUpdateRequest("invoices").BindFunc(func(e *core.RecordRequestEvent) error {
+		for _, field := range append(issueFields, eInvoiceFields...) {
+			if e.Record.GetString(field) != e.Record.Original().GetString(field) {
+				return handlers.Fail(e.Request.Context(), handlers.ErrInvoiceIssuedLocked.WithParams("field", field))
+			}
+		}
+		return e.Next()
+	})
+}
@@ -1,13 +1,16 @@
 package invoice
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"hirevo/internal/config"
 	"hirevo/internal/handlers"
 	pdfgenerator "hirevo/services/pdf"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/pocketbase/pocketbase"
@@ -15,82 +18,123 @@ import (
 	"github.com/pocketbase/pocketbase/tools/filesystem"
 )
 
-// RegisterHooks fetch, validate and generate invoices
-func RegisterHooks(app *pocketbase.PocketBase) {
-	onGenerateInvoiceRequest(app)
+// RegisterHooks fetch, validate, generate and send invoices, bill the recurring ones, follow up the overdue ones
+// and issue their credit notes
+func RegisterHooks(app *pocketbase.PocketBase, cfg config.InvoicesConfig) {
+	onGenerateInvoiceRequest(app, cfg)
+	onCompanyTermsChange(app)
+	onCurrencyChange(app)
+	onInvoicePaid(app)
+	onCreditNoteCreate(app)
+	onRecurringInvoiceChange(app)
+	registerSendRoutes(app)
+	scheduleOverdue(app, cfg)
+	scheduleRecurring(app)
 }
 
-func onGenerateInvoiceRequest(app *pocketbase.PocketBase) {
+func onGenerateInvoiceRequest(app *pocketbase.PocketBase, cfg config.InvoicesConfig) {
 	app.OnRecordCreate("invoices").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		// the issue time of the invoice, its rate, terms, e-invoice and embedded data all use it
+		issued := time.Now()
 		// Extract metadata attribute
 		metadataRaw := e.Record.Get("metadata")
-		content, err := validateBody(metadataRaw)
+		content, err := validateBody(ctx, metadataRaw)
 		if err != nil {
-			handlers.LogError(err, "Failed while convert invoice attributes", content)
-			return handlers.BadRequestError("Failed while convert invoice attributes", err)
+			handlers.LogError(ctx, err, "Failed while convert invoice attributes", content)
+			return err
 		}
 		companyIDRaw := e.Record.Get("companyID")
 		companyID, ok := companyIDRaw.(string)
 		if !ok || companyID == "" {
-			handlers.LogError(err, "Failed to process invoice creation due to invalid companyID", "companyIDRaw", companyIDRaw)
-			return handlers.BadRequestError("Missing or invalid 'companyID'", companyIDRaw)
+			handlers.LogError(ctx, err, "Failed to process invoice creation due to invalid companyID", "companyIDRaw", companyIDRaw)
+			return handlers.Fail(ctx, handlers.ErrInvoiceCompanyRequired.WithField("companyID", validation.NewError(
+				"invalid_company",
+				"The 'companyID' field is required",
+			)))
 		}
 
 		userIDRaw := e.Record.Get("userID")
 		userID, ok := userIDRaw.(string)
 		if !ok || userID == "" {
-			handlers.LogError(err, "Failed to process invoice creation due to invalid userID", "userIDRaw", userIDRaw)
-			return handlers.BadRequestError("Missing or invalid 'userID'", userIDRaw)
+			handlers.LogError(ctx, err, "Failed to process invoice creation due to invalid userID", "userIDRaw", userIDRaw)
+			return handlers.Fail(ctx, handlers.ErrInvoiceUserRequired.WithField("userID", validation.NewError(
+				"invalid_user",
+				"The 'userID' field is required",
+			)))
+		}
+		if err := applyCurrency(e.App, e.Record, content, issued); err != nil {
+			return handlers.Fail(ctx, err, "companyID", companyID)
+		}
+		// the invoice number, printed and in the e-invoice, is known before the record is saved
+		if e.Record.Id == "" {
+			e.Record.Id = core.GenerateDefaultRandomId()
+		}
+		applyPaymentTerms(e.App, e.Record, cfg, issued)
+		ubl, domainErr := applyEInvoice(ctx, e.App, e.Record, issued)
+		if domainErr != nil {
+			return handlers.Fail(ctx, domainErr, "companyID", companyID, "userID", userID)
+		}
+		fullMetadata, err := buildFullMetadata(ctx, app, companyID, userID, content)
+		if err != nil {
+			return err
+		}
+		attachment, err := invoiceAttachment(e.Record, content, ubl, issued)
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed while build invoice attachment")
+			return handlers.Fail(ctx, handlers.ErrInvoicePDFFailed.Wrap(err))
 		}
-		fullMetadata, err := buildFullMetadata(app, companyID, userID, content)
 		pdfData := pdfgenerator.PDFData{
 			Title:       fullMetadata["Title"].(string),
 			HeaderImage: fullMetadata["HeaderImage"].([]byte),
 			Header:      fullMetadata["Header"].(string),
 			Content:     fullMetadata["Content"].(map[string]string),
 			Footer:      fullMetadata["Footer"].(string),
+			Author:      fullMetadata["Author"].(string),
+			Subject:     "Invoice " + Number(e.Record),
+			Attachments: []pdfgenerator.Attachment{attachment},
 		}
 
 		// Generate PDF
-		pdfBytes, err := pdfgenerator.GeneratePDFBytes(pdfData)
+		pdfBytes, err := pdfgenerator.GeneratePDFBytes(ctx, pdfData)
 		if err != nil {
-			handlers.LogError(err, "Failed while generate PDF invoice")
-			return handlers.InternalServerError("Failed while generate PDF invoice", err)
+			handlers.LogError(ctx, err, "Failed while generate PDF invoice")
+			return handlers.Fail(ctx, handlers.ErrInvoicePDFFailed.Wrap(err))
 		}
 
 		//Create file from PDF bytes
 		file, err := filesystem.NewFileFromBytes(pdfBytes, "invoice.pdf")
 		if err != nil {
-			handlers.LogError(err, "Failed while generate PDF from bytes")
-			return handlers.InternalServerError("Failed while generate PDF invoice", err)
+			handlers.LogError(ctx, err, "Failed while generate PDF from bytes")
+			return handlers.Fail(ctx, handlers.ErrInvoicePDFFailed.Wrap(err))
 		}
 
 		e.Record.Set("metadata", fullMetadata)
-		e.Record.Set("status", "PENDING")
+		e.Record.Set("status", StatusPending)
 		e.Record.Set("doc", file)
 
-		handlers.LogInfo("Create PDF invoice successfully", "companyID", companyID, "userID", userID)
+		handlers.LogInfo(ctx, "Create PDF invoice successfully", "companyID", companyID, "userID", userID)
 		return e.Next()
 	})
 }
 
-func validateBody(metadataRaw any) (map[string]string, error) {
+func validateBody(ctx context.Context, metadataRaw any) (map[string]string, error) {
 	if metadataRaw == nil {
-		handlers.LogWarn("Missing metadata", "metadata", metadataRaw)
-		err := handlers.BadRequestError("Missing metadata field", "", validation.NewError(
+		handlers.LogWarn(ctx, "Missing metadata", "metadata", metadataRaw)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceMetadataMissing.WithField("metadata", validation.NewError(
 			"invalid_metadata",
 			"The 'metadata' field is required",
-		))
+		)))
 		return nil, err
 	}
 
 	metadataBytes, err := json.Marshal(metadataRaw)
 	if err != nil {
-		handlers.LogError(err, "Failed to format JSON marshal metadata attribute 'json.Marshal(metadataRaw)'", "metadata", metadataRaw)
-		err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
+		handlers.LogError(ctx, err, "Failed to format JSON marshal metadata attribute 'json.Marshal(metadataRaw)'", "metadata", metadataRaw)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceMetadataInvalid.WithField("metadata", validation.NewError(
 			"invalid_metadata",
 			"Invalid 'metadata' field",
-		))
+		)))
 		return nil, err
 	}
 
@@ -99,19 +143,19 @@ func validateBody(metadataRaw any) (map[string]string, error) {
 	}
 	var metadataReq MetadataRequest
 	if err := json.Unmarshal(metadataBytes, &metadataReq); err != nil {
-		handlers.LogError(err, "Failed to format JSON marshal metadata attribute 'json.Unmarshal(metadataBytes, &metadataReq)'", "metadataBytes", metadataBytes)
-		err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
+		handlers.LogError(ctx, err, "Failed to format JSON marshal metadata attribute 'json.Unmarshal(metadataBytes, &metadataReq)'", "metadataBytes", metadataBytes)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceMetadataInvalid.WithField("metadata", validation.NewError(
 			"invalid_metadata",
 			"Invalid 'metadata' field",
-		))
+		)))
 		return nil, err
 	}
 	if metadataReq.Content == nil {
-		handlers.LogError(err, "Failed to found Content field on metadata request", "Content", metadataReq.Content)
-		err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
+		handlers.LogError(ctx, err, "Failed to found Content field on metadata request", "Content", metadataReq.Content)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceMetadataInvalid.WithField("metadata", validation.NewError(
 			"invalid_metadata",
 			"Failed to found Content field on metadata request",
-		))
+		)))
 		return nil, err
 	}
 	// Validate map[string]string
@@ -120,11 +164,11 @@ func validateBody(metadataRaw any) (map[string]string, error) {
 		if strValue, ok := value.(string); ok {
 			content[key] = strValue
 		} else {
-			handlers.LogWarn("Invalid Content", "Key", key, "Value", value)
-			err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
+			handlers.LogWarn(ctx, "Invalid Content", "Key", key, "Value", value)
+			err := handlers.Fail(ctx, handlers.ErrInvoiceContentInvalid.WithField("metadata", validation.NewError(
 				"invalid_metadata",
 				fmt.Sprintf("Inalid Content: Key '%s' is %T type, but the function needs string", key, value),
-			))
+			)))
 			return nil, err
 		}
 	}
@@ -132,26 +176,26 @@ func validateBody(metadataRaw any) (map[string]string, error) {
 	return content, nil
 }
 
-func buildFullMetadata(app *pocketbase.PocketBase, companyID string, userID string, content map[string]string) (map[string]interface{}, error) {
+func buildFullMetadata(ctx context.Context, app *pocketbase.PocketBase, companyID string, userID string, content map[string]string) (map[string]interface{}, error) {
 	//Fetch company data
 	company, err := app.FindRecordById("companies", companyID)
 	if err != nil {
-		handlers.LogError(err, "Not found record id during build full metadata PDF invoice", "CompanyID", companyID)
-		err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
-			"invalid_metadata",
+		handlers.LogError(ctx, err, "Not found record id during build full metadata PDF invoice", "CompanyID", companyID)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceCompanyNotFound.Wrap(err).WithParams("companyID", companyID).WithField("companyID", validation.NewError(
+			"not_found",
 			fmt.Sprintf("Not found company while creation Invoice with company id '%s'", companyID),
-		))
+		)))
 		return nil, err
 	}
 
 	//Fetch user data
 	users, err := app.FindRecordById("users", userID)
 	if err != nil {
-		handlers.LogError(err, "Not found record id during build full metadata PDF invoice dor userID", "userID", userID)
-		err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
-			"invalid_metadata",
+		handlers.LogError(ctx, err, "Not found record id during build full metadata PDF invoice dor userID", "userID", userID)
+		err := handlers.Fail(ctx, handlers.ErrInvoiceUserNotFound.Wrap(err).WithParams("userID", userID).WithField("userID", validation.NewError(
+			"not_found",
 			fmt.Sprintf("Not found user while creation Invoice with user id '%s'", userID),
-		))
+		)))
 		return nil, err
 	}
 
@@ -171,14 +215,10 @@ func buildFullMetadata(app *pocketbase.PocketBase, companyID string, userID stri
 		//TODO: Uses environment variables
 		baseURL := "http://localhost:8090"
 		logoUrl := fmt.Sprintf("%s/api/files/companies/%s/%s", baseURL, companyID, logoFile)
-		logo, err := fetchLogoBase64(logoUrl)
+		logo, err := fetchLogoBase64(ctx, logoUrl)
 		if err != nil {
-			handlers.LogError(err, "Failed fetch company logo while generating invoice", "logo", logo)
-			err := handlers.BadRequestError("Invalid metadata field", "", validation.NewError(
-				"invalid_invoice",
-				fmt.Sprintf("Failed fetch company logo while generating invoice"),
-			))
-			return nil, err
+			handlers.LogError(ctx, err, "Failed fetch company logo while generating invoice", "logo", logo)
+			return nil, handlers.Fail(ctx, handlers.ErrInvoiceLogoUnavailable.Wrap(err).WithParams("companyID", companyID))
 		}
 		logoBase64 = logo
 	}
@@ -190,37 +230,33 @@ func buildFullMetadata(app *pocketbase.PocketBase, companyID string, userID stri
 	completeMap["Header"] = header
 	completeMap["Content"] = content
 	completeMap["Footer"] = ""
+	completeMap["Author"] = name
 
 	return completeMap, nil
 }
 
-func fetchLogoBase64(logoUrl string) ([]byte, error) {
-	resp, err := http.Get(logoUrl)
+func fetchLogoBase64(ctx context.Context, logoUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logoUrl, nil)
+	if err == nil {
+		req.Header.Set(handlers.RequestIDHeader, handlers.RequestID(ctx))
+	}
+	var resp *http.Response
+	if err == nil {
+		resp, err = http.DefaultClient.Do(req)
+	}
 	if err != nil {
-		handlers.LogError(err, "Failed download company logo while generating invoice", "logoUrl", logoUrl)
-		err := handlers.BadRequestError("Invalid base url", "", validation.NewError(
-			"invalid_url",
-			fmt.Sprintf("Failed download company logo while generating invoice"),
-		))
+		handlers.LogError(ctx, err, "Failed download company logo while generating invoice", "logoUrl", logoUrl)
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		handlers.LogError(err, "Response code is invalid generating invoice", "Status code", resp.StatusCode)
-		err := handlers.BadRequestError("Invalid base url", "", validation.NewError(
-			"invalid_url",
-			fmt.Sprintf("Failed while generating invoice"),
-		))
-		return nil, err
+		handlers.LogWarn(ctx, "Response code is invalid generating invoice", "Status code", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected logo response status %d", resp.StatusCode)
 	}
 
 	logoBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		handlers.LogError(err, "Failed read logo bytes while generating invoice")
-		err := handlers.BadRequestError("Invalid company logo", "", validation.NewError(
-			"invalid_url",
-			fmt.Sprintf("Failed while generating invoice"),
-		))
+		handlers.LogError(ctx, err, "Failed read logo bytes while generating invoice")
 		return nil, err
 	}
 
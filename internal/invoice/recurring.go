@@ -0,0 +1,256 @@
+package invoice
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Recurring invoice frequencies
+const (
+	FrequencyWeekly      = "WEEKLY"
+	FrequencyFortnightly = "FORTNIGHTLY"
+	FrequencyMonthly     = "MONTHLY"
+)
+
+// frequencyRules recurrence rule of each frequency, the series starts on the template start date
+var frequencyRules = map[string]string{
+	FrequencyWeekly:      "FREQ=WEEKLY",
+	FrequencyFortnightly: "FREQ=WEEKLY;INTERVAL=2",
+	FrequencyMonthly:     "FREQ=MONTHLY",
+}
+
+// recurringCron generate the invoices due every hour, so each timezone is billed soon after its midnight
+const recurringCron = "15 * * * *"
+
+// maxLineItems of a recurring invoice
+const maxLineItems = 50
+
+// periodLayout dates of the billed period printed on the invoices
+const periodLayout = "02/01/2006"
+
+// LineItem billed on every invoice of a recurring invoice
+type LineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+}
+
+// Price of a unit in the currency, rounded half up to the minor unit
+func (l LineItem) Price(code string) currency.Money {
+	return currency.FromMajor(l.UnitPrice, code, currency.RoundHalfUp)
+}
+
+// Amount of the line in the currency, the quantity times the rounded unit price rounded half up
+func (l LineItem) Amount(code string) currency.Money {
+	return l.Price(code).Mul(currency.RoundHalfUp, l.Quantity)
+}
+
+// recurringSchedule parsed template of a recurring invoice
+type recurringSchedule struct {
+	rule    jobs.RRule
+	dtstart time.Time
+	// end exclusive end of the series, zero without end date
+	end   time.Time
+	items []LineItem
+}
+
+// parseRecurring validate a recurring invoice template
+func parseRecurring(record *core.Record) (recurringSchedule, *handlers.DomainError) {
+	schedule := recurringSchedule{}
+	invalid := func(field string, code string, message string) *handlers.DomainError {
+		return handlers.ErrRecurringInvoiceInvalid.WithParams("field", field).WithField(field, validation.NewError(code, message))
+	}
+
+	rrule, ok := frequencyRules[record.GetString("frequency")]
+	if !ok {
+		return schedule, invalid("frequency", "invalid_frequency", "Frequency must be WEEKLY, FORTNIGHTLY or MONTHLY")
+	}
+	rule, err := jobs.ParseRRule(rrule)
+	if err != nil {
+		return schedule, invalid("frequency", "invalid_frequency", err.Error())
+	}
+	schedule.rule = rule
+
+	if code := record.GetString("currency"); code != "" && !currency.Valid(currency.Normalize(code)) {
+		return schedule, invalid("currency", "invalid_currency", "Unsupported ISO 4217 currency")
+	}
+
+	timezone := record.GetString("timezone")
+	if timezone == "" {
+		timezone = jobs.DefaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return schedule, invalid("timezone", "invalid_timezone", "Unknown timezone")
+	}
+	if schedule.dtstart, err = time.ParseInLocation(time.DateOnly, record.GetString("startDate"), loc); err != nil {
+		return schedule, invalid("startDate", "invalid_start_date", "Start date must be a YYYY-MM-DD date")
+	}
+	// months without the start day would be skipped
+	if record.GetString("frequency") == FrequencyMonthly && schedule.dtstart.Day() > 28 {
+		return schedule, invalid("startDate", "invalid_start_date", "Monthly invoices must start between the 1st and the 28th")
+	}
+	if endDate := record.GetString("endDate"); endDate != "" {
+		last, err := time.ParseInLocation(time.DateOnly, endDate, loc)
+		if err != nil || last.Before(schedule.dtstart) {
+			return schedule, invalid("endDate", "invalid_end_date", "End date must be a YYYY-MM-DD date after the start date")
+		}
+		schedule.end = last.AddDate(0, 0, 1)
+	}
+
+	if err := record.UnmarshalJSONField("lineItems", &schedule.items); err != nil || len(schedule.items) == 0 {
+		return schedule, invalid("lineItems", "line_items_required", "At least one line item is required")
+	}
+	if len(schedule.items) > maxLineItems {
+		return schedule, invalid("lineItems", "too_many_line_items", fmt.Sprintf("At most %d line items are allowed", maxLineItems))
+	}
+	for _, item := range schedule.items {
+		if item.Description == "" || item.Quantity <= 0 || item.UnitPrice < 0 {
+			return schedule, invalid("lineItems", "invalid_line_item", "Line items need a description, a positive quantity and a unit price")
+		}
+	}
+	return schedule, nil
+}
+
+// onRecurringInvoiceChange validate the templates before they are saved
+func onRecurringInvoiceChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		if _, err := parseRecurring(e.Record); err != nil {
+			return handlers.Fail(handlers.RecordContext(e), err)
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("recurring_invoices").BindFunc(validate)
+	app.OnRecordUpdate("recurring_invoices").BindFunc(validate)
+}
+
+// scheduleRecurring generate the recurring invoices due
+func scheduleRecurring(app *pocketbase.PocketBase) {
+	app.Cron().MustAdd("invoicesRecurring", recurringCron, func() {
+		if _, err := GenerateRecurringInvoices(context.Background(), app, time.Now()); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to generate recurring invoices")
+		}
+	})
+}
+
+// GenerateRecurringInvoices create the invoices of every active template for the periods started by now,
+// the periods missed while the server was down are caught up, returns the number of invoices created
+func GenerateRecurringInvoices(ctx context.Context, app core.App, now time.Time) (int, error) {
+	templates, err := app.FindRecordsByFilter("recurring_invoices", "active = true", "startDate", 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	for _, template := range templates {
+		count, err := generateRecurring(ctx, app, template, now)
+		created += count
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to generate recurring invoice", "recurringInvoiceID", template.Id)
+		}
+	}
+	if created > 0 {
+		handlers.LogInfo(ctx, "Recurring invoices generated", "count", created)
+	}
+	return created, nil
+}
+
+// generateRecurring create the invoices of a template since its last generated period, the periods
+// already invoiced are skipped so a run interrupted or repeated never bills a period twice
+func generateRecurring(ctx context.Context, app core.App, template *core.Record, now time.Time) (int, error) {
+	schedule, parseErr := parseRecurring(template)
+	if parseErr != nil {
+		return 0, parseErr
+	}
+	loc := schedule.dtstart.Location()
+	from := schedule.dtstart
+	if last, err := time.ParseInLocation(time.DateOnly, template.GetString("lastGeneratedDate"), loc); err == nil {
+		from = last.AddDate(0, 0, 1)
+	}
+	today := now.In(loc)
+	to := time.Date(today.Year(), today.Month(), today.Day()+1, 0, 0, 0, 0, loc)
+	if !schedule.end.IsZero() && schedule.end.Before(to) {
+		to = schedule.end
+	}
+
+	created := 0
+	for _, period := range schedule.rule.Occurrences(schedule.dtstart, from, to) {
+		periodDate := jobs.DateKey(period)
+		exists, err := app.CountRecords("invoices", dbx.HashExp{"recurringInvoiceID": template.Id, "periodDate": periodDate})
+		if err != nil {
+			return created, err
+		}
+		if exists == 0 {
+			if err := createRecurringInvoice(ctx, app, template, schedule, period); err != nil {
+				return created, err
+			}
+			created++
+		} else {
+			handlers.LogDebug(ctx, "Recurring invoice period already invoiced", "recurringInvoiceID", template.Id, "periodDate", periodDate)
+		}
+		template.Set("lastGeneratedDate", periodDate)
+		if err := app.SaveWithContext(ctx, template); err != nil {
+			return created, err
+		}
+	}
+	return created, nil
+}
+
+// createRecurringInvoice save the invoice of a period, the invoice creation hook builds its PDF and due date
+func createRecurringInvoice(ctx context.Context, app core.App, template *core.Record, schedule recurringSchedule, period time.Time) error {
+	periodEnd := period
+	if next := schedule.rule.Occurrences(schedule.dtstart, period.AddDate(0, 0, 1), period.AddDate(0, 2, 1)); len(next) > 0 {
+		periodEnd = next[0].AddDate(0, 0, -1)
+	}
+
+	// the template currency, else the company base currency the invoice hook defaults to
+	code := currency.Normalize(template.GetString("currency"))
+	if template.GetString("currency") == "" {
+		if company, err := app.FindRecordById("companies", template.GetString("companyID")); err == nil {
+			code = currency.Normalize(company.GetString("baseCurrency"))
+		}
+	}
+
+	content := map[string]string{
+		"Period": period.Format(periodLayout) + " - " + periodEnd.Format(periodLayout),
+	}
+	if title := template.GetString("title"); title != "" {
+		content["Description"] = title
+	}
+	total := currency.Zero(code)
+	for i, item := range schedule.items {
+		amount := item.Amount(code)
+		content[fmt.Sprintf("%d. %s", i+1, item.Description)] = fmt.Sprintf("%g x %s = %s", item.Quantity, item.Price(code), amount)
+		total = total.Add(amount)
+	}
+	content["Total"] = total.String()
+
+	collection, err := app.FindCollectionByNameOrId("invoices")
+	if err != nil {
+		return err
+	}
+	invoice := core.NewRecord(collection)
+	invoice.Set("companyID", template.GetString("companyID"))
+	invoice.Set("userID", template.GetString("userID"))
+	invoice.Set("recurringInvoiceID", template.Id)
+	invoice.Set("periodDate", jobs.DateKey(period))
+	invoice.Set("currency", code)
+	invoice.Set("paymentTermsDays", template.GetInt("paymentTermsDays"))
+	for _, field := range eInvoiceFields {
+		invoice.Set(field, template.Get(field))
+	}
+	invoice.Set("metadata", map[string]any{"Content": content})
+	if err := app.SaveWithContext(ctx, invoice); err != nil {
+		return err
+	}
+	handlers.LogInfo(ctx, "Recurring invoice created", "invoiceID", invoice.Id, "recurringInvoiceID", template.Id, "periodDate", jobs.DateKey(period), "total", total.String())
+	return nil
+}
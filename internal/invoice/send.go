@@ -0,0 +1,391 @@
+package invoice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbox"
+	"html/template"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// Invoice send statuses
+const (
+	SendStatusSent    = "SENT"
+	SendStatusFailed  = "FAILED"
+	SendStatusOpened  = "OPENED"
+	SendStatusBounced = "BOUNCED"
+)
+
+// maxSendRecipients addresses accepted in each of to, cc and bcc
+const maxSendRecipients = 10
+
+// sendTextMax length of the error and bounceReason fields of the sends, longer mail server answers are cut
+const sendTextMax = 1000
+
+// SendRequest body of the send invoice action, the invoice user is emailed when To is empty
+type SendRequest struct {
+	To  []string `json:"to"`
+	Cc  []string `json:"cc"`
+	Bcc []string `json:"bcc"`
+	// Subject defaults to "Invoice from <company>"
+	Subject string `json:"subject"`
+	Message string `json:"message"`
+}
+
+// sendEmail fields of the invoice email templates
+type sendEmail struct {
+	CompanyName  string
+	CompanyLines []string
+	Recipient    string
+	Message      string
+	TrackingURL  string
+}
+
+var sendHTMLTemplate = template.Must(template.New("invoice_send").Parse(`<div style="font-family:Arial,sans-serif;color:#222;max-width:600px">
+<h2 style="margin-bottom:4px">{{.CompanyName}}</h2>
+<p style="color:#777;font-size:12px;margin-top:0">{{range .CompanyLines}}{{.}}<br>{{end}}</p>
+<p>Hello {{.Recipient}},</p>
+{{if .Message}}<p style="white-space:pre-line">{{.Message}}</p>{{end}}
+<p>Please find attached your invoice from {{.CompanyName}}.</p>
+<p>Kind regards,<br>{{.CompanyName}}</p>
+{{if .TrackingURL}}<img src="{{.TrackingURL}}" width="1" height="1" alt="">{{end}}
+</div>`))
+
+// SendInvoice email the invoice PDF and record the send, a failed send is recorded as FAILED and its error returned
+func SendInvoice(ctx context.Context, app core.App, invoice *core.Record, sender string, req SendRequest) (*core.Record, error) {
+	issuer, err := app.FindRecordById("companies", invoice.GetString("companyID"))
+	if err != nil {
+		return nil, err
+	}
+	collection, err := app.FindCollectionByNameOrId("invoice_sends")
+	if err != nil {
+		return nil, err
+	}
+
+	send := core.NewRecord(collection)
+	send.Id = core.GenerateDefaultRandomId()
+	send.Set("invoiceID", invoice.Id)
+	send.Set("companyID", issuer.Id)
+	send.Set("sentBy", sender)
+	send.Set("to", req.To)
+	send.Set("cc", req.Cc)
+	send.Set("bcc", req.Bcc)
+	send.Set("message", req.Message)
+	subject := req.Subject
+	if subject == "" {
+		subject = "Invoice from " + issuer.GetString("name")
+	}
+	send.Set("subject", subject)
+	send.Set("messageId", messageID(app, send.Id))
+	send.Set("trackingToken", security.RandomString(32))
+
+	sendErr := deliverInvoice(ctx, app, invoice, issuer, send)
+	now := time.Now()
+	if sendErr != nil {
+		send.Set("status", SendStatusFailed)
+		send.Set("error", outbox.Truncate(sendErr.Error(), sendTextMax))
+		invoice.Set("sendStatus", SendStatusFailed)
+	} else {
+		send.Set("status", SendStatusSent)
+		invoice.Set("sendStatus", SendStatusSent)
+		invoice.Set("lastSentAt", now)
+		invoice.Set("sendCount", invoice.GetInt("sendCount")+1)
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.SaveWithContext(ctx, send); err != nil {
+			return err
+		}
+		return txApp.SaveWithContext(ctx, invoice)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sendErr != nil {
+		return send, sendErr
+	}
+	handlers.LogInfo(ctx, "Invoice sent", "invoiceID", invoice.Id, "sendID", send.Id, "recipients", len(req.To)+len(req.Cc)+len(req.Bcc))
+	return send, nil
+}
+
+// deliverInvoice build the company branded email with the invoice PDF attached and send it with the PocketBase mailer
+func deliverInvoice(ctx context.Context, app core.App, invoice *core.Record, issuer *core.Record, send *core.Record) error {
+	doc := invoice.GetString("doc")
+	if doc == "" {
+		return fmt.Errorf("invoice %s has no document", invoice.Id)
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+	file, err := fsys.GetFile(invoice.BaseFilesPath() + "/" + doc)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	to, _ := parseAddresses(send.GetStringSlice("to"))
+	cc, _ := parseAddresses(send.GetStringSlice("cc"))
+	bcc, _ := parseAddresses(send.GetStringSlice("bcc"))
+	recipient := to[0].Name
+	if recipient == "" {
+		recipient = to[0].Address
+	}
+
+	email := sendEmail{
+		CompanyName: issuer.GetString("name"),
+		Recipient:   recipient,
+		Message:     send.GetString("message"),
+		TrackingURL: trackingURL(app, send),
+	}
+	for _, field := range []string{"abn", "phone", "email", "website"} {
+		if value := issuer.GetString(field); value != "" {
+			email.CompanyLines = append(email.CompanyLines, value)
+		}
+	}
+	var html bytes.Buffer
+	if err := sendHTMLTemplate.Execute(&html, email); err != nil {
+		return err
+	}
+
+	headers := map[string]string{"Message-ID": send.GetString("messageId")}
+	if replyTo := issuer.GetString("email"); replyTo != "" {
+		headers["Reply-To"] = replyTo
+	}
+	message := &mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    issuer.GetString("name"),
+		},
+		To:          to,
+		Cc:          cc,
+		Bcc:         bcc,
+		Subject:     send.GetString("subject"),
+		HTML:        html.String(),
+		Headers:     headers,
+		Attachments: map[string]io.Reader{"invoice-" + invoice.Id + ".pdf": file},
+	}
+	handlers.LogDebug(ctx, "Sending invoice email", "invoiceID", invoice.Id, "sendID", send.Id)
+	return app.NewMailClient().Send(message)
+}
+
+// parseAddresses validate a list of email addresses
+func parseAddresses(values []string) ([]mail.Address, error) {
+	addresses := make([]mail.Address, 0, len(values))
+	for _, value := range values {
+		address, err := mail.ParseAddress(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid email address %q", value)
+		}
+		addresses = append(addresses, *address)
+	}
+	return addresses, nil
+}
+
+// messageID Message-ID header of a send, used to match the bounces reported by the mail provider
+func messageID(app core.App, sendID string) string {
+	host := "hirevo"
+	if parsed, err := url.Parse(app.Settings().Meta.AppURL); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	return "<invoice-" + sendID + "@" + host + ">"
+}
+
+// trackingURL pixel marking the send as opened when the email is displayed
+func trackingURL(app core.App, send *core.Record) string {
+	appURL := strings.TrimRight(app.Settings().Meta.AppURL, "/")
+	if appURL == "" {
+		return ""
+	}
+	return appURL + "/api/invoices/sends/" + send.Id + "/open?token=" + url.QueryEscape(send.GetString("trackingToken"))
+}
+
+// MarkOpened record the first open of a SENT invoice email
+func MarkOpened(ctx context.Context, app core.App, send *core.Record) error {
+	if send.GetString("status") != SendStatusSent {
+		return nil
+	}
+	send.Set("status", SendStatusOpened)
+	send.Set("openedAt", time.Now())
+	return updateSendStatus(ctx, app, send, SendStatusSent)
+}
+
+// MarkBounced record a bounce reported by the mail provider
+func MarkBounced(ctx context.Context, app core.App, send *core.Record, reason string) error {
+	send.Set("status", SendStatusBounced)
+	send.Set("bouncedAt", time.Now())
+	send.Set("bounceReason", outbox.Truncate(reason, sendTextMax))
+	return updateSendStatus(ctx, app, send, SendStatusSent, SendStatusOpened)
+}
+
+// updateSendStatus save the send, the invoice status follows when it is still one of the given statuses
+func updateSendStatus(ctx context.Context, app core.App, send *core.Record, from ...string) error {
+	return app.RunInTransaction(func(txApp core.App) error {
+		if err := txApp.SaveWithContext(ctx, send); err != nil {
+			return err
+		}
+		invoice, err := txApp.FindRecordById("invoices", send.GetString("invoiceID"))
+		if err != nil {
+			return err
+		}
+		current := invoice.GetString("sendStatus")
+		for _, status := range from {
+			if current == status {
+				invoice.Set("sendStatus", send.GetString("status"))
+				return txApp.SaveWithContext(ctx, invoice)
+			}
+		}
+		return nil
+	})
+}
+
+// trackingPixel transparent 1x1 GIF returned by the open tracking route
+var trackingPixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// BounceRequest bounce reported by the mail provider
+type BounceRequest struct {
+	MessageID string `json:"messageId"`
+	Reason    string `json:"reason"`
+}
+
+// registerSendRoutes send and resend invoices, track opens and receive bounces
+func registerSendRoutes(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/invoices/{id}/send", sendInvoice).Bind(apis.RequireAuth())
+		se.Router.GET("/api/invoices/sends/{id}/open", trackOpen)
+		se.Router.POST("/api/invoices/sends/bounce", recordBounce).Bind(apis.RequireSuperuserAuth())
+		return se.Next()
+	})
+}
+
+// sendInvoice POST /api/invoices/{id}/send, email the invoice PDF, calling it again resends the invoice
+func sendInvoice(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	invoiceID := e.Request.PathValue("id")
+	invoice, err := e.App.FindRecordById("invoices", invoiceID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "invoices", "id", invoiceID))
+	}
+	companyID := invoice.GetString("companyID")
+	if !e.HasSuperuserAuth() && !company.HasRole(e.App, companyID, e.Auth.Id, company.RoleOwner, company.RoleAdmin) {
+		handlers.LogWarn(ctx, "User not allowed to send invoices", "companyID", companyID, "userId", e.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrInvoiceSendForbidden.WithParams("companyID", companyID))
+	}
+	if invoice.GetString("doc") == "" {
+		return handlers.Fail(ctx, handlers.ErrInvoiceDocumentMissing.WithParams("invoiceID", invoiceID))
+	}
+
+	body := SendRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
+	}
+	if len(body.To) == 0 {
+		if user, err := e.App.FindRecordById("users", invoice.GetString("userID")); err == nil && user.Email() != "" {
+			body.To = []string{(&mail.Address{Name: user.GetString("name"), Address: user.Email()}).String()}
+		}
+	}
+	if invalidErr := validateSendRequest(body); invalidErr != nil {
+		return handlers.Fail(ctx, invalidErr, "invoiceID", invoiceID)
+	}
+
+	send, err := SendInvoice(ctx, e.App, invoice, e.Auth.Id, body)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to send invoice", "invoiceID", invoiceID)
+		failErr := handlers.ErrInvoiceSendFailed.Wrap(err)
+		if send != nil {
+			failErr = failErr.WithParams("sendID", send.Id)
+		}
+		return handlers.Fail(ctx, failErr, "invoiceID", invoiceID)
+	}
+	return e.JSON(http.StatusOK, send)
+}
+
+// validateSendRequest at least one recipient, every address valid
+func validateSendRequest(body SendRequest) *handlers.DomainError {
+	if len(body.To) == 0 {
+		return handlers.ErrInvoiceSendInvalid.WithField("to", validation.NewError(
+			"recipient_required",
+			"The invoice user has no email address, provide a recipient",
+		))
+	}
+	for field, addresses := range map[string][]string{"to": body.To, "cc": body.Cc, "bcc": body.Bcc} {
+		if len(addresses) > maxSendRecipients {
+			return handlers.ErrInvoiceSendInvalid.WithParams("field", field).WithField(field, validation.NewError(
+				"too_many_recipients",
+				fmt.Sprintf("At most %d addresses are allowed", maxSendRecipients),
+			))
+		}
+		if _, err := parseAddresses(addresses); err != nil {
+			return handlers.ErrInvoiceSendInvalid.WithParams("field", field).WithField(field, validation.NewError(
+				"invalid_email",
+				err.Error(),
+			))
+		}
+	}
+	if len(body.Subject) > 300 {
+		return handlers.ErrInvoiceSendInvalid.WithField("subject", validation.NewError(
+			"subject_too_long",
+			"The subject must be at most 300 characters",
+		))
+	}
+	if len(body.Message) > 5000 {
+		return handlers.ErrInvoiceSendInvalid.WithField("message", validation.NewError(
+			"message_too_long",
+			"The message must be at most 5000 characters",
+		))
+	}
+	return nil
+}
+
+// trackOpen GET /api/invoices/sends/{id}/open, tracking pixel of the invoice emails, always answers the pixel
+func trackOpen(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	sendID := e.Request.PathValue("id")
+	token := e.Request.URL.Query().Get("token")
+	send, err := e.App.FindRecordById("invoice_sends", sendID)
+	if err == nil && token != "" && security.Equal(token, send.GetString("trackingToken")) {
+		if err := MarkOpened(ctx, e.App, send); err != nil {
+			handlers.LogError(ctx, err, "Failed to record invoice email open", "sendID", sendID)
+		}
+	}
+	e.Response.Header().Set("Cache-Control", "no-store")
+	return e.Blob(http.StatusOK, "image/gif", trackingPixel)
+}
+
+// recordBounce POST /api/invoices/sends/bounce, bounce notification of the mail provider
+func recordBounce(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	body := BounceRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
+	}
+	send, err := e.App.FindFirstRecordByData("invoice_sends", "messageId", body.MessageID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "invoice_sends", "messageId", body.MessageID))
+	}
+	if err := MarkBounced(ctx, e.App, send, body.Reason); err != nil {
+		return handlers.Fail(ctx, handlers.ErrInternal.Wrap(err), "sendID", send.Id)
+	}
+	handlers.LogWarn(ctx, "Invoice email bounced", "invoiceID", send.GetString("invoiceID"), "sendID", send.Id)
+	return e.JSON(http.StatusOK, send)
+}
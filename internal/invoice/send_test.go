@@ -0,0 +1,190 @@
+package invoice
+
+import (
+	"context"
+	"encoding/base64"
+	"hirevo/internal/tests"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// testPDF content of the invoice document attached to the emails
+const testPDF = "%PDF-1.7 test"
+
+// smtpSink local SMTP server keeping the messages it receives, rejectRecipients answers
+// every RCPT with a 550 and the given reason
+type smtpSink struct {
+	addr             *net.TCPAddr
+	rejectRecipients string
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	sink := &smtpSink{addr: listener.Addr().(*net.TCPAddr)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go sink.serve(conn)
+		}
+	}()
+	return sink
+}
+
+// serve the commands used by the mailer, no extension is advertised so the client stays on plain text
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 sink ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 sink")
+		case "RCPT":
+			if s.rejectRecipients != "" {
+				text.PrintfLine("550 %s", s.rejectRecipients)
+				continue
+			}
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 send the message")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+// newSendApp app mailing through the sink and an invoice with its PDF
+func newSendApp(t *testing.T, sink *smtpSink) (core.App, *core.Record) {
+	t.Helper()
+	app := tests.NewApp(t)
+	settings := app.Settings()
+	settings.Meta.SenderAddress = "invoices@hirevo.com"
+	settings.Meta.AppURL = "https://hirevo.com"
+	settings.SMTP.Enabled = true
+	settings.SMTP.Host = sink.addr.IP.String()
+	settings.SMTP.Port = sink.addr.Port
+
+	user := tests.NewUser(t, app, "worker@example.com")
+	issuer := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme", "email": "billing@acme.com"})
+	doc, err := filesystem.NewFileFromBytes([]byte(testPDF), "invoice.pdf")
+	if err != nil {
+		t.Fatalf("doc: %v", err)
+	}
+	invoice := tests.NewRecord(t, app, "invoices", map[string]any{"companyID": issuer.Id, "userID": user.Id, "doc": doc})
+	return app, invoice
+}
+
+func TestSendInvoiceThroughSMTP(t *testing.T) {
+	sink := newSMTPSink(t)
+	app, invoice := newSendApp(t, sink)
+
+	send, err := SendInvoice(context.Background(), app, invoice, "", SendRequest{
+		To:      []string{"Jane <jane@example.com>"},
+		Message: "Thanks for your work",
+	})
+	if err != nil {
+		t.Fatalf("send invoice: %v", err)
+	}
+	if got := send.GetString("status"); got != SendStatusSent {
+		t.Errorf("send status = %s, want %s", got, SendStatusSent)
+	}
+	saved, err := app.FindRecordById("invoices", invoice.Id)
+	if err != nil {
+		t.Fatalf("find invoice: %v", err)
+	}
+	if got := saved.GetString("sendStatus"); got != SendStatusSent {
+		t.Errorf("invoice sendStatus = %s, want %s", got, SendStatusSent)
+	}
+	if got := saved.GetInt("sendCount"); got != 1 {
+		t.Errorf("invoice sendCount = %d, want 1", got)
+	}
+
+	messages := sink.received()
+	if len(messages) != 1 {
+		t.Fatalf("sink received %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	for _, want := range []string{
+		"Subject: Invoice from Acme",
+		"Message-ID: " + send.GetString("messageId"),
+		"Reply-To: billing@acme.com",
+		`filename="invoice-` + invoice.Id + `.pdf"`,
+		base64.StdEncoding.EncodeToString([]byte(testPDF)),
+		"https://hirevo.com/api/invoices/sends/" + send.Id + "/open",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message does not contain %q", want)
+		}
+	}
+}
+
+func TestSendInvoiceRecordsLongErrors(t *testing.T) {
+	sink := newSMTPSink(t)
+	sink.rejectRecipients = "mailbox unavailable " + strings.Repeat("é", 2*sendTextMax)
+	app, invoice := newSendApp(t, sink)
+
+	send, err := SendInvoice(context.Background(), app, invoice, "", SendRequest{To: []string{"jane@example.com"}})
+	if err == nil {
+		t.Fatal("send invoice succeeded, want the rejected recipient error")
+	}
+	if send == nil {
+		t.Fatalf("send not recorded: %v", err)
+	}
+	saved, err := app.FindRecordById("invoice_sends", send.Id)
+	if err != nil {
+		t.Fatalf("find send: %v", err)
+	}
+	if got := saved.GetString("status"); got != SendStatusFailed {
+		t.Errorf("send status = %s, want %s", got, SendStatusFailed)
+	}
+	sendError := saved.GetString("error")
+	if !strings.Contains(sendError, "mailbox unavailable") {
+		t.Errorf("error = %q, want the server answer", sendError)
+	}
+	if got := utf8.RuneCountInString(sendError); got != sendTextMax {
+		t.Errorf("error length = %d, want %d", got, sendTextMax)
+	}
+	if len(sink.received()) != 0 {
+		t.Error("sink received a message for a rejected recipient")
+	}
+}
@@ -0,0 +1,233 @@
+package invoice
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/archive"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"net/mail"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Invoice statuses
+const (
+	StatusPending = "PENDING"
+	StatusOverdue = "OVERDUE"
+	StatusPaid    = "PAID"
+)
+
+// overdueCron mark the overdue invoices and send the reminders every hour
+const overdueCron = "0 * * * *"
+
+// dueDateLayout due date printed in the reminders
+const dueDateLayout = "02/01/2006"
+
+// applyPaymentTerms set the payment terms of a new invoice, its own, else the company ones, else the default,
+// and the due date they give from now
+func applyPaymentTerms(app core.App, invoice *core.Record, cfg config.InvoicesConfig, now time.Time) {
+	days := invoice.GetInt("paymentTermsDays")
+	if days <= 0 {
+		days = cfg.PaymentTermsDays
+		if company, err := app.FindRecordById("companies", invoice.GetString("companyID")); err == nil && company.GetInt("paymentTermsDays") > 0 {
+			days = company.GetInt("paymentTermsDays")
+		}
+	}
+	invoice.Set("paymentTermsDays", days)
+	if invoice.GetDateTime("dueDate").IsZero() {
+		invoice.Set("dueDate", now.AddDate(0, 0, days))
+	}
+}
+
+// ReminderSchedule days past the due date the reminders of the company invoices are sent
+func ReminderSchedule(company *core.Record, cfg config.InvoicesConfig) []int {
+	days := []int{}
+	if company != nil && company.UnmarshalJSONField("reminderDays", &days) == nil && len(days) > 0 {
+		return days
+	}
+	return cfg.ReminderDays
+}
+
+// onCompanyTermsChange validate the reminder schedule of a company
+func onCompanyTermsChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		days := []int{}
+		if raw := e.Record.GetString("reminderDays"); raw != "" && raw != "null" {
+			if err := e.Record.UnmarshalJSONField("reminderDays", &days); err != nil {
+				return handlers.Fail(ctx, handlers.ErrInvoiceTermsInvalid.Wrap(err).WithField("reminderDays", validation.NewError(
+					"invalid_reminder_days",
+					"Reminder days must be a list of days",
+				)))
+			}
+		}
+		previous := 0
+		for _, day := range days {
+			if day <= previous {
+				return handlers.Fail(ctx, handlers.ErrInvoiceTermsInvalid.WithField("reminderDays", validation.NewError(
+					"invalid_reminder_days",
+					"Reminder days must be positive and in ascending order",
+				)))
+			}
+			previous = day
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("companies").BindFunc(validate)
+	app.OnRecordUpdate("companies").BindFunc(validate)
+}
+
+// onInvoicePaid record when an invoice is paid, the payment date of the accounting exports
+func onInvoicePaid(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate("invoices").BindFunc(func(e *core.RecordEvent) error {
+		if e.Record.GetString("status") == StatusPaid && e.Record.Original().GetString("status") != StatusPaid && e.Record.GetDateTime("paidAt").IsZero() {
+			e.Record.Set("paidAt", time.Now())
+		}
+		return e.Next()
+	})
+}
+
+// scheduleOverdue mark the invoices past their due date OVERDUE then send the reminders due
+func scheduleOverdue(app *pocketbase.PocketBase, cfg config.InvoicesConfig) {
+	app.Cron().MustAdd("invoicesOverdue", overdueCron, func() {
+		ctx := context.Background()
+		if _, err := MarkOverdue(ctx, app, time.Now()); err != nil {
+			handlers.LogError(ctx, err, "Failed to mark overdue invoices")
+			return
+		}
+		if _, err := SendReminders(ctx, app, cfg, time.Now()); err != nil {
+			handlers.LogError(ctx, err, "Failed to send invoice reminders")
+		}
+	})
+}
+
+// MarkOverdue move the PENDING invoices past their due date to OVERDUE
+func MarkOverdue(ctx context.Context, app core.App, now time.Time) (int, error) {
+	nowValue, err := types.ParseDateTime(now)
+	if err != nil {
+		return 0, err
+	}
+	invoices, err := app.FindRecordsByFilter("invoices", "status = {:pending} && dueDate != '' && dueDate < {:now} && "+archive.ActiveFilter, "dueDate", 0, 0, dbx.Params{
+		"pending": StatusPending,
+		"now":     nowValue.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, invoice := range invoices {
+		invoice.Set("status", StatusOverdue)
+		if err := app.SaveWithContext(ctx, invoice); err != nil {
+			handlers.LogError(ctx, err, "Failed to mark invoice overdue", "invoiceID", invoice.Id)
+			return i, err
+		}
+	}
+	if len(invoices) > 0 {
+		handlers.LogInfo(ctx, "Invoices marked overdue", "count", len(invoices))
+	}
+	return len(invoices), nil
+}
+
+// SendReminders email the OVERDUE invoices whose next reminder of the company schedule is due,
+// after an outage only the latest reminder due is sent, returns the number of reminders sent
+func SendReminders(ctx context.Context, app core.App, cfg config.InvoicesConfig, now time.Time) (int, error) {
+	invoices, err := app.FindRecordsByFilter("invoices", "status = {:overdue} && "+archive.ActiveFilter, "dueDate", 0, 0, dbx.Params{
+		"overdue": StatusOverdue,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, invoice := range invoices {
+		company, err := app.FindRecordById("companies", invoice.GetString("companyID"))
+		if err != nil {
+			handlers.LogWarn(ctx, "Company of overdue invoice not found", "invoiceID", invoice.Id)
+			continue
+		}
+		schedule := ReminderSchedule(company, cfg)
+		dueDate := invoice.GetDateTime("dueDate").Time()
+		daysOverdue := int(now.Sub(dueDate).Hours() / 24)
+		reminder := invoice.GetInt("remindersSent")
+		for reminder < len(schedule) && schedule[reminder] <= daysOverdue {
+			reminder++
+		}
+		if reminder == invoice.GetInt("remindersSent") {
+			continue
+		}
+
+		user, err := app.FindRecordById("users", invoice.GetString("userID"))
+		if err != nil || user.Email() == "" {
+			handlers.LogWarn(ctx, "Overdue invoice has no recipient for reminders", "invoiceID", invoice.Id)
+			continue
+		}
+		req := reminderRequest(company, invoice, reminder, len(schedule), daysOverdue)
+		req.To = []string{(&mail.Address{Name: user.GetString("name"), Address: user.Email()}).String()}
+		if _, err := SendInvoice(ctx, app, invoice, "", req); err != nil {
+			handlers.LogError(ctx, err, "Failed to send invoice reminder", "invoiceID", invoice.Id, "reminder", reminder)
+			continue
+		}
+		invoice.Set("remindersSent", reminder)
+		invoice.Set("lastReminderAt", now)
+		if err := app.SaveWithContext(ctx, invoice); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	if sent > 0 {
+		handlers.LogInfo(ctx, "Invoice reminders sent", "count", sent)
+	}
+	return sent, nil
+}
+
+// reminderRequest subject and message of a reminder, escalating from a friendly reminder to a final notice
+func reminderRequest(company *core.Record, invoice *core.Record, reminder int, total int, daysOverdue int) SendRequest {
+	loc, err := time.LoadLocation(jobs.DefaultTimezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	dueDate := invoice.GetDateTime("dueDate").Time().In(loc).Format(dueDateLayout)
+	name := company.GetString("name")
+	overdue := fmt.Sprintf("This invoice was due on %s and is now %d days overdue.", dueDate, daysOverdue)
+
+	switch {
+	case reminder >= total && total > 1:
+		return SendRequest{
+			Subject: "Final notice: overdue invoice from " + name,
+			Message: overdue + " This is our final reminder, please pay it immediately or contact us to avoid further action.",
+		}
+	case reminder == 1:
+		return SendRequest{
+			Subject: "Payment reminder: invoice from " + name,
+			Message: overdue + " If you have already paid it, please disregard this reminder.",
+		}
+	default:
+		return SendRequest{
+			Subject: fmt.Sprintf("Reminder %d: overdue invoice from %s", reminder, name),
+			Message: overdue + " Please arrange the payment as soon as possible.",
+		}
+	}
+}
+
+// Number of an invoice printed on its documents and used by the accounting exports
+func Number(invoice *core.Record) string {
+	return "INV-" + strings.ToUpper(invoice.Id)
+}
+
+// Content lines of an invoice, the "Content" of its metadata
+func Content(invoice *core.Record) map[string]string {
+	metadata := struct {
+		Content map[string]string `json:"Content"`
+	}{}
+	if err := invoice.UnmarshalJSONField("metadata", &metadata); err != nil || metadata.Content == nil {
+		return map[string]string{}
+	}
+	return metadata.Content
+}
@@ -0,0 +1,315 @@
+package invoice
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// Peppol BIS Billing 3.0 A-NZ identifiers
+const (
+	ublCustomizationID = "urn:cen.eu:en16931:2017#conformant#urn:fdc:peppol.eu:2017:poacc:billing:international:aunz:3.0"
+	ublProfileID       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+	// ublInvoiceTypeCode commercial invoice
+	ublInvoiceTypeCode = "380"
+	// ublABNScheme Peppol scheme of the Australian Business Numbers
+	ublABNScheme = "0151"
+	// ublNZBNScheme Peppol scheme of the New Zealand Business Numbers, GS1 global location numbers
+	ublNZBNScheme = "0088"
+	ublTaxScheme  = "GST"
+	// ublStandardRated GST category of the invoices, 10% on the tax exclusive amount
+	ublStandardRated = "S"
+	ublGSTPercent    = 10
+	// ublUnitCode one unit, the invoices have a single line for their total
+	ublUnitCode = "C62"
+)
+
+// UBLInvoice UBL 2.1 invoice, the fields follow the element order of the schema
+type UBLInvoice struct {
+	XMLName              xml.Name      `xml:"Invoice"`
+	Xmlns                string        `xml:"xmlns,attr"`
+	XmlnsCac             string        `xml:"xmlns:cac,attr"`
+	XmlnsCbc             string        `xml:"xmlns:cbc,attr"`
+	CustomizationID      string        `xml:"cbc:CustomizationID"`
+	ProfileID            string        `xml:"cbc:ProfileID"`
+	ID                   string        `xml:"cbc:ID"`
+	IssueDate            string        `xml:"cbc:IssueDate"`
+	DueDate              string        `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode      string        `xml:"cbc:InvoiceTypeCode"`
+	Note                 string        `xml:"cbc:Note,omitempty"`
+	DocumentCurrencyCode string        `xml:"cbc:DocumentCurrencyCode"`
+	TaxCurrencyCode      string        `xml:"cbc:TaxCurrencyCode,omitempty"`
+	BuyerReference       string        `xml:"cbc:BuyerReference,omitempty"`
+	Supplier             UBLParty      `xml:"cac:AccountingSupplierParty>cac:Party"`
+	Customer             UBLParty      `xml:"cac:AccountingCustomerParty>cac:Party"`
+	PaymentTerms         string        `xml:"cac:PaymentTerms>cbc:Note,omitempty"`
+	TaxTotals            []UBLTaxTotal `xml:"cac:TaxTotal"`
+	MonetaryTotal        UBLTotals     `xml:"cac:LegalMonetaryTotal"`
+	Lines                []UBLLine     `xml:"cac:InvoiceLine"`
+}
+
+// UBLParty seller or buyer
+type UBLParty struct {
+	EndpointID   UBLIdentifier  `xml:"cbc:EndpointID"`
+	Address      UBLAddress     `xml:"cac:PostalAddress"`
+	TaxScheme    *UBLTaxScheme  `xml:"cac:PartyTaxScheme,omitempty"`
+	Name         string         `xml:"cac:PartyLegalEntity>cbc:RegistrationName"`
+	LegalID      *UBLIdentifier `xml:"cac:PartyLegalEntity>cbc:CompanyID,omitempty"`
+	ContactEmail string         `xml:"cac:Contact>cbc:ElectronicMail,omitempty"`
+}
+
+// UBLTaxScheme GST registration of a party
+type UBLTaxScheme struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	SchemeID  string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+// UBLIdentifier identifier with its scheme
+type UBLIdentifier struct {
+	SchemeID string `xml:"schemeID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// UBLAddress postal address
+type UBLAddress struct {
+	StreetName       string `xml:"cbc:StreetName,omitempty"`
+	CityName         string `xml:"cbc:CityName,omitempty"`
+	PostalZone       string `xml:"cbc:PostalZone,omitempty"`
+	CountrySubentity string `xml:"cbc:CountrySubentity,omitempty"`
+	Country          string `xml:"cac:Country>cbc:IdentificationCode"`
+}
+
+// UBLAmount amount with its currency
+type UBLAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+// UBLTaxTotal tax of the invoice, with its subtotals by category in the document currency only
+type UBLTaxTotal struct {
+	TaxAmount UBLAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []UBLTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+// UBLTaxSubtotal tax of a category
+type UBLTaxSubtotal struct {
+	TaxableAmount UBLAmount      `xml:"cbc:TaxableAmount"`
+	TaxAmount     UBLAmount      `xml:"cbc:TaxAmount"`
+	Category      UBLTaxCategory `xml:"cac:TaxCategory"`
+}
+
+// UBLTaxCategory category and rate of the tax
+type UBLTaxCategory struct {
+	ID          string `xml:"cbc:ID"`
+	Percent     int    `xml:"cbc:Percent"`
+	TaxSchemeID string `xml:"cac:TaxScheme>cbc:ID"`
+}
+
+// UBLTotals monetary totals of the invoice
+type UBLTotals struct {
+	LineExtensionAmount UBLAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  UBLAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  UBLAmount `xml:"cbc:TaxInclusiveAmount"`
+	PayableAmount       UBLAmount `xml:"cbc:PayableAmount"`
+}
+
+// UBLLine invoice line
+type UBLLine struct {
+	ID                  string         `xml:"cbc:ID"`
+	Quantity            UBLQuantity    `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount UBLAmount      `xml:"cbc:LineExtensionAmount"`
+	ItemName            string         `xml:"cac:Item>cbc:Name"`
+	ItemTaxCategory     UBLTaxCategory `xml:"cac:Item>cac:ClassifiedTaxCategory"`
+	PriceAmount         UBLAmount      `xml:"cac:Price>cbc:PriceAmount"`
+}
+
+// UBLQuantity quantity with its unit
+type UBLQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// ublAmount amount element of money
+func ublAmount(amount currency.Money) UBLAmount {
+	return UBLAmount{CurrencyID: amount.Currency, Value: amount.Decimal()}
+}
+
+// eInvoiceFields e-invoice options of the invoices, copied from their recurring template
+var eInvoiceFields = []string{"eInvoice", "buyerReference", "buyerABN", "buyerNZBN", "buyerCountry"}
+
+// applyEInvoice generate the UBL document of a new e-invoice, validated before it is stored alongside the PDF,
+// nil when the invoice is not an e-invoice
+func applyEInvoice(ctx context.Context, app core.App, invoice *core.Record, now time.Time) ([]byte, *handlers.DomainError) {
+	if !invoice.GetBool("eInvoice") {
+		return nil, nil
+	}
+	invoice.Set("buyerCountry", countryCode(invoice.GetString("buyerCountry")))
+	company, err := app.FindRecordById("companies", invoice.GetString("companyID"))
+	if err != nil {
+		return nil, handlers.ErrInvoiceCompanyNotFound.Wrap(err).WithParams("companyID", invoice.GetString("companyID"))
+	}
+	buyer, err := app.FindRecordById("users", invoice.GetString("userID"))
+	if err != nil {
+		return nil, handlers.ErrInvoiceUserNotFound.Wrap(err).WithParams("userID", invoice.GetString("userID"))
+	}
+	doc, err := buildUBL(invoice, company, buyer, now)
+	if err != nil {
+		return nil, handlers.ErrInternal.Wrap(err)
+	}
+	data, err := MarshalUBL(doc)
+	if err != nil {
+		return nil, handlers.ErrInternal.Wrap(err)
+	}
+	if violations := PrecheckUBL(data); len(violations) > 0 {
+		handlers.LogWarn(ctx, "E-invoice rejected by the UBL pre-check", "invoiceID", invoice.Id, "violations", violations)
+		return nil, handlers.ErrEInvoiceInvalid.WithParams("rules", violationRules(violations)).WithField("eInvoice", validation.NewError(
+			"invalid_einvoice",
+			violations[0].Rule+": "+violations[0].Message,
+		))
+	}
+	file, err := filesystem.NewFileFromBytes(data, "invoice.xml")
+	if err != nil {
+		return nil, handlers.ErrInternal.Wrap(err)
+	}
+	invoice.Set("ubl", file)
+	return data, nil
+}
+
+// buildUBL e-invoice of an invoice issued by the company, its total is GST inclusive
+func buildUBL(invoice *core.Record, company *core.Record, buyer *core.Record, issued time.Time) (*UBLInvoice, error) {
+	loc, err := time.LoadLocation(jobs.DefaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	code := currency.Normalize(invoice.GetString("currency"))
+	total := currency.New(int64(invoice.GetInt("totalMinor")), code)
+	gst := total.MulRatio(ublGSTPercent, ublGSTPercent+100, currency.RoundHalfUp)
+	net := total.Sub(gst)
+	category := UBLTaxCategory{ID: ublStandardRated, Percent: ublGSTPercent, TaxSchemeID: ublTaxScheme}
+
+	description := Content(invoice)["Description"]
+	if description == "" {
+		description = "Invoice " + Number(invoice)
+	}
+	abn := normalizeABN(company.GetString("abn"))
+	buyerID := buyerIdentifier(invoice)
+	doc := &UBLInvoice{
+		Xmlns:                ublInvoiceNS,
+		XmlnsCac:             ublAggregateNS,
+		XmlnsCbc:             ublBasicNS,
+		CustomizationID:      ublCustomizationID,
+		ProfileID:            ublProfileID,
+		ID:                   Number(invoice),
+		IssueDate:            issued.In(loc).Format(time.DateOnly),
+		InvoiceTypeCode:      ublInvoiceTypeCode,
+		DocumentCurrencyCode: code,
+		BuyerReference:       invoice.GetString("buyerReference"),
+		Supplier: UBLParty{
+			EndpointID:   UBLIdentifier{SchemeID: ublABNScheme, Value: abn},
+			Address:      companyAddress(company),
+			TaxScheme:    &UBLTaxScheme{CompanyID: abn, SchemeID: ublTaxScheme},
+			Name:         company.GetString("name"),
+			LegalID:      &UBLIdentifier{SchemeID: ublABNScheme, Value: abn},
+			ContactEmail: company.GetString("email"),
+		},
+		Customer: UBLParty{
+			EndpointID:   buyerID,
+			Address:      UBLAddress{Country: invoice.GetString("buyerCountry")},
+			Name:         buyer.GetString("name"),
+			LegalID:      &buyerID,
+			ContactEmail: buyer.Email(),
+		},
+		TaxTotals: []UBLTaxTotal{{
+			TaxAmount: ublAmount(gst),
+			Subtotals: []UBLTaxSubtotal{{TaxableAmount: ublAmount(net), TaxAmount: ublAmount(gst), Category: category}},
+		}},
+		MonetaryTotal: UBLTotals{
+			LineExtensionAmount: ublAmount(net),
+			TaxExclusiveAmount:  ublAmount(net),
+			TaxInclusiveAmount:  ublAmount(total),
+			PayableAmount:       ublAmount(total),
+		},
+		Lines: []UBLLine{{
+			ID:                  "1",
+			Quantity:            UBLQuantity{UnitCode: ublUnitCode, Value: "1"},
+			LineExtensionAmount: ublAmount(net),
+			ItemName:            description,
+			ItemTaxCategory:     category,
+			PriceAmount:         ublAmount(net),
+		}},
+	}
+	if due := invoice.GetDateTime("dueDate"); !due.IsZero() {
+		doc.DueDate = due.Time().In(loc).Format(time.DateOnly)
+	}
+	if days := invoice.GetInt("paymentTermsDays"); days > 0 {
+		doc.PaymentTerms = fmt.Sprintf("Payment within %d days", days)
+	}
+	// the GST is also reported in the base currency of the company when the invoice is in another currency
+	if base := currency.Normalize(invoice.GetString("baseCurrency")); base != code {
+		doc.TaxCurrencyCode = base
+		doc.TaxTotals = append(doc.TaxTotals, UBLTaxTotal{
+			TaxAmount: ublAmount(gst.Convert(base, invoice.GetFloat("exchangeRate"), currency.RoundHalfEven)),
+		})
+	}
+	return doc, nil
+}
+
+// MarshalUBL XML document of the e-invoice
+func MarshalUBL(doc *UBLInvoice) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// companyAddress postal address of the company "address"
+func companyAddress(company *core.Record) UBLAddress {
+	address := map[string]any{}
+	_ = company.UnmarshalJSONField("address", &address)
+	value := func(key string) string {
+		text, _ := address[key].(string)
+		return strings.TrimSpace(text)
+	}
+	return UBLAddress{
+		StreetName:       value("street"),
+		CityName:         value("suburb"),
+		PostalZone:       value("postcode"),
+		CountrySubentity: value("state"),
+		Country:          countryCode(value("country")),
+	}
+}
+
+// countryCode ISO 3166 alpha-2 code of a country, Australia by default
+func countryCode(country string) string {
+	switch strings.ToUpper(strings.TrimSpace(country)) {
+	case "", "AU", "AUS", "AUSTRALIA":
+		return "AU"
+	case "NZ", "NZL", "NEW ZEALAND":
+		return "NZ"
+	}
+	return strings.ToUpper(strings.TrimSpace(country))
+}
+
+// buyerIdentifier Peppol identifier of the buyer, the NZBN of the New Zealand buyers and the ABN of the others
+func buyerIdentifier(invoice *core.Record) UBLIdentifier {
+	if invoice.GetString("buyerCountry") == "NZ" {
+		return UBLIdentifier{SchemeID: ublNZBNScheme, Value: invoice.GetString("buyerNZBN")}
+	}
+	return UBLIdentifier{SchemeID: ublABNScheme, Value: normalizeABN(invoice.GetString("buyerABN"))}
+}
+
+// normalizeABN digits of an ABN, the separating spaces removed
+func normalizeABN(abn string) string {
+	return strings.ReplaceAll(strings.TrimSpace(abn), " ", "")
+}
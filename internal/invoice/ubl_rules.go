@@ -0,0 +1,307 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hirevo/internal/currency"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UBL 2.1 namespaces of the invoice document and its components
+const (
+	ublInvoiceNS   = "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+	ublAggregateNS = "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+	ublBasicNS     = "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2"
+)
+
+// ublInvoiceSequence order of the Invoice children in the UBL 2.1 schema, restricted to the elements the documents use
+var ublInvoiceSequence = []string{
+	"CustomizationID", "ProfileID", "ID", "IssueDate", "DueDate", "InvoiceTypeCode", "Note",
+	"DocumentCurrencyCode", "TaxCurrencyCode", "BuyerReference",
+	"AccountingSupplierParty", "AccountingCustomerParty", "PaymentTerms", "TaxTotal", "LegalMonetaryTotal", "InvoiceLine",
+}
+
+// ublDecimal amounts have at most two decimals (BR-DEC)
+var ublDecimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?$`)
+
+// UBLViolation rule of the schema, of EN 16931 or of Peppol the document breaks
+type UBLViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PrecheckUBL partial check of the XML document before it is stored: the order and cardinality of the Invoice
+// children the documents use and the amount formats of the UBL 2.1 schema, then the EN 16931 and Peppol BIS
+// Billing 3.0 A-NZ rules these documents can break. It is not a validation against the UBL 2.1 XSD nor the
+// Peppol Schematron, the access point sending the e-invoice runs them, it only catches our own mistakes early.
+func PrecheckUBL(data []byte) []UBLViolation {
+	violations := validateUBLSchema(data)
+	if len(violations) > 0 {
+		return violations
+	}
+	doc := &ublDocument{}
+	if err := xml.Unmarshal(data, doc); err != nil {
+		return []UBLViolation{{Rule: "UBL-SCHEMA", Message: err.Error()}}
+	}
+	return validateUBLRules(doc)
+}
+
+// validateUBLSchema namespaces, order and cardinality of the Invoice children and the amount formats
+func validateUBLSchema(data []byte) []UBLViolation {
+	violations := []UBLViolation{}
+	fail := func(format string, args ...any) {
+		violations = append(violations, UBLViolation{Rule: "UBL-SCHEMA", Message: fmt.Sprintf(format, args...)})
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth, position := 0, 0
+	seen := map[string]int{}
+	var amount *xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fail("malformed XML: %s", err)
+			return violations
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			name := element.Name
+			switch {
+			case depth == 1:
+				if name.Space != ublInvoiceNS || name.Local != "Invoice" {
+					fail("root element must be the UBL 2.1 Invoice, found {%s}%s", name.Space, name.Local)
+					return violations
+				}
+			case name.Space != ublAggregateNS && name.Space != ublBasicNS:
+				fail("element %s is not in the UBL common components namespaces", name.Local)
+			case depth == 2:
+				index := slices.Index(ublInvoiceSequence, name.Local)
+				if index < 0 {
+					fail("unexpected element %s in Invoice", name.Local)
+					continue
+				}
+				if index < position {
+					fail("element %s is out of the schema order", name.Local)
+				}
+				position = index
+				seen[name.Local]++
+			}
+			amount = nil
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "currencyID" {
+					amount = &element
+					if !currency.Valid(attr.Value) {
+						fail("%s has an unknown currency %q", name.Local, attr.Value)
+					}
+				}
+			}
+		case xml.CharData:
+			if amount != nil && !ublDecimal.Match(bytes.TrimSpace(element)) {
+				fail("%s must be a decimal with at most two fraction digits (BR-DEC)", amount.Name.Local)
+			}
+			amount = nil
+		case xml.EndElement:
+			depth--
+			amount = nil
+		}
+	}
+	for _, name := range []string{"ID", "IssueDate", "AccountingSupplierParty", "AccountingCustomerParty", "LegalMonetaryTotal"} {
+		if seen[name] == 0 {
+			fail("missing required element %s", name)
+		}
+	}
+	for _, name := range ublInvoiceSequence {
+		if seen[name] > 1 && name != "Note" && name != "TaxTotal" && name != "InvoiceLine" {
+			fail("element %s occurs more than once", name)
+		}
+	}
+	return violations
+}
+
+// ublDocument the parsed e-invoice, with the namespaces of the schema
+type ublDocument struct {
+	CustomizationID      string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 CustomizationID"`
+	ProfileID            string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 ProfileID"`
+	ID                   string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 ID"`
+	IssueDate            string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 IssueDate"`
+	DueDate              string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 DueDate"`
+	InvoiceTypeCode      string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 InvoiceTypeCode"`
+	DocumentCurrencyCode string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 DocumentCurrencyCode"`
+	TaxCurrencyCode      string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 TaxCurrencyCode"`
+	BuyerReference       string         `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2 BuyerReference"`
+	Supplier             ublParsedParty `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2 AccountingSupplierParty>Party"`
+	Customer             ublParsedParty `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2 AccountingCustomerParty>Party"`
+	TaxTotals            []struct {
+		TaxAmount UBLAmount `xml:"TaxAmount"`
+		Subtotals []struct {
+			TaxableAmount UBLAmount `xml:"TaxableAmount"`
+			TaxAmount     UBLAmount `xml:"TaxAmount"`
+			CategoryID    string    `xml:"TaxCategory>ID"`
+			Percent       float64   `xml:"TaxCategory>Percent"`
+		} `xml:"TaxSubtotal"`
+	} `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2 TaxTotal"`
+	MonetaryTotal struct {
+		LineExtensionAmount UBLAmount `xml:"LineExtensionAmount"`
+		TaxExclusiveAmount  UBLAmount `xml:"TaxExclusiveAmount"`
+		TaxInclusiveAmount  UBLAmount `xml:"TaxInclusiveAmount"`
+		PayableAmount       UBLAmount `xml:"PayableAmount"`
+	} `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2 LegalMonetaryTotal"`
+	Lines []struct {
+		ID                  string    `xml:"ID"`
+		LineExtensionAmount UBLAmount `xml:"LineExtensionAmount"`
+		ItemName            string    `xml:"Item>Name"`
+		CategoryID          string    `xml:"Item>ClassifiedTaxCategory>ID"`
+		PriceAmount         UBLAmount `xml:"Price>PriceAmount"`
+	} `xml:"urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2 InvoiceLine"`
+}
+
+// ublParsedParty the parsed seller or buyer
+type ublParsedParty struct {
+	EndpointID UBLIdentifier `xml:"EndpointID"`
+	Country    string        `xml:"PostalAddress>Country>IdentificationCode"`
+	Name       string        `xml:"PartyLegalEntity>RegistrationName"`
+}
+
+// validateUBLRules EN 16931 and Peppol rules the documents can break, the rule ids are the ones of the Peppol validation artefacts
+func validateUBLRules(doc *ublDocument) []UBLViolation {
+	violations := []UBLViolation{}
+	check := func(ok bool, rule string, message string) {
+		if !ok {
+			violations = append(violations, UBLViolation{Rule: rule, Message: message})
+		}
+	}
+	code := doc.DocumentCurrencyCode
+	money := func(amount UBLAmount) currency.Money {
+		value, err := currency.Parse(amount.Value, code)
+		check(err == nil && amount.CurrencyID == code, "PEPPOL-EN16931-R051", "All amounts must be in the document currency "+code)
+		return value
+	}
+	_, issueErr := time.Parse(time.DateOnly, doc.IssueDate)
+
+	check(doc.CustomizationID == ublCustomizationID, "BR-01", "The specification identifier must be Peppol BIS Billing 3.0 A-NZ")
+	check(doc.ProfileID != "", "PEPPOL-EN16931-R001", "The business process must be provided")
+	check(doc.ID != "", "BR-02", "An invoice must have an invoice number")
+	check(issueErr == nil, "BR-03", "An invoice must have an issue date")
+	check(doc.InvoiceTypeCode != "", "BR-04", "An invoice must have an invoice type code")
+	check(currency.Valid(code), "BR-05", "An invoice must have a valid currency code")
+	check(doc.Supplier.Name != "", "BR-06", "An invoice must contain the seller name")
+	check(doc.Customer.Name != "", "BR-07", "An invoice must contain the buyer name")
+	check(doc.Supplier.Country != "", "BR-09", "The seller postal address must contain a country code")
+	check(doc.Customer.Country != "", "BR-11", "The buyer postal address must contain a country code")
+	check(len(doc.Lines) > 0, "BR-16", "An invoice must have at least one invoice line")
+	check(doc.BuyerReference != "", "PEPPOL-EN16931-R003", "A buyer reference or purchase order reference must be provided")
+	check(doc.Customer.EndpointID.Value != "", "PEPPOL-EN16931-R010", "The buyer electronic address must be provided")
+	check(doc.Supplier.EndpointID.Value != "", "PEPPOL-EN16931-R020", "The seller electronic address must be provided")
+	check(doc.TaxCurrencyCode != code, "PEPPOL-EN16931-R005", "The GST accounting currency must differ from the invoice currency")
+	if doc.Supplier.Country == "AU" {
+		check(ValidABN(doc.Supplier.EndpointID.Value), "AUNZ-ABN", "The seller ABN is not a valid Australian Business Number")
+	}
+	if doc.Customer.Country == "NZ" {
+		check(doc.Customer.EndpointID.SchemeID == ublNZBNScheme, "AUNZ-NZBN", "New Zealand buyers must be addressed by their NZBN (scheme "+ublNZBNScheme+")")
+	}
+	if doc.Customer.EndpointID.SchemeID == ublABNScheme && doc.Customer.EndpointID.Value != "" {
+		check(ValidABN(doc.Customer.EndpointID.Value), "AUNZ-ABN", "The buyer ABN is not a valid Australian Business Number")
+	}
+	if doc.Customer.EndpointID.SchemeID == ublNZBNScheme && doc.Customer.EndpointID.Value != "" {
+		check(ValidNZBN(doc.Customer.EndpointID.Value), "AUNZ-NZBN", "The buyer NZBN is not a valid New Zealand Business Number")
+	}
+	if !currency.Valid(code) || len(doc.TaxTotals) == 0 {
+		check(len(doc.TaxTotals) > 0, "BR-CO-18", "An invoice must have a GST breakdown")
+		return violations
+	}
+
+	lines := currency.Zero(code)
+	for _, line := range doc.Lines {
+		lines = lines.Add(money(line.LineExtensionAmount))
+		check(line.ItemName != "", "BR-25", "Each invoice line must contain the item name")
+		check(line.CategoryID != "", "BR-CO-04", "Each invoice line must be categorized with a GST category code")
+	}
+	taxTotal := doc.TaxTotals[0]
+	check(len(taxTotal.Subtotals) > 0, "BR-CO-18", "An invoice must have a GST breakdown")
+	subtotals := currency.Zero(code)
+	for _, subtotal := range taxTotal.Subtotals {
+		taxable, tax := money(subtotal.TaxableAmount), money(subtotal.TaxAmount)
+		subtotals = subtotals.Add(tax)
+		// the GST of the category may differ by a cent from its taxable amount times its rate
+		difference := taxable.Mul(currency.RoundHalfUp, subtotal.Percent/100).Sub(tax).Minor
+		check(difference >= -1 && difference <= 1, "BR-CO-17", "The GST of a category must be its taxable amount times its rate")
+	}
+	for _, other := range doc.TaxTotals[1:] {
+		check(len(other.Subtotals) == 0 && other.TaxAmount.CurrencyID == doc.TaxCurrencyCode && doc.TaxCurrencyCode != "", "PEPPOL-EN16931-R053",
+			"Only one tax total with subtotals, the other must be in the GST accounting currency")
+	}
+
+	totals := doc.MonetaryTotal
+	lineExtension, exclusive := money(totals.LineExtensionAmount), money(totals.TaxExclusiveAmount)
+	inclusive, payable := money(totals.TaxInclusiveAmount), money(totals.PayableAmount)
+	tax := money(taxTotal.TaxAmount)
+	check(lineExtension == lines, "BR-CO-10", "The sum of the invoice line net amounts must equal the sum of the lines")
+	check(exclusive == lineExtension, "BR-CO-13", "The total without GST must equal the sum of the lines")
+	check(tax == subtotals, "BR-CO-14", "The total GST must equal the sum of the GST of the categories")
+	check(inclusive == exclusive.Add(tax), "BR-CO-15", "The total with GST must equal the total without GST plus the GST")
+	check(payable == inclusive, "BR-CO-16", "The amount due must equal the total with GST")
+	return violations
+}
+
+// ValidABN check digit of an Australian Business Number: subtract 1 from the first digit,
+// the weighted sum of the 11 digits must be a multiple of 89
+func ValidABN(abn string) bool {
+	abn = normalizeABN(abn)
+	if len(abn) != 11 {
+		return false
+	}
+	weights := []int{10, 1, 3, 5, 7, 9, 11, 13, 15, 17, 19}
+	sum := 0
+	for i, r := range abn {
+		if r < '0' || r > '9' {
+			return false
+		}
+		digit := int(r - '0')
+		if i == 0 {
+			digit--
+		}
+		sum += digit * weights[i]
+	}
+	return sum%89 == 0
+}
+
+// ValidNZBN check digit of a New Zealand Business Number, a 13 digit GS1 global location number:
+// the digits weighted 1 and 3 alternately from the left, check digit included, sum to a multiple of 10
+func ValidNZBN(nzbn string) bool {
+	if len(nzbn) != 13 {
+		return false
+	}
+	sum := 0
+	for i, r := range nzbn {
+		if r < '0' || r > '9' {
+			return false
+		}
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(r-'0') * weight
+	}
+	return sum%10 == 0
+}
+
+// violationRules ids of the broken rules, for the error params
+func violationRules(violations []UBLViolation) string {
+	rules := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		if !slices.Contains(rules, violation.Rule) {
+			rules = append(rules, violation.Rule)
+		}
+	}
+	return strings.Join(rules, ",")
+}
@@ -0,0 +1,144 @@
+package invoice
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"hirevo/internal/tests"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// update rewrite the golden files from the current output: go test ./internal/invoice -run UBL -update
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// checkGolden compare the output with the golden file of testdata
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("write golden %s: %v", name, err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden %s: %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file:\n%s", name, got)
+	}
+}
+
+// newUBLRecord record of the collection with a fixed id, not saved
+func newUBLRecord(t *testing.T, app core.App, collection string, id string, data map[string]any) *core.Record {
+	t.Helper()
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatalf("collection %s: %v", collection, err)
+	}
+	record := core.NewRecord(c)
+	record.Load(data)
+	record.Id = id
+	return record
+}
+
+func TestBuildUBL(t *testing.T) {
+	app := tests.NewApp(t)
+	company := newUBLRecord(t, app, "companies", "company00000001", map[string]any{
+		"name":  "Acme Staffing Pty Ltd",
+		"abn":   "51 824 753 556",
+		"email": "accounts@acme.example.com",
+		"address": map[string]any{
+			"street":   "1 George Street",
+			"suburb":   "Sydney",
+			"postcode": "2000",
+			"state":    "NSW",
+			"country":  "Australia",
+		},
+	})
+	buyer := newUBLRecord(t, app, "users", "buyer0000000001", map[string]any{"name": "Harbour Cafe", "email": "owner@harbour.example.com"})
+	// late on the 1st of March in UTC, already the 2nd in Australia
+	issued := time.Date(2026, time.March, 1, 20, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name string
+		data map[string]any
+	}{
+		{
+			name: "ubl_domestic.xml",
+			data: map[string]any{
+				"currency":         "AUD",
+				"totalMinor":       110000,
+				"baseCurrency":     "AUD",
+				"exchangeRate":     1,
+				"buyerReference":   "PO-1234",
+				"buyerABN":         "53 004 085 616",
+				"buyerCountry":     "AU",
+				"dueDate":          "2026-03-16 13:00:00.000Z",
+				"paymentTermsDays": 14,
+				"metadata":         map[string]any{"Content": map[string]string{"Description": "Barista shifts, week 9"}},
+			},
+		},
+		{
+			// the GST is also reported in the AUD base currency of the company
+			name: "ubl_new_zealand.xml",
+			data: map[string]any{
+				"currency":       "NZD",
+				"totalMinor":     23000,
+				"baseCurrency":   "AUD",
+				"exchangeRate":   0.9125,
+				"buyerReference": "Harbour Cafe",
+				"buyerNZBN":      "9429041535134",
+				"buyerCountry":   "NZ",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			invoice := newUBLRecord(t, app, "invoices", "invoice00000001", tc.data)
+			doc, err := buildUBL(invoice, company, buyer, issued)
+			if err != nil {
+				t.Fatalf("build UBL: %v", err)
+			}
+			data, err := MarshalUBL(doc)
+			if err != nil {
+				t.Fatalf("marshal UBL: %v", err)
+			}
+			checkGolden(t, tc.name, data)
+			if violations := PrecheckUBL(data); len(violations) > 0 {
+				t.Errorf("pre-check violations = %v, want none", violations)
+			}
+		})
+	}
+}
+
+// TestPrecheckUBL every document of testdata/precheck breaks rules of the pre-check, the violations
+// of each document are in precheck.json
+func TestPrecheckUBL(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "precheck", "*.xml"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("pre-check documents: %v", err)
+	}
+	results := map[string][]UBLViolation{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".xml")
+		results[name] = PrecheckUBL(data)
+		if len(results[name]) == 0 {
+			t.Errorf("%s passes the pre-check", name)
+		}
+	}
+	got, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		t.Fatalf("encode violations: %v", err)
+	}
+	checkGolden(t, "precheck.json", append(got, '\n'))
+}
@@ -0,0 +1,288 @@
+package jobs
+
+import (
+	"context"
+	"hirevo/internal/company"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// offerExpiryCron check expired offers every 5 minutes
+const offerExpiryCron = "*/5 * * * *"
+
+// onApplicationRequest check who can apply, shortlist, offer, hire, reject or withdraw
+func onApplicationRequest(app *pocketbase.PocketBase) {
+	app.OnRecordCreateRequest("job_members").BindFunc(func(e *core.RecordRequestEvent) error {
+		ctx := e.Request.Context()
+		if e.HasSuperuserAuth() {
+			return e.Next()
+		}
+		status := e.Record.GetString("status")
+		if status == "" {
+			status = MemberStatusApplied
+		}
+
+		isWorker, isManager := applicationActor(e)
+		allowed := (isWorker && status == MemberStatusApplied) ||
+			(isManager && (status == MemberStatusOffered || status == MemberStatusHired))
+		if !allowed {
+			handlers.LogWarn(ctx, "User not allowed to create job member", "jobID", e.Record.GetString("jobID"), "status", status)
+			return handlers.Fail(ctx, handlers.ErrApplicationForbidden.WithParams("status", status))
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdateRequest("job_members").BindFunc(func(e *core.RecordRequestEvent) error {
+		ctx := e.Request.Context()
+		from := e.Record.Original().GetString("status")
+		to := e.Record.GetString("status")
+		if from == to || e.HasSuperuserAuth() {
+			return e.Next()
+		}
+
+		// workers withdraw or answer an offer, companies run the rest of the pipeline
+		isWorker, isManager := applicationActor(e)
+		allowed := (isWorker && to == MemberStatusWithdrawn) ||
+			(isWorker && from == MemberStatusOffered && (to == MemberStatusHired || to == MemberStatusRejected)) ||
+			(isManager && slices.Contains([]string{MemberStatusShortlisted, MemberStatusOffered, MemberStatusHired, MemberStatusRejected}, to))
+		if !allowed {
+			handlers.LogWarn(ctx, "User not allowed to change job member status", "memberID", e.Record.Id, "from", from, "to", to)
+			return handlers.Fail(ctx, handlers.ErrApplicationForbidden.WithParams("status", to))
+		}
+		return e.Next()
+	})
+}
+
+// applicationActor tell if the authenticated user is the worker of the job member and/or a manager of the job company
+func applicationActor(e *core.RecordRequestEvent) (isWorker bool, isManager bool) {
+	if e.Auth == nil {
+		return false, false
+	}
+	isWorker = e.Record.GetString("userID") == e.Auth.Id
+	job, err := e.App.FindRecordById("jobs", e.Record.GetString("jobID"))
+	if err == nil {
+		isManager = company.HasRole(e.App, job.GetString("companyID"), e.Auth.Id, company.RoleOwner, company.RoleAdmin)
+	}
+	return isWorker, isManager
+}
+
+// onApplicationChange enforce the job member pipeline, the headcount and the offer expiry
+func onApplicationChange(app *pocketbase.PocketBase, cfg config.JobsConfig) {
+	app.OnRecordCreate("job_members").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		status := e.Record.GetString("status")
+		if status == "" {
+			status = MemberStatusApplied
+			e.Record.Set("status", status)
+		}
+
+		if !IsMemberStatus(status) {
+			return handlers.Fail(ctx, handlers.ErrApplicationStatusUnknown.WithParams("status", status))
+		}
+		if !slices.Contains(initialMemberStatuses, status) {
+			return handlers.Fail(ctx, handlers.ErrApplicationTransitionInvalid.WithParams("from", "", "to", status))
+		}
+
+		job, jobErr := findHiringJob(e.App, e.Record.GetString("jobID"))
+		if jobErr != nil {
+			return handlers.Fail(ctx, jobErr)
+		}
+		duplicates, err := e.App.CountRecords("job_members",
+			dbx.HashExp{"jobID": job.Id, "userID": e.Record.GetString("userID")},
+			dbx.In("status", toAny(append(slices.Clone(OpenMemberStatuses), MemberStatusHired))...),
+		)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrApplicationFailed.Wrap(err), "jobID", job.Id)
+		}
+		if duplicates > 0 {
+			return handlers.Fail(ctx, handlers.ErrApplicationDuplicate.WithParams("jobID", job.Id))
+		}
+
+		if err := prepareStatus(e.App, e.Record, job, status, cfg); err != nil {
+			return handlers.Fail(ctx, err, "jobID", job.Id)
+		}
+		if err := saveWithinHeadcount(ctx, e, job); err != nil {
+			return err
+		}
+		return afterStatusChange(ctx, e.App, e.Record, job)
+	})
+
+	app.OnRecordUpdate("job_members").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		from := e.Record.Original().GetString("status")
+		to := e.Record.GetString("status")
+		if from == to {
+			return e.Next()
+		}
+
+		if !IsMemberStatus(to) {
+			return handlers.Fail(ctx, handlers.ErrApplicationStatusUnknown.WithParams("status", to))
+		}
+		// members created before the workflow may have an unknown status, they can only be fixed forward
+		if IsMemberStatus(from) && !CanMemberTransition(from, to) {
+			return handlers.Fail(ctx, handlers.ErrApplicationTransitionInvalid.WithParams("from", from, "to", to))
+		}
+		if from == MemberStatusOffered && to == MemberStatusHired && isOfferExpired(e.Record.Original(), time.Now()) {
+			return handlers.Fail(ctx, handlers.ErrApplicationOfferExpired.WithParams("memberID", e.Record.Id))
+		}
+
+		// moving backwards in the pipeline does not need a hiring job
+		var job *core.Record
+		if slices.Contains(OpenMemberStatuses, to) || to == MemberStatusHired {
+			var err *handlers.DomainError
+			if job, err = findHiringJob(e.App, e.Record.GetString("jobID")); err != nil {
+				return handlers.Fail(ctx, err, "memberID", e.Record.Id)
+			}
+		}
+		if err := prepareStatus(e.App, e.Record, job, to, cfg); err != nil {
+			return handlers.Fail(ctx, err, "memberID", e.Record.Id)
+		}
+		if err := saveWithinHeadcount(ctx, e, job); err != nil {
+			return err
+		}
+
+		handlers.LogInfo(ctx, "Job member status changed", "memberID", e.Record.Id, "from", from, "to", to)
+		return afterStatusChange(ctx, e.App, e.Record, job)
+	})
+}
+
+// findHiringJob fetch the job of a job member, only HIRING jobs accept applications, offers and hires
+func findHiringJob(app core.App, jobID string) (*core.Record, *handlers.DomainError) {
+	job, err := app.FindRecordById("jobs", jobID)
+	if err != nil {
+		return nil, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "jobs", "id", jobID)
+	}
+	if job.GetString("status") != StatusHiring {
+		return nil, handlers.ErrApplicationJobNotHiring.WithParams("jobID", jobID, "status", job.GetString("status"))
+	}
+	return job, nil
+}
+
+// prepareStatus check the headcount and set the dates of the new status before the member is saved,
+// job is only needed for the open and HIRED statuses
+func prepareStatus(app core.App, member *core.Record, job *core.Record, status string, cfg config.JobsConfig) *handlers.DomainError {
+	if slices.Contains(OpenMemberStatuses, status) || status == MemberStatusHired {
+		hired, err := countMembers(app, job.Id, MemberStatusHired)
+		if err != nil {
+			return handlers.ErrApplicationFailed.Wrap(err)
+		}
+		if hired >= int64(Headcount(job)) {
+			return handlers.ErrJobFull.WithParams("jobID", job.Id, "headcount", Headcount(job))
+		}
+	}
+
+	if status == MemberStatusOffered {
+		// keep an expiry sent with the offer, otherwise use the default TTL
+		now := time.Now()
+		expiresAt := member.GetDateTime("offerExpiresAt")
+		if expiresAt.IsZero() || !expiresAt.Time().After(now) {
+			member.Set("offerExpiresAt", now.Add(cfg.OfferTTL))
+		}
+	}
+	member.Set("statusChangedAt", types.NowDateTime())
+	return nil
+}
+
+// saveWithinHeadcount save the job member, a hire is saved and the HIRED members of the job counted again
+// in one transaction so concurrent hires passing prepareStatus cannot overfill the job
+func saveWithinHeadcount(ctx context.Context, e *core.RecordEvent, job *core.Record) error {
+	if e.Record.GetString("status") != MemberStatusHired {
+		return e.Next()
+	}
+	app := e.App
+	defer func() { e.App = app }()
+	return app.RunInTransaction(func(txApp core.App) error {
+		e.App = txApp
+		if err := e.Next(); err != nil {
+			return err
+		}
+		hired, err := countMembers(txApp, job.Id, MemberStatusHired)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrApplicationFailed.Wrap(err), "jobID", job.Id)
+		}
+		if hired > int64(Headcount(job)) {
+			return handlers.Fail(ctx, handlers.ErrJobFull.WithParams("jobID", job.Id, "headcount", Headcount(job)))
+		}
+		return nil
+	})
+}
+
+// afterStatusChange reject the remaining applicants once the hire filled the job
+func afterStatusChange(ctx context.Context, app core.App, member *core.Record, job *core.Record) error {
+	if member.GetString("status") != MemberStatusHired {
+		return nil
+	}
+	hired, err := countMembers(app, job.Id, MemberStatusHired)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrApplicationFailed.Wrap(err), "jobID", job.Id)
+	}
+	if hired < int64(Headcount(job)) {
+		return nil
+	}
+	handlers.LogInfo(ctx, "Job is full, closing remaining applications", "jobID", job.Id, "headcount", Headcount(job))
+	if err := closeOpenApplications(ctx, app, job); err != nil {
+		return handlers.Fail(ctx, handlers.ErrApplicationFailed.Wrap(err), "jobID", job.Id)
+	}
+	return nil
+}
+
+// Headcount number of workers the job needs, at least 1
+func Headcount(job *core.Record) int {
+	return max(job.GetInt("headcount"), 1)
+}
+
+func isOfferExpired(member *core.Record, now time.Time) bool {
+	expiresAt := member.GetDateTime("offerExpiresAt")
+	return !expiresAt.IsZero() && !expiresAt.Time().After(now)
+}
+
+// scheduleOfferExpiry expire the offers not answered in time
+func scheduleOfferExpiry(app *pocketbase.PocketBase) {
+	app.Cron().MustAdd("jobsExpireOffers", offerExpiryCron, func() {
+		if _, err := ExpireOffers(context.Background(), app); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to expire job offers")
+		}
+	})
+}
+
+// ExpireOffers move the OFFERED job members past their expiry to EXPIRED
+func ExpireOffers(ctx context.Context, app core.App) (int, error) {
+	now, err := types.ParseDateTime(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	members, err := app.FindRecordsByFilter("job_members", "status = {:status} && offerExpiresAt != '' && offerExpiresAt <= {:now}", "offerExpiresAt", 0, 0, dbx.Params{
+		"status": MemberStatusOffered,
+		"now":    now.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, member := range members {
+		member.Set("status", MemberStatusExpired)
+		if err := app.SaveWithContext(ctx, member); err != nil {
+			handlers.LogError(ctx, err, "Failed to expire job offer", "memberID", member.Id)
+			return i, err
+		}
+	}
+	if len(members) > 0 {
+		handlers.LogInfo(ctx, "Expired job offers", "count", len(members))
+	}
+	return len(members), nil
+}
+
+func toAny(values []string) []any {
+	items := make([]any, len(values))
+	for i, value := range values {
+		items[i] = value
+	}
+	return items
+}
@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/tests"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestConcurrentHiresKeepHeadcount(t *testing.T) {
+	const headcount, workers = 1, 3
+
+	app := tests.NewApp(t)
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	job := tests.NewRecord(t, app, "jobs", map[string]any{"companyID": company.Id, "title": "Barista", "status": StatusHiring, "headcount": headcount})
+	RegisterHooks(app, config.JobsConfig{OfferTTL: 24 * time.Hour, ScheduleHorizon: 7 * 24 * time.Hour})
+
+	// every hire waits after the headcount check until the others passed it too, a hire
+	// saved in a transaction holds the others back so the wait gives up after a while
+	var arrived sync.WaitGroup
+	arrived.Add(workers)
+	app.OnRecordCreate("job_members").BindFunc(func(e *core.RecordEvent) error {
+		arrived.Done()
+		all := make(chan struct{})
+		go func() {
+			arrived.Wait()
+			close(all)
+		}()
+		select {
+		case <-all:
+		case <-time.After(500 * time.Millisecond):
+		}
+		return e.Next()
+	})
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+	for i := range workers {
+		user := tests.NewUser(t, app, fmt.Sprintf("worker%d@example.com", i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			collection, err := app.FindCollectionByNameOrId("job_members")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			member := core.NewRecord(collection)
+			member.Load(map[string]any{"jobID": job.Id, "userID": user.Id, "status": MemberStatusHired})
+			errs[i] = app.Save(member)
+		}()
+	}
+	wg.Wait()
+
+	hired, err := app.CountRecords("job_members", dbx.HashExp{"jobID": job.Id, "status": MemberStatusHired})
+	if err != nil {
+		t.Fatalf("count hired: %v", err)
+	}
+	if hired != headcount {
+		t.Fatalf("hired %d workers, want the headcount %d", hired, headcount)
+	}
+	for i, err := range errs {
+		var domainErr *handlers.DomainError
+		if err != nil && (!errors.As(err, &domainErr) || domainErr.Code != handlers.ErrJobFull.Code) {
+			t.Errorf("worker %d: %v, want %s", i, err, handlers.ErrJobFull.Code)
+		}
+	}
+}
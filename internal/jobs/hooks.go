@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// RegisterHooks validate job status transitions, record the status history, run the hiring workflow and the nearby jobs search
+func RegisterHooks(app *pocketbase.PocketBase, cfg config.JobsConfig) {
+	onCreateJob(app)
+	onUpdateJobStatus(app)
+	onJobLocation(app)
+	onJobSearchRequest(app)
+	onApplicationRequest(app)
+	onApplicationChange(app, cfg)
+	scheduleOfferExpiry(app)
+	onScheduleChange(app, cfg.ScheduleHorizon)
+	onScheduledShiftEdit(app)
+	onRateChange(app)
+	onHolidayChange(app, cfg.ScheduleHorizon)
+	scheduleExpansion(app, cfg.ScheduleHorizon)
+}
+
+// Transition move the job to a new status, the hooks validate it and write the history
+func Transition(ctx context.Context, app core.App, job *core.Record, to string, reason string) error {
+	job.Set("status", to)
+	job.Set("statusReason", reason)
+	return app.SaveWithContext(ctx, job)
+}
+
+func onCreateJob(app *pocketbase.PocketBase) {
+	app.OnRecordCreate("jobs").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		status := e.Record.GetString("status")
+		if status == "" {
+			status = StatusDraft
+			e.Record.Set("status", status)
+		}
+
+		if !IsStatus(status) {
+			return handlers.Fail(ctx, handlers.ErrJobStatusUnknown.WithParams("status", status))
+		}
+		if !slices.Contains(initialStatuses, status) {
+			return handlers.Fail(ctx, handlers.ErrJobTransitionInvalid.WithParams("from", "", "to", status))
+		}
+		if err := checkPreconditions(e.App, e.Record, status); err != nil {
+			return handlers.Fail(ctx, err)
+		}
+		e.Record.Set("statusChangedAt", types.NowDateTime())
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if err := addHistory(ctx, e.App, e.Record, "", e.Record.GetString("statusReason")); err != nil {
+			return handlers.Fail(ctx, handlers.ErrJobTransitionFailed.Wrap(err), "jobID", e.Record.Id)
+		}
+		handlers.LogInfo(ctx, "Job created", "jobID", e.Record.Id, "status", status)
+		return nil
+	})
+}
+
+func onUpdateJobStatus(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate("jobs").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		from := e.Record.Original().GetString("status")
+		to := e.Record.GetString("status")
+		if from == to {
+			return e.Next()
+		}
+
+		if !IsStatus(to) {
+			return handlers.Fail(ctx, handlers.ErrJobStatusUnknown.WithParams("status", to))
+		}
+		// jobs created before the lifecycle may have an unknown status, they can only be fixed forward
+		if IsStatus(from) && !CanTransition(from, to) {
+			return handlers.Fail(ctx, handlers.ErrJobTransitionInvalid.WithParams("from", from, "to", to))
+		}
+		if err := checkPreconditions(e.App, e.Record, to); err != nil {
+			return handlers.Fail(ctx, err, "jobID", e.Record.Id)
+		}
+		// a reason is only kept for the transition it was sent with
+		reason := e.Record.GetString("statusReason")
+		if reason == e.Record.Original().GetString("statusReason") {
+			reason = ""
+			e.Record.Set("statusReason", "")
+		}
+		e.Record.Set("statusChangedAt", types.NowDateTime())
+
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		// side effects run in the same transaction as the status change
+		if err := addHistory(ctx, e.App, e.Record, from, reason); err != nil {
+			return handlers.Fail(ctx, handlers.ErrJobTransitionFailed.Wrap(err), "jobID", e.Record.Id)
+		}
+		if (from == StatusHiring && to != StatusDraft) || to == StatusCancelled {
+			if err := closeOpenApplications(ctx, e.App, e.Record); err != nil {
+				return handlers.Fail(ctx, handlers.ErrJobTransitionFailed.Wrap(err), "jobID", e.Record.Id)
+			}
+		}
+
+		handlers.LogInfo(ctx, "Job status changed", "jobID", e.Record.Id, "from", from, "to", to)
+		return nil
+	})
+}
+
+// checkPreconditions return the catalogue error of the first unmet requirement of the target status
+func checkPreconditions(app core.App, job *core.Record, to string) *handlers.DomainError {
+	switch to {
+	case StatusHiring:
+		if len(job.GetStringSlice("rates")) == 0 {
+			return handlers.ErrJobPreconditionFailed.WithParams("status", to, "requirement", "rate")
+		}
+	case StatusReady, StatusInProgress:
+		if len(job.GetStringSlice("rates")) == 0 {
+			return handlers.ErrJobPreconditionFailed.WithParams("status", to, "requirement", "rate")
+		}
+		hired, err := countMembers(app, job.Id, MemberStatusHired)
+		if err != nil {
+			return handlers.ErrJobTransitionFailed.Wrap(err)
+		}
+		if hired == 0 {
+			return handlers.ErrJobPreconditionFailed.WithParams("status", to, "requirement", "hiredMember")
+		}
+	}
+	return nil
+}
+
+func countMembers(app core.App, jobID string, statuses ...any) (int64, error) {
+	if jobID == "" {
+		return 0, nil
+	}
+	return app.CountRecords("job_members", dbx.HashExp{"jobID": jobID}, dbx.In("status", statuses...))
+}
+
+func addHistory(ctx context.Context, app core.App, job *core.Record, from string, reason string) error {
+	collection, err := app.FindCachedCollectionByNameOrId("job_status_history")
+	if err != nil {
+		return err
+	}
+
+	scope, _ := handlers.ScopeFromContext(ctx)
+	history := core.NewRecord(collection)
+	history.Set("jobID", job.Id)
+	history.Set("companyID", job.GetString("companyID"))
+	history.Set("fromStatus", from)
+	history.Set("toStatus", job.GetString("status"))
+	history.Set("reason", reason)
+	history.Set("actorId", scope.ActorID)
+	history.Set("actorCollection", scope.ActorCollection)
+	history.Set("requestId", scope.ID)
+	return app.SaveWithContext(ctx, history)
+}
+
+// closeOpenApplications reject the applications still pending once the job stops hiring
+func closeOpenApplications(ctx context.Context, app core.App, job *core.Record) error {
+	members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": job.Id}, dbx.In("status", toAny(OpenMemberStatuses)...))
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		member.Set("status", MemberStatusRejected)
+		if err := app.SaveWithContext(ctx, member); err != nil {
+			return err
+		}
+	}
+	if len(members) > 0 {
+		handlers.LogInfo(ctx, "Closed open applications", "jobID", job.Id, "count", len(members))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"encoding/json"
+	"hirevo/internal/handlers"
+	"math"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// onJobLocation default the job coordinates to the company address and follow the company when it moves
+func onJobLocation(app *pocketbase.PocketBase) {
+	app.OnRecordCreate("jobs").BindFunc(func(e *core.RecordEvent) error {
+		if hasLocation(e.Record) {
+			return e.Next()
+		}
+		ctx := handlers.RecordContext(e)
+		company, err := e.App.FindRecordById("companies", e.Record.GetString("companyID"))
+		if err != nil {
+			// the relation validation reports the missing company
+			return e.Next()
+		}
+		if lat, lng, ok := companyLocation(company); ok {
+			e.Record.Set("latitude", lat)
+			e.Record.Set("longitude", lng)
+			handlers.LogDebug(ctx, "Job location defaulted to company address", "companyID", company.Id)
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("companies").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		oldLat, oldLng, hadLocation := companyLocation(e.Record.Original())
+		lat, lng, ok := companyLocation(e.Record)
+		if !hadLocation || !ok || (oldLat == lat && oldLng == lng) {
+			return e.Next()
+		}
+
+		// jobs still at the old company address were defaulted, jobs with their own site are kept
+		companyJobs, err := e.App.FindAllRecords("jobs", dbx.HashExp{"companyID": e.Record.Id, "latitude": oldLat, "longitude": oldLng})
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to fetch jobs to relocate", "companyID", e.Record.Id)
+			return e.Next()
+		}
+		for _, job := range companyJobs {
+			job.Set("latitude", lat)
+			job.Set("longitude", lng)
+			if err := e.App.SaveWithContext(ctx, job); err != nil {
+				handlers.LogError(ctx, err, "Failed to relocate job", "jobID", job.Id)
+			}
+		}
+		if len(companyJobs) > 0 {
+			handlers.LogInfo(ctx, "Jobs relocated to the new company address", "companyID", e.Record.Id, "jobs", len(companyJobs))
+		}
+		return e.Next()
+	})
+}
+
+func hasLocation(job *core.Record) bool {
+	return job.GetFloat("latitude") != 0 || job.GetFloat("longitude") != 0
+}
+
+// companyLocation coordinates of the company address, validated on company creation
+func companyLocation(company *core.Record) (float64, float64, bool) {
+	var address struct {
+		Latitude  *float64 `json:"latitude"`
+		Longitude *float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal([]byte(company.GetString("address")), &address); err != nil {
+		return 0, 0, false
+	}
+	if address.Latitude == nil || address.Longitude == nil {
+		return 0, 0, false
+	}
+	return *address.Latitude, *address.Longitude, true
+}
+
+// HasLocation check if the job has coordinates
+func HasLocation(job *core.Record) bool {
+	return hasLocation(job)
+}
+
+// DistanceKm haversine distance between two points, same formula as the search SQL
+func DistanceKm(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Pow(math.Sin(dLat/2), 2) + math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * 6371.0 * math.Asin(math.Min(1, math.Sqrt(a)))
+}
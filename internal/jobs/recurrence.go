@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies supported from RFC 5545
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+// maxRecurrenceSpan occurrences are never generated further than this from the series start
+const maxRecurrenceSpan = 10 * 366 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// RRule subset of an RFC 5545 recurrence rule: FREQ, INTERVAL, BYDAY, BYMONTHDAY, UNTIL and COUNT
+type RRule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	// Until last date of the series, inclusive, a date only UNTIL is the whole local day
+	Until     time.Time
+	untilDate bool
+	Count     int
+}
+
+// ParseRRule read a rule such as "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;UNTIL=20261219"
+func ParseRRule(value string) (RRule, error) {
+	rule := RRule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	if value == "" {
+		return rule, fmt.Errorf("empty rule")
+	}
+
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok || val == "" {
+			return rule, fmt.Errorf("invalid part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+			if rule.Freq != FreqDaily && rule.Freq != FreqWeekly && rule.Freq != FreqMonthly {
+				return rule, fmt.Errorf("unsupported FREQ %q, expected DAILY, WEEKLY or MONTHLY", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 || n > 366 {
+				return rule, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid COUNT %q", val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := time.Parse("20060102T150405Z", val)
+			if err != nil {
+				if until, err = time.Parse("20060102", val); err != nil {
+					return rule, fmt.Errorf("invalid UNTIL %q, expected YYYYMMDD or YYYYMMDDTHHMMSSZ", val)
+				}
+				rule.untilDate = true
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(val), ",") {
+				weekday, ok := weekdays[strings.TrimSpace(day)]
+				if !ok {
+					return rule, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				n, err := strconv.Atoi(strings.TrimSpace(day))
+				if err != nil || n < 1 || n > 31 {
+					return rule, fmt.Errorf("invalid BYMONTHDAY %q", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		case "WKST":
+			if strings.ToUpper(val) != "MO" {
+				return rule, fmt.Errorf("unsupported WKST %q, weeks start on Monday", val)
+			}
+		default:
+			return rule, fmt.Errorf("unsupported part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return rule, fmt.Errorf("COUNT and UNTIL cannot be used together")
+	}
+	return rule, nil
+}
+
+// Occurrences start times of the series starting at dtstart, in its location, within [from, to)
+func (r RRule) Occurrences(dtstart time.Time, from time.Time, to time.Time) []time.Time {
+	loc := dtstart.Location()
+	first := dateOf(dtstart)
+	end := to
+	if limit := dtstart.Add(maxRecurrenceSpan); limit.Before(end) {
+		end = limit
+	}
+	last := dateOf(end.In(loc))
+
+	occurrences := []time.Time{}
+	count := 0
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		if !r.matches(first, day) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), dtstart.Hour(), dtstart.Minute(), dtstart.Second(), 0, loc)
+		if start.Before(dtstart) {
+			continue
+		}
+		if !r.Until.IsZero() {
+			if r.untilDate && DateKey(start) > r.Until.Format(time.DateOnly) {
+				break
+			}
+			if !r.untilDate && start.After(r.Until) {
+				break
+			}
+		}
+		count++
+		if r.Count > 0 && count > r.Count {
+			break
+		}
+		if !start.Before(to) {
+			break
+		}
+		if !start.Before(from) {
+			occurrences = append(occurrences, start)
+		}
+	}
+	return occurrences
+}
+
+// matches check if the local day is part of the series starting on the first day
+func (r RRule) matches(first time.Time, day time.Time) bool {
+	switch r.Freq {
+	case FreqDaily:
+		if daysBetween(first, day)%r.Interval != 0 {
+			return false
+		}
+		return len(r.ByDay) == 0 || slices.Contains(r.ByDay, day.Weekday())
+	case FreqWeekly:
+		if daysBetween(weekStart(first), weekStart(day))/7%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) == 0 {
+			return day.Weekday() == first.Weekday()
+		}
+		return slices.Contains(r.ByDay, day.Weekday())
+	case FreqMonthly:
+		months := (day.Year()-first.Year())*12 + int(day.Month()-first.Month())
+		if months%r.Interval != 0 {
+			return false
+		}
+		if len(r.ByDay) > 0 && !slices.Contains(r.ByDay, day.Weekday()) {
+			return false
+		}
+		if len(r.ByMonthDay) == 0 {
+			return len(r.ByDay) > 0 || day.Day() == first.Day()
+		}
+		return slices.Contains(r.ByMonthDay, day.Day())
+	}
+	return false
+}
+
+// DateKey local date of the time, YYYY-MM-DD
+func DateKey(t time.Time) string {
+	return t.Format(time.DateOnly)
+}
+
+// dateOf midnight of the local day, in UTC so adding days ignores daylight saving
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func daysBetween(from time.Time, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// weekStart Monday of the week of the day
+func weekStart(day time.Time) time.Time {
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
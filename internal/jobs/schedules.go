@@ -0,0 +1,334 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hirevo/internal/handlers"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// DefaultTimezone of the schedules without a timezone
+const DefaultTimezone = "Australia/Sydney"
+
+// scheduleExpansionCron roll the schedules horizon every day at 1am
+const scheduleExpansionCron = "0 1 * * *"
+
+// ScheduleSync changes made to the job_rates of a schedule
+type ScheduleSync struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+// onScheduleChange validate the schedule and keep its job_rates in sync with the series
+func onScheduleChange(app *pocketbase.PocketBase, horizon time.Duration) {
+	sync := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		if _, _, err := parseSchedule(e.Record); err != nil {
+			return handlers.Fail(ctx, err)
+		}
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		result, err := SyncSchedule(ctx, e.App, e.Record, horizon)
+		if err != nil {
+			return failSync(ctx, err, e.Record)
+		}
+		handlers.LogInfo(ctx, "Schedule synced", "scheduleID", e.Record.Id, "jobID", e.Record.GetString("jobID"), "created", result.Created, "updated", result.Updated, "removed", result.Removed)
+		return nil
+	}
+
+	app.OnRecordCreate("job_schedules").BindFunc(sync)
+	app.OnRecordUpdate("job_schedules").BindFunc(sync)
+
+	// the shifts already worked stay, the upcoming ones go with the series
+	app.OnRecordDelete("job_schedules").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		result, err := syncOccurrences(ctx, e.App, e.Record, nil)
+		if err != nil {
+			return failSync(ctx, err, e.Record)
+		}
+		handlers.LogInfo(ctx, "Schedule removed", "scheduleID", e.Record.Id, "jobID", e.Record.GetString("jobID"), "removed", result.Removed)
+		return e.Next()
+	})
+}
+
+// onScheduledShiftEdit detach a generated shift edited by hand, the series no longer overwrites it
+func onScheduledShiftEdit(app *pocketbase.PocketBase) {
+	app.OnRecordUpdateRequest("job_rates").BindFunc(func(e *core.RecordRequestEvent) error {
+		rate := e.Record
+		original := rate.Original()
+		if rate.GetString("scheduleID") == "" || rate.GetBool("detached") {
+			return e.Next()
+		}
+		if rate.GetString("startTime") != original.GetString("startTime") ||
+			rate.GetString("endTime") != original.GetString("endTime") ||
+			rate.GetInt("rateMinor") != original.GetInt("rateMinor") ||
+			rate.GetFloat("rateValue") != original.GetFloat("rateValue") {
+			rate.Set("detached", true)
+			handlers.LogDebug(e.Request.Context(), "Scheduled shift detached", "rateID", rate.Id, "scheduleID", rate.GetString("scheduleID"))
+		}
+		return e.Next()
+	})
+}
+
+// onHolidayChange resync the schedules so the upcoming shifts follow the public holidays
+func onHolidayChange(app *pocketbase.PocketBase, horizon time.Duration) {
+	resync := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		if _, err := SyncAllSchedules(ctx, e.App, horizon); err != nil {
+			handlers.LogError(ctx, err, "Failed to sync schedules after holiday change", "holidayID", e.Record.Id, "date", e.Record.GetString("date"))
+		}
+		return e.Next()
+	}
+
+	app.OnRecordAfterCreateSuccess("public_holidays").BindFunc(resync)
+	app.OnRecordAfterUpdateSuccess("public_holidays").BindFunc(resync)
+	app.OnRecordAfterDeleteSuccess("public_holidays").BindFunc(resync)
+}
+
+// scheduleExpansion expand the schedules up to the rolling horizon
+func scheduleExpansion(app *pocketbase.PocketBase, horizon time.Duration) {
+	app.Cron().MustAdd("jobsExpandSchedules", scheduleExpansionCron, func() {
+		if _, err := SyncAllSchedules(context.Background(), app, horizon); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to expand job schedules")
+		}
+	})
+}
+
+// SyncAllSchedules sync the schedules of the jobs not finished, a failing schedule does not stop the others
+func SyncAllSchedules(ctx context.Context, app core.App, horizon time.Duration) (int, error) {
+	schedules, err := app.FindRecordsByFilter(
+		"job_schedules",
+		"jobID.status != {:cancelled} && jobID.status != {:completed}",
+		"created", 0, 0,
+		dbx.Params{"cancelled": StatusCancelled, "completed": StatusCompleted},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	var errs []error
+	for _, schedule := range schedules {
+		result, err := SyncSchedule(ctx, app, schedule, horizon)
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to sync schedule", "scheduleID", schedule.Id, "jobID", schedule.GetString("jobID"))
+			errs = append(errs, err)
+			continue
+		}
+		if result != (ScheduleSync{}) {
+			synced++
+			handlers.LogInfo(ctx, "Schedule synced", "scheduleID", schedule.Id, "jobID", schedule.GetString("jobID"), "created", result.Created, "updated", result.Updated, "removed", result.Removed)
+		}
+	}
+	return synced, errors.Join(errs...)
+}
+
+// SyncSchedule create, update and remove the upcoming job_rates of the schedule up to the horizon,
+// holidays and exceptions are skipped and the shifts edited by hand are left alone
+func SyncSchedule(ctx context.Context, app core.App, schedule *core.Record, horizon time.Duration) (ScheduleSync, error) {
+	rule, loc, ruleErr := parseSchedule(schedule)
+	if ruleErr != nil {
+		return ScheduleSync{}, ruleErr
+	}
+	job, err := app.FindRecordById("jobs", schedule.GetString("jobID"))
+	if err != nil {
+		return ScheduleSync{}, err
+	}
+
+	var occurrences []time.Time
+	if status := job.GetString("status"); status != StatusCancelled && status != StatusCompleted {
+		now := time.Now()
+		dtstart := schedule.GetDateTime("startTime").Time().In(loc)
+		occurrences = rule.Occurrences(dtstart, now, now.Add(horizon))
+	}
+
+	skipped, err := skippedDates(app, schedule)
+	if err != nil {
+		return ScheduleSync{}, err
+	}
+	kept := occurrences[:0]
+	for _, start := range occurrences {
+		if !skipped[DateKey(start)] {
+			kept = append(kept, start)
+		}
+	}
+	return syncOccurrences(ctx, app, schedule, kept)
+}
+
+// syncOccurrences make the upcoming generated job_rates of the schedule match the occurrences
+func syncOccurrences(ctx context.Context, app core.App, schedule *core.Record, occurrences []time.Time) (ScheduleSync, error) {
+	result := ScheduleSync{}
+	err := app.RunInTransaction(func(txApp core.App) error {
+		job, err := txApp.FindRecordById("jobs", schedule.GetString("jobID"))
+		if err != nil {
+			return err
+		}
+		rates, err := txApp.FindAllRecords("job_rates", dbx.HashExp{"scheduleID": schedule.Id})
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]*core.Record, len(rates))
+		for _, rate := range rates {
+			existing[rate.GetString("occurrence")] = rate
+		}
+
+		duration := time.Duration(schedule.GetInt("durationMinutes")) * time.Minute
+		wanted := make(map[string]bool, len(occurrences))
+		added := []string{}
+		for _, start := range occurrences {
+			key := DateKey(start)
+			wanted[key] = true
+			startTime := start.UTC().Format(time.RFC3339)
+			endTime := start.Add(duration).UTC().Format(time.RFC3339)
+
+			rate, ok := existing[key]
+			if ok && (rate.GetBool("detached") ||
+				(rate.GetString("startTime") == startTime && rate.GetString("endTime") == endTime && rate.GetInt("rateMinor") == schedule.GetInt("rateMinor"))) {
+				continue
+			}
+			if !ok {
+				collection, err := txApp.FindCollectionByNameOrId("job_rates")
+				if err != nil {
+					return err
+				}
+				rate = core.NewRecord(collection)
+				rate.Set("scheduleID", schedule.Id)
+				rate.Set("occurrence", key)
+			}
+			rate.Set("startTime", startTime)
+			rate.Set("endTime", endTime)
+			rate.Set("rateMinor", schedule.GetInt("rateMinor"))
+			rate.Set("rateValue", schedule.GetFloat("rateValue"))
+			if err := txApp.SaveWithContext(ctx, rate); err != nil {
+				return err
+			}
+			if ok {
+				result.Updated++
+			} else {
+				added = append(added, rate.Id)
+				result.Created++
+			}
+		}
+
+		now := time.Now()
+		removed := []*core.Record{}
+		for key, rate := range existing {
+			if wanted[key] || rate.GetBool("detached") {
+				continue
+			}
+			if shift, ok := ParseShift(rate); ok && !shift.Start.After(now) {
+				continue
+			}
+			removed = append(removed, rate)
+		}
+
+		if len(added) > 0 || len(removed) > 0 {
+			job.Set("rates+", added)
+			for _, rate := range removed {
+				job.Set("rates-", rate.Id)
+			}
+			if err := txApp.SaveWithContext(ctx, job); err != nil {
+				return err
+			}
+		}
+		for _, rate := range removed {
+			if err := txApp.DeleteWithContext(ctx, rate); err != nil {
+				return err
+			}
+			result.Removed++
+		}
+		return nil
+	})
+	return result, err
+}
+
+// skippedDates exceptions of the schedule and, when it skips them, the public holidays of its region
+func skippedDates(app core.App, schedule *core.Record) (map[string]bool, error) {
+	skipped := map[string]bool{}
+	var exceptions []string
+	if raw := schedule.GetString("exceptions"); raw != "" && raw != "null" {
+		if err := json.Unmarshal([]byte(raw), &exceptions); err != nil {
+			return nil, err
+		}
+	}
+	for _, date := range exceptions {
+		skipped[date] = true
+	}
+
+	if !schedule.GetBool("skipHolidays") {
+		return skipped, nil
+	}
+	holidays, err := app.FindRecordsByFilter(
+		"public_holidays",
+		"region = '' || region = {:region}",
+		"", 0, 0,
+		dbx.Params{"region": schedule.GetString("holidayRegion")},
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, holiday := range holidays {
+		skipped[holiday.GetString("date")] = true
+	}
+	return skipped, nil
+}
+
+// parseSchedule recurrence rule and timezone of the schedule
+func parseSchedule(schedule *core.Record) (RRule, *time.Location, *handlers.DomainError) {
+	rule, err := ParseRRule(schedule.GetString("rrule"))
+	if err != nil {
+		return rule, nil, handlers.ErrScheduleInvalid.Wrap(err).WithField("rrule", validation.NewError(
+			"invalid_rrule",
+			"Invalid recurrence rule: "+err.Error(),
+		))
+	}
+
+	timezone := schedule.GetString("timezone")
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return rule, nil, handlers.ErrScheduleInvalid.Wrap(err).WithField("timezone", validation.NewError(
+			"invalid_timezone",
+			"Unknown timezone",
+		))
+	}
+
+	var exceptions []string
+	if raw := schedule.GetString("exceptions"); raw != "" && raw != "null" {
+		if err := json.Unmarshal([]byte(raw), &exceptions); err != nil {
+			return rule, nil, handlers.ErrScheduleInvalid.Wrap(err).WithField("exceptions", validation.NewError(
+				"invalid_exceptions",
+				"Exceptions must be a list of YYYY-MM-DD dates",
+			))
+		}
+	}
+	for _, date := range exceptions {
+		if _, err := time.Parse(time.DateOnly, date); err != nil {
+			return rule, nil, handlers.ErrScheduleInvalid.Wrap(err).WithParams("date", date).WithField("exceptions", validation.NewError(
+				"invalid_exceptions",
+				"Exceptions must be a list of YYYY-MM-DD dates",
+			))
+		}
+	}
+	return rule, loc, nil
+}
+
+// failSync keep the domain errors of the nested saves (eg. a shift conflict), else report a sync failure
+func failSync(ctx context.Context, err error, schedule *core.Record) error {
+	var domainErr *handlers.DomainError
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+	return handlers.Fail(ctx, handlers.ErrScheduleSyncFailed.Wrap(err), "scheduleID", schedule.Id, "jobID", schedule.GetString("jobID"))
+}
@@ -0,0 +1,229 @@
+package jobs
+
+import (
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Search limits
+const (
+	DefaultSearchRadiusKm = 25.0
+	MaxSearchRadiusKm     = 200.0
+	defaultSearchPerPage  = 30
+	maxSearchPerPage      = 100
+)
+
+// kmPerDegree length of a degree of latitude
+const kmPerDegree = 111.32
+
+// haversineSQL great circle distance in km (earth mean radius 6371 km) between the job and {:lat}/{:lng},
+// needs the SQLite math functions
+const haversineSQL = "2 * 6371.0 * asin(min(1, sqrt(" +
+	"power(sin(radians([[jobs.latitude]] - {:lat}) / 2), 2) + " +
+	"cos(radians({:lat})) * cos(radians([[jobs.latitude]])) * power(sin(radians([[jobs.longitude]] - {:lng}) / 2), 2)" +
+	")))"
+
+// JobSearchQuery filters of the nearby jobs search
+type JobSearchQuery struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+	MinRate   *float64
+	MaxRate   *float64
+	From      *time.Time
+	To        *time.Time
+	Page      int
+	PerPage   int
+}
+
+// JobSearchItem job with its distance from the searched point
+type JobSearchItem struct {
+	Job        *core.Record `json:"job"`
+	DistanceKm float64      `json:"distanceKm"`
+}
+
+// JobSearchResponse paginated HIRING jobs sorted by distance
+type JobSearchResponse struct {
+	Page       int             `json:"page"`
+	PerPage    int             `json:"perPage"`
+	TotalItems int64           `json:"totalItems"`
+	Items      []JobSearchItem `json:"items"`
+}
+
+func onJobSearchRequest(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/jobs/search", searchJobsRequest).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// searchJobsRequest GET /api/jobs/search?lat=&lng=&radiusKm=&minRate=&maxRate=&from=&to=&page=&perPage=
+func searchJobsRequest(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	query, err := parseSearchQuery(e.Request.URL.Query())
+	if err != nil {
+		return handlers.Fail(ctx, err)
+	}
+
+	response, searchErr := SearchJobs(e.App, query)
+	if searchErr != nil {
+		handlers.LogError(ctx, searchErr, "Failed to search jobs", "lat", query.Latitude, "lng", query.Longitude, "radiusKm", query.RadiusKm)
+		return handlers.Fail(ctx, handlers.ErrJobSearchFailed.Wrap(searchErr))
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+func parseSearchQuery(values url.Values) (JobSearchQuery, *handlers.DomainError) {
+	query := JobSearchQuery{RadiusKm: DefaultSearchRadiusKm, Page: 1, PerPage: defaultSearchPerPage}
+	invalid := func(field string, message string) *handlers.DomainError {
+		return handlers.ErrJobSearchInvalid.WithParams("field", field).WithField(field, validation.NewError("invalid_"+strings.ToLower(field), message))
+	}
+
+	var err error
+	if query.Latitude, err = strconv.ParseFloat(values.Get("lat"), 64); err != nil || query.Latitude < -90 || query.Latitude > 90 {
+		return query, invalid("lat", "Latitude is required and must be between -90 and 90")
+	}
+	if query.Longitude, err = strconv.ParseFloat(values.Get("lng"), 64); err != nil || query.Longitude < -180 || query.Longitude > 180 {
+		return query, invalid("lng", "Longitude is required and must be between -180 and 180")
+	}
+	if raw := values.Get("radiusKm"); raw != "" {
+		if query.RadiusKm, err = strconv.ParseFloat(raw, 64); err != nil || query.RadiusKm <= 0 || query.RadiusKm > MaxSearchRadiusKm {
+			return query, invalid("radiusKm", "Radius must be greater than 0 and at most "+strconv.Itoa(int(MaxSearchRadiusKm))+" km")
+		}
+	}
+
+	for _, param := range []struct {
+		name   string
+		target **float64
+	}{{"minRate", &query.MinRate}, {"maxRate", &query.MaxRate}} {
+		if raw := values.Get(param.name); raw != "" {
+			rate, err := strconv.ParseFloat(raw, 64)
+			if err != nil || rate < 0 {
+				return query, invalid(param.name, "Rate must be a positive number")
+			}
+			*param.target = &rate
+		}
+	}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		if raw := values.Get(param.name); raw != "" {
+			date, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return query, invalid(param.name, "Date must use the RFC3339 format")
+			}
+			*param.target = &date
+		}
+	}
+
+	if page, err := strconv.Atoi(values.Get("page")); err == nil && page > 0 {
+		query.Page = page
+	}
+	if perPage, err := strconv.Atoi(values.Get("perPage")); err == nil && perPage > 0 {
+		query.PerPage = min(perPage, maxSearchPerPage)
+	}
+	return query, nil
+}
+
+// SearchJobs HIRING jobs within the radius, prefiltered by bounding box on the location index then sorted by haversine distance
+func SearchJobs(app core.App, query JobSearchQuery) (*JobSearchResponse, error) {
+	params := dbx.Params{
+		"lat":    query.Latitude,
+		"lng":    query.Longitude,
+		"radius": query.RadiusKm,
+		"status": StatusHiring,
+	}
+
+	where := []string{
+		"[[jobs.status]] = {:status}",
+		"[[jobs.deletedAt]] = ''",
+		"NOT EXISTS (SELECT 1 FROM {{companies}} c WHERE c.id = [[jobs.companyID]] AND c.deletedAt != '')",
+	}
+
+	deltaLat := query.RadiusKm / kmPerDegree
+	params["minLat"], params["maxLat"] = query.Latitude-deltaLat, query.Latitude+deltaLat
+	where = append(where, "[[jobs.latitude]] BETWEEN {:minLat} AND {:maxLat}")
+	// near the poles or across the antimeridian the longitude box is not a simple range, the haversine filter is enough
+	if cosLat := math.Cos(query.Latitude * math.Pi / 180); cosLat > 0.01 {
+		deltaLng := query.RadiusKm / (kmPerDegree * cosLat)
+		if query.Longitude-deltaLng >= -180 && query.Longitude+deltaLng <= 180 {
+			params["minLng"], params["maxLng"] = query.Longitude-deltaLng, query.Longitude+deltaLng
+			where = append(where, "[[jobs.longitude]] BETWEEN {:minLng} AND {:maxLng}")
+		}
+	}
+
+	// at least one shift of the job matches every rate/date filter
+	var shift []string
+	if query.MinRate != nil {
+		shift = append(shift, "r.rateMinor >= {:minRate}")
+		params["minRate"] = currency.FromMajor(*query.MinRate, currency.Base, currency.RoundHalfUp).Minor
+	}
+	if query.MaxRate != nil {
+		shift = append(shift, "r.rateMinor <= {:maxRate}")
+		params["maxRate"] = currency.FromMajor(*query.MaxRate, currency.Base, currency.RoundHalfUp).Minor
+	}
+	if query.From != nil {
+		shift = append(shift, "datetime(r.startTime) >= datetime({:from})")
+		params["from"] = query.From.UTC().Format(time.RFC3339)
+	}
+	if query.To != nil {
+		shift = append(shift, "datetime(r.endTime) <= datetime({:to})")
+		params["to"] = query.To.UTC().Format(time.RFC3339)
+	}
+	if len(shift) > 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM json_each([[jobs.rates]]) jr JOIN {{job_rates}} r ON r.id = jr.value WHERE "+strings.Join(shift, " AND ")+")")
+	}
+
+	nearby := "SELECT [[jobs.id]] AS id, " + haversineSQL + " AS distance FROM {{jobs}} WHERE " + strings.Join(where, " AND ")
+
+	var total int64
+	err := app.DB().NewQuery("SELECT count(*) FROM (" + nearby + ") WHERE distance <= {:radius}").Bind(params).Row(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	params["limit"] = query.PerPage
+	params["offset"] = (query.Page - 1) * query.PerPage
+	var rows []struct {
+		ID       string  `db:"id"`
+		Distance float64 `db:"distance"`
+	}
+	err = app.DB().NewQuery("SELECT id, distance FROM (" + nearby + ") WHERE distance <= {:radius} ORDER BY distance, id LIMIT {:limit} OFFSET {:offset}").Bind(params).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	records, err := app.FindRecordsByIds("jobs", ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*core.Record, len(records))
+	for _, record := range records {
+		byID[record.Id] = record
+	}
+
+	items := make([]JobSearchItem, 0, len(rows))
+	for _, row := range rows {
+		if job, ok := byID[row.ID]; ok {
+			items = append(items, JobSearchItem{Job: job, DistanceKm: math.Round(row.Distance*100) / 100})
+		}
+	}
+	return &JobSearchResponse{Page: query.Page, PerPage: query.PerPage, TotalItems: total, Items: items}, nil
+}
@@ -0,0 +1,105 @@
+package jobs
+
+import (
+	"hirevo/internal/currency"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Shift a job_rates window with its hourly rate
+type Shift struct {
+	ID    string
+	Start time.Time
+	End   time.Time
+	// Rate hourly, in the base currency
+	Rate currency.Money
+}
+
+// ParseShift read a job_rates record, ok is false when the times are missing or invalid
+func ParseShift(rate *core.Record) (Shift, bool) {
+	start, err := time.Parse(time.RFC3339, rate.GetString("startTime"))
+	if err != nil {
+		return Shift{}, false
+	}
+	end, err := time.Parse(time.RFC3339, rate.GetString("endTime"))
+	if err != nil || !end.After(start) {
+		return Shift{}, false
+	}
+	return Shift{ID: rate.Id, Start: start, End: end, Rate: currency.New(int64(rate.GetInt("rateMinor")), currency.Base)}, true
+}
+
+// FindShifts valid shifts of the job, sorted as stored
+func FindShifts(app core.App, job *core.Record) ([]Shift, error) {
+	ids := job.GetStringSlice("rates")
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	rates, err := app.FindRecordsByIds("job_rates", ids)
+	if err != nil {
+		return nil, err
+	}
+	shifts := make([]Shift, 0, len(rates))
+	for _, rate := range rates {
+		if shift, ok := ParseShift(rate); ok {
+			shifts = append(shifts, shift)
+		}
+	}
+	return shifts, nil
+}
+
+// LastShiftEnd end of the latest shift of the job, zero when the job has no valid shift
+func LastShiftEnd(app core.App, job *core.Record) time.Time {
+	shifts, err := FindShifts(app, job)
+	if err != nil {
+		return time.Time{}
+	}
+	var last time.Time
+	for _, shift := range shifts {
+		if shift.End.After(last) {
+			last = shift.End
+		}
+	}
+	return last
+}
+
+// Overlaps check if two shifts share some time, touching shifts do not overlap
+func (s Shift) Overlaps(other Shift) bool {
+	return s.Start.Before(other.End) && other.Start.Before(s.End)
+}
+
+// Hours duration of the shift in hours
+func (s Shift) Hours() float64 {
+	return s.End.Sub(s.Start).Hours()
+}
+
+// onRateChange keep the hourly rate in cents and its display value in dollars in step, on the shifts
+// and on the schedules generating them. rateMinor wins when both are sent, a rateValue sent alone is
+// rounded half up to the cent
+func onRateChange(app *pocketbase.PocketBase) {
+	sync := func(e *core.RecordEvent) error {
+		syncRate(e.Record)
+		return e.Next()
+	}
+	for _, collection := range []string{"job_rates", "job_schedules"} {
+		app.OnRecordCreate(collection).BindFunc(sync)
+		app.OnRecordUpdate(collection).BindFunc(sync)
+	}
+}
+
+// syncRate set the rateMinor and rateValue of the record from the one that changed
+func syncRate(record *core.Record) {
+	minor, value := int64(record.GetInt("rateMinor")), record.GetFloat("rateValue")
+	minorChanged, valueChanged := minor != 0, value != 0
+	if !record.IsNew() {
+		original := record.Original()
+		minorChanged = minor != int64(original.GetInt("rateMinor"))
+		valueChanged = value != original.GetFloat("rateValue")
+	}
+	if valueChanged && !minorChanged {
+		minor = currency.FromMajor(value, currency.Base, currency.RoundHalfUp).Minor
+		record.Set("rateMinor", minor)
+	}
+	record.Set("rateValue", currency.New(minor, currency.Base).Major())
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"hirevo/internal/config"
+	"hirevo/internal/tests"
+	"testing"
+	"time"
+)
+
+func TestRateKeptInCents(t *testing.T) {
+	app := tests.NewApp(t)
+	RegisterHooks(app, config.JobsConfig{OfferTTL: 24 * time.Hour, ScheduleHorizon: 7 * 24 * time.Hour})
+
+	// clients sending the rate in dollars get it rounded to the cent
+	rate := tests.NewRecord(t, app, "job_rates", map[string]any{
+		"startTime": "2026-10-19T08:00:00Z",
+		"endTime":   "2026-10-19T16:00:00Z",
+		"rateValue": 33.335,
+	})
+	if got, value := rate.GetInt("rateMinor"), rate.GetFloat("rateValue"); got != 3334 || value != 33.34 {
+		t.Fatalf("rate = %d cents, %v dollars, want 3334 cents, 33.34 dollars", got, value)
+	}
+
+	rate.Set("rateMinor", 3000)
+	if err := app.Save(rate); err != nil {
+		t.Fatalf("save rate: %v", err)
+	}
+	if got := rate.GetFloat("rateValue"); got != 30 {
+		t.Errorf("rateValue = %v, want 30 after the cents changed", got)
+	}
+
+	shift, ok := ParseShift(rate)
+	if !ok {
+		t.Fatal("shift not parsed")
+	}
+	if shift.Rate.Minor != 3000 || shift.Rate.Currency != "AUD" {
+		t.Errorf("shift rate = %v, want AUD 30.00", shift.Rate)
+	}
+}
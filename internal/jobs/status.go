@@ -0,0 +1,81 @@
+package jobs
+
+import "slices"
+
+// Job statuses
+const (
+	StatusDraft      = "DRAFT"
+	StatusHiring     = "HIRING"
+	StatusReady      = "READY"
+	StatusInProgress = "IN_PROGRESS"
+	StatusCompleted  = "COMPLETED"
+	StatusCancelled  = "CANCELLED"
+)
+
+// Job member statuses
+const (
+	MemberStatusApplied     = "APPLIED"
+	MemberStatusShortlisted = "SHORTLISTED"
+	MemberStatusOffered     = "OFFERED"
+	MemberStatusHired       = "HIRED"
+	MemberStatusRejected    = "REJECTED"
+	MemberStatusWithdrawn   = "WITHDRAWN"
+	MemberStatusExpired     = "EXPIRED"
+)
+
+// OpenMemberStatuses applications still waiting for a decision, closed when the job stops hiring
+var OpenMemberStatuses = []string{MemberStatusApplied, MemberStatusShortlisted, MemberStatusOffered}
+
+// memberTransitions allowed target statuses by current job member status, REJECTED, WITHDRAWN and EXPIRED are final
+var memberTransitions = map[string][]string{
+	MemberStatusApplied:     {MemberStatusShortlisted, MemberStatusOffered, MemberStatusHired, MemberStatusRejected, MemberStatusWithdrawn},
+	MemberStatusShortlisted: {MemberStatusOffered, MemberStatusHired, MemberStatusRejected, MemberStatusWithdrawn},
+	MemberStatusOffered:     {MemberStatusHired, MemberStatusRejected, MemberStatusWithdrawn, MemberStatusExpired},
+	MemberStatusHired:       {MemberStatusWithdrawn},
+	MemberStatusRejected:    {},
+	MemberStatusWithdrawn:   {},
+	MemberStatusExpired:     {},
+}
+
+// initialMemberStatuses a job member can be created with: an application, an invitation or a direct hire
+var initialMemberStatuses = []string{MemberStatusApplied, MemberStatusOffered, MemberStatusHired}
+
+// transitions allowed target statuses by current status, COMPLETED and CANCELLED are final
+var transitions = map[string][]string{
+	StatusDraft:      {StatusHiring, StatusCancelled},
+	StatusHiring:     {StatusDraft, StatusReady, StatusCancelled},
+	StatusReady:      {StatusHiring, StatusInProgress, StatusCancelled},
+	StatusInProgress: {StatusCompleted, StatusCancelled},
+	StatusCompleted:  {},
+	StatusCancelled:  {},
+}
+
+// initialStatuses a job can be created with
+var initialStatuses = []string{StatusDraft, StatusHiring}
+
+// IsStatus check if status is a known job status
+func IsStatus(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanTransition check if a job can move from one status to another
+func CanTransition(from string, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// IsActive jobs counted as active in the company reports
+func IsActive(status string) bool {
+	return status == StatusHiring || status == StatusReady || status == StatusInProgress
+}
+
+// IsMemberStatus check if status is a known job member status
+func IsMemberStatus(status string) bool {
+	_, ok := memberTransitions[status]
+	return ok
+}
+
+// CanMemberTransition check if a job member can move from one status to another
+func CanMemberTransition(from string, to string) bool {
+	return slices.Contains(memberTransitions[from], to)
+}
@@ -0,0 +1,58 @@
+package matching
+
+import (
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"net/http"
+	"strconv"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// RecommendationsResponse ranked workers for a job
+type RecommendationsResponse struct {
+	JobID string           `json:"jobId"`
+	Items []Recommendation `json:"items"`
+}
+
+// RegisterHooks expose the ranked recommendations of workers for a job
+func RegisterHooks(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/jobs/{id}/recommendations", listRecommendations).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// listRecommendations GET /api/jobs/{id}/recommendations?limit=, best candidates first with the score breakdown
+func listRecommendations(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	jobID := e.Request.PathValue("id")
+	job, err := e.App.FindRecordById("jobs", jobID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "jobs", "id", jobID))
+	}
+	if !e.HasSuperuserAuth() && !company.HasRole(e.App, job.GetString("companyID"), e.Auth.Id, company.RoleOwner, company.RoleAdmin) {
+		handlers.LogWarn(ctx, "User not allowed to see job recommendations", "jobID", jobID, "userId", e.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrMatchingForbidden.WithParams("jobID", jobID))
+	}
+
+	limit, _ := strconv.Atoi(e.Request.URL.Query().Get("limit"))
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	limit = min(limit, maxLimit)
+
+	recommendations, err := Recommend(e.App, job, limit)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to compute job recommendations", "jobID", jobID)
+		return handlers.Fail(ctx, handlers.ErrMatchingFailed.Wrap(err), "jobID", jobID)
+	}
+	return e.JSON(http.StatusOK, RecommendationsResponse{JobID: jobID, Items: recommendations})
+}
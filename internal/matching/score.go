@@ -0,0 +1,443 @@
+package matching
+
+import (
+	"encoding/json"
+	"fmt"
+	"hirevo/internal/jobs"
+	"hirevo/internal/workers"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Score factors
+const (
+	FactorSkills       = "skills"
+	FactorDistance     = "distance"
+	FactorAvailability = "availability"
+	FactorHistory      = "history"
+	FactorReliability  = "reliability"
+)
+
+// weights of each factor, they sum to 1 so the score is out of 100
+var weights = map[string]float64{
+	FactorSkills:       0.35,
+	FactorDistance:     0.25,
+	FactorAvailability: 0.20,
+	FactorHistory:      0.10,
+	FactorReliability:  0.10,
+}
+
+const (
+	// DefaultMaxTravelKm when the worker did not set how far they travel
+	DefaultMaxTravelKm = 50.0
+	// MaxCandidateDistanceKm workers further than this from the job are not considered
+	MaxCandidateDistanceKm = 150.0
+	// historyHoursTarget hours worked for the company giving the full history score
+	historyHoursTarget = 160.0
+	// maxMatchedShifts upcoming shifts checked against the worker calendars, the earliest ones
+	maxMatchedShifts = 100
+)
+
+// Factor explain one part of the score
+type Factor struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	// Value between 0 and 1
+	Value float64 `json:"value"`
+	// Points contributed to the score, Weight * Value * 100
+	Points float64 `json:"points"`
+	Detail string  `json:"detail"`
+}
+
+// Recommendation scored worker for a job
+type Recommendation struct {
+	UserID            string   `json:"userId"`
+	Name              string   `json:"name"`
+	Score             float64  `json:"score"`
+	ApplicationStatus string   `json:"applicationStatus,omitempty"`
+	Breakdown         []Factor `json:"breakdown"`
+}
+
+// candidate data needed to score a worker
+type candidate struct {
+	userID     string
+	name       string
+	skills     []string
+	lat, lng   float64
+	hasLoc     bool
+	maxTravel  float64
+	memberStat string
+	// companyHours worked for the company of the job
+	companyHours float64
+}
+
+// Recommend eligible workers for the job, best score first
+func Recommend(app core.App, job *core.Record, limit int) ([]Recommendation, error) {
+	allShifts, err := jobs.FindShifts(app, job)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	shifts := upcomingShifts(allShifts, now)
+	required, _ := workers.ParseSkills(job.GetString("requiredSkills"))
+	candidates, err := findCandidates(app, job, required, shifts)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return []Recommendation{}, nil
+	}
+	userIDs := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		userIDs = append(userIDs, c.userID)
+	}
+
+	// credentials must stay valid until the last shift of the job
+	validUntil := now
+	for _, shift := range allShifts {
+		if shift.End.After(validUntil) {
+			validUntil = shift.End
+		}
+	}
+	// required credentials are a hard filter, hiring would be refused
+	missing, err := workers.MissingCredentialsOf(app, userIDs, job.GetStringSlice("requiredCredentials"), validUntil)
+	if err != nil {
+		return nil, err
+	}
+	conflicts, err := workers.FindConflictsOf(app, userIDs, shifts, job.Id)
+	if err != nil {
+		return nil, err
+	}
+	reliability, err := reliabilityFactors(app, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]Recommendation, 0, len(candidates))
+	for _, c := range candidates {
+		if len(missing[c.userID]) > 0 {
+			continue
+		}
+
+		factors := []Factor{
+			skillsFactor(required, c.skills),
+			distanceFactor(job, c),
+			availabilityFactor(shifts, conflicts[c.userID]),
+			historyFactor(c),
+			reliability[c.userID],
+		}
+
+		score := 0.0
+		for i := range factors {
+			factors[i].Weight = weights[factors[i].Name]
+			factors[i].Points = round(factors[i].Weight * factors[i].Value * 100)
+			factors[i].Value = round(factors[i].Value)
+			score += factors[i].Points
+		}
+
+		recommendations = append(recommendations, Recommendation{
+			UserID:            c.userID,
+			Name:              c.name,
+			Score:             round(score),
+			ApplicationStatus: c.memberStat,
+			Breakdown:         factors,
+		})
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		if recommendations[i].Score != recommendations[j].Score {
+			return recommendations[i].Score > recommendations[j].Score
+		}
+		return recommendations[i].UserID < recommendations[j].UserID
+	})
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations, nil
+}
+
+// upcomingShifts shifts not over yet, earliest first, at most maxMatchedShifts.
+// Past shifts say nothing about whether the worker can still work the job
+func upcomingShifts(shifts []jobs.Shift, now time.Time) []jobs.Shift {
+	upcoming := make([]jobs.Shift, 0, len(shifts))
+	for _, shift := range shifts {
+		if shift.End.After(now) {
+			upcoming = append(upcoming, shift)
+		}
+	}
+	slices.SortFunc(upcoming, func(a, b jobs.Shift) int { return a.Start.Compare(b.Start) })
+	if len(upcoming) > maxMatchedShifts {
+		upcoming = upcoming[:maxMatchedShifts]
+	}
+	return upcoming
+}
+
+// haversineSQL great circle distance in km between the worker profile and the job at {:lat}/{:lng},
+// same formula as the jobs search
+const haversineSQL = "2 * 6371.0 * asin(min(1, sqrt(" +
+	"power(sin(radians([[worker_profiles.latitude]] - {:lat}) / 2), 2) + " +
+	"cos(radians({:lat})) * cos(radians([[worker_profiles.latitude]])) * power(sin(radians([[worker_profiles.longitude]] - {:lng}) / 2), 2)" +
+	")))"
+
+// findCandidates worker profiles that can work the job, filtered in SQL before being scored:
+// not already hired or closed on the job, with at least one of the required skills,
+// within the distance they travel and not unavailable for every shift
+func findCandidates(app core.App, job *core.Record, required []string, shifts []jobs.Shift) ([]candidate, error) {
+	query := app.RecordQuery("worker_profiles")
+
+	params := dbx.Params{"jobID": job.Id}
+	open := make([]string, 0, len(jobs.OpenMemberStatuses))
+	for i, status := range jobs.OpenMemberStatuses {
+		name := fmt.Sprintf("open%d", i)
+		params[name] = status
+		open = append(open, "{:"+name+"}")
+	}
+	query.AndWhere(dbx.NewExp("NOT EXISTS (SELECT 1 FROM {{job_members}} m WHERE m.[[jobID]] = {:jobID} "+
+		"AND m.[[userID]] = [[worker_profiles.userID]] AND m.[[status]] NOT IN ("+strings.Join(open, ", ")+"))", params))
+
+	if len(required) > 0 {
+		params := dbx.Params{}
+		skills := make([]string, 0, len(required))
+		for i, skill := range required {
+			name := fmt.Sprintf("skill%d", i)
+			params[name] = skill
+			skills = append(skills, "{:"+name+"}")
+		}
+		query.AndWhere(dbx.NewExp("EXISTS (SELECT 1 FROM json_each(CASE WHEN json_valid([[worker_profiles.skills]]) "+
+			"THEN [[worker_profiles.skills]] ELSE '[]' END) s WHERE s.value IN ("+strings.Join(skills, ", ")+"))", params))
+	}
+
+	if jobs.HasLocation(job) {
+		// workers without a location are kept, they get a neutral distance score
+		lat, lng := job.GetFloat("latitude"), job.GetFloat("longitude")
+		delta := MaxCandidateDistanceKm / 111.32
+		query.AndWhere(dbx.NewExp("([[worker_profiles.latitude]] = 0 AND [[worker_profiles.longitude]] = 0) OR ("+
+			"[[worker_profiles.latitude]] BETWEEN {:minLat} AND {:maxLat} AND "+
+			haversineSQL+" <= min({:maxDistance}, CASE WHEN [[worker_profiles.maxTravelKm]] > 0 THEN [[worker_profiles.maxTravelKm]] ELSE {:defaultTravel} END))",
+			dbx.Params{
+				"lat":           lat,
+				"lng":           lng,
+				"minLat":        lat - delta,
+				"maxLat":        lat + delta,
+				"maxDistance":   MaxCandidateDistanceKm,
+				"defaultTravel": DefaultMaxTravelKm,
+			},
+		))
+	}
+
+	if len(shifts) > 0 {
+		// a worker is kept while at least one shift is outside the declared unavailability,
+		// the shifts are passed as a JSON array so the expression does not grow with them
+		periods := make([]map[string]string, 0, len(shifts))
+		for _, shift := range shifts {
+			start, err := types.ParseDateTime(shift.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := types.ParseDateTime(shift.End)
+			if err != nil {
+				return nil, err
+			}
+			periods = append(periods, map[string]string{"start": start.String(), "end": end.String()})
+		}
+		encoded, err := json.Marshal(periods)
+		if err != nil {
+			return nil, err
+		}
+		query.AndWhere(dbx.NewExp("EXISTS (SELECT 1 FROM json_each({:shifts}) s WHERE NOT EXISTS ("+
+			"SELECT 1 FROM {{worker_availability}} a WHERE a.[[userID]] = [[worker_profiles.userID]] AND a.[[type]] = {:unavailable} "+
+			"AND a.[[startTime]] < json_extract(s.value, '$.end') AND a.[[endTime]] > json_extract(s.value, '$.start')))",
+			dbx.Params{"shifts": string(encoded), "unavailable": workers.AvailabilityUnavailable},
+		))
+	}
+
+	profiles := []*core.Record{}
+	if err := query.All(&profiles); err != nil {
+		return nil, err
+	}
+	if len(profiles) == 0 {
+		return nil, nil
+	}
+
+	members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": job.Id})
+	if err != nil {
+		return nil, err
+	}
+	memberStatus := make(map[string]string, len(members))
+	for _, member := range members {
+		memberStatus[member.GetString("userID")] = member.GetString("status")
+	}
+
+	for _, err := range app.ExpandRecords(profiles, []string{"userID"}, nil) {
+		return nil, err
+	}
+
+	userIDs := make([]any, 0, len(profiles))
+	for _, profile := range profiles {
+		userIDs = append(userIDs, profile.GetString("userID"))
+	}
+	hours, err := companyHours(app, job.GetString("companyID"), userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]candidate, 0, len(profiles))
+	for _, profile := range profiles {
+		userID := profile.GetString("userID")
+		skills, _ := workers.ParseSkills(profile.GetString("skills"))
+		c := candidate{
+			userID:       userID,
+			skills:       skills,
+			lat:          profile.GetFloat("latitude"),
+			lng:          profile.GetFloat("longitude"),
+			maxTravel:    profile.GetFloat("maxTravelKm"),
+			memberStat:   memberStatus[userID],
+			companyHours: hours[userID],
+		}
+		c.hasLoc = c.lat != 0 || c.lng != 0
+		if c.maxTravel <= 0 {
+			c.maxTravel = DefaultMaxTravelKm
+		}
+		if user := profile.ExpandedOne("userID"); user != nil {
+			c.name = user.GetString("name")
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// companyHours hours the workers worked for the company according to their user_reports
+func companyHours(app core.App, companyID string, userIDs []any) (map[string]float64, error) {
+	reports := []*core.Record{}
+	if err := app.RecordQuery("user_reports").AndWhere(dbx.In("userID", userIDs...)).All(&reports); err != nil {
+		return nil, err
+	}
+	hours := make(map[string]float64, len(reports))
+	for _, report := range reports {
+		byCompany := map[string]float64{}
+		if err := report.UnmarshalJSONField("companyHours", &byCompany); err != nil {
+			continue
+		}
+		hours[report.GetString("userID")] = byCompany[companyID]
+	}
+	return hours, nil
+}
+
+// skillsFactor share of the required skills the worker has, full score when the job requires none
+func skillsFactor(required []string, skills []string) Factor {
+	if len(required) == 0 {
+		return Factor{Name: FactorSkills, Value: 1, Detail: "No skills required"}
+	}
+	matched := []string{}
+	for _, skill := range required {
+		if slices.Contains(skills, skill) {
+			matched = append(matched, skill)
+		}
+	}
+	detail := fmt.Sprintf("%d of %d required skills", len(matched), len(required))
+	if len(matched) > 0 {
+		detail += ": " + strings.Join(matched, ", ")
+	}
+	return Factor{Name: FactorSkills, Value: float64(len(matched)) / float64(len(required)), Detail: detail}
+}
+
+// distanceFactor decrease linearly up to the distance the worker is willing to travel
+func distanceFactor(job *core.Record, c candidate) Factor {
+	if !jobs.HasLocation(job) || !c.hasLoc {
+		return Factor{Name: FactorDistance, Value: 0.5, Detail: "Location unknown"}
+	}
+	distance := jobs.DistanceKm(job.GetFloat("latitude"), job.GetFloat("longitude"), c.lat, c.lng)
+	value := math.Max(0, 1-distance/c.maxTravel)
+	return Factor{Name: FactorDistance, Value: value, Detail: fmt.Sprintf("%.1f km away, travels up to %.0f km", distance, c.maxTravel)}
+}
+
+// availabilityFactor share of the upcoming job shifts free in the worker calendar, shifts outside the published availability count half
+func availabilityFactor(shifts []jobs.Shift, conflicts []workers.Conflict) Factor {
+	if len(shifts) == 0 {
+		return Factor{Name: FactorAvailability, Value: 1, Detail: "Job has no upcoming shifts"}
+	}
+	free, outside := 0, 0
+	for _, shift := range shifts {
+		kinds := []string{}
+		for _, conflict := range conflicts {
+			if conflict.ShiftID == shift.ID {
+				kinds = append(kinds, conflict.Kind)
+			}
+		}
+		switch {
+		case len(kinds) == 0:
+			free++
+		case len(kinds) == 1 && kinds[0] == workers.ConflictOutsideAvailability:
+			outside++
+		}
+	}
+	detail := fmt.Sprintf("Free for %d of %d upcoming shifts", free, len(shifts))
+	if outside > 0 {
+		detail += fmt.Sprintf(", %d outside the published availability", outside)
+	}
+	return Factor{
+		Name:   FactorAvailability,
+		Value:  (float64(free) + 0.5*float64(outside)) / float64(len(shifts)),
+		Detail: detail,
+	}
+}
+
+// historyFactor hours the worker already worked for the company, from the user report
+func historyFactor(c candidate) Factor {
+	return Factor{
+		Name:   FactorHistory,
+		Value:  math.Min(1, c.companyHours/historyHoursTarget),
+		Detail: fmt.Sprintf("%.1f hours worked for the company", c.companyHours),
+	}
+}
+
+// reliabilityFactors hires against withdrawals and expired offers of each worker, by user,
+// smoothed so new workers start at 0.5
+func reliabilityFactors(app core.App, userIDs []string) (map[string]Factor, error) {
+	ids := make([]any, 0, len(userIDs))
+	for _, userID := range userIDs {
+		ids = append(ids, userID)
+	}
+	var counts []struct {
+		UserID string `db:"userID"`
+		Status string `db:"status"`
+		Total  int    `db:"total"`
+	}
+	err := app.RecordQuery("job_members").
+		Select("userID", "status", "count(*) AS total").
+		AndWhere(dbx.In("userID", ids...)).
+		AndWhere(dbx.In("status", jobs.MemberStatusHired, jobs.MemberStatusWithdrawn, jobs.MemberStatusExpired)).
+		GroupBy("userID", "status").
+		All(&counts)
+	if err != nil {
+		return nil, err
+	}
+	kept, dropped := map[string]int{}, map[string]int{}
+	for _, count := range counts {
+		if count.Status == jobs.MemberStatusHired {
+			kept[count.UserID] += count.Total
+		} else {
+			dropped[count.UserID] += count.Total
+		}
+	}
+	factors := make(map[string]Factor, len(userIDs))
+	for _, userID := range userIDs {
+		factors[userID] = Factor{
+			Name:   FactorReliability,
+			Value:  float64(kept[userID]+1) / float64(kept[userID]+dropped[userID]+2),
+			Detail: fmt.Sprintf("%d hires, %d withdrawn or expired", kept[userID], dropped[userID]),
+		}
+	}
+	return factors, nil
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
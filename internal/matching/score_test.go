@@ -0,0 +1,122 @@
+package matching
+
+import (
+	"fmt"
+	"hirevo/internal/jobs"
+	"hirevo/internal/tests"
+	"hirevo/internal/workers"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newShift job_rates record of a shift starting at the given offset from now
+func newShift(t *testing.T, app core.App, offset time.Duration) *core.Record {
+	t.Helper()
+	start := time.Now().Add(offset).UTC().Truncate(time.Second)
+	return tests.NewRecord(t, app, "job_rates", map[string]any{
+		"startTime": start.Format(time.RFC3339),
+		"endTime":   start.Add(8 * time.Hour).Format(time.RFC3339),
+		"rateMinor": 3000,
+	})
+}
+
+func TestRecommendMatchesUpcomingShifts(t *testing.T) {
+	app := tests.NewApp(t)
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+
+	past := []*core.Record{newShift(t, app, -72*time.Hour), newShift(t, app, -48*time.Hour)}
+	upcoming := []*core.Record{newShift(t, app, 48*time.Hour), newShift(t, app, 72*time.Hour)}
+	rates := []string{}
+	for _, rate := range append(past, upcoming...) {
+		rates = append(rates, rate.Id)
+	}
+	job := tests.NewRecord(t, app, "jobs", map[string]any{
+		"companyID":           company.Id,
+		"title":               "Forklift driver",
+		"status":              jobs.StatusHiring,
+		"rates":               rates,
+		"requiredCredentials": []string{workers.CredentialForklift},
+	})
+
+	// free: free for every upcoming shift, busy during the past ones which do not matter
+	// busy: unavailable for every upcoming shift, free during the past ones
+	// partly: unavailable for one of the upcoming shifts
+	// unlicensed: free but without the required credential
+	users := map[string]*core.Record{}
+	for _, name := range []string{"free", "busy", "partly", "unlicensed"} {
+		user := tests.NewUser(t, app, name+"@example.com")
+		users[name] = user
+		tests.NewRecord(t, app, "worker_profiles", map[string]any{"userID": user.Id})
+		if name != "unlicensed" {
+			tests.NewRecord(t, app, "worker_credentials", map[string]any{
+				"userID":    user.Id,
+				"type":      workers.CredentialForklift,
+				"expiresAt": time.Now().AddDate(1, 0, 0),
+			})
+		}
+	}
+	unavailable := func(user *core.Record, shift *core.Record) {
+		tests.NewRecord(t, app, "worker_availability", map[string]any{
+			"userID":    user.Id,
+			"type":      workers.AvailabilityUnavailable,
+			"startTime": shift.GetString("startTime"),
+			"endTime":   shift.GetString("endTime"),
+		})
+	}
+	for _, shift := range past {
+		unavailable(users["free"], shift)
+	}
+	for _, shift := range upcoming {
+		unavailable(users["busy"], shift)
+	}
+	unavailable(users["partly"], upcoming[0])
+
+	recommendations, err := Recommend(app, job, 0)
+	if err != nil {
+		t.Fatalf("recommend: %v", err)
+	}
+	availability := map[string]Factor{}
+	for _, recommendation := range recommendations {
+		for _, factor := range recommendation.Breakdown {
+			if factor.Name == FactorAvailability {
+				availability[recommendation.UserID] = factor
+			}
+		}
+	}
+	if len(availability) != 2 {
+		t.Fatalf("recommended %v, want the free and partly available workers", recommendations)
+	}
+	for name, want := range map[string]Factor{
+		"free":   {Value: 1, Detail: "Free for 2 of 2 upcoming shifts"},
+		"partly": {Value: 0.5, Detail: "Free for 1 of 2 upcoming shifts"},
+	} {
+		got, ok := availability[users[name].Id]
+		if !ok {
+			t.Errorf("%s worker not recommended", name)
+			continue
+		}
+		if got.Value != want.Value || got.Detail != want.Detail {
+			t.Errorf("%s availability = %v %q, want %v %q", name, got.Value, got.Detail, want.Value, want.Detail)
+		}
+	}
+}
+
+func TestUpcomingShiftsCapped(t *testing.T) {
+	now := time.Now()
+	shifts := []jobs.Shift{}
+	for i := maxMatchedShifts + 10; i >= -10; i-- {
+		start := now.Add(time.Duration(i) * 24 * time.Hour)
+		shifts = append(shifts, jobs.Shift{ID: fmt.Sprint(i), Start: start, End: start.Add(8 * time.Hour)})
+	}
+
+	upcoming := upcomingShifts(shifts, now)
+	if len(upcoming) != maxMatchedShifts {
+		t.Fatalf("kept %d shifts, want %d", len(upcoming), maxMatchedShifts)
+	}
+	// the shift of yesterday ended 16 hours ago, the one starting now is the first kept
+	if upcoming[0].ID != "0" || upcoming[len(upcoming)-1].ID != fmt.Sprint(maxMatchedShifts-1) {
+		t.Errorf("kept shifts %s to %s, want the earliest upcoming ones", upcoming[0].ID, upcoming[len(upcoming)-1].ID)
+	}
+}
@@ -0,0 +1,142 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbound"
+	"net/http"
+	"net/mail"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/mailer"
+)
+
+// Delivery channels
+const (
+	ChannelInApp   = "IN_APP"
+	ChannelEmail   = "EMAIL"
+	ChannelWebhook = "WEBHOOK"
+)
+
+// DeliveryHeader id of the delivery sent to the webhooks, the same on every retry
+const DeliveryHeader = "X-Hirevo-Delivery"
+
+// Channel deliver a message to a user, an error leaves the delivery in the outbox to be retried
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, app core.App, message Message) error
+}
+
+var (
+	channels   = map[string]Channel{}
+	channelsMu sync.RWMutex
+)
+
+// RegisterChannel add or replace the channel delivering the messages of its name
+func RegisterChannel(channel Channel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[channel.Name()] = channel
+}
+
+func findChannel(name string) (Channel, bool) {
+	channelsMu.RLock()
+	defer channelsMu.RUnlock()
+	channel, ok := channels[name]
+	return channel, ok
+}
+
+// InAppChannel store the message in "notifications", the clients subscribed to the collection receive it over realtime
+type InAppChannel struct{}
+
+// Name of the channel
+func (InAppChannel) Name() string { return ChannelInApp }
+
+// Send create the notification of the user
+func (InAppChannel) Send(ctx context.Context, app core.App, message Message) error {
+	collection, err := app.FindCollectionByNameOrId("notifications")
+	if err != nil {
+		return err
+	}
+	notification := core.NewRecord(collection)
+	notification.Set("userID", message.UserID)
+	notification.Set("event", message.Event)
+	notification.Set("title", message.Title)
+	notification.Set("body", message.Body)
+	notification.Set("data", message.Data)
+	return app.SaveWithContext(ctx, notification)
+}
+
+// EmailChannel send the message with the mailer configured in the PocketBase settings
+type EmailChannel struct{}
+
+// Name of the channel
+func (EmailChannel) Name() string { return ChannelEmail }
+
+// Send email the message to the user address
+func (EmailChannel) Send(ctx context.Context, app core.App, message Message) error {
+	user, err := app.FindRecordById("users", message.UserID)
+	if err != nil {
+		return err
+	}
+	if user.Email() == "" {
+		return errors.New("user has no email address")
+	}
+	return app.NewMailClient().Send(&mailer.Message{
+		From: mail.Address{
+			Address: app.Settings().Meta.SenderAddress,
+			Name:    app.Settings().Meta.SenderName,
+		},
+		To:      []mail.Address{{Address: user.Email(), Name: user.GetString("name")}},
+		Subject: message.Title,
+		Text:    message.Body,
+	})
+}
+
+// WebhookChannel POST the message as JSON to the webhook URL of the user preferences
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+// NewWebhookChannel webhook channel giving up on endpoints slower than the timeout,
+// the URLs are chosen by the users so only public addresses are reached unless allowPrivate
+func NewWebhookChannel(timeout time.Duration, allowPrivate bool) *WebhookChannel {
+	return &WebhookChannel{Client: outbound.NewClient(timeout, allowPrivate)}
+}
+
+// Name of the channel
+func (c *WebhookChannel) Name() string { return ChannelWebhook }
+
+// Send post the message, any status other than 2xx is a failure
+func (c *WebhookChannel) Send(ctx context.Context, app core.App, message Message) error {
+	url := FindPreferences(app, message.UserID).WebhookURL
+	if url == "" {
+		return errors.New("user has no webhook URL")
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, message.ID)
+	req.Header.Set(handlers.RequestIDHeader, handlers.RequestID(ctx))
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected webhook response status %d", resp.StatusCode)
+	}
+	return nil
+}
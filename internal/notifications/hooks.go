@@ -0,0 +1,136 @@
+package notifications
+
+import (
+	"context"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"slices"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// offerExpiryLayout expiry of the offers in the invitation messages
+const offerExpiryLayout = "02/01/2006 15:04 MST"
+
+// RegisterHooks register the default channels, notify the status changes and retry the outbox
+func RegisterHooks(app *pocketbase.PocketBase, cfg config.NotificationsConfig) {
+	RegisterChannel(InAppChannel{})
+	RegisterChannel(EmailChannel{})
+	RegisterChannel(NewWebhookChannel(cfg.WebhookTimeout, cfg.WebhookAllowPrivateNetworks))
+
+	onPreferencesChange(app)
+	notifyOnInvoiceCreated(app)
+	notifyOnJobMemberChange(app)
+	scheduleOutbox(app, cfg)
+}
+
+// onPreferencesChange validate the channels and muted events, the webhook channel needs an URL
+func onPreferencesChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		if slices.Contains(e.Record.GetStringSlice("channels"), ChannelWebhook) && e.Record.GetString("webhookUrl") == "" {
+			return handlers.Fail(ctx, handlers.ErrNotificationPreferencesInvalid.WithField("webhookUrl", validation.NewError(
+				"webhook_url_required",
+				"A webhook URL is required to receive notifications by webhook",
+			)))
+		}
+		muted := []string{}
+		if err := e.Record.UnmarshalJSONField("mutedEvents", &muted); err != nil {
+			return handlers.Fail(ctx, handlers.ErrNotificationPreferencesInvalid.Wrap(err).WithField("mutedEvents", validation.NewError(
+				"invalid_muted_events",
+				"Muted events must be a list of event names",
+			)))
+		}
+		for _, event := range muted {
+			if _, ok := templates[event]; !ok {
+				return handlers.Fail(ctx, handlers.ErrNotificationPreferencesInvalid.WithParams("event", event).WithField("mutedEvents", validation.NewError(
+					"unknown_event",
+					"Unknown notification event",
+				)))
+			}
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("notification_preferences").BindFunc(validate)
+	app.OnRecordUpdate("notification_preferences").BindFunc(validate)
+}
+
+// notifyOnInvoiceCreated tell the user of the invoice it is available
+func notifyOnInvoiceCreated(app *pocketbase.PocketBase) {
+	app.OnRecordAfterCreateSuccess("invoices").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		companyName := ""
+		if company, err := e.App.FindRecordById("companies", e.Record.GetString("companyID")); err == nil {
+			companyName = company.GetString("name")
+		}
+		notify(ctx, e.App, e.Record.GetString("userID"), EventInvoiceCreated, map[string]any{
+			"invoiceId":   e.Record.Id,
+			"companyId":   e.Record.GetString("companyID"),
+			"companyName": companyName,
+		})
+		return e.Next()
+	})
+}
+
+// notifyOnJobMemberChange tell the worker about an offer or a hire, on creation or on a status change
+func notifyOnJobMemberChange(app *pocketbase.PocketBase) {
+	notifyStatus := func(e *core.RecordEvent, from string) {
+		var event string
+		switch to := e.Record.GetString("status"); {
+		case to == from:
+			return
+		case to == jobs.MemberStatusHired:
+			event = EventMemberHired
+		case to == jobs.MemberStatusOffered:
+			event = EventInvitationSent
+		default:
+			return
+		}
+
+		ctx := handlers.RecordContext(e)
+		data := map[string]any{"memberId": e.Record.Id, "jobId": e.Record.GetString("jobID"), "jobTitle": "", "companyName": "", "offerExpiresAt": ""}
+		if job, err := e.App.FindRecordById("jobs", e.Record.GetString("jobID")); err == nil {
+			data["jobTitle"] = job.GetString("title")
+			if company, err := e.App.FindRecordById("companies", job.GetString("companyID")); err == nil {
+				data["companyName"] = company.GetString("name")
+			}
+		}
+		if expiresAt := e.Record.GetDateTime("offerExpiresAt"); event == EventInvitationSent && !expiresAt.IsZero() {
+			loc, err := time.LoadLocation(jobs.DefaultTimezone)
+			if err != nil {
+				loc = time.UTC
+			}
+			data["offerExpiresAt"] = expiresAt.Time().In(loc).Format(offerExpiryLayout)
+		}
+		notify(ctx, e.App, e.Record.GetString("userID"), event, data)
+	}
+
+	app.OnRecordAfterCreateSuccess("job_members").BindFunc(func(e *core.RecordEvent) error {
+		notifyStatus(e, "")
+		return e.Next()
+	})
+	app.OnRecordAfterUpdateSuccess("job_members").BindFunc(func(e *core.RecordEvent) error {
+		notifyStatus(e, e.Record.Original().GetString("status"))
+		return e.Next()
+	})
+}
+
+// notify the change already happened, a notification failure is only logged
+func notify(ctx context.Context, app core.App, userID string, event string, data map[string]any) {
+	if err := Notify(ctx, app, userID, event, data); err != nil {
+		handlers.LogError(ctx, err, "Failed to queue notification", "userID", userID, "event", event)
+	}
+}
+
+// scheduleOutbox send the queued deliveries and retry the ones of the channels that were down
+func scheduleOutbox(app *pocketbase.PocketBase, cfg config.NotificationsConfig) {
+	app.Cron().MustAdd("notificationsOutbox", outboxCron, func() {
+		if _, err := DeliverPending(context.Background(), app, cfg); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to deliver pending notifications")
+		}
+	})
+}
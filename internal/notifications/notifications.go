@@ -0,0 +1,124 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbox"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Notification events
+const (
+	EventInvoiceCreated = "invoice.created"
+	EventMemberHired    = "job_member.hired"
+	EventInvitationSent = "job_member.invited"
+)
+
+// Outbox statuses
+const (
+	StatusPending = outbox.StatusPending
+	StatusSending = outbox.StatusSending
+	StatusSent    = "SENT"
+	StatusFailed  = outbox.StatusFailed
+)
+
+// defaultChannels used by the users without preferences
+var defaultChannels = []string{ChannelInApp, ChannelEmail}
+
+// Message rendered notification handed to the channels
+type Message struct {
+	// ID of the outbox delivery, stable across retries so receivers can ignore duplicates
+	ID     string         `json:"id"`
+	UserID string         `json:"userId"`
+	Event  string         `json:"event"`
+	Title  string         `json:"title"`
+	Body   string         `json:"body"`
+	Data   map[string]any `json:"data"`
+}
+
+// Preferences channels a user receives the notifications on
+type Preferences struct {
+	Channels    []string
+	WebhookURL  string
+	MutedEvents []string
+}
+
+// Notify render the event template and queue one delivery per channel enabled by the user,
+// the outbox worker sends the deliveries and retries them when a channel is down
+func Notify(ctx context.Context, app core.App, userID string, event string, data map[string]any) error {
+	message, err := render(event, data)
+	if err != nil {
+		return err
+	}
+	message.UserID = userID
+
+	preferences := FindPreferences(app, userID)
+	if slices.Contains(preferences.MutedEvents, event) {
+		handlers.LogDebug(ctx, "Notification muted by the user", "userID", userID, "event", event)
+		return nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("notification_outbox")
+	if err != nil {
+		return err
+	}
+	now, err := types.ParseDateTime(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, name := range preferences.Channels {
+		if _, ok := findChannel(name); !ok {
+			handlers.LogWarn(ctx, "Notification channel not registered", "channel", name, "userID", userID)
+			continue
+		}
+		delivery := core.NewRecord(collection)
+		delivery.Set("userID", userID)
+		delivery.Set("channel", name)
+		delivery.Set("event", event)
+		delivery.Set("title", message.Title)
+		delivery.Set("body", message.Body)
+		delivery.Set("data", message.Data)
+		delivery.Set("status", StatusPending)
+		delivery.Set("nextAttemptAt", now)
+		if err := app.SaveWithContext(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	handlers.LogInfo(ctx, "Notification queued", "userID", userID, "event", event, "channels", preferences.Channels)
+	return nil
+}
+
+// FindPreferences notification preferences of the user, the defaults when the user has none
+func FindPreferences(app core.App, userID string) Preferences {
+	preferences := Preferences{Channels: defaultChannels}
+	record, err := app.FindFirstRecordByData("notification_preferences", "userID", userID)
+	if err != nil {
+		return preferences
+	}
+	preferences.Channels = record.GetStringSlice("channels")
+	preferences.WebhookURL = record.GetString("webhookUrl")
+	_ = record.UnmarshalJSONField("mutedEvents", &preferences.MutedEvents)
+	return preferences
+}
+
+// render title and body of the event from its templates
+func render(event string, data map[string]any) (Message, error) {
+	tmpl, ok := templates[event]
+	if !ok {
+		return Message{}, fmt.Errorf("no notification template for event %q", event)
+	}
+	var title, body bytes.Buffer
+	if err := tmpl.title.Execute(&title, data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.body.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	return Message{Event: event, Title: title.String(), Body: body.String(), Data: data}, nil
+}
@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbox"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// outboxCron send the pending deliveries every minute
+const outboxCron = "* * * * *"
+
+// queue notification deliveries, retried with delays doubled from a minute up to 6 hours
+var queue = outbox.Queue{
+	Collection: "notification_outbox",
+	BatchSize:  100,
+	BaseDelay:  time.Minute,
+	MaxDelay:   6 * time.Hour,
+}
+
+// deliver send a claimed delivery on its channel, a failure schedules the next attempt
+// until cfg.MaxAttempts is reached, the error is only returned when the outbox cannot be updated
+func deliver(ctx context.Context, app core.App, cfg config.NotificationsConfig, delivery *core.Record) error {
+	message := Message{
+		ID:     delivery.Id,
+		UserID: delivery.GetString("userID"),
+		Event:  delivery.GetString("event"),
+		Title:  delivery.GetString("title"),
+		Body:   delivery.GetString("body"),
+	}
+	_ = delivery.UnmarshalJSONField("data", &message.Data)
+
+	channelName := delivery.GetString("channel")
+	var sendErr error
+	if channel, ok := findChannel(channelName); ok {
+		sendErr = channel.Send(ctx, app, message)
+	} else {
+		sendErr = fmt.Errorf("notification channel %q not registered", channelName)
+	}
+
+	attempts := queue.Attempt(delivery)
+	if sendErr == nil {
+		delivery.Set("status", StatusSent)
+		delivery.Set("sentAt", time.Now())
+		delivery.Set("lastError", "")
+	} else if queue.Fail(delivery, sendErr, cfg.MaxAttempts) {
+		handlers.LogWarn(ctx, "Notification delivery failed, will retry", "deliveryID", delivery.Id, "channel", channelName, "attempts", attempts, "error", sendErr.Error())
+	} else {
+		handlers.LogError(ctx, sendErr, "Notification delivery failed, giving up", "deliveryID", delivery.Id, "channel", channelName, "attempts", attempts)
+	}
+	if err := app.SaveWithContext(ctx, delivery); err != nil {
+		handlers.LogError(ctx, err, "Failed to update notification delivery", "deliveryID", delivery.Id)
+		return err
+	}
+	return nil
+}
+
+// DeliverPending claim and send the PENDING deliveries that are due, returns the number sent
+func DeliverPending(ctx context.Context, app core.App, cfg config.NotificationsConfig) (int, error) {
+	sent := 0
+	attempted, err := queue.DeliverPending(ctx, app, func(ctx context.Context, delivery *core.Record) error {
+		if err := deliver(ctx, app, cfg, delivery); err != nil {
+			return err
+		}
+		if delivery.GetString("status") == StatusSent {
+			sent++
+		}
+		return nil
+	})
+	if attempted > 0 {
+		handlers.LogInfo(ctx, "Attempted notification deliveries", "count", attempted, "sent", sent)
+	}
+	return sent, err
+}
@@ -0,0 +1,29 @@
+package notifications
+
+import "text/template"
+
+// messageTemplate title and body of the notifications of an event, executed with the event data
+type messageTemplate struct {
+	title *template.Template
+	body  *template.Template
+}
+
+func newTemplate(event string, title string, body string) messageTemplate {
+	return messageTemplate{
+		title: template.Must(template.New(event + ".title").Option("missingkey=error").Parse(title)),
+		body:  template.Must(template.New(event + ".body").Option("missingkey=error").Parse(body)),
+	}
+}
+
+// templates by event
+var templates = map[string]messageTemplate{
+	EventInvoiceCreated: newTemplate(EventInvoiceCreated,
+		"New invoice from {{.companyName}}",
+		"An invoice from {{.companyName}} is available in your account."),
+	EventMemberHired: newTemplate(EventMemberHired,
+		"You are hired for {{.jobTitle}}",
+		"{{.companyName}} hired you for {{.jobTitle}}. Check the job for your shifts."),
+	EventInvitationSent: newTemplate(EventInvitationSent,
+		"{{.companyName}} offered you {{.jobTitle}}",
+		"{{.companyName}} invites you to work on {{.jobTitle}}.{{if .offerExpiresAt}} Answer before {{.offerExpiresAt}}.{{end}}"),
+}
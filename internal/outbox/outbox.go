@@ -0,0 +1,137 @@
+// Package outbox delivery queue shared by the notifications and the webhooks, the hooks only save PENDING rows
+// and a cron worker claims each due row before sending it so a delivery is never sent twice at the same time
+package outbox
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Statuses shared by the queues, each queue adds its own status for the sent rows
+const (
+	StatusPending = "PENDING"
+	// StatusSending claimed by the worker sending it
+	StatusSending = "SENDING"
+	StatusFailed  = "FAILED"
+)
+
+// LastErrorMax length of the lastError field of the queues
+const LastErrorMax = 1000
+
+// claimLease time a claimed row has to be sent, past it the row is considered lost with its worker and released
+const claimLease = 10 * time.Minute
+
+// Queue collection of deliveries with a status, attempts, nextAttemptAt and lastError fields
+type Queue struct {
+	Collection string
+	// BatchSize rows attempted by a single run of the worker
+	BatchSize int
+	// BaseDelay wait after the first failed attempt, doubled after each failure up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Claim move a PENDING row to SENDING, false when another worker claimed it first.
+// The update is guarded by the status so only one worker sends each row.
+func (q Queue) Claim(app core.App, delivery *core.Record) (bool, error) {
+	lease, err := types.ParseDateTime(time.Now().Add(claimLease))
+	if err != nil {
+		return false, err
+	}
+	result, err := app.DB().Update(q.Collection,
+		dbx.Params{"status": StatusSending, "nextAttemptAt": lease.String()},
+		dbx.HashExp{"id": delivery.Id, "status": StatusPending},
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	claimed, err := result.RowsAffected()
+	return claimed == 1, err
+}
+
+// Attempt count an attempt of a claimed row, returns the number of attempts including this one
+func (q Queue) Attempt(delivery *core.Record) int {
+	attempts := delivery.GetInt("attempts") + 1
+	delivery.Set("attempts", attempts)
+	return attempts
+}
+
+// Fail record the error of the last attempt, the row is put back PENDING with a backoff until
+// maxAttempts is reached and then FAILED, returns true when the row will be retried
+func (q Queue) Fail(delivery *core.Record, sendErr error, maxAttempts int) bool {
+	attempts := delivery.GetInt("attempts")
+	delivery.Set("lastError", Truncate(sendErr.Error(), LastErrorMax))
+	if attempts >= maxAttempts {
+		delivery.Set("status", StatusFailed)
+		return false
+	}
+	delivery.Set("status", StatusPending)
+	delivery.Set("nextAttemptAt", time.Now().Add(q.RetryDelay(attempts)))
+	return true
+}
+
+// RetryDelay wait before the next attempt of a row that failed the given number of times
+func (q Queue) RetryDelay(attempts int) time.Duration {
+	delay := q.BaseDelay
+	for i := 1; i < attempts && delay < q.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, q.MaxDelay)
+}
+
+// DeliverPending claim the PENDING rows that are due and send them, the claims of the workers that stopped
+// before recording the result are released first, returns the number of rows attempted
+func (q Queue) DeliverPending(ctx context.Context, app core.App, send func(ctx context.Context, delivery *core.Record) error) (int, error) {
+	now, err := types.ParseDateTime(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if err := q.releaseExpiredClaims(app, now); err != nil {
+		return 0, err
+	}
+	deliveries, err := app.FindRecordsByFilter(q.Collection, "status = {:status} && nextAttemptAt <= {:now}", "nextAttemptAt", q.BatchSize, 0, dbx.Params{
+		"status": StatusPending,
+		"now":    now.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		claimed, err := q.Claim(app, delivery)
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+		if err := send(ctx, delivery); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+	return attempted, nil
+}
+
+// releaseExpiredClaims put back the SENDING rows whose lease is over
+func (q Queue) releaseExpiredClaims(app core.App, now types.DateTime) error {
+	_, err := app.DB().Update(q.Collection,
+		dbx.Params{"status": StatusPending},
+		dbx.NewExp("[[status]] = {:sending} AND [[nextAttemptAt]] <= {:now}", dbx.Params{"sending": StatusSending, "now": now.String()}),
+	).Execute()
+	return err
+}
+
+// Truncate cut a value to the max length of a text field, counted in characters like the field validation
+func Truncate(value string, max int) string {
+	if utf8.RuneCountInString(value) <= max {
+		return value
+	}
+	return string([]rune(value)[:max])
+}
@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"hirevo/internal/tests"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func TestRetryDelay(t *testing.T) {
+	queue := Queue{BaseDelay: time.Minute, MaxDelay: time.Hour}
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	} {
+		if got := queue.RetryDelay(tc.attempts); got != tc.want {
+			t.Errorf("RetryDelay(%d) = %s, want %s", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestClaimOnce(t *testing.T) {
+	app := tests.NewApp(t)
+	queue := Queue{Collection: "notification_outbox", BatchSize: 10, BaseDelay: time.Minute, MaxDelay: time.Hour}
+	user := tests.NewUser(t, app, "worker@example.com")
+	delivery := tests.NewRecord(t, app, "notification_outbox", map[string]any{
+		"userID":        user.Id,
+		"channel":       "IN_APP",
+		"event":         "invoice.created",
+		"status":        StatusPending,
+		"nextAttemptAt": time.Now().Add(-time.Minute),
+	})
+
+	claimed, err := queue.Claim(app, delivery)
+	if err != nil || !claimed {
+		t.Fatalf("first claim = %v, %v, want true", claimed, err)
+	}
+	claimed, err = queue.Claim(app, delivery)
+	if err != nil || claimed {
+		t.Fatalf("second claim = %v, %v, want false", claimed, err)
+	}
+
+	sent := 0
+	send := func(ctx context.Context, delivery *core.Record) error {
+		sent++
+		queue.Attempt(delivery)
+		queue.Fail(delivery, errors.New("down"), 1)
+		return app.Save(delivery)
+	}
+	if _, err := queue.DeliverPending(context.Background(), app, send); err != nil {
+		t.Fatalf("deliver pending: %v", err)
+	}
+	if sent != 0 {
+		t.Fatal("a claimed delivery was sent again")
+	}
+
+	// the worker holding the claim stopped, the delivery is sent once the lease is over
+	_, err = app.DB().Update("notification_outbox", dbx.Params{"nextAttemptAt": "2000-01-01 00:00:00.000Z"}, dbx.HashExp{"id": delivery.Id}).Execute()
+	if err != nil {
+		t.Fatalf("expire claim: %v", err)
+	}
+	if _, err := queue.DeliverPending(context.Background(), app, send); err != nil {
+		t.Fatalf("deliver pending: %v", err)
+	}
+	if sent != 1 {
+		t.Fatalf("sent %d times after the lease expired, want 1", sent)
+	}
+	failed, err := app.FindRecordById("notification_outbox", delivery.Id)
+	if err != nil {
+		t.Fatalf("find delivery: %v", err)
+	}
+	if got := failed.GetString("status"); got != StatusFailed {
+		t.Errorf("status = %s, want %s", got, StatusFailed)
+	}
+}
@@ -0,0 +1,213 @@
+package payroll
+
+import (
+	"hirevo/internal/archive"
+	"hirevo/internal/company"
+	"hirevo/internal/currency"
+	"hirevo/internal/jobs"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Penalty loadings, by the local day the shift starts on
+const (
+	LoadingOrdinary      = "ORDINARY"
+	LoadingSaturday      = "SATURDAY"
+	LoadingSunday        = "SUNDAY"
+	LoadingPublicHoliday = "PUBLIC_HOLIDAY"
+)
+
+// loadingRates multiplier of the hourly rate for each loading
+var loadingRates = map[string]float64{
+	LoadingOrdinary:      1,
+	LoadingSaturday:      1.25,
+	LoadingSunday:        1.5,
+	LoadingPublicHoliday: 2.5,
+}
+
+// loadingNames printed on the payslips
+var loadingNames = map[string]string{
+	LoadingOrdinary:      "Ordinary hours",
+	LoadingSaturday:      "Saturday",
+	LoadingSunday:        "Sunday",
+	LoadingPublicHoliday: "Public holiday",
+}
+
+// EarningsLine hours of a job paid at the same rate and loading
+type EarningsLine struct {
+	JobID    string         `json:"jobId"`
+	JobTitle string         `json:"jobTitle"`
+	Loading  string         `json:"loading"`
+	Hours    float64        `json:"hours"`
+	Rate     currency.Money `json:"rate"`
+	// Multiplier of the rate for the loading, eg. 1.5 on Sunday
+	Multiplier float64        `json:"multiplier"`
+	Amount     currency.Money `json:"amount"`
+}
+
+// Earnings of a worker for a company over a pay period, the amounts are in AUD
+type Earnings struct {
+	Lines     []EarningsLine `json:"lines"`
+	Hours     float64        `json:"hours"`
+	Gross     currency.Money `json:"gross"`
+	SuperRate float64        `json:"superRate"`
+	Super     currency.Money `json:"super"`
+	// Withholding PAYG withheld from the gross, Net is paid to the worker
+	Withholding      currency.Money `json:"withholding"`
+	Net              currency.Money `json:"net"`
+	TaxTableVersion  string         `json:"taxTableVersion"`
+	TaxFreeThreshold bool           `json:"taxFreeThreshold"`
+	PayFrequency     string         `json:"payFrequency"`
+}
+
+// ComputeEarnings pay of the shifts starting in [start, end) of the company jobs the worker is hired on,
+// withheld with the scale of the pay frequency
+func ComputeEarnings(app core.App, companyID string, userID string, start time.Time, end time.Time, frequency string) (*Earnings, error) {
+	loc := start.Location()
+	members, err := app.FindRecordsByFilter(
+		"job_members",
+		"userID = {:userID} && status = {:hired} && jobID.companyID = {:companyID} && jobID.status != {:cancelled} && jobID."+archive.ActiveFilter,
+		"", 0, 0,
+		dbx.Params{"userID": userID, "hired": jobs.MemberStatusHired, "companyID": companyID, "cancelled": jobs.StatusCancelled},
+	)
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := publicHolidays(app, companyID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	table, err := TaxTableFor(start)
+	if err != nil {
+		return nil, err
+	}
+
+	type lineKey struct {
+		jobID   string
+		loading string
+		rate    int64
+	}
+	lines := map[lineKey]*EarningsLine{}
+	for _, member := range members {
+		job, err := app.FindRecordById("jobs", member.GetString("jobID"))
+		if err != nil {
+			continue
+		}
+		shifts, err := jobs.FindShifts(app, job)
+		if err != nil {
+			return nil, err
+		}
+		for _, shift := range shifts {
+			if shift.Start.Before(start) || !shift.Start.Before(end) {
+				continue
+			}
+			loading := shiftLoading(shift.Start.In(loc), holidays)
+			key := lineKey{jobID: job.Id, loading: loading, rate: shift.Rate.Minor}
+			line, ok := lines[key]
+			if !ok {
+				line = &EarningsLine{JobID: job.Id, JobTitle: job.GetString("title"), Loading: loading, Rate: shift.Rate, Multiplier: loadingRates[loading]}
+				lines[key] = line
+			}
+			line.Hours += shift.Hours()
+		}
+	}
+
+	earnings := &Earnings{
+		Lines:            []EarningsLine{},
+		Gross:            currency.Zero(currency.Base),
+		SuperRate:        table.SuperGuaranteeRate,
+		TaxTableVersion:  table.Version,
+		TaxFreeThreshold: claimsTaxFreeThreshold(app, companyID, userID),
+		PayFrequency:     frequency,
+	}
+	for _, line := range lines {
+		line.Hours = roundHundredths(line.Hours)
+		line.Amount = line.Rate.Mul(currency.RoundHalfUp, line.Hours, line.Multiplier)
+		earnings.Lines = append(earnings.Lines, *line)
+		earnings.Hours += line.Hours
+		earnings.Gross = earnings.Gross.Add(line.Amount)
+	}
+	sort.Slice(earnings.Lines, func(i, j int) bool {
+		a, b := earnings.Lines[i], earnings.Lines[j]
+		if a.JobTitle != b.JobTitle {
+			return a.JobTitle < b.JobTitle
+		}
+		if a.Multiplier != b.Multiplier {
+			return a.Multiplier < b.Multiplier
+		}
+		return a.Rate.Minor < b.Rate.Minor
+	})
+	earnings.Hours = roundHundredths(earnings.Hours)
+	earnings.Super = earnings.Gross.Mul(currency.RoundHalfUp, earnings.SuperRate)
+	if earnings.Withholding, err = table.Withholding(earnings.Gross, frequency, earnings.TaxFreeThreshold); err != nil {
+		return nil, err
+	}
+	earnings.Net = earnings.Gross.Sub(earnings.Withholding)
+	return earnings, nil
+}
+
+// claimsTaxFreeThreshold check the membership of the worker in the company, the threshold is claimed from one payer only
+// so without an active membership recording the claim the company withholds without it
+func claimsTaxFreeThreshold(app core.App, companyID string, userID string) bool {
+	member, err := company.FindActiveMember(app, companyID, userID)
+	if err != nil {
+		return false
+	}
+	return member.GetBool("claimsTaxFreeThreshold")
+}
+
+// shiftLoading loading of a shift starting at the local time
+func shiftLoading(start time.Time, holidays map[string]bool) string {
+	switch {
+	case holidays[jobs.DateKey(start)]:
+		return LoadingPublicHoliday
+	case start.Weekday() == time.Sunday:
+		return LoadingSunday
+	case start.Weekday() == time.Saturday:
+		return LoadingSaturday
+	}
+	return LoadingOrdinary
+}
+
+// publicHolidays national holidays and the holidays of the company state within the period
+func publicHolidays(app core.App, companyID string, start time.Time, end time.Time) (map[string]bool, error) {
+	region := ""
+	if record, err := app.FindRecordById("companies", companyID); err == nil {
+		address := map[string]any{}
+		if err := record.UnmarshalJSONField("address", &address); err == nil {
+			region, _ = address["state"].(string)
+		}
+	}
+	records, err := app.FindRecordsByFilter(
+		"public_holidays",
+		"date >= {:start} && date <= {:end} && (region = '' || region = {:region})",
+		"", 0, 0,
+		dbx.Params{"start": jobs.DateKey(start), "end": jobs.DateKey(end), "region": region},
+	)
+	if err != nil {
+		return nil, err
+	}
+	holidays := make(map[string]bool, len(records))
+	for _, record := range records {
+		holidays[record.GetString("date")] = true
+	}
+	return holidays, nil
+}
+
+// FinancialYearStart 1 July starting the Australian financial year of the day
+func FinancialYearStart(day time.Time) time.Time {
+	year := day.Year()
+	if day.Month() < time.July {
+		year--
+	}
+	return time.Date(year, time.July, 1, 0, 0, 0, 0, day.Location())
+}
+
+// roundHundredths hours are paid to the hundredth of an hour
+func roundHundredths(value float64) float64 {
+	return math.Round(value*100) / 100
+}
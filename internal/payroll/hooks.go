@@ -0,0 +1,144 @@
+package payroll
+
+import (
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"math"
+	"net/http"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxPayPeriodDays longest pay period, a month
+const maxPayPeriodDays = 31
+
+// payslipRoles company roles generating the payslips, the same roles can read them in the payslips view rule
+var payslipRoles = []string{company.RoleOwner, company.RoleAdmin, company.RolePayroll}
+
+// PayslipsRequest body of the payslips generation, dates are inclusive
+type PayslipsRequest struct {
+	PeriodStart string `json:"periodStart"`
+	PeriodEnd   string `json:"periodEnd"`
+	// PayFrequency WEEKLY, FORTNIGHTLY, FOUR_WEEKLY or MONTHLY, selects the withholding scale
+	PayFrequency string `json:"payFrequency"`
+	// UserID only generate the payslip of this worker
+	UserID   string `json:"userId"`
+	Timezone string `json:"timezone"`
+}
+
+// PayslipsResponse payslips generated for the period
+type PayslipsResponse struct {
+	PeriodStart string         `json:"periodStart"`
+	PeriodEnd   string         `json:"periodEnd"`
+	Items       []*core.Record `json:"items"`
+}
+
+// RegisterHooks expose the payslips generation to the company owners, admins and payroll officers
+func RegisterHooks(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/companies/{id}/payslips", generatePayslips).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// generatePayslips POST /api/companies/{id}/payslips, one payslip per worker with shifts in the period
+func generatePayslips(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	companyID := e.Request.PathValue("id")
+	companyRecord, err := e.App.FindRecordById("companies", companyID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "companies", "id", companyID))
+	}
+	if !e.HasSuperuserAuth() && !company.HasRole(e.App, companyID, e.Auth.Id, payslipRoles...) {
+		handlers.LogWarn(ctx, "User not allowed to generate payslips", "companyID", companyID, "userId", e.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrPayslipForbidden.WithParams("companyID", companyID))
+	}
+
+	body := PayslipsRequest{}
+	if err := e.BindBody(&body); err != nil {
+		return handlers.Fail(ctx, handlers.ErrRequestInfo.Wrap(err))
+	}
+	start, end, periodErr := parsePeriod(body)
+	if periodErr != nil {
+		return handlers.Fail(ctx, periodErr)
+	}
+
+	members, err := e.App.FindRecordsByFilter(
+		"job_members",
+		"status = {:hired} && jobID.companyID = {:companyID}",
+		"", 0, 0,
+		dbx.Params{"hired": jobs.MemberStatusHired, "companyID": companyID},
+	)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrPayslipFailed.Wrap(err), "companyID", companyID)
+	}
+
+	response := PayslipsResponse{PeriodStart: body.PeriodStart, PeriodEnd: body.PeriodEnd, Items: []*core.Record{}}
+	seen := map[string]bool{}
+	for _, member := range members {
+		userID := member.GetString("userID")
+		if seen[userID] || (body.UserID != "" && userID != body.UserID) {
+			continue
+		}
+		seen[userID] = true
+		user, err := e.App.FindRecordById("users", userID)
+		if err != nil {
+			continue
+		}
+		payslip, err := GeneratePayslip(ctx, e.App, companyRecord, user, start, end, body.PayFrequency)
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to generate payslip", "companyID", companyID, "userID", userID)
+			return handlers.Fail(ctx, handlers.ErrPayslipFailed.Wrap(err), "companyID", companyID, "userID", userID)
+		}
+		if payslip != nil {
+			response.Items = append(response.Items, payslip)
+		}
+	}
+	return e.JSON(http.StatusOK, response)
+}
+
+// parsePeriod start and exclusive end of the pay period in the requested timezone, its length must match the pay frequency
+func parsePeriod(body PayslipsRequest) (time.Time, time.Time, *handlers.DomainError) {
+	invalid := func(field string, code string, message string) *handlers.DomainError {
+		return handlers.ErrPayslipInvalid.WithParams("field", field).WithField(field, validation.NewError(code, message))
+	}
+
+	timezone := body.Timezone
+	if timezone == "" {
+		timezone = jobs.DefaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, time.Time{}, invalid("timezone", "invalid_timezone", "Unknown timezone")
+	}
+	start, err := time.ParseInLocation(time.DateOnly, body.PeriodStart, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, invalid("periodStart", "invalid_period_start", "Period start must be a YYYY-MM-DD date")
+	}
+	last, err := time.ParseInLocation(time.DateOnly, body.PeriodEnd, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, invalid("periodEnd", "invalid_period_end", "Period end must be a YYYY-MM-DD date")
+	}
+	end := last.AddDate(0, 0, 1)
+	if !end.After(start) || end.Sub(start) > maxPayPeriodDays*24*time.Hour+time.Hour {
+		return time.Time{}, time.Time{}, invalid("periodEnd", "invalid_period", "The period must end after its start and last at most 31 days")
+	}
+	if !IsPayFrequency(body.PayFrequency) {
+		return time.Time{}, time.Time{}, invalid("payFrequency", "invalid_pay_frequency", "Pay frequency must be WEEKLY, FORTNIGHTLY, FOUR_WEEKLY or MONTHLY")
+	}
+	// calendar days, daylight saving changes do not count
+	days := int(math.Round(end.Sub(start).Hours() / 24))
+	if bounds := frequencyDays[body.PayFrequency]; days < bounds[0] || days > bounds[1] {
+		return time.Time{}, time.Time{}, invalid("periodEnd", "period_frequency_mismatch", "The period length does not match the pay frequency")
+	}
+	if end.After(time.Now().AddDate(0, 0, 1)) {
+		return time.Time{}, time.Time{}, invalid("periodEnd", "period_not_ended", "Payslips can only be generated for past periods")
+	}
+	return start, end, nil
+}
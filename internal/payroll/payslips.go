@@ -0,0 +1,191 @@
+package payroll
+
+import (
+	"context"
+	"fmt"
+	"hirevo/internal/currency"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	pdfgenerator "hirevo/services/pdf"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// GeneratePayslip create or replace the payslip of the worker for the period [start, end) paid at the frequency,
+// nil when the worker has no shift to pay in the period
+func GeneratePayslip(ctx context.Context, app core.App, company *core.Record, user *core.Record, start time.Time, end time.Time, frequency string) (*core.Record, error) {
+	earnings, err := ComputeEarnings(app, company.Id, user.Id, start, end, frequency)
+	if err != nil {
+		return nil, err
+	}
+	if earnings.Hours == 0 {
+		return nil, nil
+	}
+
+	periodStart, err := types.ParseDateTime(start)
+	if err != nil {
+		return nil, err
+	}
+	payslip, err := app.FindFirstRecordByFilter("payslips", "userID = {:userID} && companyID = {:companyID} && periodStart = {:periodStart}", dbx.Params{
+		"userID":      user.Id,
+		"companyID":   company.Id,
+		"periodStart": periodStart.String(),
+	})
+	if err != nil {
+		collection, err := app.FindCollectionByNameOrId("payslips")
+		if err != nil {
+			return nil, err
+		}
+		payslip = core.NewRecord(collection)
+		payslip.Set("userID", user.Id)
+		payslip.Set("companyID", company.Id)
+		payslip.Set("periodStart", periodStart)
+	}
+
+	ytd, err := yearToDate(app, company.Id, user.Id, start)
+	if err != nil {
+		return nil, err
+	}
+	ytd.Gross = ytd.Gross.Add(earnings.Gross)
+	ytd.Super = ytd.Super.Add(earnings.Super)
+	ytd.Withholding = ytd.Withholding.Add(earnings.Withholding)
+	ytd.Net = ytd.Net.Add(earnings.Net)
+
+	payslip.Set("periodEnd", end)
+	payslip.Set("lines", earnings.Lines)
+	payslip.Set("hours", earnings.Hours)
+	payslip.Set("grossMinor", earnings.Gross.Minor)
+	payslip.Set("superRate", earnings.SuperRate)
+	payslip.Set("superMinor", earnings.Super.Minor)
+	payslip.Set("withholdingMinor", earnings.Withholding.Minor)
+	payslip.Set("netMinor", earnings.Net.Minor)
+	payslip.Set("taxTableVersion", earnings.TaxTableVersion)
+	payslip.Set("taxFreeThreshold", earnings.TaxFreeThreshold)
+	payslip.Set("payFrequency", earnings.PayFrequency)
+	payslip.Set("ytdGrossMinor", ytd.Gross.Minor)
+	payslip.Set("ytdSuperMinor", ytd.Super.Minor)
+	payslip.Set("ytdWithholdingMinor", ytd.Withholding.Minor)
+	payslip.Set("ytdNetMinor", ytd.Net.Minor)
+
+	pdfBytes, err := pdfgenerator.GenerateTablePDFBytes(ctx, payslipPDFData(company, user, start, end, earnings, ytd))
+	if err != nil {
+		return nil, err
+	}
+	file, err := filesystem.NewFileFromBytes(pdfBytes, "payslip-"+jobs.DateKey(start)+".pdf")
+	if err != nil {
+		return nil, err
+	}
+	payslip.Set("document", file)
+
+	if err := app.SaveWithContext(ctx, payslip); err != nil {
+		return nil, err
+	}
+	handlers.LogInfo(ctx, "Payslip generated", "payslipID", payslip.Id, "companyID", company.Id, "userID", user.Id, "periodStart", jobs.DateKey(start), "gross", earnings.Gross.String(), "net", earnings.Net.String())
+	return payslip, nil
+}
+
+// YearToDate totals of the payslips of a financial year
+type YearToDate struct {
+	Gross       currency.Money
+	Super       currency.Money
+	Withholding currency.Money
+	Net         currency.Money
+}
+
+// yearToDate totals of the payslips of the financial year before the period, summed in cents
+func yearToDate(app core.App, companyID string, userID string, start time.Time) (YearToDate, error) {
+	zero := currency.Zero(currency.Base)
+	totals := YearToDate{Gross: zero, Super: zero, Withholding: zero, Net: zero}
+	yearStart, err := types.ParseDateTime(FinancialYearStart(start))
+	if err != nil {
+		return totals, err
+	}
+	periodStart, err := types.ParseDateTime(start)
+	if err != nil {
+		return totals, err
+	}
+	cents := struct {
+		Gross       int64 `db:"gross"`
+		Super       int64 `db:"super"`
+		Withholding int64 `db:"withholding"`
+		Net         int64 `db:"net"`
+	}{}
+	err = app.RecordQuery("payslips").
+		Select(
+			"COALESCE(SUM(grossMinor), 0) AS gross",
+			"COALESCE(SUM(superMinor), 0) AS super",
+			"COALESCE(SUM(withholdingMinor), 0) AS withholding",
+			"COALESCE(SUM(netMinor), 0) AS net",
+		).
+		AndWhere(dbx.HashExp{"userID": userID, "companyID": companyID}).
+		AndWhere(dbx.NewExp("periodStart >= {:yearStart} AND periodStart < {:periodStart}", dbx.Params{
+			"yearStart":   yearStart.String(),
+			"periodStart": periodStart.String(),
+		})).
+		One(&cents)
+	if err != nil {
+		return totals, err
+	}
+	totals.Gross = currency.New(cents.Gross, currency.Base)
+	totals.Super = currency.New(cents.Super, currency.Base)
+	totals.Withholding = currency.New(cents.Withholding, currency.Base)
+	totals.Net = currency.New(cents.Net, currency.Base)
+	return totals, nil
+}
+
+// payslipPDFData earnings lines then the totals of the period and of the financial year
+func payslipPDFData(company *core.Record, user *core.Record, start time.Time, end time.Time, earnings *Earnings, ytd YearToDate) pdfgenerator.TablePDFData {
+	rows := make([][]string, 0, len(earnings.Lines)+8)
+	for _, line := range earnings.Lines {
+		rows = append(rows, []string{
+			line.JobTitle,
+			loadingNames[line.Loading],
+			fmt.Sprintf("%.2f", line.Hours),
+			formatMoney(line.Rate),
+			fmt.Sprintf("x%.2f", line.Multiplier),
+			formatMoney(line.Amount),
+		})
+	}
+	threshold := "Tax-free threshold not claimed"
+	if earnings.TaxFreeThreshold {
+		threshold = "Tax-free threshold claimed"
+	}
+	rows = append(rows,
+		[]string{"Gross earnings", "", fmt.Sprintf("%.2f", earnings.Hours), "", "", formatMoney(earnings.Gross)},
+		[]string{"PAYG withholding", threshold, "", "", "", formatMoney(earnings.Withholding.Neg())},
+		[]string{"Net pay", "", "", "", "", formatMoney(earnings.Net)},
+		[]string{fmt.Sprintf("Superannuation guarantee (%.1f%%)", earnings.SuperRate*100), "", "", "", "", formatMoney(earnings.Super)},
+		[]string{"Year to date gross", "", "", "", "", formatMoney(ytd.Gross)},
+		[]string{"Year to date PAYG withholding", "", "", "", "", formatMoney(ytd.Withholding)},
+		[]string{"Year to date net pay", "", "", "", "", formatMoney(ytd.Net)},
+		[]string{"Year to date superannuation", "", "", "", "", formatMoney(ytd.Super)},
+	)
+
+	lastDay := end.AddDate(0, 0, -1)
+	return pdfgenerator.TablePDFData{
+		Title:  fmt.Sprintf("Earnings statement %s to %s", start.Format("02/01/2006"), lastDay.Format("02/01/2006")),
+		Header: company.GetString("name") + "\nABN " + company.GetString("abn") + "\n" + user.GetString("name"),
+		Columns: []pdfgenerator.TableColumn{
+			{Title: "Job", Width: 4},
+			{Title: "Description", Width: 3},
+			{Title: "Hours", Width: 2},
+			{Title: "Rate", Width: 2},
+			{Title: "Loading", Width: 2},
+			{Title: "Amount", Width: 2},
+		},
+		Rows:    rows,
+		Footer:  "Tax tables " + earnings.TaxTableVersion + " - generated " + time.Now().In(start.Location()).Format("02/01/2006 15:04"),
+		Author:  company.GetString("name"),
+		Subject: "Payslip of " + user.GetString("name") + " from " + jobs.DateKey(start) + " to " + jobs.DateKey(lastDay),
+	}
+}
+
+// formatMoney amounts of the payslips are in AUD, printed with the dollar sign
+func formatMoney(amount currency.Money) string {
+	return strings.Replace(amount.String(), amount.Currency+" ", "$", 1)
+}
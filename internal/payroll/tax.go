@@ -0,0 +1,138 @@
+package payroll
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"hirevo/internal/currency"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// taxTablesFile ATO withholding coefficients and super guarantee rates, one entry per financial year.
+// Add a new entry when the ATO publishes new tables, the entries already used by payslips must not change.
+//
+//go:embed data/tax_tables.json
+var taxTablesFile []byte
+
+// TaxBracket withholding of the weekly earnings below LessThan is a * x - b, the last bracket has no limit
+type TaxBracket struct {
+	LessThan float64 `json:"lessThan"`
+	A        float64 `json:"a"`
+	B        float64 `json:"b"`
+}
+
+// TaxTable withholding and super rates effective from a date
+type TaxTable struct {
+	Version            string       `json:"version"`
+	EffectiveFrom      string       `json:"effectiveFrom"`
+	SuperGuaranteeRate float64      `json:"superGuaranteeRate"`
+	NoTaxFreeThreshold []TaxBracket `json:"noTaxFreeThreshold"`
+	TaxFreeThreshold   []TaxBracket `json:"taxFreeThreshold"`
+}
+
+// Pay frequencies, they select the ATO withholding scale
+const (
+	FrequencyWeekly      = "WEEKLY"
+	FrequencyFortnightly = "FORTNIGHTLY"
+	FrequencyFourWeekly  = "FOUR_WEEKLY"
+	FrequencyMonthly     = "MONTHLY"
+)
+
+// frequencyWeeks weeks of earnings in a pay period of the frequency, monthly periods use the 13/3 weeks rule of the ATO
+var frequencyWeeks = map[string]float64{
+	FrequencyWeekly:      1,
+	FrequencyFortnightly: 2,
+	FrequencyFourWeekly:  4,
+	FrequencyMonthly:     13.0 / 3,
+}
+
+// frequencyDays shortest and longest pay period of each frequency
+var frequencyDays = map[string][2]int{
+	FrequencyWeekly:      {7, 7},
+	FrequencyFortnightly: {14, 14},
+	FrequencyFourWeekly:  {28, 28},
+	FrequencyMonthly:     {28, 31},
+}
+
+// IsPayFrequency check if the frequency is one of the supported pay frequencies
+func IsPayFrequency(frequency string) bool {
+	_, ok := frequencyWeeks[frequency]
+	return ok
+}
+
+var (
+	taxTables     []TaxTable
+	taxTablesErr  error
+	taxTablesOnce sync.Once
+)
+
+// loadTaxTables parse the embedded tables once, latest first
+func loadTaxTables() ([]TaxTable, error) {
+	taxTablesOnce.Do(func() {
+		var file struct {
+			Tables []TaxTable `json:"tables"`
+		}
+		if taxTablesErr = json.Unmarshal(taxTablesFile, &file); taxTablesErr != nil {
+			return
+		}
+		for _, table := range file.Tables {
+			if _, err := time.Parse(time.DateOnly, table.EffectiveFrom); err != nil {
+				taxTablesErr = fmt.Errorf("tax table %s: invalid effectiveFrom: %w", table.Version, err)
+				return
+			}
+			if len(table.NoTaxFreeThreshold) == 0 || len(table.TaxFreeThreshold) == 0 {
+				taxTablesErr = fmt.Errorf("tax table %s: missing brackets", table.Version)
+				return
+			}
+		}
+		sort.Slice(file.Tables, func(i, j int) bool { return file.Tables[i].EffectiveFrom > file.Tables[j].EffectiveFrom })
+		taxTables = file.Tables
+	})
+	return taxTables, taxTablesErr
+}
+
+// TaxTableFor table in effect on the day
+func TaxTableFor(day time.Time) (*TaxTable, error) {
+	tables, err := loadTaxTables()
+	if err != nil {
+		return nil, err
+	}
+	key := day.Format(time.DateOnly)
+	for i := range tables {
+		if tables[i].EffectiveFrom <= key {
+			return &tables[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no tax table effective on %s", key)
+}
+
+// Withholding PAYG amount to withhold from the gross earnings of a pay period,
+// the earnings are converted to weekly earnings with the scale of the pay frequency
+func (t *TaxTable) Withholding(gross currency.Money, frequency string, taxFreeThreshold bool) (currency.Money, error) {
+	weeks, ok := frequencyWeeks[frequency]
+	if !ok {
+		return currency.Money{}, fmt.Errorf("unknown pay frequency %q", frequency)
+	}
+	if gross.Minor <= 0 {
+		return currency.Zero(gross.Currency), nil
+	}
+
+	brackets := t.NoTaxFreeThreshold
+	if taxFreeThreshold {
+		brackets = t.TaxFreeThreshold
+	}
+	// earnings are rounded down to the dollar plus 99 cents
+	weekly := math.Floor(gross.Major()/weeks) + 0.99
+	bracket := brackets[len(brackets)-1]
+	for _, candidate := range brackets {
+		if candidate.LessThan > 0 && weekly < candidate.LessThan {
+			bracket = candidate
+			break
+		}
+	}
+	withheld := math.Round(math.Max(0, bracket.A*weekly-bracket.B))
+	return currency.FromMajor(math.Round(withheld*weeks), gross.Currency, currency.RoundHalfUp), nil
+}
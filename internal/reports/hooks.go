@@ -1,65 +1,200 @@
 package reports
 
 import (
+	"context"
+	"hirevo/internal/archive"
+	"hirevo/internal/currency"
 	"hirevo/internal/handlers"
+	"hirevo/internal/invoice"
+	"hirevo/internal/jobs"
+	"math"
 	"time"
 
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
 // RegisterHooks update company and user reports
 func RegisterHooks(app *pocketbase.PocketBase) {
 	updateCompanyReportOnJobChange(app)
 	updateCompanyReportOnInvoiceChange(app)
+	scheduleAgedReceivables(app)
 	updateUserReportOnJobMemberChange(app)
+	updateUserReportOnJobArchive(app)
+	updateUserReportOnPayslipChange(app)
 }
 
 // Job observer (create/update) -> company_reports
 func updateCompanyReportOnJobChange(app *pocketbase.PocketBase) {
 	app.OnRecordAfterCreateSuccess("jobs").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		companyID := e.Record.GetString("companyID")
-		return updateCompanyReport(app, companyID)
+		if err := updateCompanyReport(ctx, app, companyID); err != nil {
+			return err
+		}
+		return e.Next()
 	})
 
 	app.OnRecordAfterUpdateSuccess("jobs").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		companyID := e.Record.GetString("companyID")
-		return updateCompanyReport(app, companyID)
+		if err := updateCompanyReport(ctx, app, companyID); err != nil {
+			return err
+		}
+		return e.Next()
 	})
 }
 
 // Invoice observer (create/update) -> company_reports
 func updateCompanyReportOnInvoiceChange(app *pocketbase.PocketBase) {
 	app.OnRecordAfterCreateSuccess("invoices").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		companyID := e.Record.GetString("companyID")
-		return updateCompanyReport(app, companyID)
+		if err := updateCompanyReport(ctx, app, companyID); err != nil {
+			return err
+		}
+		return e.Next()
 	})
 
 	app.OnRecordAfterUpdateSuccess("invoices").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		companyID := e.Record.GetString("companyID")
-		return updateCompanyReport(app, companyID)
+		if err := updateCompanyReport(ctx, app, companyID); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+}
+
+// agedReceivablesCron refresh the aging of the unpaid invoices every night, it changes without any invoice update
+const agedReceivablesCron = "0 2 * * *"
+
+// agedReceivables amounts in the base currency of the unpaid invoices by days past their due date
+type agedReceivables struct {
+	overdueInvoices int
+	current         currency.Money
+	days1To30       currency.Money
+	days31To60      currency.Money
+	days61To90      currency.Money
+	over90          currency.Money
+}
+
+func newAgedReceivables(baseCurrency string) agedReceivables {
+	zero := currency.Zero(baseCurrency)
+	return agedReceivables{current: zero, days1To30: zero, days31To60: zero, days61To90: zero, over90: zero}
+}
+
+func (a *agedReceivables) add(total currency.Money, dueDate types.DateTime, now time.Time) {
+	if dueDate.IsZero() || !now.After(dueDate.Time()) {
+		a.current = a.current.Add(total)
+		return
+	}
+	a.overdueInvoices++
+	switch days := int(math.Ceil(now.Sub(dueDate.Time()).Hours() / 24)); {
+	case days <= 30:
+		a.days1To30 = a.days1To30.Add(total)
+	case days <= 60:
+		a.days31To60 = a.days31To60.Add(total)
+	case days <= 90:
+		a.days61To90 = a.days61To90.Add(total)
+	default:
+		a.over90 = a.over90.Add(total)
+	}
+}
+
+// Nightly refresh of the company_reports with unpaid invoices
+func scheduleAgedReceivables(app *pocketbase.PocketBase) {
+	app.Cron().MustAdd("reportsAgedReceivables", agedReceivablesCron, func() {
+		ctx := context.Background()
+		companyIDs := []string{}
+		err := app.RecordQuery("invoices").
+			Distinct(true).
+			Select("companyID").
+			AndWhere(dbx.In("status", invoice.StatusPending, invoice.StatusOverdue)).
+			AndWhere(dbx.NewExp(archive.ActiveFilter)).
+			Column(&companyIDs)
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to fetch companies with unpaid invoices")
+			return
+		}
+		for _, companyID := range companyIDs {
+			if err := updateCompanyReport(ctx, app, companyID); err != nil {
+				handlers.LogError(ctx, err, "Failed to refresh aged receivables", "companyID", companyID)
+			}
+		}
 	})
 }
 
 // Job members observer (create/update) -> user_reports
 func updateUserReportOnJobMemberChange(app *pocketbase.PocketBase) {
 	app.OnRecordAfterCreateSuccess("job_members").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		userID := e.Record.GetString("userID")
-		return updateUserReport(app, userID)
+		if err := updateUserReport(ctx, app, userID); err != nil {
+			return err
+		}
+		return e.Next()
 	})
 
 	app.OnRecordAfterUpdateSuccess("job_members").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		userID := e.Record.GetString("userID")
+		if err := updateUserReport(ctx, app, userID); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+}
+
+// Payslips observer (create/update) -> user_reports
+func updateUserReportOnPayslipChange(app *pocketbase.PocketBase) {
+	app.OnRecordAfterCreateSuccess("payslips").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		userID := e.Record.GetString("userID")
+		if err := updateUserReport(ctx, app, userID); err != nil {
+			return err
+		}
+		return e.Next()
+	})
+
+	app.OnRecordAfterUpdateSuccess("payslips").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
 		userID := e.Record.GetString("userID")
-		return updateUserReport(app, userID)
+		if err := updateUserReport(ctx, app, userID); err != nil {
+			return err
+		}
+		return e.Next()
 	})
 }
 
-func updateCompanyReport(app *pocketbase.PocketBase, companyID string) error {
+// Job observer (archive/restore) -> user_reports of the job members
+func updateUserReportOnJobArchive(app *pocketbase.PocketBase) {
+	app.OnRecordAfterUpdateSuccess("jobs").BindFunc(func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		if e.Record.GetString("deletedAt") == e.Record.Original().GetString("deletedAt") {
+			return e.Next()
+		}
+		members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": e.Record.Id})
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to fetch job_members of archived job", "jobID", e.Record.Id)
+			return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to fetch job_members of archived job"), "jobID", e.Record.Id)
+		}
+		for _, member := range members {
+			if err := updateUserReport(ctx, app, member.GetString("userID")); err != nil {
+				return err
+			}
+		}
+		return e.Next()
+	})
+}
+
+func updateCompanyReport(ctx context.Context, app *pocketbase.PocketBase, companyID string) error {
 	collection, err := app.FindCollectionByNameOrId("company_reports")
 	if err != nil {
-		handlers.LogError(err, "Failed to find company_reports collection -> CompanyID received", "companyID", companyID)
-		return handlers.InternalServerError("Failed to find company_reports collection -> CompanyID received", err, "companyID", companyID)
+		handlers.LogError(ctx, err, "Failed to find company_reports collection -> CompanyID received", "companyID", companyID)
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to find company_reports collection -> CompanyID received"), "companyID", companyID)
 	}
 
 	// Fetch or create company report
@@ -67,26 +202,27 @@ func updateCompanyReport(app *pocketbase.PocketBase, companyID string) error {
 		"companyID": companyID,
 	})
 	if err != nil {
-		handlers.LogInfo("No existing company report found, creating new", "companyID", companyID)
+		handlers.LogInfo(ctx, "No existing company report found, creating new", "companyID", companyID)
 		report = core.NewRecord(collection)
 		report.Set("companyID", companyID)
 	}
 
 	// metrics
-	jobs, err := app.FindRecordsByFilter("jobs", "companyID = {:companyID}", "-created", 0, 0, dbx.Params{
+	companyJobs, err := app.FindRecordsByFilter("jobs", "companyID = {:companyID} && "+archive.ActiveFilter, "-created", 0, 0, dbx.Params{
 		"companyID": companyID,
 	})
 	if err != nil {
 		return err
 	}
-	totalJobs := len(jobs)
+	totalJobs := len(companyJobs)
 	activeJobs := 0
 	completedJobs := 0
-	for _, job := range jobs {
-		switch job.GetString("status") {
-		case "HIRING", "READY":
+	for _, job := range companyJobs {
+		status := job.GetString("status")
+		switch {
+		case jobs.IsActive(status):
 			activeJobs++
-		case "COMPLETED":
+		case status == jobs.StatusCompleted:
 			completedJobs++
 		}
 	}
@@ -99,23 +235,35 @@ func updateCompanyReport(app *pocketbase.PocketBase, companyID string) error {
 	}
 	totalWorkers := len(members)
 
-	invoices, err := app.FindRecordsByFilter("invoices", "companyID = {:companyID}", "-created", 0, 0, dbx.Params{
+	invoices, err := app.FindRecordsByFilter("invoices", "companyID = {:companyID} && "+archive.ActiveFilter, "-created", 0, 0, dbx.Params{
 		"companyID": companyID,
 	})
 	if err != nil {
-		handlers.LogError(err, "Failed to fetch company invoices report", "companyID", companyID)
-		return handlers.InternalServerError("Failed to fetch company invoices report", err, "companyID", companyID)
+		handlers.LogError(ctx, err, "Failed to fetch company invoices report", "companyID", companyID)
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to fetch company invoices report"), "companyID", companyID)
 	}
 	totalInvoices := len(invoices)
 	paidInvoices := 0
-	totalRevenue := 0.0
+	// invoices are issued in any currency, their base total is in the company base currency
+	baseCurrency := currency.Base
+	if company, err := app.FindRecordById("companies", companyID); err == nil {
+		baseCurrency = currency.Normalize(company.GetString("baseCurrency"))
+	}
+	totalRevenue := currency.Zero(baseCurrency)
+	aging := newAgedReceivables(baseCurrency)
+	now := time.Now()
 	for _, inv := range invoices {
-		if inv.GetString("status") == "PAID" {
+		total := invoice.BaseTotal(inv)
+		if total.Currency != baseCurrency {
+			handlers.LogWarn(ctx, "Invoice issued in another base currency left out of the report", "invoiceID", inv.Id, "baseCurrency", total.Currency)
+			continue
+		}
+		switch inv.GetString("status") {
+		case invoice.StatusPaid:
 			paidInvoices++
-			metadata := inv.Get("metadata").(map[string]interface{})
-			if total, ok := metadata["Total"].(float64); ok {
-				totalRevenue += total
-			}
+			totalRevenue = totalRevenue.Add(total)
+		case invoice.StatusPending, invoice.StatusOverdue:
+			aging.add(total, inv.GetDateTime("dueDate"), now)
 		}
 	}
 
@@ -126,22 +274,34 @@ func updateCompanyReport(app *pocketbase.PocketBase, companyID string) error {
 	report.Set("totalWorkers", totalWorkers)
 	report.Set("totalInvoices", totalInvoices)
 	report.Set("paidInvoices", paidInvoices)
-	report.Set("totalRevenue", totalRevenue)
+	report.Set("currency", baseCurrency)
+	report.Set("overdueInvoices", aging.overdueInvoices)
+	// amounts in minor units, the floats are kept for display
+	for name, amount := range map[string]currency.Money{
+		"totalRevenue":       totalRevenue,
+		"receivablesCurrent": aging.current,
+		"receivables1To30":   aging.days1To30,
+		"receivables31To60":  aging.days31To60,
+		"receivables61To90":  aging.days61To90,
+		"receivablesOver90":  aging.over90,
+	} {
+		setAmount(report, name, amount)
+	}
 
-	if err := app.SaveNoValidate(report); err != nil {
-		handlers.LogError(err, "Failed to save company report", "companyID", companyID)
-		return handlers.InternalServerError("Failed to save company report", err, "companyID", companyID)
+	if err := app.SaveNoValidateWithContext(ctx, report); err != nil {
+		handlers.LogError(ctx, err, "Failed to save company report", "companyID", companyID)
+		return handlers.Fail(ctx, handlers.ErrReportSaveFailed.Wrap(err).WithMessage("Failed to save company report"), "companyID", companyID)
 	}
 
-	handlers.LogInfo("Company report updated successfully", "companyID", companyID, "totalJobs", totalJobs, "activeJobs", activeJobs, "completedJobs", completedJobs, "totalWorkers", totalWorkers, "totalInvoices", totalInvoices, "paidInvoices", paidInvoices, "totalRevenue", totalRevenue)
+	handlers.LogInfo(ctx, "Company report updated successfully", "companyID", companyID, "totalJobs", totalJobs, "activeJobs", activeJobs, "completedJobs", completedJobs, "totalWorkers", totalWorkers, "totalInvoices", totalInvoices, "paidInvoices", paidInvoices, "totalRevenue", totalRevenue.Major(), "currency", baseCurrency)
 	return nil
 }
 
-func updateUserReport(app *pocketbase.PocketBase, userID string) error {
+func updateUserReport(ctx context.Context, app *pocketbase.PocketBase, userID string) error {
 	collection, err := app.FindCollectionByNameOrId("user_reports")
 	if err != nil {
-		handlers.LogError(err, "Failed to find user_reports collection", "collection", "user_reports")
-		return handlers.InternalServerError("Failed to find user_reports collection", err, "user_reports", "user_reports")
+		handlers.LogError(ctx, err, "Failed to find user_reports collection", "collection", "user_reports")
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to find user_reports collection"), "user_reports", "user_reports")
 	}
 
 	// Fetch or create user reports
@@ -149,95 +309,96 @@ func updateUserReport(app *pocketbase.PocketBase, userID string) error {
 		"userID": userID,
 	})
 	if err != nil {
-		handlers.LogInfo("No existing user report found, creating new", "userID", userID)
+		handlers.LogInfo(ctx, "No existing user report found, creating new", "userID", userID)
 		report = core.NewRecord(collection)
 		report.Set("userID", userID)
 	}
 
 	// metrics
-	jobMembers, err := app.FindRecordsByFilter("job_members", "userID = {:userID}", "-created", 0, 0, dbx.Params{
+	jobMembers, err := app.FindRecordsByFilter("job_members", "userID = {:userID} && jobID."+archive.ActiveFilter, "-created", 0, 0, dbx.Params{
 		"userID": userID,
 	})
 	if err != nil {
-		handlers.LogError(err, "Failed to fetch job_members", "userID", userID)
-		return handlers.InternalServerError("Failed to fetch job_members during generate reports", err, "userID", userID)
+		handlers.LogError(ctx, err, "Failed to fetch job_members", "userID", userID)
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to fetch job_members during generate reports"), "userID", userID)
 	}
 	totalJobs := len(jobMembers)
 	hiredJobs := 0
 	totalHours := 0.0
-	totalEarnings := 0.0
+	// hours by company of the job, used by the matching history
+	companyHours := map[string]float64{}
+	// worker pay is in AUD, each shift is rounded to the cent before being added
+	totalEarnings := currency.Zero(currency.Base)
 	for _, jm := range jobMembers {
-		if jm.GetString("status") == "HIRED" {
+		if jm.GetString("status") == jobs.MemberStatusHired {
 			hiredJobs++
 			jobID := jm.GetString("jobID")
 			job, err := app.FindRecordById("jobs", jobID)
 			if err != nil {
-				handlers.LogWarn("Job not found for job_member", "jobID", jobID)
+				handlers.LogWarn(ctx, "Job not found for job_member", "jobID", jobID)
 				continue
 			}
-			rateIds, ok := job.Get("rates").([]interface{})
-			if !ok || len(rateIds) == 0 {
-				handlers.LogWarn("No rates found for job", "jobID", jobID)
+			shifts, err := jobs.FindShifts(app, job)
+			if err != nil {
+				handlers.LogError(ctx, err, "Failed to fetch job rates", "jobID", jobID)
 				continue
 			}
-			// Convert IDs -> strings
-			var rateIdStrings []string
-			for _, id := range rateIds {
-				if idStr, ok := id.(string); ok {
-					rateIdStrings = append(rateIdStrings, idStr)
-				}
-			}
-			if len(rateIdStrings) == 0 {
+			if len(shifts) == 0 {
+				handlers.LogWarn(ctx, "No rates found for job", "jobID", jobID)
 				continue
 			}
-			rates, err := app.FindRecordsByFilter("job_rates", "id IN ({:rateIds})", "-created", 0, 0, dbx.Params{
-				"rateIds": rateIdStrings,
-			})
-			if err != nil {
-				handlers.LogError(err, "Failed to fetch job rates", "jobID", jobID)
-				continue
-			}
-			for _, rate := range rates {
-				// Convert date fields (strings) -> time.Time
-				startStr := rate.GetString("startTime")
-				endStr := rate.GetString("endTime")
-				start, err := time.Parse(time.RFC3339, startStr)
-				if err != nil {
-					handlers.LogWarn("Invalid startTime format", "startTime", startStr)
-					continue
-				}
-				end, err := time.Parse(time.RFC3339, endStr)
-				if err != nil {
-					handlers.LogWarn("Invalid endTime format", "endTime", endStr)
-					continue
-				}
-				hours := end.Sub(start).Hours()
+			for _, shift := range shifts {
+				hours := shift.Hours()
 				totalHours += hours
-				totalEarnings += hours * rate.GetFloat("rateValue")
+				companyHours[job.GetString("companyID")] += hours
+				totalEarnings = totalEarnings.Add(shift.Rate.Mul(currency.RoundHalfUp, hours))
 			}
 		}
 	}
 
-	companies, err := app.FindRecordsByFilter("company_members", "userID = {:userID} && status = 'ACTIVE'", "-created", 0, 0, dbx.Params{
+	companies, err := app.FindRecordsByFilter("company_members", "userID = {:userID} && status = 'ACTIVE' && companyID."+archive.ActiveFilter, "-created", 0, 0, dbx.Params{
 		"userID": userID,
 	})
 	if err != nil {
-		handlers.LogError(err, "Failed to fetch company_members", "userID", userID)
-		return handlers.InternalServerError("Failed to fetch company_members during generate reports", err, "userID", userID)
+		handlers.LogError(ctx, err, "Failed to fetch company_members", "userID", userID)
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to fetch company_members during generate reports"), "userID", userID)
 	}
 	activeCompanies := len(companies)
 
+	// withholding and net pay of the generated payslips, summed in cents
+	payslipTotals := struct {
+		Withholding int64 `db:"withholding"`
+		Net         int64 `db:"net"`
+	}{}
+	err = app.RecordQuery("payslips").
+		Select("COALESCE(SUM(withholdingMinor), 0) AS withholding", "COALESCE(SUM(netMinor), 0) AS net").
+		AndWhere(dbx.HashExp{"userID": userID}).
+		One(&payslipTotals)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to sum payslips", "userID", userID)
+		return handlers.Fail(ctx, handlers.ErrReportFetchFailed.Wrap(err).WithMessage("Failed to sum payslips during generate reports"), "userID", userID)
+	}
+
 	// Update user_reports
 	report.Set("totalJobs", totalJobs)
 	report.Set("hiredJobs", hiredJobs)
 	report.Set("totalHours", totalHours)
-	report.Set("totalEarnings", totalEarnings)
+	report.Set("companyHours", companyHours)
 	report.Set("activeCompanies", activeCompanies)
+	setAmount(report, "totalEarnings", totalEarnings)
+	setAmount(report, "totalWithholding", currency.New(payslipTotals.Withholding, currency.Base))
+	setAmount(report, "totalNetEarnings", currency.New(payslipTotals.Net, currency.Base))
 
-	if err := app.SaveNoValidate(report); err != nil {
-		handlers.LogError(err, "Failed while saving user report", "userID", userID)
-		return handlers.InternalServerError("Failed while saving user report", err, "userID", userID)
+	if err := app.SaveNoValidateWithContext(ctx, report); err != nil {
+		handlers.LogError(ctx, err, "Failed while saving user report", "userID", userID)
+		return handlers.Fail(ctx, handlers.ErrReportSaveFailed.Wrap(err).WithMessage("Failed while saving user report"), "userID", userID)
 	}
-	handlers.LogInfo("User report updated successfully", "userID", userID, "totalJobs", totalJobs, "hiredJobs", hiredJobs, "totalHours", totalHours, "totalEarnings", totalEarnings)
+	handlers.LogInfo(ctx, "User report updated successfully", "userID", userID, "totalJobs", totalJobs, "hiredJobs", hiredJobs, "totalHours", totalHours, "totalEarnings", totalEarnings.String())
 	return nil
 }
+
+// setAmount set the amount of the report in minor units, and in major units for display
+func setAmount(report *core.Record, name string, amount currency.Money) {
+	report.Set(name+"Minor", amount.Minor)
+	report.Set(name, amount.Major())
+}
@@ -0,0 +1,85 @@
+package reports
+
+import (
+	"fmt"
+	"hirevo/internal/jobs"
+	"hirevo/internal/tests"
+	"testing"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func TestJobArchiveUpdatesUserReport(t *testing.T) {
+	app := tests.NewApp(t)
+	RegisterHooks(app)
+
+	worker := tests.NewUser(t, app, "worker@example.com")
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	job := tests.NewRecord(t, app, "jobs", map[string]any{"companyID": company.Id, "title": "Barista", "status": jobs.StatusHiring})
+	tests.NewRecord(t, app, "job_members", map[string]any{"jobID": job.Id, "userID": worker.Id, "status": jobs.MemberStatusHired})
+
+	userJobs := func() int {
+		t.Helper()
+		report, err := app.FindFirstRecordByFilter("user_reports", "userID = {:userID}", dbx.Params{"userID": worker.Id})
+		if err != nil {
+			t.Fatalf("user report: %v", err)
+		}
+		return report.GetInt("totalJobs")
+	}
+	if got := userJobs(); got != 1 {
+		t.Fatalf("totalJobs before archive = %d, want 1", got)
+	}
+
+	job.Set("deletedAt", types.NowDateTime())
+	if err := app.Save(job); err != nil {
+		t.Fatalf("archive job: %v", err)
+	}
+	if got := userJobs(); got != 0 {
+		t.Fatalf("totalJobs after archive = %d, want 0", got)
+	}
+
+	// restore from a fresh copy like the restore route, the saved record keeps its original data
+	archived, err := app.FindRecordById("jobs", job.Id)
+	if err != nil {
+		t.Fatalf("find archived job: %v", err)
+	}
+	archived.Set("deletedAt", "")
+	if err := app.Save(archived); err != nil {
+		t.Fatalf("restore job: %v", err)
+	}
+	if got := userJobs(); got != 1 {
+		t.Fatalf("totalJobs after restore = %d, want 1", got)
+	}
+}
+
+func TestUserReportEarningsInCents(t *testing.T) {
+	app := tests.NewApp(t)
+	RegisterHooks(app)
+
+	// three shifts of 7.5 hours at 33.33 an hour, each paid 249.975 rounded half up to 249.98
+	rates := []string{}
+	for day := 19; day <= 21; day++ {
+		rate := tests.NewRecord(t, app, "job_rates", map[string]any{
+			"startTime": fmt.Sprintf("2026-10-%dT08:00:00Z", day),
+			"endTime":   fmt.Sprintf("2026-10-%dT15:30:00Z", day),
+			"rateMinor": 3333,
+		})
+		rates = append(rates, rate.Id)
+	}
+	worker := tests.NewUser(t, app, "worker@example.com")
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	job := tests.NewRecord(t, app, "jobs", map[string]any{"companyID": company.Id, "title": "Barista", "status": jobs.StatusHiring, "rates": rates})
+	tests.NewRecord(t, app, "job_members", map[string]any{"jobID": job.Id, "userID": worker.Id, "status": jobs.MemberStatusHired})
+
+	report, err := app.FindFirstRecordByFilter("user_reports", "userID = {:userID}", dbx.Params{"userID": worker.Id})
+	if err != nil {
+		t.Fatalf("user report: %v", err)
+	}
+	if got := report.GetInt("totalEarningsMinor"); got != 74994 {
+		t.Errorf("totalEarningsMinor = %d, want 74994", got)
+	}
+	if got := report.GetFloat("totalEarnings"); got != 749.94 {
+		t.Errorf("totalEarnings = %v, want 749.94", got)
+	}
+}
@@ -0,0 +1,166 @@
+package roster
+
+import (
+	"fmt"
+	"hirevo/internal/company"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	pdfgenerator "hirevo/services/pdf"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks expose the weekly roster of a company as JSON and as a printable PDF
+func RegisterHooks(app *pocketbase.PocketBase) {
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.GET("/api/companies/{id}/roster", getRoster).Bind(apis.RequireAuth())
+		se.Router.GET("/api/companies/{id}/roster/pdf", getRosterPDF).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// getRoster GET /api/companies/{id}/roster?week=YYYY-MM-DD&tz=
+func getRoster(e *core.RequestEvent) error {
+	roster, err := loadRoster(e)
+	if err != nil {
+		return err
+	}
+	return e.JSON(http.StatusOK, roster)
+}
+
+// getRosterPDF GET /api/companies/{id}/roster/pdf?week=YYYY-MM-DD&tz=, a landscape table to pin on site
+func getRosterPDF(e *core.RequestEvent) error {
+	ctx := e.Request.Context()
+	roster, err := loadRoster(e)
+	if err != nil {
+		return err
+	}
+
+	pdfBytes, err := pdfgenerator.GenerateTablePDFBytes(ctx, rosterPDFData(roster))
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRosterPDFFailed.Wrap(err), "companyID", roster.CompanyID, "week", roster.WeekStart)
+	}
+	handlers.LogInfo(ctx, "Roster PDF generated", "companyID", roster.CompanyID, "week", roster.WeekStart, "rows", len(roster.Rows))
+
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="roster-%s.pdf"`, roster.WeekStart))
+	return e.Blob(http.StatusOK, "application/pdf", pdfBytes)
+}
+
+// loadRoster check the user is an active member of the company and build the requested week
+func loadRoster(e *core.RequestEvent) (*Roster, error) {
+	ctx := e.Request.Context()
+	companyID := e.Request.PathValue("id")
+	record, err := e.App.FindRecordById("companies", companyID)
+	if err != nil {
+		return nil, handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "companies", "id", companyID))
+	}
+	if !e.HasSuperuserAuth() {
+		if _, err := company.FindActiveMember(e.App, companyID, e.Auth.Id); err != nil {
+			handlers.LogWarn(ctx, "User not allowed to read the company roster", "companyID", companyID, "userId", e.Auth.Id)
+			return nil, handlers.Fail(ctx, handlers.ErrRosterForbidden.WithParams("companyID", companyID))
+		}
+	}
+
+	weekStart, queryErr := parseWeek(e.Request.URL.Query())
+	if queryErr != nil {
+		return nil, handlers.Fail(ctx, queryErr)
+	}
+	roster, err := BuildRoster(e.App, record, weekStart)
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed to build roster", "companyID", companyID, "week", jobs.DateKey(weekStart))
+		return nil, handlers.Fail(ctx, handlers.ErrRosterFailed.Wrap(err), "companyID", companyID)
+	}
+	return roster, nil
+}
+
+// parseWeek Monday of the requested week, the current week by default
+func parseWeek(values url.Values) (time.Time, *handlers.DomainError) {
+	timezone := values.Get("tz")
+	if timezone == "" {
+		timezone = jobs.DefaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return time.Time{}, handlers.ErrRosterInvalid.Wrap(err).WithParams("field", "tz").WithField("tz", validation.NewError(
+			"invalid_tz",
+			"Unknown timezone",
+		))
+	}
+
+	day := time.Now()
+	if raw := values.Get("week"); raw != "" {
+		if day, err = time.ParseInLocation(time.DateOnly, raw, loc); err != nil {
+			return time.Time{}, handlers.ErrRosterInvalid.Wrap(err).WithParams("field", "week").WithField("week", validation.NewError(
+				"invalid_week",
+				"Week must be a YYYY-MM-DD date",
+			))
+		}
+	}
+	return WeekStart(day, loc), nil
+}
+
+// rosterPDFData one line per worker and job, the shift times in the day columns
+func rosterPDFData(roster *Roster) pdfgenerator.TablePDFData {
+	columns := []pdfgenerator.TableColumn{{Title: "Job", Width: 3}, {Title: "Worker", Width: 3}}
+	for _, day := range roster.Days {
+		date, _ := time.Parse(time.DateOnly, day)
+		columns = append(columns, pdfgenerator.TableColumn{Title: date.Format("Mon 02/01"), Width: 2})
+	}
+	columns = append(columns, pdfgenerator.TableColumn{Title: "Hours", Width: 1})
+
+	rows := make([][]string, 0, len(roster.Rows)+1)
+	for _, row := range roster.Rows {
+		name := row.Name
+		if row.UserID == "" {
+			name = "Unfilled"
+		}
+		cells := []string{row.JobTitle, name}
+		for _, shifts := range row.Days {
+			times := make([]string, 0, len(shifts))
+			for _, shift := range shifts {
+				times = append(times, shift.Start.Format("15:04")+"-"+shift.End.Format("15:04"))
+			}
+			cells = append(cells, strings.Join(times, "\n"))
+		}
+		rows = append(rows, append(cells, formatHours(row.Hours)))
+	}
+
+	totals := []string{"Total", ""}
+	for _, hours := range roster.DayHours {
+		totals = append(totals, formatHours(hours))
+	}
+	rows = append(rows, append(totals, formatHours(roster.TotalHours)))
+
+	return pdfgenerator.TablePDFData{
+		Title:     "Roster - week of " + roster.WeekStart,
+		Header:    roster.CompanyName + "\n" + roster.Timezone,
+		Columns:   columns,
+		Rows:      rows,
+		Footer:    "Generated " + time.Now().In(timezoneOf(roster)).Format("02/01/2006 15:04"),
+		Landscape: true,
+		Author:    roster.CompanyName,
+		Subject:   "Roster of the week of " + roster.WeekStart,
+	}
+}
+
+func formatHours(hours float64) string {
+	if hours == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.2f", hours), ".00")
+}
+
+func timezoneOf(roster *Roster) *time.Location {
+	loc, err := time.LoadLocation(roster.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
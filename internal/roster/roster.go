@@ -0,0 +1,156 @@
+package roster
+
+import (
+	"hirevo/internal/archive"
+	"hirevo/internal/jobs"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// daysPerWeek columns of the roster grid, Monday first
+const daysPerWeek = 7
+
+// Roster week grid of the company jobs and the workers hired on their shifts
+type Roster struct {
+	CompanyID   string `json:"companyId"`
+	CompanyName string `json:"companyName"`
+	Timezone    string `json:"timezone"`
+	// WeekStart Monday of the week, YYYY-MM-DD
+	WeekStart string `json:"weekStart"`
+	// Days dates of the grid columns, YYYY-MM-DD
+	Days       []string    `json:"days"`
+	Rows       []RosterRow `json:"rows"`
+	DayHours   []float64   `json:"dayHours"`
+	TotalHours float64     `json:"totalHours"`
+}
+
+// RosterRow a worker on a job, UserID is empty for the shifts of a job with nobody hired yet
+type RosterRow struct {
+	JobID     string `json:"jobId"`
+	JobTitle  string `json:"jobTitle"`
+	JobStatus string `json:"jobStatus"`
+	UserID    string `json:"userId"`
+	Name      string `json:"name"`
+	// Days shifts starting on each day of the week
+	Days  [][]RosterShift `json:"days"`
+	Hours float64         `json:"hours"`
+}
+
+// RosterShift a shift in the roster, times in the roster timezone
+type RosterShift struct {
+	ShiftID string    `json:"shiftId"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Hours   float64   `json:"hours"`
+}
+
+// WeekStart Monday midnight of the week of the day in the location
+func WeekStart(day time.Time, loc *time.Location) time.Time {
+	day = day.In(loc)
+	offset := (int(day.Weekday()) + 6) % 7
+	return time.Date(day.Year(), day.Month(), day.Day()-offset, 0, 0, 0, 0, loc)
+}
+
+// BuildRoster roster of the company for the week starting on weekStart, jobs sorted by title then workers by name
+func BuildRoster(app core.App, company *core.Record, weekStart time.Time) (*Roster, error) {
+	loc := weekStart.Location()
+	dayStarts := make([]time.Time, daysPerWeek+1)
+	for i := range dayStarts {
+		dayStarts[i] = time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day()+i, 0, 0, 0, 0, loc)
+	}
+	week := jobs.Shift{Start: dayStarts[0], End: dayStarts[daysPerWeek]}
+
+	roster := &Roster{
+		CompanyID:   company.Id,
+		CompanyName: company.GetString("name"),
+		Timezone:    loc.String(),
+		WeekStart:   jobs.DateKey(weekStart),
+		Days:        make([]string, daysPerWeek),
+		Rows:        []RosterRow{},
+		DayHours:    make([]float64, daysPerWeek),
+	}
+	for i := range roster.Days {
+		roster.Days[i] = jobs.DateKey(dayStarts[i])
+	}
+
+	companyJobs, err := app.FindRecordsByFilter(
+		"jobs",
+		archive.ActiveFilter+" && companyID = {:companyID} && status != {:draft} && status != {:cancelled}",
+		"title", 0, 0,
+		dbx.Params{"companyID": company.Id, "draft": jobs.StatusDraft, "cancelled": jobs.StatusCancelled},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, job := range companyJobs {
+		shifts, err := jobs.FindShifts(app, job)
+		if err != nil {
+			return nil, err
+		}
+		days := make([][]RosterShift, daysPerWeek)
+		for i := range days {
+			days[i] = []RosterShift{}
+		}
+		hours := 0.0
+		for _, shift := range shifts {
+			if !shift.Overlaps(week) {
+				continue
+			}
+			start := shift.Start.In(loc)
+			day := 0
+			for day < daysPerWeek-1 && !start.Before(dayStarts[day+1]) {
+				day++
+			}
+			days[day] = append(days[day], RosterShift{ShiftID: shift.ID, Start: start, End: shift.End.In(loc), Hours: shift.Hours()})
+			hours += shift.Hours()
+		}
+		if hours == 0 {
+			continue
+		}
+		for _, dayShifts := range days {
+			sort.Slice(dayShifts, func(i, j int) bool { return dayShifts[i].Start.Before(dayShifts[j].Start) })
+		}
+
+		members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": job.Id, "status": jobs.MemberStatusHired})
+		if err != nil {
+			return nil, err
+		}
+		for _, err := range app.ExpandRecords(members, []string{"userID"}, nil) {
+			return nil, err
+		}
+
+		row := RosterRow{JobID: job.Id, JobTitle: job.GetString("title"), JobStatus: job.GetString("status"), Days: days, Hours: hours}
+		if len(members) == 0 {
+			roster.Rows = append(roster.Rows, row)
+			roster.addHours(days)
+			continue
+		}
+		jobRows := make([]RosterRow, 0, len(members))
+		for _, member := range members {
+			workerRow := row
+			workerRow.UserID = member.GetString("userID")
+			if user := member.ExpandedOne("userID"); user != nil {
+				workerRow.Name = user.GetString("name")
+			}
+			jobRows = append(jobRows, workerRow)
+			roster.addHours(days)
+		}
+		sort.SliceStable(jobRows, func(i, j int) bool { return jobRows[i].Name < jobRows[j].Name })
+		roster.Rows = append(roster.Rows, jobRows...)
+	}
+	return roster, nil
+}
+
+// addHours count the shift hours of a row in the day and week totals
+func (r *Roster) addHours(days [][]RosterShift) {
+	for i, shifts := range days {
+		for _, shift := range shifts {
+			r.DayHours[i] += shift.Hours
+			r.TotalHours += shift.Hours
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package tests test application with the hirevo schema, shared by the tests of the domain packages
+package tests
+
+import (
+	_ "hirevo/migrations"
+	"testing"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// authRule any authenticated user, the base collections are managed outside of the migrations
+const authRule = "@request.auth.id != ''"
+
+// NewApp bootstrap an app in a temporary directory with the base collections and all the migrations applied,
+// the hooks are not registered so each test binds the ones it covers
+func NewApp(t testing.TB) *pocketbase.PocketBase {
+	t.Helper()
+	app := pocketbase.NewWithConfig(pocketbase.Config{DefaultDataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	t.Cleanup(func() { _ = app.ResetBootstrapState() })
+
+	if err := app.RunSystemMigrations(); err != nil {
+		t.Fatalf("system migrations: %v", err)
+	}
+	if err := createBaseCollections(app); err != nil {
+		t.Fatalf("base collections: %v", err)
+	}
+	if err := app.RunAppMigrations(); err != nil {
+		t.Fatalf("app migrations: %v", err)
+	}
+	return app
+}
+
+// createBaseCollections collections the migrations extend
+func createBaseCollections(app core.App) error {
+	collections := []struct {
+		name   string
+		fields func() ([]core.Field, error)
+	}{
+		{"companies", func() ([]core.Field, error) {
+			return []core.Field{
+				&core.TextField{Name: "name"},
+				&core.TextField{Name: "abn"},
+				&core.TextField{Name: "phone"},
+				&core.TextField{Name: "email"},
+				&core.TextField{Name: "website"},
+				&core.FileField{Name: "logo", MaxSelect: 1, MaxSize: 1 << 20},
+				&core.JSONField{Name: "address"},
+				&core.TextField{Name: "createdBy"},
+			}, nil
+		}},
+		{"company_members", func() ([]core.Field, error) {
+			return relations(app, map[string]string{"userID": "users", "companyID": "companies"},
+				&core.TextField{Name: "role"},
+				&core.TextField{Name: "status"},
+			)
+		}},
+		{"job_rates", func() ([]core.Field, error) {
+			return []core.Field{
+				&core.TextField{Name: "startTime"},
+				&core.TextField{Name: "endTime"},
+				&core.NumberField{Name: "rateValue"},
+			}, nil
+		}},
+		{"jobs", func() ([]core.Field, error) {
+			rates, err := app.FindCollectionByNameOrId("job_rates")
+			if err != nil {
+				return nil, err
+			}
+			return relations(app, map[string]string{"companyID": "companies"},
+				&core.TextField{Name: "title"},
+				&core.TextField{Name: "status"},
+				&core.RelationField{Name: "rates", CollectionId: rates.Id, MaxSelect: 99},
+			)
+		}},
+		{"job_members", func() ([]core.Field, error) {
+			return relations(app, map[string]string{"jobID": "jobs", "userID": "users"},
+				&core.TextField{Name: "status"},
+			)
+		}},
+		{"invoices", func() ([]core.Field, error) {
+			return relations(app, map[string]string{"companyID": "companies", "userID": "users"},
+				&core.JSONField{Name: "metadata"},
+				&core.TextField{Name: "status"},
+				&core.FileField{Name: "doc", MaxSelect: 1, MaxSize: 10 << 20},
+			)
+		}},
+		{"company_reports", func() ([]core.Field, error) {
+			return relations(app, map[string]string{"companyID": "companies"},
+				&core.NumberField{Name: "totalJobs"},
+				&core.NumberField{Name: "activeJobs"},
+				&core.NumberField{Name: "completedJobs"},
+				&core.NumberField{Name: "totalWorkers"},
+				&core.NumberField{Name: "totalInvoices"},
+				&core.NumberField{Name: "paidInvoices"},
+				&core.NumberField{Name: "totalRevenue"},
+			)
+		}},
+		{"user_reports", func() ([]core.Field, error) {
+			return relations(app, map[string]string{"userID": "users"},
+				&core.NumberField{Name: "totalJobs"},
+				&core.NumberField{Name: "hiredJobs"},
+				&core.NumberField{Name: "totalHours"},
+				&core.NumberField{Name: "totalEarnings"},
+				&core.NumberField{Name: "activeCompanies"},
+			)
+		}},
+	}
+
+	rule := authRule
+	for _, definition := range collections {
+		fields, err := definition.fields()
+		if err != nil {
+			return err
+		}
+		collection := core.NewBaseCollection(definition.name)
+		collection.Fields.Add(fields...)
+		collection.Fields.Add(
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.ListRule, collection.ViewRule, collection.CreateRule, collection.UpdateRule, collection.DeleteRule = &rule, &rule, &rule, &rule, &rule
+		if err := app.Save(collection); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relations single relation fields to the named collections followed by the other fields
+func relations(app core.App, targets map[string]string, fields ...core.Field) ([]core.Field, error) {
+	related := make([]core.Field, 0, len(targets)+len(fields))
+	for name, target := range targets {
+		collection, err := app.FindCollectionByNameOrId(target)
+		if err != nil {
+			return nil, err
+		}
+		related = append(related, &core.RelationField{Name: name, CollectionId: collection.Id, MaxSelect: 1})
+	}
+	return append(related, fields...), nil
+}
+
+// NewRecord save a record of the collection with the given data
+func NewRecord(t testing.TB, app core.App, collection string, data map[string]any) *core.Record {
+	t.Helper()
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatalf("collection %s: %v", collection, err)
+	}
+	record := core.NewRecord(c)
+	record.Load(data)
+	if err := app.Save(record); err != nil {
+		t.Fatalf("save %s: %v", collection, err)
+	}
+	return record
+}
+
+// NewUser save a user able to authenticate
+func NewUser(t testing.TB, app core.App, email string) *core.Record {
+	t.Helper()
+	users, err := app.FindCollectionByNameOrId("users")
+	if err != nil {
+		t.Fatalf("users: %v", err)
+	}
+	user := core.NewRecord(users)
+	user.SetEmail(email)
+	user.SetPassword("1234567890")
+	user.Set("name", email)
+	if err := app.Save(user); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	return user
+}
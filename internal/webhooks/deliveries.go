@@ -0,0 +1,165 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbound"
+	"hirevo/internal/outbox"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = outbox.StatusPending
+	StatusSending   = outbox.StatusSending
+	StatusSucceeded = "SUCCEEDED"
+	StatusFailed    = outbox.StatusFailed
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Hirevo-Event"
+	DeliveryHeader  = "X-Hirevo-Delivery"
+	SignatureHeader = "X-Hirevo-Signature"
+)
+
+// deliveryCron send the pending deliveries every minute
+const deliveryCron = "* * * * *"
+
+// queue webhook deliveries, retried with delays doubled from a minute up to 12 hours
+var queue = outbox.Queue{
+	Collection: "webhook_deliveries",
+	BatchSize:  100,
+	BaseDelay:  time.Minute,
+	MaxDelay:   12 * time.Hour,
+}
+
+// responseBodyLimit bytes of the endpoint response kept in the delivery log
+const responseBodyLimit = 2000
+
+// Sign signature header of a payload, "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<payload>">",
+// receivers recompute it with the endpoint secret and reject old timestamps to prevent replays
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + unix + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver post a claimed delivery to its endpoint, a failure schedules the next attempt with an
+// exponential backoff until cfg.MaxAttempts is reached, the error is only returned when the log cannot be updated
+func Deliver(ctx context.Context, app core.App, cfg config.WebhooksConfig, delivery *core.Record) error {
+	attempts := queue.Attempt(delivery)
+	status, body, sendErr := post(ctx, app, cfg, delivery)
+	delivery.Set("responseStatus", status)
+	delivery.Set("responseBody", body)
+	if sendErr == nil {
+		delivery.Set("status", StatusSucceeded)
+		delivery.Set("deliveredAt", time.Now())
+		delivery.Set("lastError", "")
+	} else if queue.Fail(delivery, sendErr, cfg.MaxAttempts) {
+		handlers.LogWarn(ctx, "Webhook delivery failed, will retry", "deliveryID", delivery.Id, "endpointID", delivery.GetString("endpointID"), "attempts", attempts, "error", sendErr.Error())
+	} else {
+		handlers.LogError(ctx, sendErr, "Webhook delivery failed, giving up", "deliveryID", delivery.Id, "endpointID", delivery.GetString("endpointID"), "attempts", attempts)
+	}
+	if err := app.SaveWithContext(ctx, delivery); err != nil {
+		handlers.LogError(ctx, err, "Failed to update webhook delivery", "deliveryID", delivery.Id)
+		return err
+	}
+	return nil
+}
+
+// post send the signed payload, any status other than 2xx is a failure
+func post(ctx context.Context, app core.App, cfg config.WebhooksConfig, delivery *core.Record) (int, string, error) {
+	endpoint, err := app.FindRecordById("webhook_endpoints", delivery.GetString("endpointID"))
+	if err != nil {
+		return 0, "", err
+	}
+	payload := []byte(delivery.GetString("payload"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.GetString("url"), bytes.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.GetString("event"))
+	req.Header.Set(DeliveryHeader, delivery.Id)
+	req.Header.Set(SignatureHeader, Sign(endpoint.GetString("secret"), time.Now(), payload))
+	req.Header.Set(handlers.RequestIDHeader, handlers.RequestID(ctx))
+
+	client := outbound.NewClient(cfg.Timeout, cfg.AllowPrivateNetworks)
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, responseBodyLimit))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, string(body), fmt.Errorf("unexpected webhook response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, string(body), nil
+}
+
+// DeliverPending claim and send the PENDING deliveries that are due, returns the number delivered
+func DeliverPending(ctx context.Context, app core.App, cfg config.WebhooksConfig) (int, error) {
+	delivered := 0
+	attempted, err := queue.DeliverPending(ctx, app, func(ctx context.Context, delivery *core.Record) error {
+		if err := Deliver(ctx, app, cfg, delivery); err != nil {
+			return err
+		}
+		if delivery.GetString("status") == StatusSucceeded {
+			delivered++
+		}
+		return nil
+	})
+	if attempted > 0 {
+		handlers.LogInfo(ctx, "Attempted webhook deliveries", "count", attempted, "delivered", delivered)
+	}
+	return delivered, err
+}
+
+// Redeliver send the payload of a delivery again as a new delivery, the event id is kept
+// so the receiver can recognize an event it already processed. The new delivery is claimed before
+// it is sent, when the cron claimed it first it is returned PENDING and sent by the cron.
+func Redeliver(ctx context.Context, app core.App, cfg config.WebhooksConfig, original *core.Record) (*core.Record, error) {
+	endpoint, err := app.FindRecordById("webhook_endpoints", original.GetString("endpointID"))
+	if err != nil {
+		return nil, err
+	}
+	payload := Payload{}
+	if err := original.UnmarshalJSONField("payload", &payload); err != nil {
+		return nil, err
+	}
+	delivery, err := newDelivery(app, endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Set("redeliveryOf", original.Id)
+	if err := app.SaveWithContext(ctx, delivery); err != nil {
+		return nil, err
+	}
+	claimed, err := queue.Claim(app, delivery)
+	if err != nil {
+		return nil, err
+	}
+	if claimed {
+		if err := Deliver(ctx, app, cfg, delivery); err != nil {
+			return nil, err
+		}
+	}
+	handlers.LogInfo(ctx, "Webhook delivery redelivered", "deliveryID", delivery.Id, "redeliveryOf", original.Id, "status", delivery.GetString("status"))
+	return delivery, nil
+}
@@ -0,0 +1,192 @@
+package webhooks
+
+import (
+	"context"
+	"hirevo/internal/config"
+	"hirevo/internal/tests"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// testConfig reach the httptest servers, they listen on loopback
+var testConfig = config.WebhooksConfig{MaxAttempts: 3, Timeout: 5 * time.Second, AllowPrivateNetworks: true}
+
+// newEndpoint company with an endpoint subscribed to every event at the URL
+func newEndpoint(t *testing.T, app core.App, url string) *core.Record {
+	t.Helper()
+	company := tests.NewRecord(t, app, "companies", map[string]any{"name": "Acme"})
+	return tests.NewRecord(t, app, "webhook_endpoints", map[string]any{
+		"companyID": company.Id,
+		"url":       url,
+		"events":    []string{EventAll},
+		"secret":    "whsec_test",
+		"active":    true,
+	})
+}
+
+// emit queue a job event to the endpoint and return its delivery
+func emit(t *testing.T, app core.App, endpoint *core.Record) *core.Record {
+	t.Helper()
+	if err := Emit(context.Background(), app, endpoint.GetString("companyID"), EventJobCreated, map[string]any{"id": "job1"}); err != nil {
+		t.Fatalf("emit: %v", err)
+	}
+	delivery, err := app.FindFirstRecordByFilter("webhook_deliveries", "endpointID = {:endpointID}", dbx.Params{"endpointID": endpoint.Id})
+	if err != nil {
+		t.Fatalf("find delivery: %v", err)
+	}
+	return delivery
+}
+
+// deliverPending run the cron once and return the refreshed delivery
+func deliverPending(t *testing.T, app core.App, cfg config.WebhooksConfig, delivery *core.Record) *core.Record {
+	t.Helper()
+	if _, err := DeliverPending(context.Background(), app, cfg); err != nil {
+		t.Fatalf("deliver pending: %v", err)
+	}
+	refreshed, err := app.FindRecordById("webhook_deliveries", delivery.Id)
+	if err != nil {
+		t.Fatalf("find delivery: %v", err)
+	}
+	return refreshed
+}
+
+func TestDeliverSignsPayload(t *testing.T) {
+	var (
+		headers http.Header
+		body    []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	app := tests.NewApp(t)
+	endpoint := newEndpoint(t, app, server.URL)
+	delivery := emit(t, app, endpoint)
+	if headers != nil {
+		t.Fatal("Emit posted the event, it must only queue it")
+	}
+
+	delivery = deliverPending(t, app, testConfig, delivery)
+	if got := delivery.GetString("status"); got != StatusSucceeded {
+		t.Fatalf("status = %s, want %s (lastError %q)", got, StatusSucceeded, delivery.GetString("lastError"))
+	}
+	if got := delivery.GetString("responseBody"); got != "ok" {
+		t.Errorf("responseBody = %q, want ok", got)
+	}
+	if got := headers.Get(EventHeader); got != EventJobCreated {
+		t.Errorf("%s = %q, want %q", EventHeader, got, EventJobCreated)
+	}
+	if got := headers.Get(DeliveryHeader); got != delivery.Id {
+		t.Errorf("%s = %q, want %q", DeliveryHeader, got, delivery.Id)
+	}
+
+	signature := headers.Get(SignatureHeader)
+	timestamp, _, ok := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+	if !ok {
+		t.Fatalf("%s = %q, want t=<unix>,v1=<hmac>", SignatureHeader, signature)
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("signature timestamp %q: %v", timestamp, err)
+	}
+	if want := Sign("whsec_test", time.Unix(unix, 0), body); signature != want {
+		t.Errorf("%s = %q, want %q", SignatureHeader, signature, want)
+	}
+	if Sign("whsec_other", time.Unix(unix, 0), body) == signature {
+		t.Error("signature does not depend on the secret")
+	}
+}
+
+func TestDeliverRetriesWithBackoffThenGivesUp(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	app := tests.NewApp(t)
+	delivery := emit(t, app, newEndpoint(t, app, server.URL))
+
+	// a minute after the first failure, doubled after each failure
+	for attempt, wantDelay := range []time.Duration{time.Minute, 2 * time.Minute} {
+		before := time.Now()
+		delivery = deliverPending(t, app, testConfig, delivery)
+		if got := delivery.GetString("status"); got != StatusPending {
+			t.Fatalf("attempt %d: status = %s, want %s", attempt+1, got, StatusPending)
+		}
+		if got := delivery.GetInt("attempts"); got != attempt+1 {
+			t.Fatalf("attempt %d: attempts = %d", attempt+1, got)
+		}
+		if got := delivery.GetInt("responseStatus"); got != http.StatusServiceUnavailable {
+			t.Errorf("attempt %d: responseStatus = %d, want %d", attempt+1, got, http.StatusServiceUnavailable)
+		}
+		next := delivery.GetDateTime("nextAttemptAt").Time()
+		if delay := next.Sub(before); delay < wantDelay-time.Second || delay > wantDelay+time.Second {
+			t.Errorf("attempt %d: next attempt in %s, want %s", attempt+1, delay, wantDelay)
+		}
+
+		// not due yet
+		delivery = deliverPending(t, app, testConfig, delivery)
+		if got := int(calls.Load()); got != attempt+1 {
+			t.Fatalf("attempt %d: endpoint called %d times before the retry was due", attempt+1, got)
+		}
+		makeDue(t, app, delivery)
+	}
+
+	delivery = deliverPending(t, app, testConfig, delivery)
+	if got := delivery.GetString("status"); got != StatusFailed {
+		t.Fatalf("status after %d attempts = %s, want %s", testConfig.MaxAttempts, got, StatusFailed)
+	}
+	if delivery.GetString("lastError") == "" {
+		t.Error("lastError not recorded")
+	}
+
+	makeDue(t, app, delivery)
+	deliverPending(t, app, testConfig, delivery)
+	if got := int(calls.Load()); got != testConfig.MaxAttempts {
+		t.Errorf("endpoint called %d times, want %d", got, testConfig.MaxAttempts)
+	}
+}
+
+func TestDeliverRejectsPrivateNetworks(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer server.Close()
+
+	app := tests.NewApp(t)
+	delivery := emit(t, app, newEndpoint(t, app, server.URL))
+
+	cfg := testConfig
+	cfg.AllowPrivateNetworks = false
+	delivery = deliverPending(t, app, cfg, delivery)
+	if calls.Load() != 0 {
+		t.Fatal("delivery reached a loopback endpoint")
+	}
+	if got := delivery.GetString("lastError"); !strings.Contains(got, "address not allowed") {
+		t.Errorf("lastError = %q, want the address to be rejected", got)
+	}
+}
+
+// makeDue move the next attempt of a delivery to the past
+func makeDue(t *testing.T, app core.App, delivery *core.Record) {
+	t.Helper()
+	_, err := app.DB().Update("webhook_deliveries", dbx.Params{"nextAttemptAt": "2000-01-01 00:00:00.000Z"}, dbx.HashExp{"id": delivery.Id}).Execute()
+	if err != nil {
+		t.Fatalf("make delivery due: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package webhooks
+
+import (
+	"context"
+	"hirevo/internal/handlers"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Webhook events
+const (
+	EventInvoiceCreated   = "invoice.created"
+	EventInvoiceUpdated   = "invoice.updated"
+	EventJobCreated       = "job.created"
+	EventJobUpdated       = "job.updated"
+	EventJobMemberCreated = "job_member.created"
+	EventJobMemberUpdated = "job_member.updated"
+)
+
+// EventAll subscribe an endpoint to every event
+const EventAll = "*"
+
+// Events an endpoint can subscribe to
+var Events = []string{
+	EventInvoiceCreated,
+	EventInvoiceUpdated,
+	EventJobCreated,
+	EventJobUpdated,
+	EventJobMemberCreated,
+	EventJobMemberUpdated,
+}
+
+// Payload body posted to the endpoints, ID is shared by all the deliveries and redeliveries of an event
+type Payload struct {
+	ID         string         `json:"id"`
+	Event      string         `json:"event"`
+	CompanyID  string         `json:"companyId"`
+	OccurredAt string         `json:"occurredAt"`
+	Data       map[string]any `json:"data"`
+}
+
+// Emit queue a delivery of the event to each active endpoint of the company subscribed to it,
+// the cron sends the deliveries and retries them while they fail
+func Emit(ctx context.Context, app core.App, companyID string, event string, data map[string]any) error {
+	endpoints, err := app.FindRecordsByFilter("webhook_endpoints", "companyID = {:companyID} && active = true", "", 0, 0, dbx.Params{
+		"companyID": companyID,
+	})
+	if err != nil {
+		return err
+	}
+	subscribed := slices.DeleteFunc(endpoints, func(endpoint *core.Record) bool {
+		events := []string{}
+		_ = endpoint.UnmarshalJSONField("events", &events)
+		return !slices.Contains(events, event) && !slices.Contains(events, EventAll)
+	})
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	payload := Payload{
+		ID:         "evt_" + security.RandomString(24),
+		Event:      event,
+		CompanyID:  companyID,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+		Data:       data,
+	}
+	for _, endpoint := range subscribed {
+		delivery, err := newDelivery(app, endpoint, payload)
+		if err != nil {
+			return err
+		}
+		if err := app.SaveWithContext(ctx, delivery); err != nil {
+			return err
+		}
+	}
+	handlers.LogInfo(ctx, "Webhook event emitted", "companyID", companyID, "event", event, "eventID", payload.ID, "endpoints", len(subscribed))
+	return nil
+}
+
+// newDelivery PENDING delivery of the payload to the endpoint, due now
+func newDelivery(app core.App, endpoint *core.Record, payload Payload) (*core.Record, error) {
+	collection, err := app.FindCollectionByNameOrId("webhook_deliveries")
+	if err != nil {
+		return nil, err
+	}
+	now, err := types.ParseDateTime(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	delivery := core.NewRecord(collection)
+	delivery.Set("endpointID", endpoint.Id)
+	delivery.Set("companyID", endpoint.GetString("companyID"))
+	delivery.Set("eventID", payload.ID)
+	delivery.Set("event", payload.Event)
+	delivery.Set("payload", payload)
+	delivery.Set("status", StatusPending)
+	delivery.Set("nextAttemptAt", now)
+	return delivery, nil
+}
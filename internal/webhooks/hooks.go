@@ -0,0 +1,140 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"hirevo/internal/company"
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/outbound"
+	"net/http"
+	"slices"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// secretPrefix of the generated endpoint secrets
+const secretPrefix = "whsec_"
+
+// RegisterHooks validate the endpoints, emit the invoice, job and job member events and retry the deliveries
+func RegisterHooks(app *pocketbase.PocketBase, cfg config.WebhooksConfig) {
+	onEndpointChange(app, cfg)
+	emitRecordEvents(app, "invoices", EventInvoiceCreated, EventInvoiceUpdated, recordCompanyID)
+	emitRecordEvents(app, "jobs", EventJobCreated, EventJobUpdated, recordCompanyID)
+	emitRecordEvents(app, "job_members", EventJobMemberCreated, EventJobMemberUpdated, jobCompanyID)
+	scheduleDeliveries(app, cfg)
+
+	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		se.Router.POST("/api/webhooks/deliveries/{id}/redeliver", func(e *core.RequestEvent) error {
+			return redeliver(e, cfg)
+		}).Bind(apis.RequireAuth())
+		return se.Next()
+	})
+}
+
+// onEndpointChange validate the URL and events of an endpoint, a secret is generated when none is given.
+// The URL must resolve to public addresses unless cfg.AllowPrivateNetworks, the deliveries check it again on connect.
+func onEndpointChange(app *pocketbase.PocketBase, cfg config.WebhooksConfig) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		if err := outbound.CheckURL(ctx, e.Record.GetString("url"), cfg.AllowPrivateNetworks); errors.Is(err, outbound.ErrAddressNotAllowed) {
+			return handlers.Fail(ctx, handlers.ErrWebhookEndpointInvalid.Wrap(err).WithField("url", validation.NewError(
+				"url_not_public",
+				"The webhook URL must resolve to a public address",
+			)))
+		} else if err != nil {
+			return handlers.Fail(ctx, handlers.ErrWebhookEndpointInvalid.Wrap(err).WithField("url", validation.NewError(
+				"invalid_url",
+				"The webhook URL must be an http or https URL with a resolvable host",
+			)))
+		}
+		events := []string{}
+		if err := e.Record.UnmarshalJSONField("events", &events); err != nil || len(events) == 0 {
+			return handlers.Fail(ctx, handlers.ErrWebhookEndpointInvalid.WithField("events", validation.NewError(
+				"events_required",
+				"Select at least one event",
+			)))
+		}
+		for _, event := range events {
+			if event != EventAll && !slices.Contains(Events, event) {
+				return handlers.Fail(ctx, handlers.ErrWebhookEndpointInvalid.WithParams("event", event).WithField("events", validation.NewError(
+					"unknown_event",
+					"Unknown webhook event",
+				)))
+			}
+		}
+		if e.Record.GetString("secret") == "" {
+			e.Record.Set("secret", secretPrefix+security.RandomString(32))
+		}
+		return e.Next()
+	}
+	app.OnRecordCreate("webhook_endpoints").BindFunc(validate)
+	app.OnRecordUpdate("webhook_endpoints").BindFunc(validate)
+}
+
+// emitRecordEvents emit the created and updated events of a collection to the endpoints of the record company
+func emitRecordEvents(app *pocketbase.PocketBase, collection string, created string, updated string, companyOf func(core.App, *core.Record) string) {
+	emit := func(e *core.RecordEvent, event string) error {
+		ctx := handlers.RecordContext(e)
+		companyID := companyOf(e.App, e.Record)
+		if companyID == "" {
+			return e.Next()
+		}
+		if err := Emit(ctx, e.App, companyID, event, e.Record.PublicExport()); err != nil {
+			handlers.LogError(ctx, err, "Failed to emit webhook event", "companyID", companyID, "event", event, "recordID", e.Record.Id)
+		}
+		return e.Next()
+	}
+	app.OnRecordAfterCreateSuccess(collection).BindFunc(func(e *core.RecordEvent) error {
+		return emit(e, created)
+	})
+	app.OnRecordAfterUpdateSuccess(collection).BindFunc(func(e *core.RecordEvent) error {
+		return emit(e, updated)
+	})
+}
+
+func recordCompanyID(_ core.App, record *core.Record) string {
+	return record.GetString("companyID")
+}
+
+func jobCompanyID(app core.App, record *core.Record) string {
+	job, err := app.FindRecordById("jobs", record.GetString("jobID"))
+	if err != nil {
+		return ""
+	}
+	return job.GetString("companyID")
+}
+
+// redeliver POST /api/webhooks/deliveries/{id}/redeliver, send a logged delivery again
+func redeliver(e *core.RequestEvent, cfg config.WebhooksConfig) error {
+	ctx := e.Request.Context()
+	deliveryID := e.Request.PathValue("id")
+	original, err := e.App.FindRecordById("webhook_deliveries", deliveryID)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrRecordNotFound.Wrap(err).WithParams("collection", "webhook_deliveries", "id", deliveryID))
+	}
+	companyID := original.GetString("companyID")
+	if !e.HasSuperuserAuth() && !company.HasRole(e.App, companyID, e.Auth.Id, company.RoleOwner, company.RoleAdmin) {
+		handlers.LogWarn(ctx, "User not allowed to redeliver webhooks", "companyID", companyID, "userId", e.Auth.Id)
+		return handlers.Fail(ctx, handlers.ErrWebhookForbidden.WithParams("companyID", companyID))
+	}
+
+	delivery, err := Redeliver(ctx, e.App, cfg, original)
+	if err != nil {
+		return handlers.Fail(ctx, handlers.ErrWebhookRedeliverFailed.Wrap(err), "deliveryID", deliveryID)
+	}
+	return e.JSON(http.StatusOK, delivery)
+}
+
+// scheduleDeliveries retry the deliveries of the endpoints that were down
+func scheduleDeliveries(app *pocketbase.PocketBase, cfg config.WebhooksConfig) {
+	app.Cron().MustAdd("webhooksDeliver", deliveryCron, func() {
+		if _, err := DeliverPending(context.Background(), app, cfg); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to deliver pending webhooks")
+		}
+	})
+}
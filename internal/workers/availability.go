@@ -0,0 +1,410 @@
+package workers
+
+import (
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"slices"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Availability types
+const (
+	AvailabilityAvailable   = "AVAILABLE"
+	AvailabilityUnavailable = "UNAVAILABLE"
+)
+
+// Conflict kinds
+const (
+	// ConflictShift the worker is hired on another shift at the same time
+	ConflictShift = "SHIFT"
+	// ConflictUnavailable the worker declared to be unavailable
+	ConflictUnavailable = "UNAVAILABLE"
+	// ConflictOutsideAvailability the worker published availability windows not covering the shift, only a warning
+	ConflictOutsideAvailability = "OUTSIDE_AVAILABILITY"
+)
+
+// maxAvailabilityWindow a single availability window can span
+const maxAvailabilityWindow = 366 * 24 * time.Hour
+
+// Conflict a job shift the worker cannot or may not work
+type Conflict struct {
+	Kind    string    `json:"kind"`
+	ShiftID string    `json:"shiftId"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	// JobID and JobTitle of the conflicting job for SHIFT conflicts
+	JobID    string `json:"jobId,omitempty"`
+	JobTitle string `json:"jobTitle,omitempty"`
+	// ConflictID the conflicting job_rates or worker_availability record
+	ConflictID    string    `json:"conflictId,omitempty"`
+	ConflictStart time.Time `json:"conflictStart,omitzero"`
+	ConflictEnd   time.Time `json:"conflictEnd,omitzero"`
+}
+
+// Blocking check if the conflict prevents hiring the worker
+func (c Conflict) Blocking() bool {
+	return c.Kind != ConflictOutsideAvailability
+}
+
+// onAvailabilityChange validate the window and warn when the worker becomes unavailable during a hired shift
+func onAvailabilityChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		start := e.Record.GetDateTime("startTime")
+		end := e.Record.GetDateTime("endTime")
+		if !end.After(start) {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityInvalid.WithField("endTime", validation.NewError(
+				"invalid_end_time",
+				"The end time must be after the start time",
+			)))
+		}
+		if end.Time().Sub(start.Time()) > maxAvailabilityWindow {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityInvalid.WithParams("maxDays", int(maxAvailabilityWindow.Hours()/24)).WithField("endTime", validation.NewError(
+				"window_too_long",
+				"The window is too long",
+			)))
+		}
+		if err := e.Next(); err != nil {
+			return err
+		}
+
+		if e.Record.GetString("type") != AvailabilityUnavailable {
+			return nil
+		}
+		// the worker keeps the hired shifts, the company has to find a replacement
+		window := jobs.Shift{ID: e.Record.Id, Start: start.Time(), End: end.Time()}
+		userID := e.Record.GetString("userID")
+		busy, err := hiredShifts(e.App, []any{userID}, "")
+		if err != nil {
+			handlers.LogError(ctx, err, "Failed to check hired shifts", "availabilityID", e.Record.Id)
+			return nil
+		}
+		for _, hired := range busy[userID] {
+			if hired.shift.Overlaps(window) {
+				handlers.LogWarn(ctx, "Worker unavailable during a hired shift", "userID", e.Record.GetString("userID"), "availabilityID", e.Record.Id, "jobID", hired.job.Id, "shiftID", hired.shift.ID)
+			}
+		}
+		return nil
+	}
+
+	app.OnRecordCreate("worker_availability").BindFunc(validate)
+	app.OnRecordUpdate("worker_availability").BindFunc(validate)
+}
+
+// onHireCheckAvailability block hiring a worker on shifts overlapping other hired shifts or declared unavailability,
+// applications and offers are only logged
+func onHireCheckAvailability(app *pocketbase.PocketBase) {
+	check := func(e *core.RecordEvent) error {
+		member := e.Record
+		status := member.GetString("status")
+		if !member.IsNew() && member.Original().GetString("status") == status {
+			return e.Next()
+		}
+		if status != jobs.MemberStatusHired && !slices.Contains(jobs.OpenMemberStatuses, status) {
+			return e.Next()
+		}
+
+		ctx := handlers.RecordContext(e)
+		job, err := e.App.FindRecordById("jobs", member.GetString("jobID"))
+		if err != nil {
+			// reported by the hiring workflow
+			return e.Next()
+		}
+		shifts, err := jobs.FindShifts(e.App, job)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityCheckFailed.Wrap(err), "jobID", job.Id)
+		}
+		conflicts, err := FindConflicts(e.App, member.GetString("userID"), shifts, job.Id)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityCheckFailed.Wrap(err), "jobID", job.Id)
+		}
+		if len(conflicts) == 0 {
+			return e.Next()
+		}
+
+		blocking := slices.ContainsFunc(conflicts, Conflict.Blocking)
+		handlers.LogWarn(ctx, "Worker has shift conflicts", "jobID", job.Id, "userID", member.GetString("userID"), "status", status, "conflicts", conflicts)
+		if blocking && status == jobs.MemberStatusHired {
+			return handlers.Fail(ctx, handlers.ErrShiftConflict.WithParams("conflicts", conflicts))
+		}
+		return e.Next()
+	}
+
+	app.OnRecordCreate("job_members").BindFunc(check)
+	app.OnRecordUpdate("job_members").BindFunc(check)
+}
+
+// onShiftChange block moving a shift or adding shifts to a job when a hired worker would have a conflict
+func onShiftChange(app *pocketbase.PocketBase) {
+	app.OnRecordUpdate("job_rates").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		if original.GetString("startTime") == e.Record.GetString("startTime") && original.GetString("endTime") == e.Record.GetString("endTime") {
+			return e.Next()
+		}
+		shift, ok := jobs.ParseShift(e.Record)
+		if !ok {
+			return e.Next()
+		}
+
+		ctx := handlers.RecordContext(e)
+		jobsWithShift, err := e.App.FindRecordsByFilter("jobs", "rates ~ {:rateID}", "", 0, 0, dbx.Params{"rateID": e.Record.Id})
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityCheckFailed.Wrap(err), "rateID", e.Record.Id)
+		}
+		for _, job := range jobsWithShift {
+			if conflictErr := checkHiredMembers(e.App, job, []jobs.Shift{shift}); conflictErr != nil {
+				return handlers.Fail(ctx, conflictErr, "jobID", job.Id, "rateID", e.Record.Id)
+			}
+		}
+		return e.Next()
+	})
+
+	app.OnRecordUpdate("jobs").BindFunc(func(e *core.RecordEvent) error {
+		original := e.Record.Original()
+		added := []string{}
+		for _, id := range e.Record.GetStringSlice("rates") {
+			if !slices.Contains(original.GetStringSlice("rates"), id) {
+				added = append(added, id)
+			}
+		}
+		if len(added) == 0 {
+			return e.Next()
+		}
+
+		ctx := handlers.RecordContext(e)
+		rates, err := e.App.FindRecordsByIds("job_rates", added)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrAvailabilityCheckFailed.Wrap(err), "jobID", e.Record.Id)
+		}
+		shifts := []jobs.Shift{}
+		for _, rate := range rates {
+			if shift, ok := jobs.ParseShift(rate); ok {
+				shifts = append(shifts, shift)
+			}
+		}
+		if conflictErr := checkHiredMembers(e.App, e.Record, shifts); conflictErr != nil {
+			return handlers.Fail(ctx, conflictErr, "jobID", e.Record.Id)
+		}
+		return e.Next()
+	})
+}
+
+// checkHiredMembers conflicts of the workers hired on the job with the given shifts
+func checkHiredMembers(app core.App, job *core.Record, shifts []jobs.Shift) *handlers.DomainError {
+	status := job.GetString("status")
+	if len(shifts) == 0 || status == jobs.StatusCancelled || status == jobs.StatusCompleted {
+		return nil
+	}
+	members, err := app.FindAllRecords("job_members", dbx.HashExp{"jobID": job.Id, "status": jobs.MemberStatusHired})
+	if err != nil {
+		return handlers.ErrAvailabilityCheckFailed.Wrap(err)
+	}
+	userIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		userIDs = append(userIDs, member.GetString("userID"))
+	}
+	conflictsByUser, err := FindConflictsOf(app, userIDs, shifts, job.Id)
+	if err != nil {
+		return handlers.ErrAvailabilityCheckFailed.Wrap(err)
+	}
+	for _, userID := range userIDs {
+		conflicts := slices.DeleteFunc(conflictsByUser[userID], func(c Conflict) bool { return !c.Blocking() })
+		if len(conflicts) > 0 {
+			return handlers.ErrShiftConflict.WithParams("userID", userID, "conflicts", conflicts)
+		}
+	}
+	return nil
+}
+
+// hiredShift a shift of a job the worker is hired on
+type hiredShift struct {
+	job   *core.Record
+	shift jobs.Shift
+}
+
+// hiredShifts shifts of the active jobs the workers are hired on, except the given job, by user
+func hiredShifts(app core.App, userIDs []any, exceptJobID string) (map[string][]hiredShift, error) {
+	members, err := app.FindAllRecords(
+		"job_members",
+		dbx.In("userID", userIDs...),
+		dbx.HashExp{"status": jobs.MemberStatusHired},
+		dbx.Not(dbx.HashExp{"jobID": exceptJobID}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil
+	}
+	jobIDs := make([]string, 0, len(members))
+	for _, member := range members {
+		jobIDs = append(jobIDs, member.GetString("jobID"))
+	}
+	activeJobs, err := app.FindRecordsByIds("jobs", jobIDs, func(q *dbx.SelectQuery) error {
+		q.AndWhere(dbx.NotIn("status", jobs.StatusCancelled, jobs.StatusCompleted))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	rateIDs := []string{}
+	for _, job := range activeJobs {
+		rateIDs = append(rateIDs, job.GetStringSlice("rates")...)
+	}
+	rates, err := app.FindRecordsByIds("job_rates", rateIDs)
+	if err != nil {
+		return nil, err
+	}
+	shifts := make(map[string]jobs.Shift, len(rates))
+	for _, rate := range rates {
+		if shift, ok := jobs.ParseShift(rate); ok {
+			shifts[rate.Id] = shift
+		}
+	}
+	jobsByID := make(map[string]*core.Record, len(activeJobs))
+	for _, job := range activeJobs {
+		jobsByID[job.Id] = job
+	}
+
+	busy := map[string][]hiredShift{}
+	for _, member := range members {
+		job, ok := jobsByID[member.GetString("jobID")]
+		if !ok {
+			continue
+		}
+		userID := member.GetString("userID")
+		for _, rateID := range job.GetStringSlice("rates") {
+			if shift, ok := shifts[rateID]; ok {
+				busy[userID] = append(busy[userID], hiredShift{job: job, shift: shift})
+			}
+		}
+	}
+	return busy, nil
+}
+
+// FindConflicts shifts overlapping the shifts the worker is hired on other jobs or the worker calendar,
+// shifts outside the published availability windows give a non blocking conflict
+func FindConflicts(app core.App, userID string, shifts []jobs.Shift, exceptJobID string) ([]Conflict, error) {
+	conflicts, err := FindConflictsOf(app, []string{userID}, shifts, exceptJobID)
+	if err != nil {
+		return nil, err
+	}
+	return conflicts[userID], nil
+}
+
+// FindConflictsOf conflicts of each worker with the shifts, by user, with the same queries whatever the number of workers.
+// Workers without conflicts are not in the map
+func FindConflictsOf(app core.App, userIDs []string, shifts []jobs.Shift, exceptJobID string) (map[string][]Conflict, error) {
+	if len(shifts) == 0 || len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]any, 0, len(userIDs))
+	for _, userID := range userIDs {
+		ids = append(ids, userID)
+	}
+	busy, err := hiredShifts(app, ids, exceptJobID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := shifts[0].Start, shifts[0].End
+	for _, shift := range shifts {
+		if shift.Start.Before(from) {
+			from = shift.Start
+		}
+		if shift.End.After(to) {
+			to = shift.End
+		}
+	}
+	windows, err := findAvailability(app, ids, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := map[string][]Conflict{}
+	for _, userID := range userIDs {
+		for _, shift := range shifts {
+			for _, hired := range busy[userID] {
+				if hired.shift.Overlaps(shift) {
+					conflicts[userID] = append(conflicts[userID], Conflict{
+						Kind:          ConflictShift,
+						ShiftID:       shift.ID,
+						Start:         shift.Start,
+						End:           shift.End,
+						JobID:         hired.job.Id,
+						JobTitle:      hired.job.GetString("title"),
+						ConflictID:    hired.shift.ID,
+						ConflictStart: hired.shift.Start,
+						ConflictEnd:   hired.shift.End,
+					})
+				}
+			}
+
+			hasAvailable, covered := false, false
+			for _, window := range windows[userID] {
+				if window.kind == AvailabilityAvailable {
+					hasAvailable = true
+					covered = covered || (!window.Start.After(shift.Start) && !window.End.Before(shift.End))
+					continue
+				}
+				if window.Overlaps(shift) {
+					conflicts[userID] = append(conflicts[userID], Conflict{
+						Kind:          ConflictUnavailable,
+						ShiftID:       shift.ID,
+						Start:         shift.Start,
+						End:           shift.End,
+						ConflictID:    window.ID,
+						ConflictStart: window.Start,
+						ConflictEnd:   window.End,
+					})
+				}
+			}
+			if hasAvailable && !covered {
+				conflicts[userID] = append(conflicts[userID], Conflict{Kind: ConflictOutsideAvailability, ShiftID: shift.ID, Start: shift.Start, End: shift.End})
+			}
+		}
+	}
+	return conflicts, nil
+}
+
+// availabilityWindow a worker_availability record
+type availabilityWindow struct {
+	jobs.Shift
+	kind string
+}
+
+// findAvailability windows of the workers overlapping the period, by user
+func findAvailability(app core.App, userIDs []any, from time.Time, to time.Time) (map[string][]availabilityWindow, error) {
+	fromDate, err := types.ParseDateTime(from)
+	if err != nil {
+		return nil, err
+	}
+	toDate, err := types.ParseDateTime(to)
+	if err != nil {
+		return nil, err
+	}
+	records := []*core.Record{}
+	err = app.RecordQuery("worker_availability").
+		AndWhere(dbx.In("userID", userIDs...)).
+		AndWhere(dbx.NewExp("[[startTime]] < {:to} AND [[endTime]] > {:from}", dbx.Params{"from": fromDate.String(), "to": toDate.String()})).
+		OrderBy("startTime").
+		All(&records)
+	if err != nil {
+		return nil, err
+	}
+	windows := make(map[string][]availabilityWindow, len(userIDs))
+	for _, record := range records {
+		userID := record.GetString("userID")
+		windows[userID] = append(windows[userID], availabilityWindow{
+			Shift: jobs.Shift{ID: record.Id, Start: record.GetDateTime("startTime").Time(), End: record.GetDateTime("endTime").Time()},
+			kind:  record.GetString("type"),
+		})
+	}
+	return windows, nil
+}
@@ -0,0 +1,183 @@
+package workers
+
+import (
+	"context"
+	"hirevo/internal/handlers"
+	"slices"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// Credential types
+const (
+	CredentialForklift            = "FORKLIFT"
+	CredentialWhiteCard           = "WHITE_CARD"
+	CredentialRSA                 = "RSA"
+	CredentialFirstAid            = "FIRST_AID"
+	CredentialDriversLicence      = "DRIVERS_LICENCE"
+	CredentialWorkingWithChildren = "WORKING_WITH_CHILDREN"
+)
+
+// Credential statuses
+const (
+	CredentialStatusValid    = "VALID"
+	CredentialStatusExpiring = "EXPIRING"
+	CredentialStatusExpired  = "EXPIRED"
+)
+
+// nonExpiringCredentials are issued for life (eg. the construction white card), expiresAt is optional
+var nonExpiringCredentials = []string{CredentialWhiteCard}
+
+// credentialsCheckCron flag expiring credentials every day at 6am
+const credentialsCheckCron = "0 6 * * *"
+
+// onCredentialChange validate the credential dates and document, and keep the status up to date
+func onCredentialChange(app *pocketbase.PocketBase, expiryWarning time.Duration) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		credential := e.Record
+		credentialType := credential.GetString("type")
+		issuedAt := credential.GetDateTime("issuedAt")
+		expiresAt := credential.GetDateTime("expiresAt")
+
+		if expiresAt.IsZero() && !slices.Contains(nonExpiringCredentials, credentialType) {
+			return handlers.Fail(ctx, handlers.ErrCredentialInvalid.WithParams("type", credentialType).WithField("expiresAt", validation.NewError(
+				"missing_expiry",
+				"The expiry date is required for this credential",
+			)))
+		}
+		if !issuedAt.IsZero() && !expiresAt.IsZero() && !expiresAt.After(issuedAt) {
+			return handlers.Fail(ctx, handlers.ErrCredentialInvalid.WithParams("type", credentialType).WithField("expiresAt", validation.NewError(
+				"invalid_expiry",
+				"The expiry date must be after the issue date",
+			)))
+		}
+		if !issuedAt.IsZero() && issuedAt.Time().After(time.Now()) {
+			return handlers.Fail(ctx, handlers.ErrCredentialInvalid.WithParams("type", credentialType).WithField("issuedAt", validation.NewError(
+				"invalid_issue_date",
+				"The issue date cannot be in the future",
+			)))
+		}
+		if credential.GetString("document") == "" && len(credential.GetUnsavedFiles("document")) == 0 {
+			return handlers.Fail(ctx, handlers.ErrCredentialInvalid.WithParams("type", credentialType).WithField("document", validation.NewError(
+				"missing_document",
+				"A copy of the licence or certificate is required",
+			)))
+		}
+
+		credential.Set("status", credentialStatus(credential, time.Now(), expiryWarning))
+		return e.Next()
+	}
+
+	app.OnRecordCreate("worker_credentials").BindFunc(validate)
+	app.OnRecordUpdate("worker_credentials").BindFunc(validate)
+}
+
+// credentialStatus VALID, EXPIRING within the warning period or EXPIRED at the given time
+func credentialStatus(credential *core.Record, at time.Time, expiryWarning time.Duration) string {
+	expiresAt := credential.GetDateTime("expiresAt")
+	switch {
+	case expiresAt.IsZero():
+		return CredentialStatusValid
+	case !expiresAt.Time().After(at):
+		return CredentialStatusExpired
+	case !expiresAt.Time().After(at.Add(expiryWarning)):
+		return CredentialStatusExpiring
+	}
+	return CredentialStatusValid
+}
+
+// MissingCredentials required credential types the worker lacks, or that are expired at the given time
+func MissingCredentials(app core.App, userID string, required []string, at time.Time) ([]string, error) {
+	missing, err := MissingCredentialsOf(app, []string{userID}, required, at)
+	if err != nil {
+		return nil, err
+	}
+	return missing[userID], nil
+}
+
+// MissingCredentialsOf required credential types each worker lacks, or that are expired at the given time,
+// by user, in a single query. Workers with all the credentials are not in the map
+func MissingCredentialsOf(app core.App, userIDs []string, required []string, at time.Time) (map[string][]string, error) {
+	if len(required) == 0 || len(userIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]any, 0, len(userIDs))
+	for _, userID := range userIDs {
+		ids = append(ids, userID)
+	}
+	credentials := []*core.Record{}
+	if err := app.RecordQuery("worker_credentials").AndWhere(dbx.In("userID", ids...)).All(&credentials); err != nil {
+		return nil, err
+	}
+	byUser := make(map[string][]*core.Record, len(userIDs))
+	for _, credential := range credentials {
+		userID := credential.GetString("userID")
+		byUser[userID] = append(byUser[userID], credential)
+	}
+
+	missing := map[string][]string{}
+	for _, userID := range userIDs {
+		for _, credentialType := range required {
+			valid := slices.ContainsFunc(byUser[userID], func(credential *core.Record) bool {
+				if credential.GetString("type") != credentialType {
+					return false
+				}
+				expiresAt := credential.GetDateTime("expiresAt")
+				return expiresAt.IsZero() || expiresAt.Time().After(at)
+			})
+			if !valid {
+				missing[userID] = append(missing[userID], credentialType)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// scheduleCredentialsCheck flag expiring and expired credentials once a day
+func scheduleCredentialsCheck(app *pocketbase.PocketBase, expiryWarning time.Duration) {
+	app.Cron().MustAdd("workersCredentialsCheck", credentialsCheckCron, func() {
+		if _, err := FlagExpiringCredentials(context.Background(), app, expiryWarning); err != nil {
+			handlers.LogError(context.Background(), err, "Failed to flag expiring credentials")
+		}
+	})
+}
+
+// FlagExpiringCredentials update the status of the credentials entering the warning period or past their expiry
+func FlagExpiringCredentials(ctx context.Context, app core.App, expiryWarning time.Duration) (int, error) {
+	now := time.Now()
+	warnBefore, err := types.ParseDateTime(now.Add(expiryWarning))
+	if err != nil {
+		return 0, err
+	}
+	credentials, err := app.FindRecordsByFilter(
+		"worker_credentials",
+		"expiresAt != '' && expiresAt <= {:warnBefore} && status != {:expired}",
+		"expiresAt", 0, 0,
+		dbx.Params{"warnBefore": warnBefore.String(), "expired": CredentialStatusExpired},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	flagged := 0
+	for _, credential := range credentials {
+		status := credentialStatus(credential, now, expiryWarning)
+		if status == credential.GetString("status") {
+			continue
+		}
+		credential.Set("status", status)
+		if err := app.SaveWithContext(ctx, credential); err != nil {
+			handlers.LogError(ctx, err, "Failed to flag credential", "credentialID", credential.Id)
+			return flagged, err
+		}
+		flagged++
+		handlers.LogInfo(ctx, "Credential flagged", "credentialID", credential.Id, "userID", credential.GetString("userID"), "type", credential.GetString("type"), "status", status)
+	}
+	return flagged, nil
+}
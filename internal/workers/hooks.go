@@ -0,0 +1,65 @@
+package workers
+
+import (
+	"hirevo/internal/config"
+	"hirevo/internal/handlers"
+	"hirevo/internal/jobs"
+	"time"
+
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks validate worker profiles, credentials and availability, and check the credentials and shift conflicts on hire
+func RegisterHooks(app *pocketbase.PocketBase, cfg config.WorkersConfig) {
+	onProfileChange(app)
+	onJobSkillsChange(app)
+	onCredentialChange(app, cfg.ExpiryWarning)
+	onHireCheckCredentials(app)
+	onAvailabilityChange(app)
+	onHireCheckAvailability(app)
+	onShiftChange(app)
+	scheduleCredentialsCheck(app, cfg.ExpiryWarning)
+}
+
+// onHireCheckCredentials block hiring a worker without the valid credentials required by the job
+func onHireCheckCredentials(app *pocketbase.PocketBase) {
+	check := func(e *core.RecordEvent) error {
+		member := e.Record
+		if member.GetString("status") != jobs.MemberStatusHired {
+			return e.Next()
+		}
+		if original := member.Original(); !member.IsNew() && original.GetString("status") == jobs.MemberStatusHired {
+			return e.Next()
+		}
+
+		ctx := handlers.RecordContext(e)
+		job, err := e.App.FindRecordById("jobs", member.GetString("jobID"))
+		if err != nil {
+			// reported by the hiring workflow
+			return e.Next()
+		}
+		required := job.GetStringSlice("requiredCredentials")
+		if len(required) == 0 {
+			return e.Next()
+		}
+
+		// credentials must stay valid until the last shift of the job
+		validUntil := time.Now()
+		if lastShift := jobs.LastShiftEnd(e.App, job); lastShift.After(validUntil) {
+			validUntil = lastShift
+		}
+		missing, err := MissingCredentials(e.App, member.GetString("userID"), required, validUntil)
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrCredentialCheckFailed.Wrap(err), "jobID", job.Id)
+		}
+		if len(missing) > 0 {
+			handlers.LogWarn(ctx, "Worker lacks required credentials", "jobID", job.Id, "userID", member.GetString("userID"), "missing", missing)
+			return handlers.Fail(ctx, handlers.ErrWorkerCredentialsMissing.WithParams("credentials", missing, "validUntil", validUntil.UTC().Format(time.RFC3339)))
+		}
+		return e.Next()
+	}
+
+	app.OnRecordCreate("job_members").BindFunc(check)
+	app.OnRecordUpdate("job_members").BindFunc(check)
+}
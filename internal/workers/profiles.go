@@ -0,0 +1,96 @@
+package workers
+
+import (
+	"encoding/json"
+	"hirevo/internal/handlers"
+	"slices"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/pocketbase/pocketbase"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxSkills a worker can list on the profile
+const maxSkills = 50
+
+// onProfileChange normalise the skills of the worker profile
+func onProfileChange(app *pocketbase.PocketBase) {
+	validate := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		skills, err := ParseSkills(e.Record.GetString("skills"))
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrWorkerProfileInvalid.Wrap(err).WithField("skills", validation.NewError(
+				"invalid_skills",
+				"Skills must be a list of names",
+			)))
+		}
+		if len(skills) > maxSkills {
+			return handlers.Fail(ctx, handlers.ErrWorkerProfileInvalid.WithParams("max", maxSkills).WithField("skills", validation.NewError(
+				"too_many_skills",
+				"Too many skills",
+			)))
+		}
+		e.Record.Set("skills", skills)
+		return e.Next()
+	}
+
+	app.OnRecordCreate("worker_profiles").BindFunc(validate)
+	app.OnRecordUpdate("worker_profiles").BindFunc(validate)
+}
+
+// onJobSkillsChange normalise the skills required by the job so they compare with the worker skills
+func onJobSkillsChange(app *pocketbase.PocketBase) {
+	normalize := func(e *core.RecordEvent) error {
+		ctx := handlers.RecordContext(e)
+		skills, err := ParseSkills(e.Record.GetString("requiredSkills"))
+		if err != nil {
+			return handlers.Fail(ctx, handlers.ErrJobSkillsInvalid.Wrap(err).WithField("requiredSkills", validation.NewError(
+				"invalid_skills",
+				"Skills must be a list of names",
+			)))
+		}
+		e.Record.Set("requiredSkills", skills)
+		return e.Next()
+	}
+
+	app.OnRecordCreate("jobs").BindFunc(normalize)
+	app.OnRecordUpdate("jobs").BindFunc(normalize)
+}
+
+// ParseSkills decode the JSON skills list, trimmed, lower cased and without duplicates
+func ParseSkills(raw string) ([]string, error) {
+	if raw == "" || raw == "null" {
+		return []string{}, nil
+	}
+	var values []string
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	return NormalizeSkills(values), nil
+}
+
+// NormalizeSkills trimmed, lower cased and sorted skills without duplicates
+func NormalizeSkills(values []string) []string {
+	skills := make([]string, 0, len(values))
+	for _, value := range values {
+		if skill := strings.ToLower(strings.TrimSpace(value)); skill != "" {
+			skills = append(skills, skill)
+		}
+	}
+	slices.Sort(skills)
+	return slices.Compact(skills)
+}
+
+// FindSkills skills of the worker profile, empty when the worker has no profile
+func FindSkills(app core.App, userID string) []string {
+	profile, err := app.FindFirstRecordByData("worker_profiles", "userID", userID)
+	if err != nil {
+		return []string{}
+	}
+	skills, err := ParseSkills(profile.GetString("skills"))
+	if err != nil {
+		return []string{}
+	}
+	return skills
+}
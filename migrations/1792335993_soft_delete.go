@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add "deletedAt" to the soft deletable collections, hide archived records and the jobs and invoices
+// of archived companies from API rules and only let the archive and restore routes change it
+func init() {
+	collections := []string{"companies", "jobs", "invoices"}
+	deletedAtLocked := bodyFieldLocked("deletedAt")
+
+	m.Register(func(app core.App) error {
+		for _, name := range collections {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			collection.Fields.Add(&core.DateField{Name: "deletedAt"})
+			collection.AddIndex("idx_"+name+"_deletedAt", false, "`deletedAt`", "")
+			filter := activeFilterOf(name)
+			collection.ListRule = withActiveFilter(collection.ListRule, filter)
+			collection.ViewRule = withActiveFilter(collection.ViewRule, filter)
+			collection.UpdateRule = withActiveFilter(withCondition(collection.UpdateRule, deletedAtLocked), filter)
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		// the children first, their rules refer to the deletedAt of the companies
+		for _, name := range slices.Backward(collections) {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			filter := activeFilterOf(name)
+			collection.ListRule = withoutActiveFilter(collection.ListRule, filter)
+			collection.ViewRule = withoutActiveFilter(collection.ViewRule, filter)
+			collection.UpdateRule = withoutCondition(withoutActiveFilter(collection.UpdateRule, filter), deletedAtLocked)
+			collection.RemoveIndex("idx_" + name + "_deletedAt")
+			collection.Fields.RemoveByName("deletedAt")
+
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
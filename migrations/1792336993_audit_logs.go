@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create the append only "audit_logs" collection, readable through the company audit route only
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("audit_logs")
+		collection.Fields.Add(
+			&core.NumberField{Name: "seq", OnlyInt: true, Required: true},
+			&core.TextField{Name: "collection", Required: true},
+			&core.TextField{Name: "recordId", Required: true},
+			&core.TextField{Name: "companyID"},
+			&core.SelectField{Name: "action", Required: true, MaxSelect: 1, Values: []string{"create", "update", "delete", "archive", "restore"}},
+			&core.TextField{Name: "actorId"},
+			&core.TextField{Name: "actorCollection"},
+			&core.JSONField{Name: "diff"},
+			&core.TextField{Name: "ip"},
+			&core.TextField{Name: "requestId"},
+			&core.DateField{Name: "occurredAt", Required: true},
+			&core.TextField{Name: "prevHash"},
+			&core.TextField{Name: "hash", Required: true},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		collection.AddIndex("idx_audit_logs_seq", true, "`seq`", "")
+		collection.AddIndex("idx_audit_logs_companyID", false, "`companyID`, `seq`", "")
+		collection.AddIndex("idx_audit_logs_record", false, "`collection`, `recordId`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("audit_logs")
+		if err != nil {
+			return err
+		}
+		return app.Delete(collection)
+	})
+}
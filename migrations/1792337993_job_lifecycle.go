@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// companyMemberRule restricts rules to active members of the record company
+const companyMemberRule = "@request.auth.id != '' && " +
+	"@collection.company_members.companyID ?= companyID && " +
+	"@collection.company_members.userID ?= @request.auth.id && " +
+	"@collection.company_members.status ?= 'ACTIVE'"
+
+// Add the job lifecycle fields and the "job_status_history" collection
+func init() {
+	statuses := []string{"DRAFT", "HIRING", "READY", "IN_PROGRESS", "COMPLETED", "CANCELLED"}
+
+	m.Register(func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+
+		// keep the existing values when status is already a select
+		if status, ok := jobs.Fields.GetByName("status").(*core.SelectField); ok {
+			for _, value := range statuses {
+				if !slices.Contains(status.Values, value) {
+					status.Values = append(status.Values, value)
+				}
+			}
+		}
+		jobs.Fields.Add(
+			&core.TextField{Name: "statusReason", Max: 500},
+			&core.DateField{Name: "statusChangedAt"},
+		)
+		jobs.AddIndex("idx_jobs_status", false, "`status`", "")
+		if err := app.Save(jobs); err != nil {
+			return err
+		}
+
+		history := core.NewBaseCollection("job_status_history")
+		history.Fields.Add(
+			&core.RelationField{Name: "jobID", CollectionId: jobs.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "companyID"},
+			&core.TextField{Name: "fromStatus"},
+			&core.TextField{Name: "toStatus", Required: true},
+			&core.TextField{Name: "reason"},
+			&core.TextField{Name: "actorId"},
+			&core.TextField{Name: "actorCollection"},
+			&core.TextField{Name: "requestId"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		history.AddIndex("idx_job_status_history_jobID", false, "`jobID`, `created`", "")
+		rule := companyMemberRule
+		history.ListRule = &rule
+		history.ViewRule = &rule
+
+		return app.Save(history)
+	}, func(app core.App) error {
+		history, err := app.FindCollectionByNameOrId("job_status_history")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(history); err != nil {
+			return err
+		}
+
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.RemoveIndex("idx_jobs_status")
+		jobs.Fields.RemoveByName("statusReason")
+		jobs.Fields.RemoveByName("statusChangedAt")
+		return app.Save(jobs)
+	})
+}
@@ -0,0 +1,68 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the hiring workflow fields to "job_members" and the headcount of "jobs",
+// the worker answering an offer cannot move its expiry
+func init() {
+	statuses := []string{"APPLIED", "SHORTLISTED", "OFFERED", "HIRED", "REJECTED", "WITHDRAWN", "EXPIRED"}
+	offerExpiryLocked := "(" + bodyFieldLocked("offerExpiresAt") + " || userID != @request.auth.id)"
+
+	m.Register(func(app core.App) error {
+		members, err := app.FindCollectionByNameOrId("job_members")
+		if err != nil {
+			return err
+		}
+
+		if status, ok := members.Fields.GetByName("status").(*core.SelectField); ok {
+			for _, value := range statuses {
+				if !slices.Contains(status.Values, value) {
+					status.Values = append(status.Values, value)
+				}
+			}
+		}
+		members.Fields.Add(
+			&core.DateField{Name: "offerExpiresAt"},
+			&core.DateField{Name: "statusChangedAt"},
+		)
+		members.AddIndex("idx_job_members_jobID_status", false, "`jobID`, `status`", "")
+		members.AddIndex("idx_job_members_offer", false, "`status`, `offerExpiresAt`", "")
+		members.UpdateRule = withCondition(members.UpdateRule, offerExpiryLocked)
+		if err := app.Save(members); err != nil {
+			return err
+		}
+
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		minHeadcount := 1.0
+		jobs.Fields.Add(&core.NumberField{Name: "headcount", OnlyInt: true, Min: &minHeadcount})
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.RemoveByName("headcount")
+		if err := app.Save(jobs); err != nil {
+			return err
+		}
+
+		members, err := app.FindCollectionByNameOrId("job_members")
+		if err != nil {
+			return err
+		}
+		members.RemoveIndex("idx_job_members_jobID_status")
+		members.RemoveIndex("idx_job_members_offer")
+		members.UpdateRule = withoutCondition(members.UpdateRule, offerExpiryLocked)
+		members.Fields.RemoveByName("offerExpiresAt")
+		members.Fields.RemoveByName("statusChangedAt")
+		return app.Save(members)
+	})
+}
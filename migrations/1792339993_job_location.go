@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the job coordinates, filled from the company address of the existing jobs
+func init() {
+	m.Register(func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+
+		minLat, maxLat := -90.0, 90.0
+		minLng, maxLng := -180.0, 180.0
+		jobs.Fields.Add(
+			&core.NumberField{Name: "latitude", Min: &minLat, Max: &maxLat},
+			&core.NumberField{Name: "longitude", Min: &minLng, Max: &maxLng},
+		)
+		jobs.AddIndex("idx_jobs_location", false, "`status`, `latitude`, `longitude`", "")
+		if err := app.Save(jobs); err != nil {
+			return err
+		}
+
+		_, err = app.DB().NewQuery(`
+			UPDATE jobs SET
+				latitude = coalesce((SELECT json_extract(c.address, '$.latitude') FROM companies c WHERE c.id = jobs.companyID), 0),
+				longitude = coalesce((SELECT json_extract(c.address, '$.longitude') FROM companies c WHERE c.id = jobs.companyID), 0)
+			WHERE latitude = 0 AND longitude = 0
+		`).Execute()
+		return err
+	}, func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.RemoveIndex("idx_jobs_location")
+		jobs.Fields.RemoveByName("latitude")
+		jobs.Fields.RemoveByName("longitude")
+		return app.Save(jobs)
+	})
+}
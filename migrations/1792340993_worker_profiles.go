@@ -0,0 +1,105 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// credentialTypes licences and certificates tracked for workers and required by jobs
+var credentialTypes = []string{"FORKLIFT", "WHITE_CARD", "RSA", "FIRST_AID", "DRIVERS_LICENCE", "WORKING_WITH_CHILDREN"}
+
+// Create "worker_profiles" and "worker_credentials", and the required credentials of "jobs"
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := "@request.auth.id != '' && userID = @request.auth.id"
+		// the owner cannot hand the record over to another user
+		updateRule := ownerRule + " && " + bodyFieldLocked("userID")
+		authRule := "@request.auth.id != ''"
+		// companies can read the credentials of the workers who applied to their jobs
+		credentialsViewRule := ownerRule + " || (" +
+			"@collection.job_members.userID ?= userID && " +
+			"@collection.job_members.jobID.companyID ?= @collection.company_members.companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE')"
+
+		profiles := core.NewBaseCollection("worker_profiles")
+		profiles.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "headline", Max: 200},
+			&core.TextField{Name: "bio", Max: 5000},
+			&core.JSONField{Name: "skills", MaxSize: 10000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		profiles.AddIndex("idx_worker_profiles_userID", true, "`userID`", "")
+		profiles.ListRule = &authRule
+		profiles.ViewRule = &authRule
+		profiles.CreateRule = &ownerRule
+		profiles.UpdateRule = &updateRule
+		profiles.DeleteRule = &ownerRule
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		credentials := core.NewBaseCollection("worker_credentials")
+		credentials.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.SelectField{Name: "type", Required: true, MaxSelect: 1, Values: credentialTypes},
+			&core.TextField{Name: "number", Max: 100},
+			&core.DateField{Name: "issuedAt"},
+			&core.DateField{Name: "expiresAt"},
+			&core.FileField{
+				Name:      "document",
+				MaxSelect: 1,
+				MaxSize:   5 << 20,
+				MimeTypes: []string{"application/pdf", "image/jpeg", "image/png"},
+				Protected: true,
+			},
+			&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{"VALID", "EXPIRING", "EXPIRED"}},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		credentials.AddIndex("idx_worker_credentials_userID", false, "`userID`, `type`", "")
+		credentials.AddIndex("idx_worker_credentials_expiresAt", false, "`status`, `expiresAt`", "")
+		credentials.ListRule = &credentialsViewRule
+		credentials.ViewRule = &credentialsViewRule
+		credentials.CreateRule = &ownerRule
+		credentials.UpdateRule = &updateRule
+		credentials.DeleteRule = &ownerRule
+		if err := app.Save(credentials); err != nil {
+			return err
+		}
+
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.Add(&core.SelectField{Name: "requiredCredentials", MaxSelect: len(credentialTypes), Values: credentialTypes})
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.RemoveByName("requiredCredentials")
+		if err := app.Save(jobs); err != nil {
+			return err
+		}
+
+		for _, name := range []string{"worker_credentials", "worker_profiles"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,73 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the skills required by "jobs", the home location of "worker_profiles"
+// and the hours per company of "user_reports" used by the matching
+func init() {
+	m.Register(func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.Add(&core.JSONField{Name: "requiredSkills", MaxSize: 10000})
+		if err := app.Save(jobs); err != nil {
+			return err
+		}
+
+		profiles, err := app.FindCollectionByNameOrId("worker_profiles")
+		if err != nil {
+			return err
+		}
+		minLat, maxLat := -90.0, 90.0
+		minLng, maxLng := -180.0, 180.0
+		minTravel, maxTravel := 0.0, 500.0
+		profiles.Fields.Add(
+			&core.NumberField{Name: "latitude", Min: &minLat, Max: &maxLat},
+			&core.NumberField{Name: "longitude", Min: &minLng, Max: &maxLng},
+			&core.NumberField{Name: "maxTravelKm", Min: &minTravel, Max: &maxTravel},
+		)
+		profiles.AddIndex("idx_worker_profiles_location", false, "`latitude`, `longitude`", "")
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		reports, err := app.FindCollectionByNameOrId("user_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.Add(&core.JSONField{Name: "companyHours", MaxSize: 100000})
+		return app.Save(reports)
+	}, func(app core.App) error {
+		reports, err := app.FindCollectionByNameOrId("user_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.RemoveByName("companyHours")
+		if err := app.Save(reports); err != nil {
+			return err
+		}
+
+		profiles, err := app.FindCollectionByNameOrId("worker_profiles")
+		if err != nil {
+			return err
+		}
+		profiles.RemoveIndex("idx_worker_profiles_location")
+		profiles.Fields.RemoveByName("latitude")
+		profiles.Fields.RemoveByName("longitude")
+		profiles.Fields.RemoveByName("maxTravelKm")
+		if err := app.Save(profiles); err != nil {
+			return err
+		}
+
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.RemoveByName("requiredSkills")
+		return app.Save(jobs)
+	})
+}
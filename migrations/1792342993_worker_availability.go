@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "worker_availability", the windows a worker is available or unavailable to work
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := "@request.auth.id != '' && userID = @request.auth.id"
+		updateRule := ownerRule + " && " + bodyFieldLocked("userID")
+		// companies can read the calendar of the workers who applied to their jobs
+		viewRule := ownerRule + " || (" +
+			"@collection.job_members.userID ?= userID && " +
+			"@collection.job_members.jobID.companyID ?= @collection.company_members.companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE')"
+
+		availability := core.NewBaseCollection("worker_availability")
+		availability.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.SelectField{Name: "type", Required: true, MaxSelect: 1, Values: []string{"AVAILABLE", "UNAVAILABLE"}},
+			&core.DateField{Name: "startTime", Required: true},
+			&core.DateField{Name: "endTime", Required: true},
+			&core.TextField{Name: "note", Max: 500},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		availability.AddIndex("idx_worker_availability_userID", false, "`userID`, `startTime`, `endTime`", "")
+		availability.ListRule = &viewRule
+		availability.ViewRule = &viewRule
+		availability.CreateRule = &ownerRule
+		availability.UpdateRule = &updateRule
+		availability.DeleteRule = &ownerRule
+		return app.Save(availability)
+	}, func(app core.App) error {
+		availability, err := app.FindCollectionByNameOrId("worker_availability")
+		if err != nil {
+			return err
+		}
+		return app.Delete(availability)
+	})
+}
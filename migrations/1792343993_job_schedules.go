@@ -0,0 +1,107 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "job_schedules" recurring shifts and "public_holidays", and link the generated "job_rates" to their schedule
+func init() {
+	m.Register(func(app core.App) error {
+		jobs, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+
+		// active members of the company of the scheduled job
+		memberRule := "@request.auth.id != '' && " +
+			"@collection.company_members.companyID ?= jobID.companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE'"
+		// the owners and admins of the company manage the schedules, which generate the job rates
+		managerRule := memberRule + " && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN')"
+		// moving a schedule to another job would write rates on the job of another company
+		updateRule := managerRule + " && " + bodyFieldLocked("jobID")
+		authRule := "@request.auth.id != ''"
+
+		minDuration, maxDuration := 15.0, 24*60.0
+		minRate := 0.0
+		schedules := core.NewBaseCollection("job_schedules")
+		schedules.Fields.Add(
+			&core.RelationField{Name: "jobID", CollectionId: jobs.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "rrule", Required: true, Max: 500},
+			&core.DateField{Name: "startTime", Required: true},
+			&core.NumberField{Name: "durationMinutes", Required: true, OnlyInt: true, Min: &minDuration, Max: &maxDuration},
+			&core.NumberField{Name: "rateValue", Min: &minRate},
+			&core.TextField{Name: "timezone", Max: 64},
+			&core.BoolField{Name: "skipHolidays"},
+			&core.TextField{Name: "holidayRegion", Max: 10},
+			&core.JSONField{Name: "exceptions", MaxSize: 10000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		schedules.AddIndex("idx_job_schedules_jobID", false, "`jobID`", "")
+		schedules.ListRule = &memberRule
+		schedules.ViewRule = &memberRule
+		schedules.CreateRule = &managerRule
+		schedules.UpdateRule = &updateRule
+		schedules.DeleteRule = &managerRule
+		if err := app.Save(schedules); err != nil {
+			return err
+		}
+
+		holidays := core.NewBaseCollection("public_holidays")
+		holidays.Fields.Add(
+			&core.TextField{Name: "date", Required: true, Pattern: `^\d{4}-\d{2}-\d{2}$`},
+			&core.TextField{Name: "name", Required: true, Max: 200},
+			// region empty for national holidays, else the state code (eg. NSW)
+			&core.TextField{Name: "region", Max: 10},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		holidays.AddIndex("idx_public_holidays_date", true, "`date`, `region`", "")
+		holidays.ListRule = &authRule
+		holidays.ViewRule = &authRule
+		if err := app.Save(holidays); err != nil {
+			return err
+		}
+
+		rates, err := app.FindCollectionByNameOrId("job_rates")
+		if err != nil {
+			return err
+		}
+		rates.Fields.Add(
+			&core.RelationField{Name: "scheduleID", CollectionId: schedules.Id, MaxSelect: 1},
+			// local date of the occurrence in the schedule timezone, YYYY-MM-DD
+			&core.TextField{Name: "occurrence", Max: 10},
+			// edited by hand, the schedule no longer updates it
+			&core.BoolField{Name: "detached"},
+		)
+		rates.AddIndex("idx_job_rates_schedule", true, "`scheduleID`, `occurrence`", "`scheduleID` != ''")
+		return app.Save(rates)
+	}, func(app core.App) error {
+		rates, err := app.FindCollectionByNameOrId("job_rates")
+		if err != nil {
+			return err
+		}
+		rates.RemoveIndex("idx_job_rates_schedule")
+		rates.Fields.RemoveByName("scheduleID")
+		rates.Fields.RemoveByName("occurrence")
+		rates.Fields.RemoveByName("detached")
+		if err := app.Save(rates); err != nil {
+			return err
+		}
+
+		for _, name := range []string{"public_holidays", "job_schedules"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "payslips", the earnings statements of a worker for a company and a pay period,
+// the amounts are AUD cents so the totals of the payslips reconcile
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+
+		// the worker and the owners, admins and payroll officers of the company, the roles allowed to generate them,
+		// payslips are only generated by the backend
+		viewRule := "@request.auth.id != '' && (userID = @request.auth.id || (" +
+			"@collection.company_members.companyID ?= companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE' && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN' || @collection.company_members.role ?= 'PAYROLL')))"
+
+		payslips := core.NewBaseCollection("payslips")
+		payslips.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1},
+			&core.DateField{Name: "periodStart", Required: true},
+			&core.DateField{Name: "periodEnd", Required: true},
+			&core.JSONField{Name: "lines", MaxSize: 100000},
+			&core.NumberField{Name: "hours"},
+			&core.NumberField{Name: "grossMinor", OnlyInt: true},
+			&core.NumberField{Name: "superRate"},
+			&core.NumberField{Name: "superMinor", OnlyInt: true},
+			&core.NumberField{Name: "ytdGrossMinor", OnlyInt: true},
+			&core.NumberField{Name: "ytdSuperMinor", OnlyInt: true},
+			&core.FileField{
+				Name:      "document",
+				MaxSelect: 1,
+				MaxSize:   5 << 20,
+				MimeTypes: []string{"application/pdf"},
+				Protected: true,
+			},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		payslips.AddIndex("idx_payslips_period", true, "`userID`, `companyID`, `periodStart`", "")
+		payslips.AddIndex("idx_payslips_companyID", false, "`companyID`, `periodStart`", "")
+		payslips.ListRule = &viewRule
+		payslips.ViewRule = &viewRule
+		return app.Save(payslips)
+	}, func(app core.App) error {
+		payslips, err := app.FindCollectionByNameOrId("payslips")
+		if err != nil {
+			return err
+		}
+		return app.Delete(payslips)
+	})
+}
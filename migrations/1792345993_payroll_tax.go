@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the tax-free threshold claim of the workers to their company membership, it is claimed from one payer only,
+// the pay frequency, PAYG withholding and net pay of the payslips and reports
+func init() {
+	m.Register(func(app core.App) error {
+		members, err := app.FindCollectionByNameOrId("company_members")
+		if err != nil {
+			return err
+		}
+		members.Fields.Add(&core.BoolField{Name: "claimsTaxFreeThreshold"})
+		if err := app.Save(members); err != nil {
+			return err
+		}
+
+		payslips, err := app.FindCollectionByNameOrId("payslips")
+		if err != nil {
+			return err
+		}
+		payslips.Fields.Add(
+			&core.NumberField{Name: "withholdingMinor", OnlyInt: true},
+			&core.NumberField{Name: "netMinor", OnlyInt: true},
+			&core.NumberField{Name: "ytdWithholdingMinor", OnlyInt: true},
+			&core.NumberField{Name: "ytdNetMinor", OnlyInt: true},
+			&core.TextField{Name: "taxTableVersion", Max: 20},
+			&core.BoolField{Name: "taxFreeThreshold"},
+			&core.SelectField{Name: "payFrequency", MaxSelect: 1, Values: []string{"WEEKLY", "FORTNIGHTLY", "FOUR_WEEKLY", "MONTHLY"}},
+		)
+		if err := app.Save(payslips); err != nil {
+			return err
+		}
+
+		reports, err := app.FindCollectionByNameOrId("user_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.Add(
+			&core.NumberField{Name: "totalWithholding"},
+			&core.NumberField{Name: "totalNetEarnings"},
+		)
+		return app.Save(reports)
+	}, func(app core.App) error {
+		reports, err := app.FindCollectionByNameOrId("user_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.RemoveByName("totalWithholding")
+		reports.Fields.RemoveByName("totalNetEarnings")
+		if err := app.Save(reports); err != nil {
+			return err
+		}
+
+		payslips, err := app.FindCollectionByNameOrId("payslips")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"withholdingMinor", "netMinor", "ytdWithholdingMinor", "ytdNetMinor", "taxTableVersion", "taxFreeThreshold", "payFrequency"} {
+			payslips.Fields.RemoveByName(name)
+		}
+		if err := app.Save(payslips); err != nil {
+			return err
+		}
+
+		members, err := app.FindCollectionByNameOrId("company_members")
+		if err != nil {
+			return err
+		}
+		members.Fields.RemoveByName("claimsTaxFreeThreshold")
+		return app.Save(members)
+	})
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "notifications", the in-app inbox delivered over realtime, "notification_preferences",
+// the channels each user wants, and "notification_outbox", the deliveries retried until they succeed
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := "@request.auth.id != '' && userID = @request.auth.id"
+		// the preferences cannot be moved to another user, their notifications would go to the owner webhook
+		preferencesUpdateRule := ownerRule + " && @request.body.userID:isset = false"
+		// the recipient can only mark the notification as read
+		readRule := ownerRule + " && @request.body.userID:isset = false && @request.body.event:isset = false && " +
+			"@request.body.title:isset = false && @request.body.body:isset = false && @request.body.data:isset = false"
+
+		notifications := core.NewBaseCollection("notifications")
+		notifications.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "event", Required: true, Max: 100},
+			&core.TextField{Name: "title", Required: true, Max: 200},
+			&core.TextField{Name: "body", Max: 2000},
+			&core.JSONField{Name: "data", MaxSize: 10000},
+			&core.DateField{Name: "readAt"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		notifications.AddIndex("idx_notifications_userID", false, "`userID`, `readAt`", "")
+		notifications.ListRule = &ownerRule
+		notifications.ViewRule = &ownerRule
+		notifications.UpdateRule = &readRule
+		notifications.DeleteRule = &ownerRule
+		if err := app.Save(notifications); err != nil {
+			return err
+		}
+
+		preferences := core.NewBaseCollection("notification_preferences")
+		preferences.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.SelectField{Name: "channels", MaxSelect: 3, Values: []string{"IN_APP", "EMAIL", "WEBHOOK"}},
+			&core.URLField{Name: "webhookUrl"},
+			&core.JSONField{Name: "mutedEvents", MaxSize: 2000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		preferences.AddIndex("idx_notification_preferences_userID", true, "`userID`", "")
+		preferences.ListRule = &ownerRule
+		preferences.ViewRule = &ownerRule
+		preferences.CreateRule = &ownerRule
+		preferences.UpdateRule = &preferencesUpdateRule
+		preferences.DeleteRule = &ownerRule
+		if err := app.Save(preferences); err != nil {
+			return err
+		}
+
+		// superusers only, deliveries are written and sent by the backend
+		outbox := core.NewBaseCollection("notification_outbox")
+		outbox.Fields.Add(
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "channel", Required: true, Max: 50},
+			&core.TextField{Name: "event", Required: true, Max: 100},
+			&core.TextField{Name: "title", Max: 200},
+			&core.TextField{Name: "body", Max: 2000},
+			&core.JSONField{Name: "data", MaxSize: 10000},
+			&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{"PENDING", "SENDING", "SENT", "FAILED"}},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.DateField{Name: "nextAttemptAt"},
+			&core.DateField{Name: "sentAt"},
+			&core.TextField{Name: "lastError", Max: 1000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		outbox.AddIndex("idx_notification_outbox_pending", false, "`status`, `nextAttemptAt`", "")
+		return app.Save(outbox)
+	}, func(app core.App) error {
+		for _, name := range []string{"notification_outbox", "notification_preferences", "notifications"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
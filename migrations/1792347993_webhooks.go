@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "webhook_endpoints", the URLs companies want their events posted to,
+// and "webhook_deliveries", the log of every attempt to deliver an event to an endpoint
+func init() {
+	m.Register(func(app core.App) error {
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+
+		// the owners and admins of the company manage its integrations
+		managerRule := "@request.auth.id != '' && " +
+			"@collection.company_members.companyID ?= companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE' && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN')"
+		updateRule := managerRule + " && @request.body.companyID:isset = false"
+
+		endpoints := core.NewBaseCollection("webhook_endpoints")
+		endpoints.Fields.Add(
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.URLField{Name: "url", Required: true},
+			&core.JSONField{Name: "events", MaxSize: 2000},
+			&core.TextField{Name: "secret", Max: 100},
+			&core.BoolField{Name: "active"},
+			&core.TextField{Name: "description", Max: 500},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		endpoints.AddIndex("idx_webhook_endpoints_companyID", false, "`companyID`, `active`", "")
+		endpoints.ListRule = &managerRule
+		endpoints.ViewRule = &managerRule
+		endpoints.CreateRule = &managerRule
+		endpoints.UpdateRule = &updateRule
+		endpoints.DeleteRule = &managerRule
+		if err := app.Save(endpoints); err != nil {
+			return err
+		}
+
+		// read only, deliveries are written by the backend
+		deliveries := core.NewBaseCollection("webhook_deliveries")
+		deliveries.Fields.Add(
+			&core.RelationField{Name: "endpointID", CollectionId: endpoints.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.TextField{Name: "eventID", Required: true, Max: 50},
+			&core.TextField{Name: "event", Required: true, Max: 100},
+			&core.JSONField{Name: "payload", MaxSize: 1 << 20},
+			&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{"PENDING", "SENDING", "SUCCEEDED", "FAILED"}},
+			&core.NumberField{Name: "attempts", OnlyInt: true},
+			&core.DateField{Name: "nextAttemptAt"},
+			&core.DateField{Name: "deliveredAt"},
+			&core.NumberField{Name: "responseStatus", OnlyInt: true},
+			&core.TextField{Name: "responseBody", Max: 2000},
+			&core.TextField{Name: "lastError", Max: 1000},
+			&core.TextField{Name: "redeliveryOf", Max: 50},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		deliveries.AddIndex("idx_webhook_deliveries_pending", false, "`status`, `nextAttemptAt`", "")
+		deliveries.AddIndex("idx_webhook_deliveries_endpointID", false, "`endpointID`, `created`", "")
+		deliveries.ListRule = &managerRule
+		deliveries.ViewRule = &managerRule
+		return app.Save(deliveries)
+	}, func(app core.App) error {
+		for _, name := range []string{"webhook_deliveries", "webhook_endpoints"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "invoice_sends", the history of the invoice emails and their open and bounce status,
+// and add the status of the last send to the invoices
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+
+		sendStatuses := []string{"SENT", "FAILED", "OPENED", "BOUNCED"}
+		invoices.Fields.Add(
+			&core.SelectField{Name: "sendStatus", MaxSelect: 1, Values: sendStatuses},
+			&core.DateField{Name: "lastSentAt"},
+			&core.NumberField{Name: "sendCount", OnlyInt: true},
+		)
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		// the owners and admins of the invoicing company, sends are only written by the backend
+		viewRule := "@request.auth.id != '' && " +
+			"@collection.company_members.companyID ?= companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE' && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN')"
+
+		sends := core.NewBaseCollection("invoice_sends")
+		sends.Fields.Add(
+			&core.RelationField{Name: "invoiceID", CollectionId: invoices.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1},
+			&core.RelationField{Name: "sentBy", CollectionId: users.Id, MaxSelect: 1},
+			&core.JSONField{Name: "to", MaxSize: 5000},
+			&core.JSONField{Name: "cc", MaxSize: 5000},
+			&core.JSONField{Name: "bcc", MaxSize: 5000},
+			&core.TextField{Name: "subject", Max: 300},
+			&core.TextField{Name: "message", Max: 5000},
+			&core.TextField{Name: "messageId", Max: 300},
+			&core.TextField{Name: "trackingToken", Max: 100, Hidden: true},
+			&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: sendStatuses},
+			&core.TextField{Name: "error", Max: 1000},
+			&core.DateField{Name: "openedAt"},
+			&core.DateField{Name: "bouncedAt"},
+			&core.TextField{Name: "bounceReason", Max: 1000},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		sends.AddIndex("idx_invoice_sends_invoiceID", false, "`invoiceID`, `created`", "")
+		sends.AddIndex("idx_invoice_sends_messageId", false, "`messageId`", "")
+		sends.ListRule = &viewRule
+		sends.ViewRule = &viewRule
+		return app.Save(sends)
+	}, func(app core.App) error {
+		sends, err := app.FindCollectionByNameOrId("invoice_sends")
+		if err != nil {
+			return err
+		}
+		if err := app.Delete(sends); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.Fields.RemoveByName("sendStatus")
+		invoices.Fields.RemoveByName("lastSentAt")
+		invoices.Fields.RemoveByName("sendCount")
+		return app.Save(invoices)
+	})
+}
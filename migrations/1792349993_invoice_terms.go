@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the payment terms and reminder schedule of the companies, the due date and reminders of the invoices
+// and the aged receivables of the company reports
+func init() {
+	m.Register(func(app core.App) error {
+		zero := 0.0
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		companies.Fields.Add(
+			&core.NumberField{Name: "paymentTermsDays", OnlyInt: true, Min: &zero},
+			&core.JSONField{Name: "reminderDays", MaxSize: 1000},
+		)
+		if err := app.Save(companies); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.Fields.Add(
+			&core.NumberField{Name: "paymentTermsDays", OnlyInt: true, Min: &zero},
+			&core.DateField{Name: "dueDate"},
+			&core.NumberField{Name: "remindersSent", OnlyInt: true},
+			&core.DateField{Name: "lastReminderAt"},
+		)
+		invoices.AddIndex("idx_invoices_due", false, "`status`, `dueDate`", "")
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		reports, err := app.FindCollectionByNameOrId("company_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.Add(
+			&core.NumberField{Name: "overdueInvoices"},
+			&core.NumberField{Name: "receivablesCurrent"},
+			&core.NumberField{Name: "receivables1To30"},
+			&core.NumberField{Name: "receivables31To60"},
+			&core.NumberField{Name: "receivables61To90"},
+			&core.NumberField{Name: "receivablesOver90"},
+		)
+		return app.Save(reports)
+	}, func(app core.App) error {
+		reports, err := app.FindCollectionByNameOrId("company_reports")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"overdueInvoices", "receivablesCurrent", "receivables1To30", "receivables31To60", "receivables61To90", "receivablesOver90"} {
+			reports.Fields.RemoveByName(name)
+		}
+		if err := app.Save(reports); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.RemoveIndex("idx_invoices_due")
+		for _, name := range []string{"paymentTermsDays", "dueDate", "remindersSent", "lastReminderAt"} {
+			invoices.Fields.RemoveByName(name)
+		}
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		companies.Fields.RemoveByName("paymentTermsDays")
+		companies.Fields.RemoveByName("reminderDays")
+		return app.Save(companies)
+	})
+}
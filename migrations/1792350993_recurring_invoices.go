@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "recurring_invoices", the templates of the invoices billed on a schedule,
+// and link the generated invoices to their template and period so each period is billed once
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+
+		// the owners and admins of the company
+		managerRule := "@request.auth.id != '' && " +
+			"@collection.company_members.companyID ?= companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE' && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN')"
+		updateRule := managerRule + " && @request.body.companyID:isset = false"
+
+		zero := 0.0
+		recurring := core.NewBaseCollection("recurring_invoices")
+		recurring.Fields.Add(
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "userID", CollectionId: users.Id, Required: true, MaxSelect: 1},
+			&core.TextField{Name: "title", Max: 200},
+			&core.SelectField{Name: "frequency", Required: true, MaxSelect: 1, Values: []string{"WEEKLY", "FORTNIGHTLY", "MONTHLY"}},
+			&core.TextField{Name: "startDate", Required: true, Pattern: `^\d{4}-\d{2}-\d{2}$`},
+			&core.TextField{Name: "endDate", Pattern: `^\d{4}-\d{2}-\d{2}$`},
+			&core.TextField{Name: "timezone", Max: 64},
+			&core.JSONField{Name: "lineItems", MaxSize: 20000},
+			&core.NumberField{Name: "paymentTermsDays", OnlyInt: true, Min: &zero},
+			&core.BoolField{Name: "active"},
+			&core.TextField{Name: "lastGeneratedDate", Max: 10},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		recurring.AddIndex("idx_recurring_invoices_active", false, "`active`, `startDate`", "")
+		recurring.ListRule = &managerRule
+		recurring.ViewRule = &managerRule
+		recurring.CreateRule = &managerRule
+		recurring.UpdateRule = &updateRule
+		recurring.DeleteRule = &managerRule
+		if err := app.Save(recurring); err != nil {
+			return err
+		}
+
+		invoices.Fields.Add(
+			&core.RelationField{Name: "recurringInvoiceID", CollectionId: recurring.Id, MaxSelect: 1},
+			&core.TextField{Name: "periodDate", Max: 10},
+		)
+		invoices.AddIndex("idx_invoices_recurring_period", true, "`recurringInvoiceID`, `periodDate`", "`recurringInvoiceID` != ''")
+		return app.Save(invoices)
+	}, func(app core.App) error {
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.RemoveIndex("idx_invoices_recurring_period")
+		invoices.Fields.RemoveByName("recurringInvoiceID")
+		invoices.Fields.RemoveByName("periodDate")
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		recurring, err := app.FindCollectionByNameOrId("recurring_invoices")
+		if err != nil {
+			return err
+		}
+		return app.Delete(recurring)
+	})
+}
@@ -0,0 +1,139 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "exchange_rates" and add the currency of the companies, recurring invoices and reports,
+// the invoices keep their amounts in minor units with the rate to the company base currency at issue time
+func init() {
+	m.Register(func(app core.App) error {
+		currencyPattern := `^[A-Z]{3}$`
+		authRule := "@request.auth.id != ''"
+
+		// rates are imported by the superusers, readable by every user
+		rates := core.NewBaseCollection("exchange_rates")
+		rates.Fields.Add(
+			&core.TextField{Name: "date", Required: true, Pattern: `^\d{4}-\d{2}-\d{2}$`},
+			&core.TextField{Name: "base", Required: true, Pattern: currencyPattern},
+			&core.TextField{Name: "quote", Required: true, Pattern: currencyPattern},
+			&core.NumberField{Name: "rate", Required: true},
+			&core.TextField{Name: "source", Max: 200},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		rates.AddIndex("idx_exchange_rates_pair", true, "`base`, `quote`, `date`", "")
+		rates.ListRule = &authRule
+		rates.ViewRule = &authRule
+		if err := app.Save(rates); err != nil {
+			return err
+		}
+
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		companies.Fields.Add(&core.TextField{Name: "baseCurrency", Pattern: currencyPattern})
+		if err := app.Save(companies); err != nil {
+			return err
+		}
+
+		recurring, err := app.FindCollectionByNameOrId("recurring_invoices")
+		if err != nil {
+			return err
+		}
+		recurring.Fields.Add(&core.TextField{Name: "currency", Pattern: currencyPattern})
+		if err := app.Save(recurring); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.Fields.Add(
+			&core.TextField{Name: "currency", Pattern: currencyPattern},
+			&core.NumberField{Name: "totalMinor", OnlyInt: true},
+			&core.TextField{Name: "baseCurrency", Pattern: currencyPattern},
+			&core.NumberField{Name: "exchangeRate"},
+			&core.TextField{Name: "exchangeRateDate", Max: 10},
+			&core.NumberField{Name: "baseTotalMinor", OnlyInt: true},
+		)
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		reports, err := app.FindCollectionByNameOrId("company_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.Add(&core.TextField{Name: "currency", Pattern: currencyPattern})
+		if err := app.Save(reports); err != nil {
+			return err
+		}
+
+		// amounts were AUD until now, the printed total of the existing invoices becomes their total in cents
+		if _, err := app.DB().NewQuery(`UPDATE companies SET baseCurrency = 'AUD' WHERE baseCurrency = ''`).Execute(); err != nil {
+			return err
+		}
+		_, err = app.DB().NewQuery(`
+			UPDATE invoices SET
+				currency = 'AUD',
+				baseCurrency = 'AUD',
+				exchangeRate = 1,
+				totalMinor = CAST(round(100 * CAST(replace(replace(replace(
+					coalesce(json_extract(metadata, '$.Total'), json_extract(metadata, '$.Content.Total'), '0'),
+					'$', ''), ',', ''), ' ', '') AS REAL)) AS INTEGER),
+				baseTotalMinor = CAST(round(100 * CAST(replace(replace(replace(
+					coalesce(json_extract(metadata, '$.Total'), json_extract(metadata, '$.Content.Total'), '0'),
+					'$', ''), ',', ''), ' ', '') AS REAL)) AS INTEGER)
+			WHERE currency = ''
+		`).Execute()
+		return err
+	}, func(app core.App) error {
+		reports, err := app.FindCollectionByNameOrId("company_reports")
+		if err != nil {
+			return err
+		}
+		reports.Fields.RemoveByName("currency")
+		if err := app.Save(reports); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"currency", "totalMinor", "baseCurrency", "exchangeRate", "exchangeRateDate", "baseTotalMinor"} {
+			invoices.Fields.RemoveByName(name)
+		}
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		recurring, err := app.FindCollectionByNameOrId("recurring_invoices")
+		if err != nil {
+			return err
+		}
+		recurring.Fields.RemoveByName("currency")
+		if err := app.Save(recurring); err != nil {
+			return err
+		}
+
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		companies.Fields.RemoveByName("baseCurrency")
+		if err := app.Save(companies); err != nil {
+			return err
+		}
+
+		rates, err := app.FindCollectionByNameOrId("exchange_rates")
+		if err != nil {
+			return err
+		}
+		return app.Delete(rates)
+	})
+}
@@ -0,0 +1,133 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Create "credit_notes" and the accounting export batches, with the documents each batch exported
+// so no invoice, payment or credit note is exported twice to the same accounting software
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+
+		// the owners and admins of the company
+		managerRule := "@request.auth.id != '' && " +
+			"@collection.company_members.companyID ?= companyID && " +
+			"@collection.company_members.userID ?= @request.auth.id && " +
+			"@collection.company_members.status ?= 'ACTIVE' && " +
+			"(@collection.company_members.role ?= 'OWNER' || @collection.company_members.role ?= 'ADMIN')"
+		formats := []string{"XERO", "MYOB"}
+
+		companies.Fields.Add(&core.JSONField{Name: "accountingCodes", MaxSize: 5000})
+		if err := app.Save(companies); err != nil {
+			return err
+		}
+
+		invoices.Fields.Add(&core.DateField{Name: "paidAt"})
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+		if _, err := app.DB().NewQuery(`UPDATE invoices SET paidAt = updated WHERE status = 'PAID' AND paidAt = ''`).Execute(); err != nil {
+			return err
+		}
+
+		// credit notes are accounting documents, they are never changed once issued
+		one := 1.0
+		creditNotes := core.NewBaseCollection("credit_notes")
+		creditNotes.Fields.Add(
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "invoiceID", CollectionId: invoices.Id, Required: true, MaxSelect: 1},
+			&core.RelationField{Name: "issuedBy", CollectionId: users.Id, MaxSelect: 1},
+			&core.NumberField{Name: "amountMinor", Required: true, OnlyInt: true, Min: &one},
+			&core.TextField{Name: "currency", Pattern: `^[A-Z]{3}$`},
+			&core.TextField{Name: "reason", Max: 500},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		creditNotes.AddIndex("idx_credit_notes_invoice", false, "`invoiceID`", "")
+		creditNotes.ListRule = &managerRule
+		creditNotes.ViewRule = &managerRule
+		creditNotes.CreateRule = &managerRule
+		if err := app.Save(creditNotes); err != nil {
+			return err
+		}
+
+		exports := core.NewBaseCollection("accounting_exports")
+		exports.Fields.Add(
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "exportedBy", CollectionId: users.Id, MaxSelect: 1},
+			&core.SelectField{Name: "format", Required: true, MaxSelect: 1, Values: formats},
+			&core.NumberField{Name: "invoices", OnlyInt: true},
+			&core.NumberField{Name: "payments", OnlyInt: true},
+			&core.NumberField{Name: "creditNotes", OnlyInt: true},
+			&core.FileField{
+				Name:      "files",
+				MaxSelect: 2,
+				MaxSize:   20 << 20,
+				MimeTypes: []string{"text/csv", "text/plain"},
+				Protected: true,
+			},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		exports.AddIndex("idx_accounting_exports_company", false, "`companyID`, `created`", "")
+		exports.ListRule = &managerRule
+		exports.ViewRule = &managerRule
+		if err := app.Save(exports); err != nil {
+			return err
+		}
+
+		items := core.NewBaseCollection("accounting_export_items")
+		items.Fields.Add(
+			&core.RelationField{Name: "exportID", CollectionId: exports.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.RelationField{Name: "companyID", CollectionId: companies.Id, Required: true, MaxSelect: 1, CascadeDelete: true},
+			&core.SelectField{Name: "format", Required: true, MaxSelect: 1, Values: formats},
+			&core.SelectField{Name: "kind", Required: true, MaxSelect: 1, Values: []string{"INVOICE", "PAYMENT", "CREDIT_NOTE"}},
+			&core.TextField{Name: "documentID", Required: true, Max: 15},
+			&core.AutodateField{Name: "created", OnCreate: true},
+		)
+		items.AddIndex("idx_accounting_export_items_document", true, "`format`, `kind`, `documentID`", "")
+		items.AddIndex("idx_accounting_export_items_export", false, "`exportID`", "")
+		items.ListRule = &managerRule
+		items.ViewRule = &managerRule
+		return app.Save(items)
+	}, func(app core.App) error {
+		for _, name := range []string{"accounting_export_items", "accounting_exports", "credit_notes"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.Fields.RemoveByName("paidAt")
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		companies, err := app.FindCollectionByNameOrId("companies")
+		if err != nil {
+			return err
+		}
+		companies.Fields.RemoveByName("accountingCodes")
+		return app.Save(companies)
+	})
+}
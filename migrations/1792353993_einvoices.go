@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// Add the Peppol e-invoice options to "invoices" and "recurring_invoices", the buyers are addressed by their ABN
+// in Australia and their NZBN in New Zealand, the UBL document of an e-invoice is stored alongside its PDF
+func init() {
+	m.Register(func(app core.App) error {
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		invoices.Fields.Add(
+			&core.BoolField{Name: "eInvoice"},
+			&core.TextField{Name: "buyerReference", Max: 200},
+			&core.TextField{Name: "buyerABN", Max: 14, Pattern: `^[0-9 ]*$`},
+			&core.TextField{Name: "buyerNZBN", Max: 13, Pattern: `^([0-9]{13})?$`},
+			&core.TextField{Name: "buyerCountry", Max: 2, Pattern: `^([A-Z]{2})?$`},
+			&core.FileField{
+				Name:      "ubl",
+				MaxSelect: 1,
+				MaxSize:   1 << 20,
+				MimeTypes: []string{"application/xml", "text/xml"},
+				Protected: true,
+			},
+		)
+		if err := app.Save(invoices); err != nil {
+			return err
+		}
+
+		recurring, err := app.FindCollectionByNameOrId("recurring_invoices")
+		if err != nil {
+			return err
+		}
+		recurring.Fields.Add(
+			&core.BoolField{Name: "eInvoice"},
+			&core.TextField{Name: "buyerReference", Max: 200},
+			&core.TextField{Name: "buyerABN", Max: 14, Pattern: `^[0-9 ]*$`},
+			&core.TextField{Name: "buyerNZBN", Max: 13, Pattern: `^([0-9]{13})?$`},
+			&core.TextField{Name: "buyerCountry", Max: 2, Pattern: `^([A-Z]{2})?$`},
+		)
+		return app.Save(recurring)
+	}, func(app core.App) error {
+		recurring, err := app.FindCollectionByNameOrId("recurring_invoices")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"eInvoice", "buyerReference", "buyerABN", "buyerNZBN", "buyerCountry"} {
+			recurring.Fields.RemoveByName(name)
+		}
+		if err := app.Save(recurring); err != nil {
+			return err
+		}
+
+		invoices, err := app.FindCollectionByNameOrId("invoices")
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{"eInvoice", "buyerReference", "buyerABN", "buyerNZBN", "buyerCountry", "ubl"} {
+			invoices.Fields.RemoveByName(name)
+		}
+		return app.Save(invoices)
+	})
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// minorFields amounts kept in minor units next to the float kept for display, by collection
+var minorFields = []struct {
+	collection string
+	fields     []string
+}{
+	{"job_rates", []string{"rateMinor"}},
+	{"job_schedules", []string{"rateMinor"}},
+	{"user_reports", []string{"totalEarningsMinor", "totalWithholdingMinor", "totalNetEarningsMinor"}},
+	{"company_reports", []string{
+		"totalRevenueMinor", "receivablesCurrentMinor", "receivables1To30Minor",
+		"receivables31To60Minor", "receivables61To90Minor", "receivablesOver90Minor",
+	}},
+}
+
+// Add the rates and report amounts in minor units, the float fields they were stored in stay for display only
+func init() {
+	m.Register(func(app core.App) error {
+		minRate := 0.0
+		for _, definition := range minorFields {
+			collection, err := app.FindCollectionByNameOrId(definition.collection)
+			if err != nil {
+				return err
+			}
+			for _, name := range definition.fields {
+				field := &core.NumberField{Name: name, OnlyInt: true}
+				if name == "rateMinor" {
+					field.Min = &minRate
+				}
+				collection.Fields.Add(field)
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+
+		// rates, earnings and payslips are in AUD cents, the company reports in the company base currency
+		// with the exponents of internal/currency
+		for _, query := range []string{
+			`UPDATE job_rates SET rateMinor = CAST(round(100 * rateValue) AS INTEGER)`,
+			`UPDATE job_schedules SET rateMinor = CAST(round(100 * rateValue) AS INTEGER)`,
+			`UPDATE user_reports SET
+				totalEarningsMinor = CAST(round(100 * totalEarnings) AS INTEGER),
+				totalWithholdingMinor = CAST(round(100 * totalWithholding) AS INTEGER),
+				totalNetEarningsMinor = CAST(round(100 * totalNetEarnings) AS INTEGER)`,
+			`UPDATE company_reports SET
+				totalRevenueMinor = CAST(round(scale * totalRevenue) AS INTEGER),
+				receivablesCurrentMinor = CAST(round(scale * receivablesCurrent) AS INTEGER),
+				receivables1To30Minor = CAST(round(scale * receivables1To30) AS INTEGER),
+				receivables31To60Minor = CAST(round(scale * receivables31To60) AS INTEGER),
+				receivables61To90Minor = CAST(round(scale * receivables61To90) AS INTEGER),
+				receivablesOver90Minor = CAST(round(scale * receivablesOver90) AS INTEGER)
+			FROM (SELECT id AS reportID, CASE
+				WHEN currency IN ('JPY', 'KRW', 'VND', 'XPF') THEN 1
+				WHEN currency IN ('BHD', 'KWD', 'OMR') THEN 1000
+				ELSE 100 END AS scale FROM company_reports)
+			WHERE id = reportID`,
+		} {
+			if _, err := app.DB().NewQuery(query).Execute(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		for _, definition := range minorFields {
+			collection, err := app.FindCollectionByNameOrId(definition.collection)
+			if err != nil {
+				return err
+			}
+			for _, name := range definition.fields {
+				collection.Fields.RemoveByName(name)
+			}
+			if err := app.Save(collection); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"strings"
+)
+
+// activeFilter restricts rules to records that are not archived
+const activeFilter = "deletedAt = ''"
+
+// activeFilterOf filter of the rules of a soft deletable collection, jobs and invoices
+// are also hidden while their company is archived
+func activeFilterOf(collection string) string {
+	if collection == "companies" {
+		return activeFilter
+	}
+	return activeFilter + " && companyID." + activeFilter
+}
+
+// withActiveFilter prepend the active filter to a collection rule
+func withActiveFilter(rule *string, filter string) *string {
+	// nil rule means superusers only, nothing to restrict
+	if rule == nil {
+		return nil
+	}
+	if *rule == "" {
+		filtered := filter
+		return &filtered
+	}
+	filtered := filter + " && (" + *rule + ")"
+	return &filtered
+}
+
+// withoutActiveFilter revert withActiveFilter
+func withoutActiveFilter(rule *string, filter string) *string {
+	if rule == nil {
+		return nil
+	}
+	if *rule == filter {
+		empty := ""
+		return &empty
+	}
+	prefix := filter + " && ("
+	if strings.HasPrefix(*rule, prefix) && strings.HasSuffix(*rule, ")") {
+		original := strings.TrimSuffix(strings.TrimPrefix(*rule, prefix), ")")
+		return &original
+	}
+	return rule
+}
+
+// bodyFieldLocked condition rejecting the requests setting the field
+func bodyFieldLocked(field string) string {
+	return "@request.body." + field + ":isset = false"
+}
+
+// withCondition append a condition to a collection rule
+func withCondition(rule *string, condition string) *string {
+	// nil rule means superusers only, nothing to restrict
+	if rule == nil {
+		return nil
+	}
+	if *rule == "" {
+		restricted := condition
+		return &restricted
+	}
+	restricted := "(" + *rule + ") && " + condition
+	return &restricted
+}
+
+// withoutCondition revert withCondition
+func withoutCondition(rule *string, condition string) *string {
+	if rule == nil {
+		return nil
+	}
+	if *rule == condition {
+		empty := ""
+		return &empty
+	}
+	suffix := ") && " + condition
+	if strings.HasPrefix(*rule, "(") && strings.HasSuffix(*rule, suffix) {
+		original := strings.TrimSuffix(strings.TrimPrefix(*rule, "("), suffix)
+		return &original
+	}
+	return rule
+}
@@ -1,6 +1,7 @@
 package pdfgeneratorservice
 
 import (
+	"context"
 	"hirevo/internal/handlers"
 	"strings"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/johnfercher/maroto/v2/pkg/consts/align"
 	"github.com/johnfercher/maroto/v2/pkg/consts/extension"
 	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
+	"github.com/johnfercher/maroto/v2/pkg/consts/orientation"
 	"github.com/johnfercher/maroto/v2/pkg/core"
 	"github.com/johnfercher/maroto/v2/pkg/props"
 )
@@ -24,24 +26,126 @@ type PDFData struct {
 	Header      string
 	Content     map[string]string
 	Footer      string
+	// Author and Subject of the document metadata, eg. the company and the invoice number
+	Author  string
+	Subject string
+	// Attachments embedded in the PDF/A-3 document
+	Attachments []Attachment
 }
 
-// GeneratePDFBytes   generate PDF and returns []byte.
-func GeneratePDFBytes(info PDFData) ([]byte, error) {
-	m, err := generatePDF(info)
+// TableColumn column of a table PDF, Width in grid units
+type TableColumn struct {
+	Title string
+	Width int
+}
+
+// TablePDFData represents a PDF laid out as a table, eg. the weekly roster
+type TablePDFData struct {
+	Title       string
+	HeaderImage []byte
+	Header      string
+	Columns     []TableColumn
+	// Rows one []string per row with a cell per column, a cell can hold several lines
+	Rows      [][]string
+	Footer    string
+	Landscape bool
+	// Author and Subject of the document metadata
+	Author  string
+	Subject string
+}
+
+// GeneratePDFBytes   generate a PDF/A-3 document and returns []byte.
+func GeneratePDFBytes(ctx context.Context, info PDFData) ([]byte, error) {
+	m, err := generatePDF(ctx, info)
+	if err != nil {
+		return nil, err
+	}
 	document, err := m.Generate()
 	if err != nil {
-		handlers.LogError(err, "Failed Maroto generate PDF")
+		handlers.LogError(ctx, err, "Failed Maroto generate PDF")
 		return nil, err
 	}
 
-	pdfBytes := document.GetBytes()
+	pdfBytes, err := archive(document.GetBytes(), archiveInfo{Title: info.Title, Author: info.Author, Subject: info.Subject, Attachments: info.Attachments})
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed convert PDF to PDF/A-3")
+		return nil, err
+	}
 	return pdfBytes, nil
 }
 
-func generatePDF(data PDFData) (core.Maroto, error) {
+// GenerateTablePDFBytes generate a table PDF/A-3 document and returns []byte.
+func GenerateTablePDFBytes(ctx context.Context, data TablePDFData) ([]byte, error) {
+	m, err := generateTablePDF(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	document, err := m.Generate()
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed Maroto generate table PDF")
+		return nil, err
+	}
+	pdfBytes, err := archive(document.GetBytes(), archiveInfo{Title: data.Title, Author: data.Author, Subject: data.Subject})
+	if err != nil {
+		handlers.LogError(ctx, err, "Failed convert table PDF to PDF/A-3")
+		return nil, err
+	}
+	return pdfBytes, nil
+}
+
+func generateTablePDF(ctx context.Context, data TablePDFData) (core.Maroto, error) {
+	gridSize := 0
+	for _, column := range data.Columns {
+		gridSize += column.Width
+	}
+
+	builder := config.NewBuilder().
+		WithCustomFonts(customFonts()).
+		WithDefaultFont(defaultFont()).
+		WithPageNumber(props.PageNumber{Family: fontFamily}).
+		WithMaxGridSize(gridSize).
+		WithLeftMargin(10).
+		WithTopMargin(15).
+		WithRightMargin(10)
+	if data.Landscape {
+		builder = builder.WithOrientation(orientation.Horizontal)
+	}
+
+	mrt := maroto.New(builder.Build())
+	m := maroto.NewMetricsDecorator(mrt)
+
+	if err := m.RegisterHeader(getPageHeader(data.HeaderImage, data.Header)); err != nil {
+		handlers.LogError(ctx, err, "Failed RegisterHeader generate table PDF")
+		return nil, err
+	}
+	if err := m.RegisterFooter(getPageFooter(data.Footer)); err != nil {
+		handlers.LogError(ctx, err, "Failed RegisterFooter generate table PDF")
+		return nil, err
+	}
+
+	// Title
+	m.AddRow(7,
+		text.NewCol(gridSize, data.Title, props.Text{
+			Top:   1.5,
+			Size:  9,
+			Left:  2,
+			Style: fontstyle.Bold,
+			Align: align.Left,
+			Color: &props.WhiteColor,
+		}),
+	).WithStyle(&props.Cell{BackgroundColor: getDarkGrayColor()})
+
+	m.AddRows(getTableHeader(data.Columns))
+	m.AddRows(getTableRows(data.Columns, data.Rows)...)
+
+	return m, nil
+}
+
+func generatePDF(ctx context.Context, data PDFData) (core.Maroto, error) {
 	cfg := config.NewBuilder().
-		WithPageNumber().
+		WithCustomFonts(customFonts()).
+		WithDefaultFont(defaultFont()).
+		WithPageNumber(props.PageNumber{Family: fontFamily}).
 		WithLeftMargin(10).
 		WithTopMargin(15).
 		WithRightMargin(10).
@@ -51,11 +155,11 @@ func generatePDF(data PDFData) (core.Maroto, error) {
 	m := maroto.NewMetricsDecorator(mrt)
 
 	if err := m.RegisterHeader(getPageHeader(data.HeaderImage, data.Header)); err != nil {
-		handlers.LogError(err, "Failed RegisterHeader generate PDF")
+		handlers.LogError(ctx, err, "Failed RegisterHeader generate PDF")
 		return nil, err
 	}
 	if err := m.RegisterFooter(getPageFooter(data.Footer)); err != nil {
-		handlers.LogError(err, "Failed RegisterFooter generate PDF")
+		handlers.LogError(ctx, err, "Failed RegisterFooter generate PDF")
 		return nil, err
 	}
 
@@ -136,6 +240,54 @@ func getPageContent(values map[string]string) []core.Row {
 	return rows
 }
 
+func getTableHeader(columns []TableColumn) core.Row {
+	r := row.New(6)
+	for _, column := range columns {
+		r.Add(text.NewCol(column.Width, column.Title, props.Text{
+			Top:   1.5,
+			Size:  7,
+			Left:  1,
+			Style: fontstyle.Bold,
+			Align: align.Left,
+		}))
+	}
+	return r.WithStyle(&props.Cell{BackgroundColor: getLightGrayColor()})
+}
+
+func getTableRows(columns []TableColumn, values [][]string) []core.Row {
+	var rows []core.Row
+	for i, cells := range values {
+		// the row grows with the cell holding the most lines
+		lines := 1
+		for _, cell := range cells {
+			lines = max(lines, strings.Count(cell, "\n")+1)
+		}
+
+		r := row.New(float64(lines)*3.5 + 2)
+		for j, column := range columns {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			cellCol := col.New(column.Width)
+			for k, line := range strings.Split(cell, "\n") {
+				cellCol.Add(text.New(line, props.Text{
+					Top:   1 + float64(k)*3.5,
+					Size:  7,
+					Left:  1,
+					Align: align.Left,
+				}))
+			}
+			r.Add(cellCol)
+		}
+		if i%2 == 1 {
+			r.WithStyle(&props.Cell{BackgroundColor: getLightGrayColor()})
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
 func getPageFooter(content string) core.Row {
 	return row.New(40).Add(
 		col.New(6).Add(
@@ -170,3 +322,11 @@ func getDarkGrayColor() *props.Color {
 		Blue:  55,
 	}
 }
+
+func getLightGrayColor() *props.Color {
+	return &props.Color{
+		Red:   235,
+		Green: 235,
+		Blue:  235,
+	}
+}
@@ -0,0 +1,398 @@
+package pdfgeneratorservice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
+	"github.com/johnfercher/maroto/v2/pkg/core/entity"
+	"github.com/johnfercher/maroto/v2/pkg/props"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fontFamily TrueType fonts embedded in the documents, PDF/A does not allow the standard fonts of the readers
+const fontFamily = "go"
+
+// creator application generating the documents, in their information and XMP metadata
+const creator = "Hirevo"
+
+// XMP packet wrapper, the packet is writable so it can be rewritten in place within its padding
+const (
+	xmpHeader  = "<?xpacket begin=\"\uFEFF\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n"
+	xmpTrailer = "<?xpacket end=\"w\"?>"
+	// xmpPadding whitespace reserved at the end of the packet for the values stamped after writing
+	xmpPadding = 512
+	// xmpDate date format of the XMP metadata, to the second like the PDF dates
+	xmpDate = "2006-01-02T15:04:05-07:00"
+)
+
+// Relationships of the attachments to the document, PDF/A-3 associated files
+const (
+	RelationshipSource      = "Source"
+	RelationshipData        = "Data"
+	RelationshipAlternative = "Alternative"
+	RelationshipSupplement  = "Supplement"
+)
+
+// Attachment file embedded in the PDF, eg. the machine-readable data of an invoice
+type Attachment struct {
+	Name        string
+	MimeType    string
+	Description string
+	// Relationship of the file to the document, RelationshipData by default
+	Relationship string
+	Content      []byte
+}
+
+// archiveInfo metadata of the archived document
+type archiveInfo struct {
+	Title       string
+	Author      string
+	Subject     string
+	Attachments []Attachment
+}
+
+// customFonts the Go fonts in the styles the documents use
+func customFonts() []*entity.CustomFont {
+	return []*entity.CustomFont{
+		{Family: fontFamily, Style: fontstyle.Normal, Bytes: goregular.TTF},
+		{Family: fontFamily, Style: fontstyle.Bold, Bytes: gobold.TTF},
+		{Family: fontFamily, Style: fontstyle.Italic, Bytes: goitalic.TTF},
+		{Family: fontFamily, Style: fontstyle.BoldItalic, Bytes: gobolditalic.TTF},
+	}
+}
+
+// defaultFont font of the texts without family, the page numbers included
+func defaultFont() *props.Font {
+	return &props.Font{Family: fontFamily}
+}
+
+// archive convert a generated PDF to PDF/A-3B: information and XMP metadata, sRGB output intent
+// and the attachments embedded as associated files of the document
+func archive(pdf []byte, info archiveInfo) ([]byte, error) {
+	api.DisableConfigDir()
+	pdfCtx, err := api.ReadContext(bytes.NewReader(pdf), model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, err
+	}
+	xRefTable := pdfCtx.XRefTable
+	catalog, err := xRefTable.Catalog()
+	if err != nil {
+		return nil, err
+	}
+
+	intent, err := outputIntent(xRefTable)
+	if err != nil {
+		return nil, err
+	}
+	catalog["OutputIntents"] = types.Array{intent}
+
+	if len(info.Attachments) > 0 {
+		files, err := embedAttachments(pdfCtx, info.Attachments)
+		if err != nil {
+			return nil, err
+		}
+		catalog["AF"] = files
+	}
+
+	infoDict := types.NewDict()
+	if pdfCtx.Info != nil {
+		if infoDict, err = xRefTable.DereferenceDict(*pdfCtx.Info); err != nil {
+			return nil, err
+		}
+	} else {
+		if pdfCtx.Info, err = xRefTable.IndRefForNewObject(infoDict); err != nil {
+			return nil, err
+		}
+	}
+	// the creation date of the generator is kept, the document is created when it is drawn
+	created := time.Now()
+	if value, err := xRefTable.DereferenceStringOrHexLiteral(infoDict["CreationDate"], model.V10, nil); err == nil {
+		if date, ok := types.DateTime(value, true); ok {
+			created = date
+		}
+	}
+	for key, value := range map[string]string{"Title": info.Title, "Author": info.Author, "Subject": info.Subject, "Creator": creator} {
+		delete(infoDict, key)
+		if value == "" {
+			continue
+		}
+		escaped, err := types.EscapeUTF16String(value)
+		if err != nil {
+			return nil, err
+		}
+		infoDict.InsertString(key, *escaped)
+	}
+
+	packet, err := padXMP(xmpMetadata(info, "pdfcpu "+model.VersionStr, created, created), 0)
+	if err != nil {
+		return nil, err
+	}
+	metadata := types.StreamDict{Dict: types.NewDict(), Content: packet}
+	metadata.InsertName("Type", "Metadata")
+	metadata.InsertName("Subtype", "XML")
+	if err := metadata.Encode(); err != nil {
+		return nil, err
+	}
+	metadataRef, err := xRefTable.IndRefForNewObject(metadata)
+	if err != nil {
+		return nil, err
+	}
+	catalog["Metadata"] = *metadataRef
+
+	out := bytes.Buffer{}
+	if err := api.WriteContext(pdfCtx, &out); err != nil {
+		return nil, err
+	}
+	pdf = out.Bytes()
+	if err := stampDates(pdf, infoDict, info, created); err != nil {
+		return nil, err
+	}
+	return pdf, nil
+}
+
+// stampDates pdfcpu stamps the information dictionary with its producer and the time of the writing,
+// rewrite in place its creation date with the one of the generator and the XMP packet with the values
+// of the dictionary, PDF/A requires both to be the same
+func stampDates(pdf []byte, infoDict types.Dict, info archiveInfo, created time.Time) error {
+	written, _ := infoDict["CreationDate"].(types.StringLiteral)
+	modDate, _ := infoDict["ModDate"].(types.StringLiteral)
+	producer, _ := infoDict["Producer"].(types.StringLiteral)
+	modified, ok := types.DateTime(modDate.Value(), false)
+	if !ok {
+		return fmt.Errorf("invalid modification date %q in the information dictionary", modDate.Value())
+	}
+
+	from := []byte("/CreationDate(" + written.Value() + ")")
+	to := []byte("/CreationDate(" + types.DateString(created) + ")")
+	index := bytes.Index(pdf, from)
+	if index < 0 || len(from) != len(to) {
+		return fmt.Errorf("creation date %q not found in the information dictionary", written.Value())
+	}
+	copy(pdf[index:], to)
+
+	start := bytes.Index(pdf, []byte(xmpHeader))
+	end := bytes.Index(pdf[max(start, 0):], []byte(xmpTrailer))
+	if start < 0 || end < 0 {
+		return errors.New("XMP packet not found")
+	}
+	packet, err := padXMP(xmpMetadata(info, producer.Value(), created, modified), end+len(xmpTrailer))
+	if err != nil {
+		return err
+	}
+	copy(pdf[start:], packet)
+	return nil
+}
+
+// embedAttachments embedded files of the attachments, listed in the names of the document
+func embedAttachments(pdfCtx *model.Context, attachments []Attachment) (types.Array, error) {
+	xRefTable := pdfCtx.XRefTable
+	if err := xRefTable.LocateNameTree("EmbeddedFiles", true); err != nil {
+		return nil, err
+	}
+	files := types.Array{}
+	for _, attachment := range attachments {
+		streamRef, err := xRefTable.NewEmbeddedStreamDict(bytes.NewReader(attachment.Content), time.Now())
+		if err != nil {
+			return nil, err
+		}
+		stream, _, err := xRefTable.DereferenceStreamDict(*streamRef)
+		if err != nil {
+			return nil, err
+		}
+		// the MIME type is a PDF name, its solidus escaped
+		stream.Dict["Subtype"] = types.Name(strings.ReplaceAll(attachment.MimeType, "/", "#2F"))
+
+		spec, err := xRefTable.NewFileSpecDict(attachment.Name, attachment.Name, attachment.Description, *streamRef)
+		if err != nil {
+			return nil, err
+		}
+		relationship := attachment.Relationship
+		if relationship == "" {
+			relationship = RelationshipData
+		}
+		spec.InsertName("AFRelationship", relationship)
+		delete(spec, "CI")
+		specRef, err := xRefTable.IndRefForNewObject(spec)
+		if err != nil {
+			return nil, err
+		}
+		names := model.NameMap{attachment.Name: []types.Dict{spec}}
+		if err := xRefTable.Names["EmbeddedFiles"].Add(xRefTable, attachment.Name, *specRef, names, []string{"F", "UF"}); err != nil {
+			return nil, err
+		}
+		files = append(files, *specRef)
+	}
+	return files, nil
+}
+
+// outputIntent PDF/A output intent of the sRGB colour space the documents are drawn in
+func outputIntent(xRefTable *model.XRefTable) (types.Dict, error) {
+	profile, err := xRefTable.NewStreamDictForBuf(srgbProfile())
+	if err != nil {
+		return nil, err
+	}
+	profile.InsertInt("N", 3)
+	if err := profile.Encode(); err != nil {
+		return nil, err
+	}
+	profileRef, err := xRefTable.IndRefForNewObject(*profile)
+	if err != nil {
+		return nil, err
+	}
+	intent := types.NewDict()
+	intent.InsertName("Type", "OutputIntent")
+	intent.InsertName("S", "GTS_PDFA1")
+	intent.InsertString("OutputConditionIdentifier", "sRGB IEC61966-2.1")
+	intent.InsertString("RegistryName", "http://www.color.org")
+	intent.InsertString("Info", "sRGB IEC61966-2.1")
+	intent.Insert("DestOutputProfile", *profileRef)
+	return intent, nil
+}
+
+// xmpMetadata XMP packet identifying the document as PDF/A-3B, with the values of its information dictionary,
+// without its padding and trailer
+func xmpMetadata(info archiveInfo, producer string, created time.Time, modified time.Time) []byte {
+	text := func(value string) string {
+		escaped := bytes.Buffer{}
+		_ = xml.EscapeText(&escaped, []byte(value))
+		return escaped.String()
+	}
+
+	packet := bytes.Buffer{}
+	packet.WriteString(xmpHeader)
+	packet.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	packet.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	packet.WriteString(`<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">`)
+	packet.WriteString(`<pdfaid:part>3</pdfaid:part><pdfaid:conformance>B</pdfaid:conformance></rdf:Description>` + "\n")
+	packet.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:format>application/pdf</dc:format>`)
+	if info.Title != "" {
+		packet.WriteString(`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + text(info.Title) + `</rdf:li></rdf:Alt></dc:title>`)
+	}
+	if info.Author != "" {
+		packet.WriteString(`<dc:creator><rdf:Seq><rdf:li>` + text(info.Author) + `</rdf:li></rdf:Seq></dc:creator>`)
+	}
+	if info.Subject != "" {
+		packet.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + text(info.Subject) + `</rdf:li></rdf:Alt></dc:description>`)
+	}
+	packet.WriteString(`</rdf:Description>` + "\n")
+	packet.WriteString(`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">`)
+	packet.WriteString(`<xmp:CreatorTool>` + creator + `</xmp:CreatorTool>`)
+	packet.WriteString(`<xmp:CreateDate>` + created.Format(xmpDate) + `</xmp:CreateDate>`)
+	packet.WriteString(`<xmp:ModifyDate>` + modified.Format(xmpDate) + `</xmp:ModifyDate><xmp:MetadataDate>` + modified.Format(xmpDate) + `</xmp:MetadataDate>`)
+	packet.WriteString(`</rdf:Description>` + "\n")
+	packet.WriteString(`<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/"><pdf:Producer>` + text(producer) + `</pdf:Producer></rdf:Description>` + "\n")
+	packet.WriteString("</rdf:RDF>\n</x:xmpmeta>\n")
+	return packet.Bytes()
+}
+
+// padXMP close the packet with whitespace padding up to the size, the reserved padding when the size is 0
+func padXMP(packet []byte, size int) ([]byte, error) {
+	if size == 0 {
+		size = len(packet) + xmpPadding + len(xmpTrailer)
+	}
+	padding := size - len(packet) - len(xmpTrailer)
+	if padding < 0 {
+		return nil, errors.New("XMP packet larger than its reserved space")
+	}
+	padded := append(packet, bytes.Repeat([]byte(" "), padding)...)
+	// lines of at most 100 characters as the XMP specification recommends
+	for i := len(packet) + 99; i < len(padded); i += 100 {
+		padded[i] = '\n'
+	}
+	return append(padded, xmpTrailer...), nil
+}
+
+// srgbProfile ICC v2 display profile of the sRGB colour space: D50 adapted primaries and the sRGB tone curve
+func srgbProfile() []byte {
+	s15Fixed16 := func(values ...float64) []byte {
+		data := make([]byte, 0, 4*len(values))
+		for _, value := range values {
+			data = binary.BigEndian.AppendUint32(data, uint32(int32(math.Round(value*65536))))
+		}
+		return data
+	}
+	xyz := func(x, y, z float64) []byte {
+		return append([]byte("XYZ \x00\x00\x00\x00"), s15Fixed16(x, y, z)...)
+	}
+	curve := []byte("curv\x00\x00\x00\x00")
+	curve = binary.BigEndian.AppendUint32(curve, 1024)
+	for i := 0; i < 1024; i++ {
+		value := float64(i) / 1023
+		if value <= 0.04045 {
+			value /= 12.92
+		} else {
+			value = math.Pow((value+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(value*65535)))
+	}
+	description := []byte("desc\x00\x00\x00\x00")
+	description = binary.BigEndian.AppendUint32(description, uint32(len("sRGB IEC61966-2.1")+1))
+	description = append(description, "sRGB IEC61966-2.1\x00"...)
+	description = append(description, make([]byte, 4+4+2+1+67)...)
+	copyright := []byte("text\x00\x00\x00\x00No copyright, use freely\x00")
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", description},
+		{"cprt", copyright},
+		{"wtpt", xyz(0.9642, 1, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	data := []byte{}
+	offset := 128 + 4 + 12*len(tags)
+	offsets := map[string]int{}
+	for _, tag := range tags {
+		key := string(tag.data)
+		start, shared := offsets[key]
+		if !shared {
+			start = offset + len(data)
+			offsets[key] = start
+			data = append(data, tag.data...)
+			for len(data)%4 != 0 {
+				data = append(data, 0)
+			}
+		}
+		table = append(table, tag.signature...)
+		table = binary.BigEndian.AppendUint32(table, uint32(start))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+	}
+
+	header := make([]byte, 0, 128)
+	header = binary.BigEndian.AppendUint32(header, uint32(offset+len(data)))
+	header = append(header, 0, 0, 0, 0)
+	header = append(header, 0x02, 0x10, 0, 0)
+	header = append(header, "mntrRGB XYZ "...)
+	for _, value := range []uint16{2026, 1, 1, 0, 0, 0} {
+		header = binary.BigEndian.AppendUint16(header, value)
+	}
+	header = append(header, "acsp"...)
+	header = append(header, make([]byte, 64-len(header))...)
+	header = binary.BigEndian.AppendUint32(header, 0)
+	header = append(header, s15Fixed16(0.9642, 1, 0.8249)...)
+	header = append(header, make([]byte, 128-len(header))...)
+
+	profile := append(header, table...)
+	return append(profile, data...)
+}
@@ -0,0 +1,232 @@
+package pdfgeneratorservice
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// testData invoice data embedded in the documents of the tests
+const testData = `{"number":"INV-0001","issueDate":"2026-10-18"}`
+
+// readCatalog parse the document with pdfcpu and return its context and catalog
+func readCatalog(t *testing.T, pdf []byte) (*model.Context, types.Dict) {
+	t.Helper()
+	api.DisableConfigDir()
+	pdfCtx, err := api.ReadContext(bytes.NewReader(pdf), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("read PDF: %v", err)
+	}
+	catalog, err := pdfCtx.XRefTable.Catalog()
+	if err != nil {
+		t.Fatalf("catalog: %v", err)
+	}
+	return pdfCtx, catalog
+}
+
+// infoEntry string entry of the information dictionary of the document
+func infoEntry(t *testing.T, pdfCtx *model.Context, key string) string {
+	t.Helper()
+	if pdfCtx.Info == nil {
+		t.Fatal("document has no information dictionary")
+	}
+	info, err := pdfCtx.XRefTable.DereferenceDict(*pdfCtx.Info)
+	if err != nil {
+		t.Fatalf("information dictionary: %v", err)
+	}
+	value, err := pdfCtx.XRefTable.DereferenceStringOrHexLiteral(info[key], model.V10, nil)
+	if err != nil {
+		t.Fatalf("information dictionary %s: %v", key, err)
+	}
+	return value
+}
+
+// xmpPacket decoded XMP metadata of the document
+func xmpPacket(t *testing.T, pdfCtx *model.Context, catalog types.Dict) string {
+	t.Helper()
+	metadataRef := catalog.IndirectRefEntry("Metadata")
+	if metadataRef == nil {
+		t.Fatal("catalog has no Metadata")
+	}
+	metadata, _, err := pdfCtx.XRefTable.DereferenceStreamDict(*metadataRef)
+	if err != nil || metadata == nil {
+		t.Fatalf("Metadata: %v", err)
+	}
+	if got := metadata.Subtype(); got == nil || *got != "XML" {
+		t.Errorf("Metadata Subtype = %v, want XML", got)
+	}
+	if err := metadata.Decode(); err != nil {
+		t.Fatalf("decode Metadata: %v", err)
+	}
+	return string(metadata.Content)
+}
+
+// checkInfoMatchesXMP the dates and producer of the information dictionary are the ones of the XMP
+// metadata, as PDF/A requires
+func checkInfoMatchesXMP(t *testing.T, pdfCtx *model.Context, xmp string) {
+	t.Helper()
+	for key, element := range map[string]string{"CreationDate": "xmp:CreateDate", "ModDate": "xmp:ModifyDate"} {
+		value := infoEntry(t, pdfCtx, key)
+		date, ok := types.DateTime(value, false)
+		if !ok {
+			t.Fatalf("information dictionary %s = %q, want a date", key, value)
+		}
+		if want := "<" + element + ">" + date.Format(xmpDate) + "</" + element + ">"; !strings.Contains(xmp, want) {
+			t.Errorf("Metadata does not contain %q of the %s %s", want, key, value)
+		}
+	}
+	if want := "<pdf:Producer>" + infoEntry(t, pdfCtx, "Producer") + "</pdf:Producer>"; !strings.Contains(xmp, want) {
+		t.Errorf("Metadata does not contain %q", want)
+	}
+}
+
+func TestGeneratePDFArchive(t *testing.T) {
+	pdf, err := GeneratePDFBytes(context.Background(), PDFData{
+		Title:   "Invoice INV-0001",
+		Header:  "Acme",
+		Content: map[string]string{"Total": "AUD 110.00"},
+		Author:  "Acme",
+		Subject: "INV-0001",
+		Attachments: []Attachment{{
+			Name:         "invoice.json",
+			MimeType:     "application/json",
+			Description:  "Invoice INV-0001 data",
+			Relationship: RelationshipData,
+			Content:      []byte(testData),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("generate PDF: %v", err)
+	}
+	pdfCtx, catalog := readCatalog(t, pdf)
+	xRefTable := pdfCtx.XRefTable
+
+	intents, err := xRefTable.DereferenceArray(catalog["OutputIntents"])
+	if err != nil || len(intents) != 1 {
+		t.Fatalf("OutputIntents = %v, %v, want one intent", catalog["OutputIntents"], err)
+	}
+	intent, err := xRefTable.DereferenceDict(intents[0])
+	if err != nil {
+		t.Fatalf("output intent: %v", err)
+	}
+	if got := intent.NameEntry("S"); got == nil || *got != "GTS_PDFA1" {
+		t.Errorf("output intent S = %v, want GTS_PDFA1", got)
+	}
+	profileRef := intent.IndirectRefEntry("DestOutputProfile")
+	if profileRef == nil {
+		t.Fatal("output intent has no DestOutputProfile")
+	}
+	profile, _, err := xRefTable.DereferenceStreamDict(*profileRef)
+	if err != nil || profile == nil {
+		t.Fatalf("DestOutputProfile: %v", err)
+	}
+	if got := profile.IntEntry("N"); got == nil || *got != 3 {
+		t.Errorf("DestOutputProfile N = %v, want 3", got)
+	}
+
+	xmp := xmpPacket(t, pdfCtx, catalog)
+	checkInfoMatchesXMP(t, pdfCtx, xmp)
+	for _, want := range []string{
+		"<pdfaid:part>3</pdfaid:part>",
+		"<pdfaid:conformance>B</pdfaid:conformance>",
+		"Invoice INV-0001",
+	} {
+		if !strings.Contains(xmp, want) {
+			t.Errorf("Metadata does not contain %q", want)
+		}
+	}
+
+	files, err := xRefTable.DereferenceArray(catalog["AF"])
+	if err != nil || len(files) != 1 {
+		t.Fatalf("AF = %v, %v, want one file", catalog["AF"], err)
+	}
+	spec, err := xRefTable.DereferenceDict(files[0])
+	if err != nil {
+		t.Fatalf("file spec: %v", err)
+	}
+	if got := spec.NameEntry("AFRelationship"); got == nil || *got != RelationshipData {
+		t.Errorf("AFRelationship = %v, want %s", got, RelationshipData)
+	}
+	for _, key := range []string{"F", "UF"} {
+		value, err := xRefTable.DereferenceStringOrHexLiteral(spec[key], model.V10, nil)
+		if err != nil || value != "invoice.json" {
+			t.Errorf("file spec %s = %q, %v, want invoice.json", key, value, err)
+		}
+	}
+	ef := spec.DictEntry("EF")
+	if ef == nil || ef.IndirectRefEntry("F") == nil {
+		t.Fatal("file spec has no embedded file")
+	}
+	stream, _, err := xRefTable.DereferenceStreamDict(*ef.IndirectRefEntry("F"))
+	if err != nil || stream == nil {
+		t.Fatalf("embedded file: %v", err)
+	}
+	// the escaped solidus of the name is decoded when parsed
+	if got := stream.Subtype(); got == nil || *got != "application/json" {
+		t.Errorf("embedded file Subtype = %v, want application/json", got)
+	}
+
+	attachments, err := api.ExtractAttachmentsRaw(bytes.NewReader(pdf), "", nil, model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatalf("extract attachments: %v", err)
+	}
+	if len(attachments) != 1 || attachments[0].FileName != "invoice.json" {
+		t.Fatalf("EmbeddedFiles = %v, want invoice.json", attachments)
+	}
+	content, err := io.ReadAll(attachments[0])
+	if err != nil {
+		t.Fatalf("read attachment: %v", err)
+	}
+	if string(content) != testData {
+		t.Errorf("attachment content = %q, want %q", content, testData)
+	}
+}
+
+func TestGeneratePDFWithoutAttachments(t *testing.T) {
+	pdf, err := GeneratePDFBytes(context.Background(), PDFData{Title: "Payslip", Content: map[string]string{"Net": "AUD 1,000.00"}})
+	if err != nil {
+		t.Fatalf("generate PDF: %v", err)
+	}
+	_, catalog := readCatalog(t, pdf)
+	if _, ok := catalog["AF"]; ok {
+		t.Error("catalog has AF without attachments")
+	}
+	if catalog["OutputIntents"] == nil || catalog["Metadata"] == nil {
+		t.Error("document without attachments is not PDF/A")
+	}
+}
+
+func TestArchiveKeepsCreationDate(t *testing.T) {
+	pdf, err := GeneratePDFBytes(context.Background(), PDFData{Title: "Payslip", Content: map[string]string{"Net": "AUD 1,000.00"}})
+	if err != nil {
+		t.Fatalf("generate PDF: %v", err)
+	}
+	// the document was drawn long before it is archived
+	pdfCtx, _ := readCatalog(t, pdf)
+	generated := infoEntry(t, pdfCtx, "CreationDate")
+	created := "D:20260102030405+10'00'"
+	if len(created) != len(generated) {
+		t.Fatalf("creation date %q, want the length of %q", generated, created)
+	}
+	pdf = bytes.Replace(pdf, []byte("/CreationDate("+generated+")"), []byte("/CreationDate("+created+")"), 1)
+
+	archived, err := archive(pdf, archiveInfo{Title: "Payslip"})
+	if err != nil {
+		t.Fatalf("archive: %v", err)
+	}
+	pdfCtx, catalog := readCatalog(t, archived)
+	if got := infoEntry(t, pdfCtx, "CreationDate"); got != created {
+		t.Errorf("CreationDate = %q, want the generator's %q", got, created)
+	}
+	xmp := xmpPacket(t, pdfCtx, catalog)
+	if want := "<xmp:CreateDate>2026-01-02T03:04:05+10:00</xmp:CreateDate>"; !strings.Contains(xmp, want) {
+		t.Errorf("Metadata does not contain %q", want)
+	}
+	checkInfoMatchesXMP(t, pdfCtx, xmp)
+}